@@ -802,6 +802,43 @@ func main() {
 				},
 			},
 		},
+		{
+			Name:    "infer",
+			Aliases: []string{"infer"},
+			Usage:   "infer stream $stream_name [$infer_json | -f infer_def_file] | infer table $table_name [$infer_json | -f infer_def_file]",
+			Subcommands: []cli.Command{
+				{
+					Name:  "stream",
+					Usage: "infer stream $stream_name [$infer_json | -f infer_def_file]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "the location of infer definition file",
+							FilePath: "/home/myinfer.txt",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						inferSchema(client, c, "stream")
+						return nil
+					},
+				},
+				{
+					Name:  "table",
+					Usage: "infer table $table_name [$infer_json | -f infer_def_file]",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:     "file, f",
+							Usage:    "the location of infer definition file",
+							FilePath: "/home/myinfer.txt",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						inferSchema(client, c, "table")
+						return nil
+					},
+				},
+			},
+		},
 		{
 			Name:    "register",
 			Aliases: []string{"register"},
@@ -885,6 +922,40 @@ func main() {
 	}
 }
 
+func inferSchema(client *rpc.Client, c *cli.Context, t string) {
+	if len(c.Args()) < 1 {
+		fmt.Printf("Expect %s name.\n", t)
+		return
+	}
+	args := &server.InferDesc{
+		RPCArgDesc: server.RPCArgDesc{
+			Name: c.Args()[0],
+		},
+		StreamType: t,
+	}
+	sfile := c.String("file")
+	if sfile != "" {
+		d, err := ioutil.ReadFile(sfile)
+		if err != nil {
+			fmt.Printf("Failed to read from infer definition file %s.\n", sfile)
+			return
+		}
+		args.Json = string(d)
+	} else if len(c.Args()) == 2 {
+		args.Json = c.Args()[1]
+	} else if len(c.Args()) > 2 {
+		fmt.Printf("Expect %s name and infer json.\nBut found %d args:%s.\n", t, len(c.Args()), c.Args())
+		return
+	}
+	var reply string
+	err := client.Call("Server.InferSchema", args, &reply)
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(reply)
+	}
+}
+
 func getPluginType(arg string) (ptype int, err error) {
 	switch arg {
 	case "source":
@@ -60,6 +60,11 @@ func (m *imageSink) Configure(props map[string]interface{}) error {
 	return nil
 }
 
+// SupportFormat returns true for the image formats so that the sink node does not encode the data
+func (m *imageSink) SupportFormat(format string) bool {
+	return format == "png" || format == "jpeg"
+}
+
 func (m *imageSink) Open(ctx api.StreamContext) error {
 	logger := ctx.GetLogger()
 	logger.Debug("Opening image sink")
@@ -0,0 +1,101 @@
+// Package converter registers the builtin formats other than json and binary to the converter registry of the
+// message package, so that they can be used by the format property of the sinks and the format of the sources.
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"sort"
+	"strconv"
+)
+
+const (
+	FormatCsv      = "csv"
+	FormatMsgpack  = "msgpack"
+	FormatProtobuf = "protobuf"
+	FormatInflux   = "influx"
+)
+
+func init() {
+	message.RegisterConverter(FormatCsv, newCsvConverter)
+	message.RegisterConverter(FormatMsgpack, newMsgpackConverter)
+	message.RegisterConverter(FormatProtobuf, newProtobufConverter)
+	message.RegisterEncoder(FormatInflux, newInfluxConverter)
+}
+
+// toRows converts the result to rows. The result is a map or a slice of maps
+func toRows(d interface{}) ([]map[string]interface{}, error) {
+	switch t := d.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{t}, nil
+	case []map[string]interface{}:
+		return t, nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, len(t))
+		for i, r := range t {
+			m, ok := r.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("expect map but found %v", r)
+			}
+			rows[i] = m
+		}
+		return rows, nil
+	default:
+		return nil, fmt.Errorf("expect map or array of map but found %v", d)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// toText formats the value as text. The float is not formatted in the exponent form, and the map or array is
+// formatted as json.
+func toText(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	case map[string]interface{}, []interface{}, []map[string]interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	default:
+		return cast.ToStringAlways(t)
+	}
+}
+
+func getStringSlice(props map[string]interface{}, key string) ([]string, error) {
+	c, ok := props[key]
+	if !ok {
+		return nil, nil
+	}
+	r, err := cast.ToStringSlice(c, cast.STRICT)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s property %v, should be a string array", key, c)
+	}
+	return r, nil
+}
+
+func getString(props map[string]interface{}, key string) (string, error) {
+	c, ok := props[key]
+	if !ok {
+		return "", nil
+	}
+	r, ok := c.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s property %v, should be a string", key, c)
+	}
+	return r, nil
+}
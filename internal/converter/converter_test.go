@@ -0,0 +1,145 @@
+package converter
+
+import (
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConverter_Encode(t *testing.T) {
+	var tests = []struct {
+		format string
+		props  map[string]interface{}
+		data   interface{}
+		result string
+		err    string
+	}{
+		{
+			format: FormatCsv,
+			data:   []map[string]interface{}{{"b": "hello", "a": 1.5}, {"a": int64(2), "b": "a,b"}},
+			result: "1.5,hello\n2,\"a,b\"",
+		}, {
+			format: FormatCsv,
+			props:  map[string]interface{}{"fields": []interface{}{"b", "a"}, "delimiter": ";", "hasHeader": true},
+			data:   map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": 1}},
+			result: "b;a\n\"{\"\"c\"\":1}\";1",
+		}, {
+			format: FormatInflux,
+			props:  map[string]interface{}{"measurement": "cpu load", "tags": []interface{}{"host"}, "timestampField": "ts"},
+			data:   []map[string]interface{}{{"host": "s 1", "usage": 0.5, "count": int64(3), "ok": true, "msg": `a "b"`, "ts": int64(1000)}},
+			result: `cpu\ load,host=s\ 1 count=3i,msg="a \"b\"",ok=true,usage=0.5 1000000000`,
+		}, {
+			format: FormatInflux,
+			props:  map[string]interface{}{"measurement": "cpu", "tags": []interface{}{"host"}},
+			data:   map[string]interface{}{"host": "s1"},
+			err:    "influx format requires at least one field but found map[host:s1]",
+		}, {
+			format: FormatInflux,
+			err:    "influx format requires the measurement property",
+		}, {
+			format: FormatProtobuf,
+			props:  map[string]interface{}{"schemaFile": "demo.proto"},
+			err:    "protobuf format requires the schemaFile and schemaMessage properties",
+		}, {
+			format: "xml",
+			err:    "invalid format xml",
+		},
+	}
+	for i, tt := range tests {
+		c, err := message.GetConverter(tt.format, tt.props)
+		if err != nil {
+			if err.Error() != tt.err {
+				t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%v", i, tt.err, err)
+			}
+			continue
+		}
+		result, err := c.Encode(tt.data)
+		if err != nil {
+			if err.Error() != tt.err {
+				t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%v", i, tt.err, err)
+			}
+			continue
+		}
+		if tt.err != "" {
+			t.Errorf("%d: expect error %s but got %s", i, tt.err, result)
+		} else if string(result) != tt.result {
+			t.Errorf("%d: result mismatch:\n  exp=%s\n  got=%s", i, tt.result, result)
+		}
+	}
+}
+
+func TestConverter_Decode(t *testing.T) {
+	schema, err := filepath.Abs(filepath.Join("test", "demo.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		format string
+		props  map[string]interface{}
+		data   interface{}
+		result map[string]interface{}
+	}{
+		{
+			format: FormatCsv,
+			props:  map[string]interface{}{"fields": []interface{}{"a", "b"}},
+			data:   map[string]interface{}{"a": "1", "b": "hello"},
+			result: map[string]interface{}{"a": "1", "b": "hello"},
+		}, {
+			format: FormatCsv,
+			props:  map[string]interface{}{"hasHeader": true},
+			data:   map[string]interface{}{"a": "1", "b": "hello"},
+			result: map[string]interface{}{"a": "1", "b": "hello"},
+		}, {
+			format: FormatMsgpack,
+			data:   map[string]interface{}{"a": int64(1), "b": "hello", "c": map[string]interface{}{"d": 1.5}},
+			result: map[string]interface{}{"a": int64(1), "b": "hello", "c": map[string]interface{}{"d": 1.5}},
+		}, {
+			format: FormatProtobuf,
+			props:  map[string]interface{}{"schemaFile": schema, "schemaMessage": "Reading"},
+			data:   []map[string]interface{}{{"device_id": "d1", "temperature": int64(30), "humidity": 50.5, "alarm": true, "other": 1}},
+			result: map[string]interface{}{"device_id": "d1", "temperature": "30", "humidity": 50.5, "alarm": true},
+		},
+	}
+	for i, tt := range tests {
+		c, err := message.GetConverter(tt.format, tt.props)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		b, err := c.Encode(tt.data)
+		if err != nil {
+			t.Errorf("%d: encode error %v", i, err)
+			continue
+		}
+		result, err := c.Decode(b)
+		if err != nil {
+			t.Errorf("%d: decode error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d: result mismatch:\n  exp=%v\n  got=%v", i, tt.result, result)
+		}
+	}
+}
+
+func TestIsDecodeSupported(t *testing.T) {
+	var tests = []struct {
+		format string
+		result bool
+	}{
+		{format: "JSON", result: true},
+		{format: FormatCsv, result: true},
+		{format: FormatProtobuf, result: true},
+		{format: FormatInflux, result: false},
+		{format: "unknown", result: false},
+	}
+	for i, tt := range tests {
+		if r := message.IsDecodeSupported(tt.format); r != tt.result {
+			t.Errorf("%d: %s decode supported mismatch, exp %v but got %v", i, tt.format, tt.result, r)
+		}
+	}
+	if !message.IsFormatSupported(FormatInflux) {
+		t.Errorf("influx format should be supported by the sinks")
+	}
+}
@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"github.com/lf-edge/ekuiper/pkg/message"
+)
+
+// csvConverter encodes each row as a line of the fields. The sorted fields of the first row are used if the fields
+// property is not set.
+type csvConverter struct {
+	delimiter rune
+	fields    []string
+	hasHeader bool
+}
+
+func newCsvConverter(props map[string]interface{}) (message.Converter, error) {
+	c := &csvConverter{delimiter: ','}
+	d, err := getString(props, "delimiter")
+	if err != nil {
+		return nil, err
+	}
+	if d != "" {
+		if len([]rune(d)) != 1 {
+			return nil, fmt.Errorf("invalid delimiter %s, must be a single character", d)
+		}
+		c.delimiter = []rune(d)[0]
+	}
+	if c.fields, err = getStringSlice(props, "fields"); err != nil {
+		return nil, err
+	}
+	if h, ok := props["hasHeader"]; ok {
+		if c.hasHeader, ok = h.(bool); !ok {
+			return nil, fmt.Errorf("invalid hasHeader property %v, should be a bool", h)
+		}
+	}
+	return c, nil
+}
+
+func (c *csvConverter) Encode(d interface{}) ([]byte, error) {
+	rows, err := toRows(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	fields := c.fields
+	if len(fields) == 0 {
+		fields = sortedKeys(rows[0])
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = c.delimiter
+	if c.hasHeader {
+		if err := w.Write(fields); err != nil {
+			return nil, err
+		}
+	}
+	record := make([]string, len(fields))
+	for _, r := range rows {
+		for i, f := range fields {
+			record[i] = toText(r[f])
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// Decode decodes the first line of values. If the fields property is not set, the first line must be the header.
+// All the values are decoded as strings.
+func (c *csvConverter) Decode(b []byte) (map[string]interface{}, error) {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.Comma = c.delimiter
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv %s: %v", b, err)
+	}
+	fields := c.fields
+	if len(fields) == 0 || c.hasHeader {
+		if len(records) == 0 {
+			return nil, fmt.Errorf("csv %s has no header", b)
+		}
+		if len(fields) == 0 {
+			fields = records[0]
+		}
+		records = records[1:]
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("csv %s has no values", b)
+	}
+	if len(records[0]) != len(fields) {
+		return nil, fmt.Errorf("csv %s has %d values but expect %d fields", b, len(records[0]), len(fields))
+	}
+	result := make(map[string]interface{}, len(fields))
+	for i, f := range fields {
+		result[f] = records[0][i]
+	}
+	return result, nil
+}
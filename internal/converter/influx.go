@@ -0,0 +1,115 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"strconv"
+	"strings"
+)
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxConverter encodes each row as a line of the influxdb line protocol. The tags property specifies the fields
+// which are encoded as tags, and the other fields are encoded as fields. The timestamp is read from the timestampField
+// in milliseconds and encoded in nanoseconds. If it is not set, the timestamp is assigned by the server.
+type influxConverter struct {
+	measurement string
+	tags        []string
+	tsField     string
+}
+
+func newInfluxConverter(props map[string]interface{}) (message.Converter, error) {
+	c := &influxConverter{}
+	var err error
+	if c.measurement, err = getString(props, "measurement"); err != nil {
+		return nil, err
+	}
+	if c.measurement == "" {
+		return nil, fmt.Errorf("influx format requires the measurement property")
+	}
+	if c.tags, err = getStringSlice(props, "tags"); err != nil {
+		return nil, err
+	}
+	if c.tsField, err = getString(props, "timestampField"); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *influxConverter) Encode(d interface{}) ([]byte, error) {
+	rows, err := toRows(d)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i, r := range rows {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		if err := c.encodeLine(&buf, r); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *influxConverter) encodeLine(buf *bytes.Buffer, r map[string]interface{}) error {
+	buf.WriteString(measurementEscaper.Replace(c.measurement))
+	isTag := make(map[string]bool, len(c.tags))
+	for _, t := range c.tags {
+		isTag[t] = true
+		if v, ok := r[t]; ok && v != nil {
+			buf.WriteString("," + keyEscaper.Replace(t) + "=" + keyEscaper.Replace(toText(v)))
+		}
+	}
+	n := 0
+	for _, k := range sortedKeys(r) {
+		v := r[k]
+		if isTag[k] || k == c.tsField || k == message.MetaKey || v == nil {
+			continue
+		}
+		if n == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(keyEscaper.Replace(k) + "=" + influxValue(v))
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("influx format requires at least one field but found %v", r)
+	}
+	if c.tsField != "" {
+		if v, ok := r[c.tsField]; ok && v != nil {
+			ts, err := cast.ToInt64(v, cast.CONVERT_ALL)
+			if err != nil {
+				return fmt.Errorf("invalid timestamp %v: %v", v, err)
+			}
+			buf.WriteString(" " + strconv.FormatInt(ts*1e6, 10))
+		}
+	}
+	return nil
+}
+
+func influxValue(v interface{}) string {
+	switch t := v.(type) {
+	case bool:
+		return strconv.FormatBool(t)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprintf("%di", t)
+	case float32, float64:
+		return toText(t)
+	default:
+		return `"` + stringEscaper.Replace(toText(t)) + `"`
+	}
+}
+
+func (c *influxConverter) Decode([]byte) (map[string]interface{}, error) {
+	return nil, fmt.Errorf("influx format does not support decoding")
+}
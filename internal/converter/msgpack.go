@@ -0,0 +1,30 @@
+package converter
+
+import (
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"github.com/ugorji/go/codec"
+	"reflect"
+)
+
+type msgpackConverter struct {
+	h *codec.MsgpackHandle
+}
+
+func newMsgpackConverter(map[string]interface{}) (message.Converter, error) {
+	h := &codec.MsgpackHandle{WriteExt: true}
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return &msgpackConverter{h: h}, nil
+}
+
+func (c *msgpackConverter) Encode(d interface{}) ([]byte, error) {
+	var b []byte
+	err := codec.NewEncoderBytes(&b, c.h).Encode(d)
+	return b, err
+}
+
+func (c *msgpackConverter) Decode(b []byte) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	err := codec.NewDecoderBytes(b, c.h).Decode(&result)
+	return result, err
+}
@@ -0,0 +1,103 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"path/filepath"
+	"sync"
+)
+
+// A buffer of the parsed schema files by path
+var schemas = &sync.Map{}
+
+// protobufConverter encodes a row as the protobuf message of the schemaMessage in the schemaFile. The schema file
+// is an absolute path or a path relative to etc/schemas.
+type protobufConverter struct {
+	md *desc.MessageDescriptor
+}
+
+func newProtobufConverter(props map[string]interface{}) (message.Converter, error) {
+	file, err := getString(props, "schemaFile")
+	if err != nil {
+		return nil, err
+	}
+	name, err := getString(props, "schemaMessage")
+	if err != nil {
+		return nil, err
+	}
+	if file == "" || name == "" {
+		return nil, fmt.Errorf("protobuf format requires the schemaFile and schemaMessage properties")
+	}
+	fd, err := parseSchema(file)
+	if err != nil {
+		return nil, err
+	}
+	md := fd.FindMessage(name)
+	if md == nil && fd.GetPackage() != "" {
+		md = fd.FindMessage(fd.GetPackage() + "." + name)
+	}
+	if md == nil {
+		return nil, fmt.Errorf("message %s is not found in schema %s", name, file)
+	}
+	return &protobufConverter{md: md}, nil
+}
+
+func parseSchema(file string) (*desc.FileDescriptor, error) {
+	if !filepath.IsAbs(file) {
+		dir, err := conf.GetConfLoc()
+		if err != nil {
+			return nil, err
+		}
+		file = filepath.Join(dir, "schemas", file)
+	}
+	if v, ok := schemas.Load(file); ok {
+		return v.(*desc.FileDescriptor), nil
+	}
+	p := &protoparse.Parser{ImportPaths: []string{filepath.Dir(file)}}
+	fds, err := p.ParseFiles(filepath.Base(file))
+	if err != nil {
+		return nil, fmt.Errorf("fail to parse schema %s: %v", file, err)
+	}
+	schemas.Store(file, fds[0])
+	return fds[0], nil
+}
+
+// Encode encodes a row. The result of multiple rows cannot be encoded as a message, so sendSingle is required for it
+func (c *protobufConverter) Encode(d interface{}) ([]byte, error) {
+	rows, err := toRows(d)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("protobuf format can only encode one row but found %d rows, please set sendSingle to true", len(rows))
+	}
+	j, err := json.Marshal(rows[0])
+	if err != nil {
+		return nil, err
+	}
+	m := dynamic.NewMessage(c.md)
+	if err := m.UnmarshalJSONPB(&jsonpb.Unmarshaler{AllowUnknownFields: true}, j); err != nil {
+		return nil, fmt.Errorf("fail to convert %s to message %s: %v", j, c.md.GetFullyQualifiedName(), err)
+	}
+	return m.Marshal()
+}
+
+func (c *protobufConverter) Decode(b []byte) (map[string]interface{}, error) {
+	m := dynamic.NewMessage(c.md)
+	if err := m.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf("fail to decode message %s: %v", c.md.GetFullyQualifiedName(), err)
+	}
+	j, err := m.MarshalJSONPB(&jsonpb.Marshaler{OrigName: true})
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]interface{})
+	err = json.Unmarshal(j, &result)
+	return result, err
+}
@@ -0,0 +1,267 @@
+package httpx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuthClientCredentials = "clientCredentials"
+	AuthRefreshToken      = "refreshToken"
+	AuthFetch             = "fetch"
+)
+
+// AuthConf is the configuration to get the access token from the token endpoint
+type AuthConf struct {
+	// clientCredentials: OAuth2 client credentials grant
+	// refreshToken: OAuth2 refresh token grant
+	// fetch: request the url and read the token from the response by the JSONPath
+	Type         string   `json:"type"`
+	TokenUrl     string   `json:"tokenUrl"`
+	ClientId     string   `json:"clientId"`
+	ClientSecret string   `json:"clientSecret"`
+	Scopes       []string `json:"scopes"`
+	RefreshToken string   `json:"refreshToken"`
+	// The request of the fetch type
+	Method   string            `json:"method"`
+	Body     string            `json:"body"`
+	BodyType string            `json:"bodyType"`
+	Headers  map[string]string `json:"headers"`
+	// The JSONPath to read the token and its lifetime in seconds from the response of the fetch type
+	TokenPath  string `json:"tokenPath"`
+	ExpirePath string `json:"expirePath"`
+	// The lifetime of the token in seconds if the token endpoint does not return it
+	Expire int `json:"expire"`
+	// The header to send the token, by default it is Authorization: Bearer {token}
+	Header string `json:"header"`
+	Prefix string `json:"prefix"`
+}
+
+// TokenSource gets the access token from the token endpoint and caches it. The token is refreshed before it expires.
+type TokenSource struct {
+	conf       *AuthConf
+	tokenPath  gval.Evaluable
+	expirePath gval.Evaluable
+
+	token        string
+	refreshToken string
+	expiry       time.Time
+	sync.Mutex
+}
+
+// NewTokenSource creates the token source from the auth property
+func NewTokenSource(props interface{}) (*TokenSource, error) {
+	c := &AuthConf{
+		Method:   http.MethodPost,
+		BodyType: "json",
+		Header:   "Authorization",
+		Prefix:   "Bearer",
+	}
+	if err := cast.MapToStruct(props, c); err != nil {
+		return nil, fmt.Errorf("invalid auth %v: %v", props, err)
+	}
+	if c.TokenUrl == "" {
+		return nil, fmt.Errorf("auth tokenUrl is required")
+	}
+	if _, err := url.Parse(c.TokenUrl); err != nil {
+		return nil, fmt.Errorf("invalid auth tokenUrl %s: %v", c.TokenUrl, err)
+	}
+	if c.Expire < 0 {
+		return nil, fmt.Errorf("invalid auth expire %d", c.Expire)
+	}
+	ts := &TokenSource{conf: c}
+	switch c.Type {
+	case AuthClientCredentials:
+		if c.ClientId == "" || c.ClientSecret == "" {
+			return nil, fmt.Errorf("auth clientId and clientSecret are required for clientCredentials type")
+		}
+	case AuthRefreshToken:
+		if c.RefreshToken == "" {
+			return nil, fmt.Errorf("auth refreshToken is required for refreshToken type")
+		}
+		ts.refreshToken = c.RefreshToken
+	case AuthFetch:
+		c.Method = strings.ToUpper(c.Method)
+		if _, ok := BodyTypeMap[c.BodyType]; !ok {
+			return nil, fmt.Errorf("invalid auth bodyType %s", c.BodyType)
+		}
+		if c.TokenPath == "" {
+			c.TokenPath = "$.access_token"
+		}
+		var err error
+		if ts.tokenPath, err = gval.Full(jsonpath.PlaceholderExtension()).NewEvaluable(c.TokenPath); err != nil {
+			return nil, fmt.Errorf("invalid auth tokenPath %s: %v", c.TokenPath, err)
+		}
+		if c.ExpirePath != "" {
+			if ts.expirePath, err = gval.Full(jsonpath.PlaceholderExtension()).NewEvaluable(c.ExpirePath); err != nil {
+				return nil, fmt.Errorf("invalid auth expirePath %s: %v", c.ExpirePath, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid auth type %s, it must be clientCredentials, refreshToken or fetch", c.Type)
+	}
+	return ts, nil
+}
+
+// Token returns the cached token, or requests a new one if there is no token or it is about to expire
+func (ts *TokenSource) Token(logger api.Logger, client *http.Client) (string, error) {
+	ts.Lock()
+	defer ts.Unlock()
+	if ts.token != "" && (ts.expiry.IsZero() || time.Now().Before(ts.expiry)) {
+		return ts.token, nil
+	}
+	logger.Debugf("request new access token from %s", ts.conf.TokenUrl)
+	var (
+		resp *http.Response
+		err  error
+	)
+	if ts.conf.Type == AuthFetch {
+		resp, err = Send(logger, client, ts.conf.BodyType, ts.conf.Method, ts.conf.TokenUrl, ts.conf.Headers, true, []byte(ts.conf.Body))
+	} else {
+		form := url.Values{}
+		if ts.conf.Type == AuthRefreshToken {
+			form.Set("grant_type", "refresh_token")
+			form.Set("refresh_token", ts.refreshToken)
+		} else {
+			form.Set("grant_type", "client_credentials")
+		}
+		if ts.conf.ClientId != "" {
+			form.Set("client_id", ts.conf.ClientId)
+			form.Set("client_secret", ts.conf.ClientSecret)
+		}
+		if len(ts.conf.Scopes) > 0 {
+			form.Set("scope", strings.Join(ts.conf.Scopes, " "))
+		}
+		resp, err = client.PostForm(ts.conf.TokenUrl, form)
+	}
+	if err != nil {
+		return "", fmt.Errorf("fail to request token from %s: %v", ts.conf.TokenUrl, err)
+	}
+	defer resp.Body.Close()
+	c, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("fail to read token response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", fmt.Errorf("fail to request token from %s with http return code: %d and error message %s", ts.conf.TokenUrl, resp.StatusCode, string(c))
+	}
+	if err := ts.parseToken(c); err != nil {
+		return "", err
+	}
+	return ts.token, nil
+}
+
+func (ts *TokenSource) parseToken(c []byte) error {
+	var (
+		token  string
+		expire = ts.conf.Expire
+	)
+	if ts.conf.Type == AuthFetch {
+		var raw interface{}
+		if err := json.Unmarshal(c, &raw); err != nil {
+			return fmt.Errorf("invalid token response %s: %v", string(c), err)
+		}
+		t, err := ts.tokenPath(context.Background(), raw)
+		if err != nil {
+			return fmt.Errorf("fail to read token by %s: %v", ts.conf.TokenPath, err)
+		}
+		token, _ = t.(string)
+		if ts.expirePath != nil {
+			if e, err := ts.expirePath(context.Background(), raw); err == nil {
+				if v, err := cast.ToInt(e, cast.CONVERT_ALL); err == nil {
+					expire = v
+				}
+			}
+		}
+	} else {
+		r := &struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+			ExpiresIn    int    `json:"expires_in"`
+		}{}
+		if err := json.Unmarshal(c, r); err != nil {
+			return fmt.Errorf("invalid token response %s: %v", string(c), err)
+		}
+		token = r.AccessToken
+		if r.ExpiresIn > 0 {
+			expire = r.ExpiresIn
+		}
+		// the refresh token may rotate
+		if r.RefreshToken != "" && ts.conf.Type == AuthRefreshToken {
+			ts.refreshToken = r.RefreshToken
+		}
+	}
+	if token == "" {
+		return fmt.Errorf("no token is found in the token response %s", string(c))
+	}
+	ts.token = token
+	ts.expiry = time.Time{}
+	if expire > 0 {
+		// refresh the token ahead of the expiry
+		lifetime := time.Duration(expire) * time.Second
+		margin := lifetime / 10
+		if margin > time.Minute {
+			margin = time.Minute
+		}
+		ts.expiry = time.Now().Add(lifetime - margin)
+	}
+	return nil
+}
+
+// Invalidate drops the cached token so that a new token is requested next time
+func (ts *TokenSource) Invalidate() {
+	ts.Lock()
+	defer ts.Unlock()
+	ts.token = ""
+}
+
+func (ts *TokenSource) headers(logger api.Logger, client *http.Client, headers map[string]string) (map[string]string, error) {
+	token, err := ts.Token(logger, client)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(headers)+1)
+	for k, v := range headers {
+		result[k] = v
+	}
+	if ts.conf.Prefix != "" {
+		token = ts.conf.Prefix + " " + token
+	}
+	result[ts.conf.Header] = token
+	return result, nil
+}
+
+// SendWithAuth sends the request with the access token of the token source if it is not nil. If the response is
+// 401 unauthorized, it requests a new token and retries once.
+func SendWithAuth(logger api.Logger, client *http.Client, auth *TokenSource, bodyType string, method string, u string, headers map[string]string, sendSingle bool, v interface{}) (*http.Response, error) {
+	if auth == nil {
+		return Send(logger, client, bodyType, method, u, headers, sendSingle, v)
+	}
+	h, err := auth.headers(logger, client, headers)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := Send(logger, client, bodyType, method, u, h, sendSingle, v)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	logger.Infof("got 401 unauthorized from %s, retry with a new token", u)
+	resp.Body.Close()
+	auth.Invalidate()
+	h, err = auth.headers(logger, client, headers)
+	if err != nil {
+		return nil, err
+	}
+	return Send(logger, client, bodyType, method, u, h, sendSingle, v)
+}
@@ -0,0 +1,139 @@
+package httpx
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestNewTokenSource(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{"type": "clientCredentials", "tokenUrl": "http://localhost/token", "clientId": "id", "clientSecret": "secret"},
+		},
+		{
+			props: map[string]interface{}{"type": "clientCredentials", "tokenUrl": "http://localhost/token", "clientId": "id"},
+			err:   "auth clientId and clientSecret are required for clientCredentials type",
+		},
+		{
+			props: map[string]interface{}{"type": "refreshToken", "tokenUrl": "http://localhost/token"},
+			err:   "auth refreshToken is required for refreshToken type",
+		},
+		{
+			props: map[string]interface{}{"type": "fetch", "tokenUrl": "http://localhost/token", "tokenPath": "$.data.token"},
+		},
+		{
+			props: map[string]interface{}{"type": "fetch", "tokenUrl": "http://localhost/token", "bodyType": "yaml"},
+			err:   "invalid auth bodyType yaml",
+		},
+		{
+			props: map[string]interface{}{"type": "basic", "tokenUrl": "http://localhost/token"},
+			err:   "invalid auth type basic, it must be clientCredentials, refreshToken or fetch",
+		},
+		{
+			props: map[string]interface{}{"type": "fetch"},
+			err:   "auth tokenUrl is required",
+		},
+	}
+	for i, tt := range tests {
+		_, err := NewTokenSource(tt.props)
+		if !reflect.DeepEqual(tt.err, errString(err)) {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.err, errString(err))
+		}
+	}
+}
+
+func TestSendWithAuth(t *testing.T) {
+	var (
+		tokenRequests []string
+		tokens        = 0
+		expired       = false
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			r.ParseForm()
+			tokenRequests = append(tokenRequests, r.Form.Encode())
+			tokens++
+			fmt.Fprintf(w, `{"access_token":"token%d","refresh_token":"refresh%d","expires_in":3600}`, tokens, tokens)
+		case "/fetch":
+			tokenRequests = append(tokenRequests, r.Header.Get("X-Key"))
+			tokens++
+			fmt.Fprintf(w, `{"data":{"token":"token%d"}}`, tokens)
+		default:
+			if expired || r.Header.Get("Authorization") != fmt.Sprintf("Bearer token%d", tokens) {
+				expired = false
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "ok")
+		}
+	}))
+	defer ts.Close()
+
+	var tests = []struct {
+		props    map[string]interface{}
+		requests []string
+	}{
+		{
+			props: map[string]interface{}{"type": "clientCredentials", "tokenUrl": ts.URL + "/token", "clientId": "id", "clientSecret": "secret", "scopes": []interface{}{"read", "write"}},
+			requests: []string{
+				"client_id=id&client_secret=secret&grant_type=client_credentials&scope=read+write",
+				"client_id=id&client_secret=secret&grant_type=client_credentials&scope=read+write",
+			},
+		},
+		{
+			props: map[string]interface{}{"type": "refreshToken", "tokenUrl": ts.URL + "/token", "refreshToken": "refresh0"},
+			requests: []string{
+				"grant_type=refresh_token&refresh_token=refresh0",
+				"grant_type=refresh_token&refresh_token=refresh1",
+			},
+		},
+		{
+			props:    map[string]interface{}{"type": "fetch", "tokenUrl": ts.URL + "/fetch", "headers": map[string]interface{}{"X-Key": "k1"}, "tokenPath": "$.data.token"},
+			requests: []string{"k1", "k1"},
+		},
+	}
+	logger := conf.Log
+	client := &http.Client{}
+	for i, tt := range tests {
+		tokenRequests = nil
+		tokens = 0
+		auth, err := NewTokenSource(tt.props)
+		if err != nil {
+			t.Errorf("%d \tfail to create token source: %v", i, err)
+			continue
+		}
+		// the first request gets the token, the second one reuses it and the third one retries after the 401
+		for j := 0; j < 3; j++ {
+			if j == 2 {
+				expired = true
+			}
+			resp, err := SendWithAuth(logger, client, auth, "none", http.MethodGet, ts.URL+"/data", nil, true, nil)
+			if err != nil {
+				t.Errorf("%d.%d \tsend error: %v", i, j, err)
+				continue
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("%d.%d \tstatus mismatch: %d", i, j, resp.StatusCode)
+			}
+		}
+		if !reflect.DeepEqual(tt.requests, tokenRequests) {
+			t.Errorf("%d \ttoken requests mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.requests, tokenRequests)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
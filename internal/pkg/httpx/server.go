@@ -0,0 +1,157 @@
+package httpx
+
+import (
+	"context"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+ *	Registry of the embedded HTTP servers shared by the built-in sources and sinks.
+ *  A server is started when the first endpoint of its address is attached and is shut down when the last endpoint
+ *  is detached. So multiple streams or rules can share one listener port with different paths. The endpoint of a path
+ *  is reference counted, the attachers of the same path share the same handler.
+ */
+var servers = &serverRegistry{
+	servers: make(map[string]*sharedServer),
+}
+
+type serverRegistry struct {
+	servers map[string]*sharedServer
+	sync.Mutex
+}
+
+type endpoint struct {
+	handler http.Handler
+	refs    int
+}
+
+type sharedServer struct {
+	certPath string
+	keyPath  string
+	server   *http.Server
+	listener net.Listener
+
+	endpoints map[string]*endpoint // keyed by path
+	sync.RWMutex
+}
+
+// AttachEndpoint attaches to the endpoint of the path on the shared server of the address. If the endpoint does not
+// exist, it is created by the newHandler function. The handler of the endpoint is returned so that the caller can
+// attach itself to a shared handler. Each successful attach must be paired with a DetachEndpoint call.
+func AttachEndpoint(addr, certPath, keyPath, path string, newHandler func() http.Handler) (http.Handler, error) {
+	servers.Lock()
+	defer servers.Unlock()
+	s, ok := servers.servers[addr]
+	if !ok {
+		var err error
+		s, err = startServer(addr, certPath, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		servers.servers[addr] = s
+	} else if s.certPath != certPath || s.keyPath != keyPath {
+		return nil, fmt.Errorf("http server %s is already started with different tls settings", addr)
+	}
+	s.Lock()
+	defer s.Unlock()
+	ep, ok := s.endpoints[path]
+	if !ok {
+		ep = &endpoint{handler: newHandler()}
+		s.endpoints[path] = ep
+	}
+	ep.refs++
+	return ep.handler, nil
+}
+
+// DetachEndpoint detaches from the endpoint of the path. The endpoint is removed when no attacher left and the server
+// is shut down when no endpoint left.
+func DetachEndpoint(addr, path string) {
+	servers.Lock()
+	defer servers.Unlock()
+	s, ok := servers.servers[addr]
+	if !ok {
+		return
+	}
+	s.Lock()
+	if ep, ok := s.endpoints[path]; ok {
+		ep.refs--
+		if ep.refs <= 0 {
+			delete(s.endpoints, path)
+			// hijacked connections like websocket are not closed by the server shutdown
+			if c, ok := ep.handler.(io.Closer); ok {
+				if err := c.Close(); err != nil {
+					conf.Log.Warnf("close endpoint %s of http server %s error: %v", path, addr, err)
+				}
+			}
+		}
+	}
+	end := len(s.endpoints) == 0
+	s.Unlock()
+	if end {
+		delete(servers.servers, addr)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			conf.Log.Warnf("shutdown http server %s error: %v", addr, err)
+		}
+		conf.Log.Infof("http server %s stopped", addr)
+	}
+}
+
+// GetServerAddr returns the actual listening address of the shared server. It is mainly for the address with port 0
+func GetServerAddr(addr string) (net.Addr, bool) {
+	servers.Lock()
+	defer servers.Unlock()
+	if s, ok := servers.servers[addr]; ok {
+		return s.listener.Addr(), true
+	}
+	return nil, false
+}
+
+func startServer(addr, certPath, keyPath string) (*sharedServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("fail to listen on %s: %v", addr, err)
+	}
+	s := &sharedServer{
+		certPath:  certPath,
+		keyPath:   keyPath,
+		listener:  ln,
+		endpoints: make(map[string]*endpoint),
+	}
+	s.server = &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		var err error
+		if certPath != "" || keyPath != "" {
+			conf.Log.Infof("http server listens on %s with tls", ln.Addr())
+			err = s.server.ServeTLS(ln, certPath, keyPath)
+		} else {
+			conf.Log.Infof("http server listens on %s", ln.Addr())
+			err = s.server.Serve(ln)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			conf.Log.Errorf("http server %s exits with error: %v", addr, err)
+		}
+	}()
+	return s, nil
+}
+
+func (s *sharedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	ep, ok := s.endpoints[r.URL.Path]
+	s.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	ep.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,201 @@
+package httpx
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const wsWriteTimeout = 5 * time.Second
+
+// WebsocketEndpoint is the handler of a websocket path on the shared http server. It keeps all the connected clients
+// to broadcast messages to them, and dispatches the messages received from the clients to all the receivers.
+// A websocket source and a websocket sink can attach to the same endpoint to communicate in both directions.
+type WebsocketEndpoint struct {
+	upgrader websocket.Upgrader
+	// the allowed origins besides the same origin, "*" allows all
+	allowedOrigins []string
+	conns          map[*websocket.Conn]bool
+	receivers      map[interface{}]func([]byte)
+	// gorilla websocket connection supports only one concurrent writer
+	wmu sync.Mutex
+	sync.RWMutex
+}
+
+// AttachWebsocketEndpoint attaches to the websocket endpoint of the path on the shared server of the address. The
+// handshake from a browser is accepted only if its origin is the same as the server host or in the allowedOrigins.
+// Each successful attach must be paired with a DetachEndpoint call.
+func AttachWebsocketEndpoint(addr, certPath, keyPath, path string, allowedOrigins []string) (*WebsocketEndpoint, error) {
+	origins := append([]string{}, allowedOrigins...)
+	sort.Strings(origins)
+	h, err := AttachEndpoint(addr, certPath, keyPath, path, func() http.Handler {
+		e := &WebsocketEndpoint{
+			allowedOrigins: origins,
+			conns:          make(map[*websocket.Conn]bool),
+			receivers:      make(map[interface{}]func([]byte)),
+		}
+		e.upgrader = websocket.Upgrader{CheckOrigin: e.checkOrigin}
+		return e
+	})
+	if err != nil {
+		return nil, err
+	}
+	ep, ok := h.(*WebsocketEndpoint)
+	if !ok {
+		DetachEndpoint(addr, path)
+		return nil, fmt.Errorf("websocket path %s of server %s is already used by other source or sink", path, addr)
+	}
+	if len(ep.allowedOrigins) != len(origins) || (len(origins) > 0 && !reflect.DeepEqual(ep.allowedOrigins, origins)) {
+		DetachEndpoint(addr, path)
+		return nil, fmt.Errorf("websocket path %s of server %s is already registered with different allowedOrigins", path, addr)
+	}
+	return ep, nil
+}
+
+// checkOrigin accepts the request without origin header which is not from a browser, the request from the same
+// origin and the request from the allowed origins.
+func (e *WebsocketEndpoint) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, o := range e.allowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func (e *WebsocketEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := e.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has replied the error to the client
+		return
+	}
+	e.Lock()
+	e.conns[conn] = true
+	e.Unlock()
+	go e.readLoop(conn)
+}
+
+func (e *WebsocketEndpoint) readLoop(conn *websocket.Conn) {
+	defer e.removeConn(conn)
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		e.RLock()
+		receivers := make([]func([]byte), 0, len(e.receivers))
+		for _, r := range e.receivers {
+			receivers = append(receivers, r)
+		}
+		e.RUnlock()
+		for _, r := range receivers {
+			r(data)
+		}
+	}
+}
+
+func (e *WebsocketEndpoint) removeConn(conn *websocket.Conn) {
+	e.Lock()
+	delete(e.conns, conn)
+	e.Unlock()
+	_ = conn.Close()
+}
+
+// AddReceiver adds a function to receive the messages from all the connected clients
+func (e *WebsocketEndpoint) AddReceiver(key interface{}, r func([]byte)) {
+	e.Lock()
+	defer e.Unlock()
+	e.receivers[key] = r
+}
+
+func (e *WebsocketEndpoint) RemoveReceiver(key interface{}) {
+	e.Lock()
+	defer e.Unlock()
+	delete(e.receivers, key)
+}
+
+// Broadcast sends the data to all the connected clients. The clients fail to receive are disconnected.
+func (e *WebsocketEndpoint) Broadcast(data []byte) {
+	e.RLock()
+	conns := make([]*websocket.Conn, 0, len(e.conns))
+	for c := range e.conns {
+		conns = append(conns, c)
+	}
+	e.RUnlock()
+	e.wmu.Lock()
+	defer e.wmu.Unlock()
+	for _, c := range conns {
+		_ = c.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.WriteMessage(websocket.TextMessage, data); err != nil {
+			e.removeConn(c)
+		}
+	}
+}
+
+// ClientCount returns the number of the connected clients
+func (e *WebsocketEndpoint) ClientCount() int {
+	e.RLock()
+	defer e.RUnlock()
+	return len(e.conns)
+}
+
+// Close disconnects all the clients. It is called when the endpoint is removed from the server
+func (e *WebsocketEndpoint) Close() error {
+	e.Lock()
+	defer e.Unlock()
+	for c := range e.conns {
+		_ = c.Close()
+	}
+	e.conns = make(map[*websocket.Conn]bool)
+	return nil
+}
+
+// DialWebsocket connects to the websocket server. If fails, it retries with an exponential backoff from the interval
+// to the maxInterval in milliseconds until connected or the context is done.
+func DialWebsocket(ctx api.StreamContext, url string, headers map[string]string, insecureSkipVerify bool, interval, maxInterval int) (*websocket.Conn, error) {
+	logger := ctx.GetLogger()
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:  &tls.Config{InsecureSkipVerify: insecureSkipVerify},
+	}
+	h := make(http.Header)
+	for k, v := range headers {
+		h.Set(k, v)
+	}
+	wait := time.Duration(interval) * time.Millisecond
+	max := time.Duration(maxInterval) * time.Millisecond
+	for {
+		conn, _, err := dialer.DialContext(ctx, url, h)
+		if err == nil {
+			logger.Infof("websocket connected to %s", url)
+			return conn, nil
+		}
+		logger.Warnf("fail to connect websocket %s: %v, retry in %v", url, err, wait)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+		if wait > max {
+			wait = max
+		}
+	}
+}
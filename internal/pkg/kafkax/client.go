@@ -0,0 +1,95 @@
+// Package kafkax holds the common configuration of the kafka source and sink.
+package kafkax
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"io/ioutil"
+	"strings"
+)
+
+// ClientConf is the connection configuration shared by the kafka source and sink
+type ClientConf struct {
+	Brokers            []string `json:"brokers"`
+	ClientId           string   `json:"clientId"`
+	Version            string   `json:"version"`
+	SaslMechanism      string   `json:"saslMechanism"`
+	Username           string   `json:"username"`
+	Password           string   `json:"password"`
+	Tls                bool     `json:"tls"`
+	CertificationPath  string   `json:"certificationPath"`
+	PrivateKeyPath     string   `json:"privateKeyPath"`
+	RootCaPath         string   `json:"rootCaPath"`
+	InsecureSkipVerify bool     `json:"insecureSkipVerify"`
+}
+
+// NewConfig validates the connection configuration and converts it to the sarama configuration
+func NewConfig(c *ClientConf) (*sarama.Config, error) {
+	if len(c.Brokers) == 0 {
+		return nil, fmt.Errorf("missing property brokers")
+	}
+	sc := sarama.NewConfig()
+	if c.ClientId != "" {
+		sc.ClientID = c.ClientId
+	} else {
+		sc.ClientID = "ekuiper"
+	}
+	if c.Version != "" {
+		v, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kafka version %s: %v", c.Version, err)
+		}
+		sc.Version = v
+	} else {
+		sc.Version = sarama.V1_0_0_0
+	}
+	switch strings.ToLower(c.SaslMechanism) {
+	case "", "none":
+	case "plain":
+		sc.Net.SASL.Enable = true
+		sc.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+		sc.Net.SASL.User = c.Username
+		sc.Net.SASL.Password = c.Password
+	default:
+		return nil, fmt.Errorf("invalid saslMechanism %s, must be none or plain", c.SaslMechanism)
+	}
+	if c.Tls || c.CertificationPath != "" || c.RootCaPath != "" {
+		tlsConf := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+		if c.CertificationPath != "" || c.PrivateKeyPath != "" {
+			cp, err := conf.ProcessPath(c.CertificationPath)
+			if err != nil {
+				return nil, err
+			}
+			kp, err := conf.ProcessPath(c.PrivateKeyPath)
+			if err != nil {
+				return nil, err
+			}
+			cer, err := tls.LoadX509KeyPair(cp, kp)
+			if err != nil {
+				return nil, err
+			}
+			tlsConf.Certificates = []tls.Certificate{cer}
+		}
+		if c.RootCaPath != "" {
+			rp, err := conf.ProcessPath(c.RootCaPath)
+			if err != nil {
+				return nil, err
+			}
+			ca, err := ioutil.ReadFile(rp)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(ca) {
+				return nil, fmt.Errorf("invalid rootCaPath %s", c.RootCaPath)
+			}
+			tlsConf.RootCAs = pool
+		}
+		sc.Net.TLS.Enable = true
+		sc.Net.TLS.Config = tlsConf
+	}
+	return sc, nil
+}
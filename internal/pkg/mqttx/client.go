@@ -0,0 +1,144 @@
+package mqttx
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"strings"
+	"time"
+)
+
+const (
+	connectTimeout = 10 * time.Second
+	// the timeout to wait for the acknowledgement of subscribe and publish
+	ackTimeout = 10 * time.Second
+)
+
+// Message is the message received from the broker. The properties are only available for MQTT v5 connections.
+type Message struct {
+	Topic           string
+	MessageId       int
+	Payload         []byte
+	ResponseTopic   string
+	CorrelationData []byte
+	ContentType     string
+	UserProperties  map[string]string
+}
+
+// PublishOptions are the options for publishing a message. The properties except Qos and Retained are ignored by
+// MQTT v3 connections.
+type PublishOptions struct {
+	Qos             byte
+	Retained        bool
+	ResponseTopic   string
+	CorrelationData []byte
+	UserProperties  map[string]string
+	// The message expiry interval in seconds, 0 means the message never expires
+	MessageExpiry uint32
+}
+
+type MessageHandler func(msg *Message)
+
+// Client is the abstraction of the MQTT v3 and v5 clients. The client reconnects automatically and resubscribes all
+// the subscriptions after reconnected.
+type Client interface {
+	Subscribe(topic string, qos byte, handler MessageHandler) error
+	Unsubscribe(topic string) error
+	Publish(topic string, payload []byte, opts *PublishOptions) error
+	Disconnect()
+}
+
+// ClientConf is the connection configuration of a client
+type ClientConf struct {
+	Server             string
+	ClientId           string
+	ProtocolVersion    uint
+	Username           string
+	Password           string
+	CertificationPath  string
+	PrivateKeyPath     string
+	InsecureSkipVerify bool
+}
+
+// ParseProtocolVersion converts the protocol version property to the version number. 3.1 is also referred as MQTT 3,
+// 3.1.1 as MQTT 4 and 5 as MQTT 5.
+func ParseProtocolVersion(v string) (uint, error) {
+	switch strings.TrimSpace(v) {
+	case "", "3", "3.1":
+		return 3, nil
+	case "4", "3.1.1":
+		return 4, nil
+	case "5", "5.0":
+		return 5, nil
+	default:
+		return 0, fmt.Errorf("unknown protocol version %s, the value could be only 3.1, 3.1.1 (also refers to MQTT version 4) or 5", v)
+	}
+}
+
+// NewClient connects to the broker and returns the client if the connection is established.
+func NewClient(ctx api.StreamContext, c *ClientConf) (Client, error) {
+	var tlsConf *tls.Config
+	if c.CertificationPath != "" || c.PrivateKeyPath != "" {
+		cp, err := conf.ProcessPath(c.CertificationPath)
+		if err != nil {
+			return nil, err
+		}
+		kp, err := conf.ProcessPath(c.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		cer, err := tls.LoadX509KeyPair(cp, kp)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf = &tls.Config{Certificates: []tls.Certificate{cer}, InsecureSkipVerify: c.InsecureSkipVerify}
+	}
+	if c.ProtocolVersion == 5 {
+		return newV5Client(ctx, c, tlsConf)
+	}
+	return newV3Client(ctx, c, tlsConf)
+}
+
+// SharedTopic returns the shared subscription topic of the group. The messages of a shared subscription are
+// distributed among all the subscribers of the same group.
+func SharedTopic(group, topic string) string {
+	if group == "" || strings.HasPrefix(topic, "$share/") {
+		return topic
+	}
+	return "$share/" + group + "/" + topic
+}
+
+// TrimSharePrefix removes the $share/{group}/ prefix of a shared subscription topic
+func TrimSharePrefix(topic string) string {
+	if strings.HasPrefix(topic, "$share/") {
+		if parts := strings.SplitN(topic, "/", 3); len(parts) == 3 {
+			return parts[2]
+		}
+	}
+	return topic
+}
+
+// MatchTopic checks whether the topic of a received message matches the subscription topic filter, which may contain
+// wildcards or be a shared subscription.
+func MatchTopic(filter, topic string) bool {
+	filter = TrimSharePrefix(filter)
+	if filter == topic {
+		return true
+	}
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	// topics beginning with $ are not matched by the wildcards at the first level
+	if strings.HasPrefix(topic, "$") && (fs[0] == "+" || fs[0] == "#") {
+		return false
+	}
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
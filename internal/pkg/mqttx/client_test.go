@@ -0,0 +1,73 @@
+package mqttx
+
+import (
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	var tests = []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{filter: "a/b", topic: "a/b", match: true},
+		{filter: "a/b", topic: "a/c", match: false},
+		{filter: "a/+", topic: "a/c", match: true},
+		{filter: "a/+", topic: "a/c/d", match: false},
+		{filter: "a/+/d", topic: "a/c/d", match: true},
+		{filter: "a/#", topic: "a/c/d", match: true},
+		{filter: "a/#", topic: "a", match: true},
+		{filter: "#", topic: "a/b", match: true},
+		{filter: "#", topic: "$SYS/b", match: false},
+		{filter: "$share/g1/a/+", topic: "a/b", match: true},
+		{filter: "$share/g1/a/b", topic: "a/b", match: true},
+		{filter: "$share/g1/a/b", topic: "g1/a/b", match: false},
+		{filter: "$share/g1/#", topic: "a/b", match: true},
+	}
+	for i, tt := range tests {
+		if r := MatchTopic(tt.filter, tt.topic); r != tt.match {
+			t.Errorf("%d. %s match %s mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.filter, tt.topic, tt.match, r)
+		}
+	}
+}
+
+func TestSharedTopic(t *testing.T) {
+	var tests = []struct {
+		group   string
+		topic   string
+		exp     string
+		trimmed string
+	}{
+		{group: "", topic: "a/b", exp: "a/b", trimmed: "a/b"},
+		{group: "g1", topic: "a/b", exp: "$share/g1/a/b", trimmed: "a/b"},
+		{group: "g1", topic: "$share/g2/a/b", exp: "$share/g2/a/b", trimmed: "a/b"},
+	}
+	for i, tt := range tests {
+		if r := SharedTopic(tt.group, tt.topic); r != tt.exp {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.exp, r)
+		}
+		if r := TrimSharePrefix(tt.exp); r != tt.trimmed {
+			t.Errorf("%d \ttrim result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.trimmed, r)
+		}
+	}
+}
+
+func TestParseProtocolVersion(t *testing.T) {
+	var tests = []struct {
+		v   string
+		exp uint
+		err bool
+	}{
+		{v: "", exp: 3},
+		{v: "3.1", exp: 3},
+		{v: "3.1.1", exp: 4},
+		{v: "5", exp: 5},
+		{v: "6", err: true},
+	}
+	for i, tt := range tests {
+		r, err := ParseProtocolVersion(tt.v)
+		if tt.err != (err != nil) || r != tt.exp {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v, %v\n\ngot=%v, %v\n\n", i, tt.exp, tt.err, r, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package mqttx
+
+import (
+	"crypto/tls"
+	"fmt"
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"sync"
+)
+
+type subscription struct {
+	qos     byte
+	handler MessageHandler
+}
+
+// v3Client is the MQTT 3.1 and 3.1.1 client based on paho.mqtt.golang
+type v3Client struct {
+	conn MQTT.Client
+	subs map[string]*subscription
+	sync.Mutex
+}
+
+func newV3Client(ctx api.StreamContext, c *ClientConf, tlsConf *tls.Config) (*v3Client, error) {
+	logger := ctx.GetLogger()
+	cli := &v3Client{subs: make(map[string]*subscription)}
+	opts := MQTT.NewClientOptions().AddBroker(c.Server).SetProtocolVersion(c.ProtocolVersion).SetClientID(c.ClientId)
+	if tlsConf != nil {
+		logger.Infof("Connect MQTT broker with certification and keys.")
+		opts.SetTLSConfig(tlsConf)
+	} else {
+		logger.Infof("Connect MQTT broker with username and password.")
+		if c.Username != "" {
+			opts.SetUsername(c.Username)
+		}
+		if c.Password != "" {
+			opts.SetPassword(c.Password)
+		}
+	}
+	opts.SetAutoReconnect(true)
+	var reconn = false
+	opts.SetConnectionLostHandler(func(_ MQTT.Client, e error) {
+		logger.Errorf("The connection %s is disconnected due to error %s, will try to re-connect later.", c.Server+": "+c.ClientId, e)
+		reconn = true
+	})
+	opts.SetOnConnectHandler(func(_ MQTT.Client) {
+		if reconn {
+			logger.Infof("The connection is %s re-established successfully.", c.Server+": "+c.ClientId)
+			cli.resubscribe(ctx)
+		}
+	})
+	cli.conn = MQTT.NewClient(opts)
+	if token := cli.conn.Connect(); token.Wait() && token.Error() != nil {
+		return nil, fmt.Errorf("found error when connecting to %s: %s", c.Server, token.Error())
+	}
+	logger.Infof("The connection to server %s was established successfully", c.Server)
+	return cli, nil
+}
+
+func (c *v3Client) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	c.Lock()
+	c.subs[topic] = &subscription{qos: qos, handler: handler}
+	c.Unlock()
+	return c.subscribe(topic, qos, handler)
+}
+
+func (c *v3Client) subscribe(topic string, qos byte, handler MessageHandler) error {
+	h := func(_ MQTT.Client, msg MQTT.Message) {
+		handler(&Message{
+			Topic:     msg.Topic(),
+			MessageId: int(msg.MessageID()),
+			Payload:   msg.Payload(),
+		})
+	}
+	if token := c.conn.Subscribe(topic, qos, h); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *v3Client) Unsubscribe(topic string) error {
+	c.Lock()
+	delete(c.subs, topic)
+	c.Unlock()
+	if token := c.conn.Unsubscribe(topic); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *v3Client) resubscribe(ctx api.StreamContext) {
+	c.Lock()
+	defer c.Unlock()
+	for topic, s := range c.subs {
+		if err := c.subscribe(topic, s.qos, s.handler); err != nil {
+			ctx.GetLogger().Errorf("Fail to resubscribe topic %s: %s", topic, err)
+		}
+	}
+}
+
+func (c *v3Client) Publish(topic string, payload []byte, opts *PublishOptions) error {
+	if token := c.conn.Publish(topic, opts.Qos, opts.Retained, payload); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+	return nil
+}
+
+func (c *v3Client) Disconnect() {
+	if c.conn.IsConnected() {
+		c.conn.Disconnect(5000)
+	}
+}
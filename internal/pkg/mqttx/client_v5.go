@@ -0,0 +1,171 @@
+package mqttx
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// v5Client is the MQTT 5 client based on the autopaho connection manager of paho.golang
+type v5Client struct {
+	cm   *autopaho.ConnectionManager
+	subs map[string]*subscription
+	sync.RWMutex
+}
+
+func newV5Client(ctx api.StreamContext, c *ClientConf, tlsConf *tls.Config) (*v5Client, error) {
+	logger := ctx.GetLogger()
+	u, err := url.Parse(c.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server %s: %v", c.Server, err)
+	}
+	cli := &v5Client{subs: make(map[string]*subscription)}
+	var reconn = false
+	cfg := autopaho.ClientConfig{
+		BrokerUrls:     []*url.URL{u},
+		TlsCfg:         tlsConf,
+		KeepAlive:      30,
+		ConnectTimeout: connectTimeout,
+		OnConnectionUp: func(_ *autopaho.ConnectionManager, _ *paho.Connack) {
+			if reconn {
+				logger.Infof("The connection is %s re-established successfully.", c.Server+": "+c.ClientId)
+				cli.resubscribe(ctx)
+			}
+			reconn = true
+		},
+		OnConnectError: func(e error) {
+			logger.Errorf("Fail to connect %s: %s, will try to re-connect later.", c.Server+": "+c.ClientId, e)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: c.ClientId,
+			OnClientError: func(e error) {
+				logger.Errorf("The connection %s is disconnected due to error %s, will try to re-connect later.", c.Server+": "+c.ClientId, e)
+			},
+		},
+	}
+	cfg.Router = paho.NewSingleHandlerRouter(cli.route)
+	if tlsConf != nil {
+		logger.Infof("Connect MQTT broker with certification and keys.")
+	} else {
+		logger.Infof("Connect MQTT broker with username and password.")
+		cfg.SetUsernamePassword(c.Username, []byte(c.Password))
+	}
+	// the connection manager keeps reconnecting until disconnected
+	cli.cm, err = autopaho.NewConnection(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+	tctx, cancel := context.WithTimeout(ctx, connectTimeout)
+	defer cancel()
+	if err := cli.cm.AwaitConnection(tctx); err != nil {
+		cli.Disconnect()
+		return nil, fmt.Errorf("found error when connecting to %s: %s", c.Server, err)
+	}
+	logger.Infof("The connection to server %s was established successfully", c.Server)
+	return cli, nil
+}
+
+// route dispatches the received message to the handlers of all the matched subscriptions
+func (c *v5Client) route(p *paho.Publish) {
+	msg := &Message{
+		Topic:     p.Topic,
+		MessageId: int(p.PacketID),
+		Payload:   p.Payload,
+	}
+	if p.Properties != nil {
+		msg.ResponseTopic = p.Properties.ResponseTopic
+		msg.CorrelationData = p.Properties.CorrelationData
+		msg.ContentType = p.Properties.ContentType
+		if len(p.Properties.User) > 0 {
+			msg.UserProperties = make(map[string]string, len(p.Properties.User))
+			for _, up := range p.Properties.User {
+				msg.UserProperties[up.Key] = up.Value
+			}
+		}
+	}
+	c.RLock()
+	var handlers []MessageHandler
+	for topic, s := range c.subs {
+		if MatchTopic(topic, p.Topic) {
+			handlers = append(handlers, s.handler)
+		}
+	}
+	c.RUnlock()
+	for _, h := range handlers {
+		h(msg)
+	}
+}
+
+func (c *v5Client) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	c.Lock()
+	c.subs[topic] = &subscription{qos: qos, handler: handler}
+	c.Unlock()
+	return c.subscribe(topic, qos)
+}
+
+func (c *v5Client) subscribe(topic string, qos byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer cancel()
+	_, err := c.cm.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{
+			topic: {QoS: qos},
+		},
+	})
+	return err
+}
+
+func (c *v5Client) Unsubscribe(topic string) error {
+	c.Lock()
+	delete(c.subs, topic)
+	c.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer cancel()
+	_, err := c.cm.Unsubscribe(ctx, &paho.Unsubscribe{Topics: []string{topic}})
+	return err
+}
+
+func (c *v5Client) resubscribe(ctx api.StreamContext) {
+	c.RLock()
+	defer c.RUnlock()
+	for topic, s := range c.subs {
+		if err := c.subscribe(topic, s.qos); err != nil {
+			ctx.GetLogger().Errorf("Fail to resubscribe topic %s: %s", topic, err)
+		}
+	}
+}
+
+func (c *v5Client) Publish(topic string, payload []byte, opts *PublishOptions) error {
+	p := &paho.Publish{
+		QoS:     opts.Qos,
+		Retain:  opts.Retained,
+		Topic:   topic,
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ResponseTopic:   opts.ResponseTopic,
+			CorrelationData: opts.CorrelationData,
+		},
+	}
+	for k, v := range opts.UserProperties {
+		p.Properties.User.Add(k, v)
+	}
+	if opts.MessageExpiry > 0 {
+		expiry := opts.MessageExpiry
+		p.Properties.MessageExpiry = &expiry
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ackTimeout)
+	defer cancel()
+	_, err := c.cm.Publish(ctx, p)
+	return err
+}
+
+func (c *v5Client) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = c.cm.Disconnect(ctx)
+}
@@ -0,0 +1,262 @@
+package mqttx
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	kctx "github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"gopkg.in/yaml.v3"
+	"strings"
+	"sync"
+)
+
+// ConnectionConf is the file to define the named connections grouped by the type. A connection is referred by the
+// connectionSelector such as mqtt.localConnection.
+const ConnectionConf = "connections/connection.yaml"
+
+// ConnectionConfig is the configuration of a named MQTT connection
+type ConnectionConfig struct {
+	Servers            []string `json:"servers"`
+	ClientId           string   `json:"clientid"`
+	PVersion           string   `json:"protocolVersion"`
+	Username           string   `json:"username"`
+	Password           string   `json:"password"`
+	CertificationPath  string   `json:"certificationPath"`
+	PrivateKeyPath     string   `json:"privateKeyPath"`
+	InsecureSkipVerify bool     `json:"insecureSkipVerify"`
+}
+
+var (
+	connPool = &connectionPool{
+		registry: make(map[string]*connectionSingleton),
+	}
+	// the function to create the client of a connection, only replaced by test
+	newConnectionClient = NewClient
+)
+
+// AttachConnection returns a client of the named connection referred by the selector such as mqtt.localConnection.
+// The connection is created when attached for the first time, and shared by all the attached clients. Call Disconnect
+// of the returned client to detach it, and the connection is closed after all the clients are detached.
+func AttachConnection(selector string) (Client, error) {
+	return connPool.attach(selector)
+}
+
+// GetConnectionConf reads the configuration of the named connection from the connection file
+func GetConnectionConf(selector string) (*ClientConf, error) {
+	parts := strings.SplitN(selector, ".", 2)
+	if len(parts) != 2 || parts[0] != "mqtt" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid connectionSelector %s, it must be like mqtt.{connectionName}", selector)
+	}
+	b, err := conf.LoadConf(ConnectionConf)
+	if err != nil {
+		return nil, fmt.Errorf("fail to load connection file %s: %v", ConnectionConf, err)
+	}
+	conns := make(map[string]map[string]interface{})
+	if err := yaml.Unmarshal(b, &conns); err != nil {
+		return nil, fmt.Errorf("fail to parse connection file %s: %v", ConnectionConf, err)
+	}
+	props, ok := conns[parts[0]][parts[1]].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("connection %s is not found in %s", selector, ConnectionConf)
+	}
+	cfg := &ConnectionConfig{}
+	if err := cast.MapToStruct(props, cfg); err != nil {
+		return nil, fmt.Errorf("read properties %v of connection %s fail with error: %v", props, selector, err)
+	}
+	if len(cfg.Servers) == 0 {
+		return nil, fmt.Errorf("connection %s is missing property servers", selector)
+	}
+	pVersion, err := ParseProtocolVersion(cfg.PVersion)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ClientId == "" {
+		if id, err := uuid.NewUUID(); err != nil {
+			return nil, fmt.Errorf("failed to get uuid, the error is %s", err)
+		} else {
+			cfg.ClientId = id.String()
+		}
+	}
+	return &ClientConf{
+		Server:             cfg.Servers[0],
+		ClientId:           cfg.ClientId,
+		ProtocolVersion:    pVersion,
+		Username:           cfg.Username,
+		Password:           strings.Trim(cfg.Password, " "),
+		CertificationPath:  cfg.CertificationPath,
+		PrivateKeyPath:     cfg.PrivateKeyPath,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}, nil
+}
+
+type connectionPool struct {
+	registry map[string]*connectionSingleton
+	sync.Mutex
+}
+
+func (p *connectionPool) attach(selector string) (Client, error) {
+	p.Lock()
+	defer p.Unlock()
+	s, ok := p.registry[selector]
+	// wait for the closing connection to disconnect so that its client id is not connected by two clients
+	for ok && s.closing != nil {
+		closing := s.closing
+		p.Unlock()
+		<-closing
+		p.Lock()
+		s, ok = p.registry[selector]
+	}
+	if !ok {
+		c, err := GetConnectionConf(selector)
+		if err != nil {
+			return nil, err
+		}
+		ctx := kctx.WithValue(kctx.Background(), kctx.LoggerKey, conf.Log.WithField("mqtt_connection", selector))
+		cli, err := newConnectionClient(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		s = &connectionSingleton{
+			cli:  cli,
+			subs: make(map[string]map[int]MessageHandler),
+		}
+		p.registry[selector] = s
+	}
+	s.nextId++
+	s.refCount++
+	return &sharedClient{selector: selector, id: s.nextId, conn: s}, nil
+}
+
+// detach removes the client from the pool under the lock, then unsubscribes its topics and disconnects the connection
+// if it is the last client. The network calls are done without the pool lock so that the other connections are not
+// blocked. The closing connection is kept in the pool until it is disconnected so that it is not attached again.
+func (p *connectionPool) detach(c *sharedClient) {
+	p.Lock()
+	s, ok := p.registry[c.selector]
+	if !ok || s != c.conn || s.closing != nil {
+		p.Unlock()
+		return
+	}
+	s.refCount--
+	last := s.refCount == 0
+	if last {
+		s.closing = make(chan struct{})
+	}
+	p.Unlock()
+	s.unsubscribeAll(c.id)
+	if last {
+		s.cli.Disconnect()
+		p.Lock()
+		delete(p.registry, c.selector)
+		close(s.closing)
+		p.Unlock()
+	}
+}
+
+// connectionSingleton holds the only client of a named connection. It subscribes each topic once and dispatches the
+// messages to all the attached clients which subscribe the topic.
+type connectionSingleton struct {
+	cli      Client
+	refCount int
+	nextId   int
+	// topic -> attached client id -> handler
+	subs map[string]map[int]MessageHandler
+	sync.RWMutex
+	// serialize the subscribe and unsubscribe operations
+	opMutex sync.Mutex
+	// closed when the connection is disconnected after the last client is detached, guarded by the pool lock
+	closing chan struct{}
+}
+
+func (s *connectionSingleton) subscribe(id int, topic string, qos byte, handler MessageHandler) error {
+	s.opMutex.Lock()
+	defer s.opMutex.Unlock()
+	s.Lock()
+	hs, ok := s.subs[topic]
+	if ok {
+		hs[id] = handler
+		s.Unlock()
+		return nil
+	}
+	s.subs[topic] = map[int]MessageHandler{id: handler}
+	s.Unlock()
+	// do not hold the lock when waiting for the ack because the dispatching needs it
+	err := s.cli.Subscribe(topic, qos, func(msg *Message) {
+		s.RLock()
+		handlers := make([]MessageHandler, 0, len(s.subs[topic]))
+		for _, h := range s.subs[topic] {
+			handlers = append(handlers, h)
+		}
+		s.RUnlock()
+		for _, h := range handlers {
+			h(msg)
+		}
+	})
+	if err != nil {
+		s.Lock()
+		delete(s.subs, topic)
+		s.Unlock()
+	}
+	return err
+}
+
+func (s *connectionSingleton) unsubscribe(id int, topic string) error {
+	s.opMutex.Lock()
+	defer s.opMutex.Unlock()
+	s.Lock()
+	hs, ok := s.subs[topic]
+	if !ok {
+		s.Unlock()
+		return nil
+	}
+	delete(hs, id)
+	last := len(hs) == 0
+	if last {
+		delete(s.subs, topic)
+	}
+	s.Unlock()
+	if last {
+		return s.cli.Unsubscribe(topic)
+	}
+	return nil
+}
+
+func (s *connectionSingleton) unsubscribeAll(id int) {
+	s.RLock()
+	var topics []string
+	for topic, hs := range s.subs {
+		if _, ok := hs[id]; ok {
+			topics = append(topics, topic)
+		}
+	}
+	s.RUnlock()
+	for _, topic := range topics {
+		if err := s.unsubscribe(id, topic); err != nil {
+			conf.Log.Warnf("Fail to unsubscribe topic %s of connection: %v", topic, err)
+		}
+	}
+}
+
+// sharedClient is the client attached to a shared connection
+type sharedClient struct {
+	selector string
+	id       int
+	conn     *connectionSingleton
+}
+
+func (c *sharedClient) Subscribe(topic string, qos byte, handler MessageHandler) error {
+	return c.conn.subscribe(c.id, topic, qos, handler)
+}
+
+func (c *sharedClient) Unsubscribe(topic string) error {
+	return c.conn.unsubscribe(c.id, topic)
+}
+
+func (c *sharedClient) Publish(topic string, payload []byte, opts *PublishOptions) error {
+	return c.conn.cli.Publish(topic, payload, opts)
+}
+
+func (c *sharedClient) Disconnect() {
+	connPool.detach(c)
+}
@@ -0,0 +1,180 @@
+package mqttx
+
+import (
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockClient struct {
+	conf      *ClientConf
+	subs      map[string]MessageHandler
+	published []string
+	closed    bool
+	// if set, Disconnect closes disconnecting and blocks until block is closed
+	disconnecting chan struct{}
+	block         chan struct{}
+	sync.Mutex
+}
+
+func (m *mockClient) Subscribe(topic string, _ byte, handler MessageHandler) error {
+	m.Lock()
+	defer m.Unlock()
+	m.subs[topic] = handler
+	return nil
+}
+
+func (m *mockClient) Unsubscribe(topic string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.subs, topic)
+	return nil
+}
+
+func (m *mockClient) Publish(topic string, payload []byte, _ *PublishOptions) error {
+	m.Lock()
+	defer m.Unlock()
+	m.published = append(m.published, topic+":"+string(payload))
+	return nil
+}
+
+func (m *mockClient) Disconnect() {
+	if m.block != nil {
+		close(m.disconnecting)
+		<-m.block
+	}
+	m.closed = true
+}
+
+func (m *mockClient) receive(topic string, payload string) {
+	m.Lock()
+	var handlers []MessageHandler
+	for t, h := range m.subs {
+		if MatchTopic(t, topic) {
+			handlers = append(handlers, h)
+		}
+	}
+	m.Unlock()
+	for _, h := range handlers {
+		h(&Message{Topic: topic, Payload: []byte(payload)})
+	}
+}
+
+func TestConnectionPool(t *testing.T) {
+	var clients []*mockClient
+	newConnectionClient = func(_ api.StreamContext, c *ClientConf) (Client, error) {
+		m := &mockClient{conf: c, subs: make(map[string]MessageHandler)}
+		clients = append(clients, m)
+		return m, nil
+	}
+	defer func() {
+		newConnectionClient = NewClient
+	}()
+
+	if _, err := AttachConnection("mqtt.notExist"); err == nil || err.Error() != "connection mqtt.notExist is not found in connections/connection.yaml" {
+		t.Errorf("attach not exist connection error mismatch, got %v", err)
+	}
+	if _, err := AttachConnection("localConnection"); err == nil || err.Error() != "invalid connectionSelector localConnection, it must be like mqtt.{connectionName}" {
+		t.Errorf("attach invalid connection error mismatch, got %v", err)
+	}
+
+	c1, err := AttachConnection("mqtt.localConnection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := AttachConnection("mqtt.localConnection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c3, err := AttachConnection("mqtt.localConnection")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clients) != 1 {
+		t.Fatalf("expect 1 shared connection but got %d", len(clients))
+	}
+	m := clients[0]
+	if m.conf.Server != "tcp://127.0.0.1:1883" || m.conf.ClientId == "" {
+		t.Errorf("connection conf mismatch, got %+v", m.conf)
+	}
+
+	var (
+		received []string
+		mu       sync.Mutex
+	)
+	handler := func(name string) MessageHandler {
+		return func(msg *Message) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, name+":"+string(msg.Payload))
+		}
+	}
+	_ = c1.Subscribe("demo", 0, handler("c1"))
+	_ = c2.Subscribe("demo", 0, handler("c2"))
+	_ = c2.Subscribe("devices/+", 0, handler("c2"))
+	m.receive("demo", "a")
+	m.receive("devices/d1", "b")
+	sort.Strings(received)
+	exp := []string{"c1:a", "c2:a", "c2:b"}
+	if !reflect.DeepEqual(exp, received) {
+		t.Errorf("received mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, received)
+	}
+
+	_ = c3.Publish("result", []byte("c"), &PublishOptions{})
+	if !reflect.DeepEqual([]string{"result:c"}, m.published) {
+		t.Errorf("published mismatch, got %v", m.published)
+	}
+
+	// detach c2 and its subscriptions are removed
+	c2.Disconnect()
+	if _, ok := m.subs["devices/+"]; ok {
+		t.Errorf("topic devices/+ should be unsubscribed after c2 detached")
+	}
+	received = nil
+	m.receive("demo", "d")
+	if !reflect.DeepEqual([]string{"c1:d"}, received) {
+		t.Errorf("received mismatch after c2 detached, got %v", received)
+	}
+
+	c1.Disconnect()
+	if m.closed {
+		t.Errorf("connection should not be closed before all clients are detached")
+	}
+	c3.Disconnect()
+	if !m.closed {
+		t.Errorf("connection should be closed after all clients are detached")
+	}
+	c4, err := AttachConnection("mqtt.localConnection")
+	if err != nil || len(clients) != 2 {
+		t.Fatalf("should create a new connection after closed, got %v", err)
+	}
+
+	// attach waits until the closing connection is disconnected
+	m = clients[1]
+	m.disconnecting, m.block = make(chan struct{}), make(chan struct{})
+	go c4.Disconnect()
+	<-m.disconnecting
+	attached := make(chan Client)
+	go func() {
+		c, _ := AttachConnection("mqtt.localConnection")
+		attached <- c
+	}()
+	select {
+	case <-attached:
+		t.Fatal("attach should wait for the closing connection")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(m.block)
+	select {
+	case c5 := <-attached:
+		if !m.closed || len(clients) != 3 {
+			t.Errorf("should create a new connection after the closing one is disconnected")
+		}
+		c5.Disconnect()
+	case <-time.After(time.Second):
+		t.Fatal("attach is not resumed after the connection is disconnected")
+	}
+}
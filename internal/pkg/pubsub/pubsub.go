@@ -0,0 +1,107 @@
+// Package pubsub is the in-process message bus to pass the results of a rule to the streams of other rules without
+// serialization.
+package pubsub
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/pkg/mqttx"
+	"strings"
+	"sync"
+)
+
+// Message is a message published to a topic
+type Message struct {
+	Topic string
+	Data  map[string]interface{}
+}
+
+// Subscriber receives the messages of the topics which match its topic filter. The topic filter supports the MQTT
+// wildcards + and #.
+type Subscriber struct {
+	filter string
+	ch     chan *Message
+	done   chan struct{}
+	once   sync.Once
+}
+
+// C returns the channel to receive the messages
+func (s *Subscriber) C() <-chan *Message {
+	return s.ch
+}
+
+var (
+	subscribers = make(map[*Subscriber]bool)
+	mutex       sync.RWMutex
+)
+
+// Subscribe registers a subscriber of the topic filter. The messages are buffered up to the bufferLength, and the
+// publisher blocks when the buffer is full.
+func Subscribe(filter string, bufferLength int) (*Subscriber, error) {
+	if err := ValidateTopic(filter, true); err != nil {
+		return nil, err
+	}
+	s := &Subscriber{
+		filter: filter,
+		ch:     make(chan *Message, bufferLength),
+		done:   make(chan struct{}),
+	}
+	mutex.Lock()
+	subscribers[s] = true
+	mutex.Unlock()
+	return s, nil
+}
+
+// Unsubscribe removes the subscriber. The pending publishing to it is canceled.
+func Unsubscribe(s *Subscriber) {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	mutex.Lock()
+	delete(subscribers, s)
+	mutex.Unlock()
+}
+
+// Publish sends the data to all the subscribers whose topic filter matches the topic. Each subscriber receives a
+// shallow copy of the data. The matched subscribers are sent after releasing the lock so that a blocked subscriber
+// does not block the others to subscribe or unsubscribe.
+func Publish(topic string, data map[string]interface{}) {
+	var matched []*Subscriber
+	mutex.RLock()
+	for s := range subscribers {
+		if mqttx.MatchTopic(s.filter, topic) {
+			matched = append(matched, s)
+		}
+	}
+	mutex.RUnlock()
+	for _, s := range matched {
+		m := make(map[string]interface{}, len(data))
+		for k, v := range data {
+			m[k] = v
+		}
+		select {
+		case s.ch <- &Message{Topic: topic, Data: m}:
+		case <-s.done:
+		}
+	}
+}
+
+// ValidateTopic checks the topic. The wildcards are only allowed in the topic filter of subscribers, + must occupy
+// a whole level and # must be the last level.
+func ValidateTopic(topic string, wildcard bool) error {
+	if topic == "" {
+		return fmt.Errorf("topic must not be empty")
+	}
+	levels := strings.Split(topic, "/")
+	for i, l := range levels {
+		if !strings.ContainsAny(l, "+#") {
+			continue
+		}
+		if !wildcard {
+			return fmt.Errorf("invalid topic %s, wildcards are not allowed", topic)
+		}
+		if (l != "+" && l != "#") || (l == "#" && i != len(levels)-1) {
+			return fmt.Errorf("invalid topic filter %s", topic)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPubSub(t *testing.T) {
+	var tests = []struct {
+		filter string
+		exp    []string
+	}{
+		{filter: "a/b", exp: []string{"a/b"}},
+		{filter: "a/+", exp: []string{"a/b", "a/c"}},
+		{filter: "#", exp: []string{"a/b", "a/c", "a/b/c", "d"}},
+		{filter: "a/#", exp: []string{"a/b", "a/c", "a/b/c"}},
+	}
+	subs := make([]*Subscriber, len(tests))
+	for i, tt := range tests {
+		s, err := Subscribe(tt.filter, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		subs[i] = s
+	}
+	for _, topic := range []string{"a/b", "a/c", "a/b/c", "d"} {
+		Publish(topic, map[string]interface{}{"topic": topic})
+	}
+	for i, tt := range tests {
+		var got []string
+	loop:
+		for {
+			select {
+			case m := <-subs[i].C():
+				if m.Data["topic"] != m.Topic {
+					t.Errorf("%d \tdata mismatch %v", i, m)
+				}
+				got = append(got, m.Topic)
+			case <-time.After(10 * time.Millisecond):
+				break loop
+			}
+		}
+		if !reflect.DeepEqual(tt.exp, got) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.exp, got)
+		}
+		Unsubscribe(subs[i])
+	}
+}
+
+func TestPublishBlocked(t *testing.T) {
+	s, err := Subscribe("a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Publish("a", map[string]interface{}{"a": 1})
+	done := make(chan struct{})
+	go func() {
+		// blocked until unsubscribed because the buffer is full
+		Publish("a", map[string]interface{}{"a": 2})
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("publish should be blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	// the blocked publishing does not block the other subscribers
+	subscribed := make(chan *Subscriber)
+	go func() {
+		other, _ := Subscribe("b", 1)
+		subscribed <- other
+	}()
+	select {
+	case other := <-subscribed:
+		Unsubscribe(other)
+	case <-time.After(time.Second):
+		t.Fatal("subscribe is blocked by the publishing")
+	}
+	Unsubscribe(s)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish is not canceled after unsubscribe")
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	var tests = []struct {
+		topic    string
+		wildcard bool
+		err      bool
+	}{
+		{topic: "a/b", wildcard: false},
+		{topic: "a/+/c", wildcard: true},
+		{topic: "a/#", wildcard: true},
+		{topic: "a/#", wildcard: false, err: true},
+		{topic: "a/#/c", wildcard: true, err: true},
+		{topic: "a/b+", wildcard: true, err: true},
+		{topic: "", wildcard: true, err: true},
+	}
+	for i, tt := range tests {
+		if err := ValidateTopic(tt.topic, tt.wildcard); tt.err != (err != nil) {
+			t.Errorf("%d \terror mismatch: %v", i, err)
+		}
+	}
+}
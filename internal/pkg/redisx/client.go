@@ -0,0 +1,37 @@
+// Package redisx holds the common configuration of the redis source and sink.
+package redisx
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/go-redis/redis/v7"
+)
+
+// ClientConf is the connection configuration shared by the redis source and sink
+type ClientConf struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+	Db       int    `json:"db"`
+	// Connect with TLS without the client certification
+	Tls                bool `json:"tls"`
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+// NewClient validates the connection configuration and creates the client. The connections are established lazily.
+func NewClient(c *ClientConf) (*redis.Client, error) {
+	if c.Addr == "" {
+		return nil, fmt.Errorf("missing property addr")
+	}
+	if c.Db < 0 {
+		return nil, fmt.Errorf("invalid db %d", c.Db)
+	}
+	opts := &redis.Options{
+		Addr:     c.Addr,
+		Password: c.Password,
+		DB:       c.Db,
+	}
+	if c.Tls {
+		opts.TLSConfig = &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	}
+	return redis.NewClient(opts), nil
+}
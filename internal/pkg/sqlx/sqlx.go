@@ -0,0 +1,228 @@
+// Package sqlx holds the common database/sql helpers of the sql source and sink. Any database/sql driver can be used
+// once it is registered, the dialect only decides the placeholder, quoting, upsert syntax and the column types.
+package sqlx
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"sort"
+	"strings"
+)
+
+// ClientConf is the connection configuration shared by the sql source and sink
+type ClientConf struct {
+	// The database/sql driver name such as sqlite3
+	Driver string `json:"driver"`
+	// The driver specific data source name
+	Dsn string `json:"dsn"`
+}
+
+// Open validates the configuration and opens the database
+func Open(c *ClientConf) (*sql.DB, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(c.Driver, c.Dsn)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open %s database: %v", c.Driver, err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("fail to connect %s database: %v", c.Driver, err)
+	}
+	return db, nil
+}
+
+func (c *ClientConf) Validate() error {
+	if c.Driver == "" {
+		return fmt.Errorf("missing property driver")
+	}
+	if c.Dsn == "" {
+		return fmt.Errorf("missing property dsn")
+	}
+	drivers := sql.Drivers()
+	i := sort.SearchStrings(drivers, c.Driver)
+	if i == len(drivers) || drivers[i] != c.Driver {
+		return fmt.Errorf("sql driver %s is not registered, available drivers are %s", c.Driver, strings.Join(drivers, ", "))
+	}
+	return nil
+}
+
+// Dialect is the syntax differences of the databases
+type Dialect interface {
+	// Placeholder returns the placeholder of the ith (from 1) parameter
+	Placeholder(i int) string
+	// Quote quotes the identifier such as the table or column name
+	Quote(ident string) string
+	// Upsert returns the clause appended to the insert statement to update the columns on the conflict of the keys
+	Upsert(keys []string, cols []string) string
+	// ColumnType returns the column type of a go value for creating table
+	ColumnType(v interface{}, key bool) string
+}
+
+// GetDialect returns the dialect of the driver. The drivers which are not known use the sqlite dialect which follows
+// the sql standard mostly.
+func GetDialect(driver string) Dialect {
+	switch driver {
+	case "postgres", "pgx":
+		return postgresDialect{}
+	case "mysql":
+		return mysqlDialect{}
+	default:
+		return sqliteDialect{}
+	}
+}
+
+// QuoteTable quotes each part of the table name which may include the schema
+func QuoteTable(d Dialect, table string) string {
+	parts := strings.Split(table, ".")
+	for i, p := range parts {
+		parts[i] = d.Quote(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Placeholder(_ int) string {
+	return "?"
+}
+
+func (sqliteDialect) Quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+func (d sqliteDialect) Upsert(keys []string, cols []string) string {
+	return standardUpsert(d, keys, cols)
+}
+
+func (sqliteDialect) ColumnType(v interface{}, _ bool) string {
+	switch v.(type) {
+	case int, int64, int32:
+		return "INTEGER"
+	case float64, float32:
+		return "REAL"
+	case bool:
+		return "BOOLEAN"
+	default:
+		return "TEXT"
+	}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Placeholder(i int) string {
+	return fmt.Sprintf("$%d", i)
+}
+
+func (postgresDialect) Quote(ident string) string {
+	return `"` + strings.ReplaceAll(ident, `"`, `""`) + `"`
+}
+
+func (d postgresDialect) Upsert(keys []string, cols []string) string {
+	return standardUpsert(d, keys, cols)
+}
+
+func (postgresDialect) ColumnType(v interface{}, _ bool) string {
+	switch v.(type) {
+	case int, int64, int32:
+		return "BIGINT"
+	case float64, float32:
+		return "DOUBLE PRECISION"
+	case bool:
+		return "BOOLEAN"
+	default:
+		return "TEXT"
+	}
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Placeholder(_ int) string {
+	return "?"
+}
+
+func (mysqlDialect) Quote(ident string) string {
+	return "`" + strings.ReplaceAll(ident, "`", "``") + "`"
+}
+
+func (d mysqlDialect) Upsert(_ []string, cols []string) string {
+	sets := make([]string, len(cols))
+	for i, c := range cols {
+		sets[i] = fmt.Sprintf("%s=VALUES(%s)", d.Quote(c), d.Quote(c))
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+func (mysqlDialect) ColumnType(v interface{}, key bool) string {
+	switch v.(type) {
+	case int, int64, int32:
+		return "BIGINT"
+	case float64, float32:
+		return "DOUBLE"
+	case bool:
+		return "BOOLEAN"
+	default:
+		// TEXT column cannot be the primary key without the prefix length
+		if key {
+			return "VARCHAR(255)"
+		}
+		return "TEXT"
+	}
+}
+
+func standardUpsert(d Dialect, keys []string, cols []string) string {
+	qk := make([]string, len(keys))
+	for i, k := range keys {
+		qk[i] = d.Quote(k)
+	}
+	var sets []string
+	for _, c := range cols {
+		if !contains(keys, c) {
+			sets = append(sets, fmt.Sprintf("%s=excluded.%s", d.Quote(c), d.Quote(c)))
+		}
+	}
+	if len(sets) == 0 {
+		return fmt.Sprintf(" ON CONFLICT(%s) DO NOTHING", strings.Join(qk, ","))
+	}
+	return fmt.Sprintf(" ON CONFLICT(%s) DO UPDATE SET %s", strings.Join(qk, ","), strings.Join(sets, ","))
+}
+
+func contains(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ScanRows reads all the rows into maps of the column names. The bytes values are converted to strings.
+func ScanRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if b, ok := values[i].([]byte); ok {
+				m[c] = string(b)
+			} else {
+				m[c] = values[i]
+			}
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
@@ -3,6 +3,9 @@ package plugin
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -15,6 +18,15 @@ var (
 )
 
 func TestGetSourceMeta(t *testing.T) {
+	// save the changed configuration into a temp conf dir instead of etc
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "etc", "sources"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	oldBase := os.Getenv(conf.KuiperBaseKey)
+	os.Setenv(conf.KuiperBaseKey, base)
+	defer os.Setenv(conf.KuiperBaseKey, oldBase)
+
 	source := new(sourceProperty)
 	var cf map[string]map[string]interface{}
 	if err := json.Unmarshal([]byte(gCf), &cf); nil != err {
@@ -10,11 +10,12 @@ import (
 	"github.com/lf-edge/ekuiper/internal/topo/planner"
 	"github.com/lf-edge/ekuiper/internal/xsql"
 	"github.com/lf-edge/ekuiper/pkg/api"
-	"github.com/lf-edge/ekuiper/pkg/cast"
 	"github.com/lf-edge/ekuiper/pkg/errorx"
 	"github.com/lf-edge/ekuiper/pkg/kv"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 )
 
 type RuleProcessor struct {
@@ -35,6 +36,9 @@ func (p *RuleProcessor) ExecCreate(name, ruleJson string) (*api.Rule, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := validateRuleId(rule.Id); err != nil {
+		return nil, err
+	}
 
 	err = p.db.Open()
 	if err != nil {
@@ -56,6 +60,9 @@ func (p *RuleProcessor) ExecUpdate(name, ruleJson string) (*api.Rule, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := validateRuleId(rule.Id); err != nil {
+		return nil, err
+	}
 
 	err = p.db.Open()
 	if err != nil {
@@ -255,9 +262,31 @@ func (p *RuleProcessor) ExecDrop(name string) (string, error) {
 	}
 }
 
+// validateRuleId checks the rule id of the created or updated rule which is used as the directory name of the rule
+// data. The rules saved by the previous versions are not validated so that they can still be loaded.
+func validateRuleId(id string) error {
+	if strings.ContainsAny(id, `/\`) || strings.Contains(id, "..") || id == "." {
+		return fmt.Errorf("Invalid rule id %s, it must not contain path separators or '..'.", id)
+	}
+	return nil
+}
+
+// ruleDataDir returns the directory of the rule data under dir. It fails if the rule id, which may be saved by the
+// previous versions without validation, points to dir itself or outside of it.
+func ruleDataDir(dir, id string) (string, error) {
+	c := filepath.Join(dir, id)
+	if rel, err := filepath.Rel(dir, c); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid rule data directory %s", c)
+	}
+	return c, nil
+}
+
 func cleanCheckpoint(name string) error {
 	dbDir, _ := conf.GetDataLoc()
-	c := path.Join(dbDir, name)
+	c, err := ruleDataDir(dbDir, name)
+	if err != nil {
+		return err
+	}
 	return os.RemoveAll(c)
 }
 
@@ -266,27 +295,10 @@ func cleanSinkCache(rule *api.Rule) error {
 	if err != nil {
 		return err
 	}
-	store := kv.GetDefaultKVStore(path.Join(dbDir, "sink"))
-	err = store.Open()
+	c, err := ruleDataDir(path.Join(dbDir, "sink"), rule.Id)
 	if err != nil {
 		return err
 	}
-	defer store.Close()
-	for d, m := range rule.Actions {
-		con := 1
-		for name, action := range m {
-			props, _ := action.(map[string]interface{})
-			if c, ok := props["concurrency"]; ok {
-				if t, err := cast.ToInt(c, cast.STRICT); err == nil && t > 0 {
-					con = t
-				}
-			}
-			for i := 0; i < con; i++ {
-				key := fmt.Sprintf("%s%s_%d%d", rule.Id, name, d, i)
-				conf.Log.Debugf("delete cache key %s", key)
-				store.Delete(key)
-			}
-		}
-	}
-	return nil
+	conf.Log.Debugf("delete sink cache %s", c)
+	return os.RemoveAll(c)
 }
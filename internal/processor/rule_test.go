@@ -140,3 +140,33 @@ func TestRuleActionParse_Apply(t *testing.T) {
 	}
 
 }
+
+func TestRuleIdValidation(t *testing.T) {
+	var tests = []struct {
+		id  string
+		ok  bool
+		dir bool
+	}{
+		{id: "rule1", ok: true, dir: true},
+		{id: "rule.1", ok: true, dir: true},
+		{id: "../rule1", ok: false, dir: false},
+		{id: "..", ok: false, dir: false},
+		{id: "a/b", ok: false, dir: true},
+		{id: "a/../..", ok: false, dir: false},
+		{id: `a\b`, ok: false, dir: true},
+	}
+	p := NewRuleProcessor(DbDir)
+	for i, tt := range tests {
+		err := validateRuleId(tt.id)
+		if tt.ok != (err == nil) {
+			t.Errorf("%d: rule id %s expect valid %v but got error %v", i, tt.id, tt.ok, err)
+		}
+		// the saved rules are loaded without the id validation
+		if _, err := p.getRuleByJson(tt.id, `{"sql": "SELECT * from demo", "actions": [{"log": {}}]}`); err != nil {
+			t.Errorf("%d: rule id %s expect to load but got error %v", i, tt.id, err)
+		}
+		if _, err := ruleDataDir("data", tt.id); tt.dir != (err == nil) {
+			t.Errorf("%d: rule id %s expect valid data directory %v but got error %v", i, tt.id, tt.dir, err)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package processor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// InferResult is the inferred schema of the sampled messages and the statement to create the stream
+type InferResult struct {
+	Fields   ast.StreamFields `json:"fields"`
+	Sql      string           `json:"sql"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// InferSchema infers the stream fields by the sampled messages. The fields are sorted by name. The types of the same
+// field in all the messages are merged: bigint and float are merged to float; for other conflicts, the first type is
+// kept with a warning.
+func InferSchema(name string, st ast.StreamType, opts *ast.Options, samples []map[string]interface{}) (*InferResult, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing %s name", ast.StreamTypeMap[st])
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("no sample message to infer the schema")
+	}
+	var warnings []string
+	root := &fieldSchema{t: ast.STRUCT}
+	for _, m := range samples {
+		root.merge("", m, &warnings)
+	}
+	fields := root.streamFields("", &warnings)
+	if opts == nil {
+		opts = &ast.Options{}
+	}
+	return &InferResult{
+		Fields:   fields,
+		Sql:      printStreamStmt(name, st, fields, opts),
+		Warnings: warnings,
+	}, nil
+}
+
+// fieldSchema is the merged type of the values of a field
+type fieldSchema struct {
+	// UNKNOWN if all the values are null
+	t ast.DataType
+	// the fields of struct
+	fields map[string]*fieldSchema
+	// the element of array
+	elem *fieldSchema
+}
+
+func (s *fieldSchema) child(k string) *fieldSchema {
+	if s.fields == nil {
+		s.fields = make(map[string]*fieldSchema)
+	}
+	c, ok := s.fields[k]
+	if !ok {
+		c = &fieldSchema{}
+		s.fields[k] = c
+	}
+	return c
+}
+
+func (s *fieldSchema) merge(name string, v interface{}, warnings *[]string) {
+	if v == nil {
+		return
+	}
+	t := valueType(v)
+	if t == ast.UNKNOWN {
+		*warnings = append(*warnings, fmt.Sprintf("field %s has unsupported value %v of type %T, ignored", name, v, v))
+		return
+	}
+	switch {
+	case s.t == ast.UNKNOWN:
+		s.t = t
+	case s.t == t:
+	case (s.t == ast.BIGINT && t == ast.FLOAT) || (s.t == ast.FLOAT && t == ast.BIGINT):
+		s.t = ast.FLOAT
+		return
+	default:
+		*warnings = append(*warnings, fmt.Sprintf("field %s has conflicting types %s and %s, use %s", name, s.t, t, s.t))
+		return
+	}
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		// merge in order so that the warnings are stable
+		keys := make([]string, 0, len(vt))
+		for k := range vt {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			cn := k
+			if name != "" {
+				cn = name + "." + k
+			}
+			s.child(k).merge(cn, vt[k], warnings)
+		}
+	case []interface{}:
+		if s.elem == nil {
+			s.elem = &fieldSchema{}
+		}
+		for _, ev := range vt {
+			s.elem.merge(name+"[]", ev, warnings)
+		}
+	case []map[string]interface{}:
+		if s.elem == nil {
+			s.elem = &fieldSchema{}
+		}
+		for _, ev := range vt {
+			s.elem.merge(name+"[]", ev, warnings)
+		}
+	}
+}
+
+func valueType(v interface{}) ast.DataType {
+	switch vt := v.(type) {
+	case bool:
+		return ast.BOOLEAN
+	case string:
+		return ast.STRINGS
+	case []byte:
+		return ast.BYTEA
+	case time.Time:
+		return ast.DATETIME
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return ast.BIGINT
+	case float32:
+		return numberType(float64(vt))
+	case float64:
+		return numberType(vt)
+	case json.Number:
+		if _, err := vt.Int64(); err == nil {
+			return ast.BIGINT
+		}
+		return ast.FLOAT
+	case map[string]interface{}:
+		return ast.STRUCT
+	case []interface{}, []map[string]interface{}:
+		return ast.ARRAY
+	default:
+		return ast.UNKNOWN
+	}
+}
+
+// numberType returns bigint for the integral numbers because the json numbers are decoded as float
+func numberType(f float64) ast.DataType {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return ast.BIGINT
+	}
+	return ast.FLOAT
+}
+
+// fieldType returns nil if the field type cannot be defined in the stream
+func (s *fieldSchema) fieldType(name string, warnings *[]string) ast.FieldType {
+	switch s.t {
+	case ast.UNKNOWN:
+		*warnings = append(*warnings, fmt.Sprintf("field %s only has null values, use string", name))
+		return &ast.BasicType{Type: ast.STRINGS}
+	case ast.STRUCT:
+		fields := s.streamFields(name+".", warnings)
+		if len(fields) == 0 {
+			*warnings = append(*warnings, fmt.Sprintf("field %s is an empty struct, ignored", name))
+			return nil
+		}
+		return &ast.RecType{StreamFields: fields}
+	case ast.ARRAY:
+		if s.elem == nil || s.elem.t == ast.UNKNOWN {
+			*warnings = append(*warnings, fmt.Sprintf("field %s only has empty arrays or null elements, use array(string)", name))
+			return &ast.ArrayType{Type: ast.STRINGS}
+		}
+		switch s.elem.t {
+		case ast.ARRAY:
+			*warnings = append(*warnings, fmt.Sprintf("field %s is a nested array which is not supported, ignored", name))
+			return nil
+		case ast.STRUCT:
+			ft := s.elem.fieldType(name+"[]", warnings)
+			if ft == nil {
+				return nil
+			}
+			return &ast.ArrayType{Type: ast.STRUCT, FieldType: ft}
+		default:
+			return &ast.ArrayType{Type: s.elem.t}
+		}
+	default:
+		return &ast.BasicType{Type: s.t}
+	}
+}
+
+func (s *fieldSchema) streamFields(prefix string, warnings *[]string) ast.StreamFields {
+	names := make([]string, 0, len(s.fields))
+	for k := range s.fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	fields := make(ast.StreamFields, 0, len(names))
+	for _, k := range names {
+		if ft := s.fields[k].fieldType(prefix+k, warnings); ft != nil {
+			fields = append(fields, ast.StreamField{Name: k, FieldType: ft})
+		}
+	}
+	return fields
+}
+
+func printStreamStmt(name string, st ast.StreamType, fields ast.StreamFields, opts *ast.Options) string {
+	var buff bytes.Buffer
+	buff.WriteString(fmt.Sprintf("CREATE %s %s (\n", strings.ToUpper(ast.StreamTypeMap[st]), printIdent(name)))
+	for i, f := range fields {
+		buff.WriteString("\t" + printIdent(f.Name) + " " + printStreamFieldType(f.FieldType))
+		if i < len(fields)-1 {
+			buff.WriteString(",")
+		}
+		buff.WriteString("\n")
+	}
+	format := opts.FORMAT
+	if format == "" {
+		format = "JSON"
+	}
+	buff.WriteString(fmt.Sprintf(`) WITH (DATASOURCE="%s", FORMAT="%s"`, opts.DATASOURCE, format))
+	if opts.TYPE != "" {
+		buff.WriteString(fmt.Sprintf(`, TYPE="%s"`, opts.TYPE))
+	}
+	if opts.CONF_KEY != "" {
+		buff.WriteString(fmt.Sprintf(`, CONF_KEY="%s"`, opts.CONF_KEY))
+	}
+	if opts.KEY != "" {
+		buff.WriteString(fmt.Sprintf(`, KEY="%s"`, opts.KEY))
+	}
+	if opts.TIMESTAMP != "" {
+		buff.WriteString(fmt.Sprintf(`, TIMESTAMP="%s"`, opts.TIMESTAMP))
+	}
+	if opts.TIMESTAMP_FORMAT != "" {
+		buff.WriteString(fmt.Sprintf(`, TIMESTAMP_FORMAT="%s"`, opts.TIMESTAMP_FORMAT))
+	}
+	if opts.STRICT_VALIDATION {
+		buff.WriteString(`, STRICT_VALIDATION="true"`)
+	}
+	if opts.RETAIN_SIZE != 0 {
+		buff.WriteString(fmt.Sprintf(`, RETAIN_SIZE="%d"`, opts.RETAIN_SIZE))
+	}
+	if opts.SHARED {
+		buff.WriteString(`, SHARED="true"`)
+	}
+	buff.WriteString(");")
+	return buff.String()
+}
+
+func printStreamFieldType(ft ast.FieldType) string {
+	switch t := ft.(type) {
+	case *ast.BasicType:
+		return strings.ToUpper(t.Type.String())
+	case *ast.ArrayType:
+		if t.FieldType != nil {
+			return "ARRAY(" + printStreamFieldType(t.FieldType) + ")"
+		}
+		return "ARRAY(" + strings.ToUpper(t.Type.String()) + ")"
+	case *ast.RecType:
+		fs := make([]string, len(t.StreamFields))
+		for i, f := range t.StreamFields {
+			fs[i] = printIdent(f.Name) + " " + printStreamFieldType(f.FieldType)
+		}
+		return "STRUCT(" + strings.Join(fs, ", ") + ")"
+	}
+	return ""
+}
+
+// printIdent quotes the name by backquotes if it is not a plain identifier such as a keyword
+func printIdent(name string) string {
+	s := xsql.NewScanner(strings.NewReader(name))
+	if tok, lit := s.Scan(); tok == ast.IDENT && lit == name {
+		if tok, _ := s.Scan(); tok == ast.EOF {
+			return name
+		}
+	}
+	return "`" + name + "`"
+}
@@ -0,0 +1,114 @@
+package processor
+
+import (
+	"encoding/json"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	var tests = []struct {
+		name     string
+		st       ast.StreamType
+		opts     *ast.Options
+		samples  []map[string]interface{}
+		sql      string
+		warnings []string
+		err      string
+	}{
+		{
+			name: "demo",
+			st:   ast.TypeStream,
+			opts: &ast.Options{DATASOURCE: "devices/+", TYPE: "mqtt", CONF_KEY: "demo_conf", TIMESTAMP: "ts"},
+			samples: []map[string]interface{}{
+				{
+					"id":     1.0,
+					"temp":   25.0,
+					"ts":     json.Number("1634544000000"),
+					"name":   "d1",
+					"on":     true,
+					"tags":   []interface{}{"a", "b"},
+					"from":   "select",
+					"extra":  nil,
+					"info":   map[string]interface{}{"model": "x", "size": map[string]interface{}{"w": 1.5}},
+					"points": []interface{}{map[string]interface{}{"x": 1.0}, map[string]interface{}{"y": 2.5}},
+				},
+				{
+					"id":   2.0,
+					"temp": 25.5,
+					"name": 3.0,
+					"tags": []interface{}{},
+					"grid": []interface{}{[]interface{}{1.0}},
+					"meta": map[string]interface{}{},
+				},
+			},
+			sql: "CREATE STREAM demo (\n" +
+				"\textra STRING,\n" +
+				"\t`from` STRING,\n" +
+				"\tid BIGINT,\n" +
+				"\tinfo STRUCT(model STRING, size STRUCT(w FLOAT)),\n" +
+				"\tname STRING,\n" +
+				"\t`on` BOOLEAN,\n" +
+				"\tpoints ARRAY(STRUCT(x BIGINT, y FLOAT)),\n" +
+				"\ttags ARRAY(STRING),\n" +
+				"\ttemp FLOAT,\n" +
+				"\tts BIGINT\n" +
+				`) WITH (DATASOURCE="devices/+", FORMAT="JSON", TYPE="mqtt", CONF_KEY="demo_conf", TIMESTAMP="ts");`,
+			warnings: []string{
+				"field name has conflicting types string and bigint, use string",
+				"field extra only has null values, use string",
+				"field grid is a nested array which is not supported, ignored",
+				"field meta is an empty struct, ignored",
+			},
+		}, {
+			name: "lookup",
+			st:   ast.TypeTable,
+			samples: []map[string]interface{}{
+				{"id": int64(1), "data": []byte("a")},
+			},
+			sql: "CREATE TABLE lookup (\n" +
+				"\tdata BYTEA,\n" +
+				"\tid BIGINT\n" +
+				`) WITH (DATASOURCE="", FORMAT="JSON");`,
+		}, {
+			name: "",
+			st:   ast.TypeStream,
+			err:  "missing stream name",
+		}, {
+			name: "demo",
+			st:   ast.TypeStream,
+			err:  "no sample message to infer the schema",
+		},
+	}
+	for i, tt := range tests {
+		r, err := InferSchema(tt.name, tt.st, tt.opts, tt.samples)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if r.Sql != tt.sql {
+			t.Errorf("%d \tsql mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.sql, r.Sql)
+		}
+		if !reflect.DeepEqual(tt.warnings, r.Warnings) && !(len(tt.warnings) == 0 && len(r.Warnings) == 0) {
+			t.Errorf("%d \twarnings mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.warnings, r.Warnings)
+		}
+		// the statement is valid and has the inferred fields
+		stmt, err := xsql.NewParser(strings.NewReader(r.Sql)).ParseCreateStmt()
+		if err != nil {
+			t.Errorf("%d: parse statement error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(r.Fields, stmt.(*ast.StreamStmt).StreamFields) {
+			t.Errorf("%d \tfields mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, r.Fields, stmt.(*ast.StreamStmt).StreamFields)
+		}
+	}
+}
@@ -9,3 +9,8 @@ type PluginDesc struct {
 	Type int
 	Stop bool
 }
+
+type InferDesc struct {
+	RPCArgDesc
+	StreamType string
+}
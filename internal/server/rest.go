@@ -82,6 +82,7 @@ func createRestServer(ip string, port int) *http.Server {
 	r.HandleFunc("/streams/{name}", streamHandler).Methods(http.MethodGet, http.MethodDelete, http.MethodPut)
 	r.HandleFunc("/tables", tablesHandler).Methods(http.MethodGet, http.MethodPost)
 	r.HandleFunc("/tables/{name}", tableHandler).Methods(http.MethodGet, http.MethodDelete, http.MethodPut)
+	r.HandleFunc("/schemas/infer", inferSchemaHandler).Methods(http.MethodPost)
 	r.HandleFunc("/rules", rulesHandler).Methods(http.MethodGet, http.MethodPost)
 	r.HandleFunc("/rules/{name}", ruleHandler).Methods(http.MethodDelete, http.MethodGet, http.MethodPut)
 	r.HandleFunc("/rules/{name}/status", getStatusRuleHandler).Methods(http.MethodGet)
@@ -240,6 +241,27 @@ func tableHandler(w http.ResponseWriter, r *http.Request) {
 	sourceManageHandler(w, r, ast.TypeTable)
 }
 
+//infer the schema of a stream or table
+func inferSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	d, err := decodeInferDescriptor(body)
+	if err != nil {
+		handleError(w, err, "Invalid body", logger)
+		return
+	}
+	result, err := inferSchema(d)
+	if err != nil {
+		handleError(w, err, "Infer schema error", logger)
+		return
+	}
+	jsonResponse(result, w, logger)
+}
+
 //list or create rules
 func rulesHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
@@ -75,6 +75,24 @@ func (t *Server) Stream(stream string, reply *string) error {
 	return nil
 }
 
+func (t *Server) InferSchema(arg *InferDesc, reply *string) error {
+	d, err := decodeInferDescriptor([]byte(arg.Json))
+	if err != nil {
+		return fmt.Errorf("Infer schema error : %s.", err)
+	}
+	d.Name = arg.Name
+	d.StreamType = arg.StreamType
+	r, err := inferSchema(d)
+	if err != nil {
+		return fmt.Errorf("Infer schema error : %s.", err)
+	}
+	for _, w := range r.Warnings {
+		*reply += fmt.Sprintf("Warning: %s\n", w)
+	}
+	*reply += r.Sql
+	return nil
+}
+
 func (t *Server) CreateRule(rule *RPCArgDesc, reply *string) error {
 	r, err := ruleProcessor.ExecCreate(rule.Name, rule.Json)
 	if err != nil {
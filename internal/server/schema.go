@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/processor"
+	"github.com/lf-edge/ekuiper/internal/topo/node"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSampleCount   = 10
+	defaultSampleTimeout = 10000
+)
+
+// inferDescriptor is the request to infer the stream schema by the pasted payloads or the messages sampled from the
+// source defined by the options
+type inferDescriptor struct {
+	Name       string       `json:"name"`
+	StreamType string       `json:"streamType"`
+	Options    *ast.Options `json:"options"`
+	// The number of messages to sample and the timeout in milliseconds
+	Count    int               `json:"count"`
+	Timeout  int               `json:"timeout"`
+	Payloads []json.RawMessage `json:"payloads"`
+}
+
+func decodeInferDescriptor(body []byte) (*inferDescriptor, error) {
+	d := &inferDescriptor{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return d, nil
+	}
+	if err := json.Unmarshal(body, d); err != nil {
+		return nil, fmt.Errorf("Error decoding the infer descriptor: %v", err)
+	}
+	return d, nil
+}
+
+func inferSchema(d *inferDescriptor) (*processor.InferResult, error) {
+	var st ast.StreamType
+	switch strings.ToLower(d.StreamType) {
+	case "", "stream":
+		st = ast.TypeStream
+	case "table":
+		st = ast.TypeTable
+	default:
+		return nil, fmt.Errorf("invalid streamType %s, must be stream or table", d.StreamType)
+	}
+	if d.Options == nil {
+		d.Options = &ast.Options{}
+	}
+	var samples []map[string]interface{}
+	if len(d.Payloads) > 0 {
+		for i, p := range d.Payloads {
+			var m map[string]interface{}
+			dec := json.NewDecoder(bytes.NewReader(p))
+			dec.UseNumber()
+			if err := dec.Decode(&m); err != nil {
+				return nil, fmt.Errorf("payload %d must be a json object: %v", i, err)
+			}
+			samples = append(samples, m)
+		}
+	} else {
+		if d.Count <= 0 {
+			d.Count = defaultSampleCount
+		}
+		if d.Timeout <= 0 {
+			d.Timeout = defaultSampleTimeout
+		}
+		var err error
+		samples, err = node.SampleSource(st, d.Options, d.Count, time.Duration(d.Timeout)*time.Millisecond)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return processor.InferSchema(d.Name, st, d.Options, samples)
+}
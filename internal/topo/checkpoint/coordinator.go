@@ -254,6 +254,7 @@ func (c *Coordinator) complete(checkpointId int64) {
 		//sink save cache
 		for _, sink := range c.sinkTasks {
 			sink.SaveCache()
+			sink.CommitCheckpoint(checkpointId)
 		}
 		c.completedCheckpoints.add(ccp.(*pendingCheckpoint).finalize())
 		c.pendingCheckpoints.Delete(checkpointId)
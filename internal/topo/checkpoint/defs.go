@@ -23,6 +23,8 @@ type SinkTask interface {
 	NonSourceTask
 
 	SaveCache()
+	// CommitCheckpoint commits the transactions of the sinks when the checkpoint is completed
+	CommitCheckpoint(checkpointId int64)
 }
 
 type BufferOrEvent struct {
@@ -11,9 +11,12 @@ const ExceptionsTotal = "exceptions_total"
 const ProcessLatencyUs = "process_latency_us"
 const LastInvocation = "last_invocation"
 const BufferLength = "buffer_length"
+const DeadLetterTotal = "dead_letter_total"
+const BreakerState = "breaker_state"
 
 var (
 	MetricNames        = []string{RecordsInTotal, RecordsOutTotal, ExceptionsTotal, ProcessLatencyUs, BufferLength, LastInvocation}
+	SinkMetricNames    = []string{RecordsInTotal, RecordsOutTotal, ExceptionsTotal, ProcessLatencyUs, BufferLength, LastInvocation, DeadLetterTotal, BreakerState}
 	prometheuseMetrics *PrometheusMetrics
 	mutex              sync.RWMutex
 )
@@ -0,0 +1,251 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/benbjohnson/clock"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"time"
+)
+
+// sinkBatch accumulates the output data of a sink instance until the number of rows reaches the size or the linger
+// time in milliseconds since the first data is reached. The input tuples are not split, so a batch may have more rows
+// than the size.
+type sinkBatch struct {
+	size   int
+	linger int
+
+	data []*sinkOutput
+	rows int
+	// the cache index of the tuple of each data in the batch, -1 if the cache is disabled
+	indexes []int
+	timer   *clock.Timer
+}
+
+func newSinkBatch(size, linger int) *sinkBatch {
+	if size <= 1 && linger <= 0 {
+		return nil
+	}
+	return &sinkBatch{size: size, linger: linger}
+}
+
+// add adds the output data of a tuple and returns true if the batch is full
+func (b *sinkBatch) add(outdatas []*sinkOutput, index int) bool {
+	if len(outdatas) == 0 {
+		return false
+	}
+	if len(b.data) == 0 && b.linger > 0 {
+		b.timer = conf.GetTimer(b.linger)
+	}
+	for _, d := range outdatas {
+		b.data = append(b.data, d)
+		b.indexes = append(b.indexes, index)
+		if rows, ok := d.rows.([]map[string]interface{}); ok {
+			b.rows += len(rows)
+		} else if d.rows != nil {
+			b.rows++
+		} else {
+			b.rows += countRows(d.data)
+		}
+	}
+	return b.size > 0 && b.rows >= b.size
+}
+
+// lingerC returns the channel of the linger timer, it is nil if the batch is nil or empty
+func (b *sinkBatch) lingerC() <-chan time.Time {
+	if b == nil || b.timer == nil {
+		return nil
+	}
+	return b.timer.C
+}
+
+// lingerFired is called when the linger timer fires so that it won't be stopped again
+func (b *sinkBatch) lingerFired() {
+	b.timer = nil
+}
+
+// take returns the data and their cache indexes in the batch and resets it
+func (b *sinkBatch) take() ([]*sinkOutput, []int) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	data, indexes := b.data, b.indexes
+	b.data, b.indexes, b.rows = nil, nil, 0
+	return data, indexes
+}
+
+func countRows(d []byte) int {
+	t := bytes.TrimSpace(d)
+	if len(t) > 0 && t[0] == '[' {
+		var rows []json.RawMessage
+		if err := json.Unmarshal(t, &rows); err == nil {
+			return len(rows)
+		}
+	}
+	return 1
+}
+
+// mergeBatch merges the json data into one json array. If any data is not json such as the result of dataTemplate,
+// the data are joined by lines.
+func mergeBatch(data [][]byte) []byte {
+	if len(data) == 1 {
+		return data[0]
+	}
+	rows := make([]json.RawMessage, 0, len(data))
+	for _, d := range data {
+		t := bytes.TrimSpace(d)
+		if len(t) > 0 && t[0] == '[' {
+			var r []json.RawMessage
+			if err := json.Unmarshal(t, &r); err == nil {
+				rows = append(rows, r...)
+				continue
+			}
+		} else if len(t) > 0 && t[0] == '{' && json.Valid(t) {
+			rows = append(rows, t)
+			continue
+		}
+		return bytes.Join(data, []byte("\n"))
+	}
+	result, _ := json.Marshal(rows)
+	return result
+}
+
+// mergeOutputs merges the output data of a batch into one. The rows are merged only if all of them are known.
+func mergeOutputs(outs []*sinkOutput) *sinkOutput {
+	if len(outs) == 1 {
+		return outs[0]
+	}
+	data := make([][]byte, len(outs))
+	var rows []map[string]interface{}
+	known, encoded := true, false
+	for i, o := range outs {
+		data[i] = o.data
+		encoded = encoded || o.encoded
+		switch r := o.rows.(type) {
+		case []map[string]interface{}:
+			rows = append(rows, r...)
+		case map[string]interface{}:
+			rows = append(rows, r)
+		default:
+			known = false
+		}
+	}
+	result := &sinkOutput{data: mergeBatch(data), encoded: encoded}
+	if known {
+		result.rows = rows
+	}
+	return result
+}
+
+// collectBatch sends the batch by CollectBatch if supported. Otherwise, the data are merged into one and the dynamic
+// properties are evaluated by the merged rows.
+func collectBatch(sink api.Sink, ctx api.StreamContext, outs []*sinkOutput, props dynamicProps) error {
+	if bs, ok := sink.(api.BatchSink); ok && props == nil {
+		items := make([]interface{}, len(outs))
+		for i, o := range outs {
+			items[i] = o.data
+		}
+		return bs.CollectBatch(ctx, items)
+	}
+	out := mergeOutputs(outs)
+	if props != nil {
+		p, err := props.eval(out.rows)
+		if err != nil {
+			return err
+		}
+		out = &sinkOutput{data: out.data, rows: out.rows, encoded: out.encoded, props: p}
+	}
+	return collectOutput(sink, ctx, out)
+}
+
+// addToBatch converts the input tuple to the output data and adds them to the batch. It returns true if the batch is full.
+// The cached tuple without output data is completed directly.
+func addToBatch(batch *sinkBatch, item interface{}, index int, cache *Cache, stats StatManager, oc *outputConf, ctx api.StreamContext) bool {
+	stats.IncTotalRecordsIn()
+	stats.ProcessTimeStart()
+	defer stats.ProcessTimeEnd()
+	outdatas := getOutData(stats, ctx, item, oc)
+	if len(outdatas) == 0 && index >= 0 {
+		cache.complete(index)
+	}
+	return batch.add(outdatas, index)
+}
+
+// doCollectBatch sends the batch and retries if failed. If succeeded, the cache indexes are signaled as completed.
+func doCollectBatch(sink api.Sink, data []*sinkOutput, indexes []int, props dynamicProps, stats StatManager, policy *retryPolicy, breaker *circuitBreaker, cache *Cache, dl *deadLetter, ctx api.StreamContext) {
+	if len(data) == 0 {
+		return
+	}
+	logger := ctx.GetLogger()
+	retryCount := policy.count
+	attempts := 0
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Infof("sink node %s instance %d stops data resending", ctx.GetOpId(), ctx.GetInstanceId())
+			return
+		default:
+		}
+		if !breaker.allow() {
+			rejectData(ctx, data, distinctIndexes(indexes), cache, dl, stats)
+			return
+		}
+		attempts++
+		if err := collectBatch(sink, ctx, data, props); err != nil {
+			stats.IncTotalExceptions()
+			logger.Warnf("sink node %s instance %d publish batch of %d data error: %v", ctx.GetOpId(), ctx.GetInstanceId(), len(data), err)
+			if breaker.failure() {
+				// reject the data in the next loop
+				continue
+			}
+			if policy.enabled() && retryCount > 0 {
+				retryCount--
+				time.Sleep(policy.delay(attempts))
+				logger.Debugf("try again")
+				continue
+			}
+			// the data kept by the dead letter sink can be removed from the cache, the tuple is failed if any of its data
+			// is not kept
+			failed := make(map[int]bool)
+			for i, d := range data {
+				if dl == nil || !dl.send(ctx, d.data, err, attempts, stats) {
+					failed[indexes[i]] = true
+				}
+			}
+			var complete, fail []int
+			for _, index := range distinctIndexes(indexes) {
+				if failed[index] {
+					fail = append(fail, index)
+				} else {
+					complete = append(complete, index)
+				}
+			}
+			cache.complete(complete...)
+			cache.fail(fail...)
+			return
+		}
+		logger.Debugf("sink node %s instance %d publish batch of %d data", ctx.GetOpId(), ctx.GetInstanceId(), len(data))
+		breaker.success()
+		for range data {
+			stats.IncTotalRecordsOut()
+		}
+		cache.complete(distinctIndexes(indexes)...)
+		return
+	}
+}
+
+// distinctIndexes returns the distinct cache indexes of the batch data in order
+func distinctIndexes(indexes []int) []int {
+	var result []int
+	seen := make(map[int]bool)
+	for _, index := range indexes {
+		if index < 0 || seen[index] {
+			continue
+		}
+		seen[index] = true
+		result = append(result, index)
+	}
+	return result
+}
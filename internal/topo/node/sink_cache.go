@@ -1,16 +1,21 @@
 package node
 
 import (
-	"encoding/gob"
+	"encoding/binary"
 	"fmt"
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
 	"github.com/lf-edge/ekuiper/pkg/api"
-	"github.com/lf-edge/ekuiper/pkg/kv"
-	"io"
 	"path"
 	"sort"
 	"strconv"
+	"time"
+)
+
+const (
+	CACHE_FULL_BLOCK       = "block"
+	CACHE_FULL_DROP_OLDEST = "dropOldest"
+	CACHE_FULL_DROP_NEWEST = "dropNewest"
 )
 
 type CacheTuple struct {
@@ -18,136 +23,195 @@ type CacheTuple struct {
 	data  interface{}
 }
 
-type LinkedQueue struct {
-	Data map[int]interface{}
-	Tail int
-}
-
-func (l *LinkedQueue) append(item interface{}) {
-	l.Data[l.Tail] = item
-	l.Tail++
-}
-
-func (l *LinkedQueue) delete(index int) {
-	delete(l.Data, index)
-}
-
-func (l *LinkedQueue) reset() {
-	l.Tail = 0
-}
-
-func (l *LinkedQueue) length() int {
-	return len(l.Data)
-}
-
-func (l *LinkedQueue) clone() *LinkedQueue {
-	result := &LinkedQueue{
-		Data: make(map[int]interface{}),
-		Tail: l.Tail,
-	}
-	for k, v := range l.Data {
-		result.Data[k] = v
-	}
-	return result
-}
-
-func (l *LinkedQueue) String() string {
-	return fmt.Sprintf("tail: %d, data: %v", l.Tail, l.Data)
+type CacheConf struct {
+	// The max number of the cached data loaded in memory to send
+	Length int
+	// The max bytes of the cache files, including the sent data in the segments not removed yet
+	MaxBytes int64
+	// The bytes to roll a new cache segment file
+	SegmentBytes int64
+	// The policy when the cache files reach MaxBytes: block, dropOldest or dropNewest
+	FullPolicy string
+	// The number of the replayed data per second, 0 means no limit
+	ReplayRate int
 }
 
+// Cache saves the sink input data in a disk queue until they are sent successfully. The data is read from the queue to
+// send by the Out channel. The sink signals the sent data by Complete so that it is removed from the queue, or the
+// failed data by Failed so that it is replayed in the ReplayRate after the sink sends any data successfully again, or
+// when the sink signals Replay such as the probe of the circuit breaker. After restart, the data not sent are replayed.
+// If the cache is saved by checkpoint, the data after the barrier of the last checkpoint are not replayed because the
+// source replays them from the checkpoint.
 type Cache struct {
 	//Data and control channels
 	in       <-chan interface{}
 	Out      chan *CacheTuple
 	Complete chan int
+	Failed   chan int
+	Replay   chan struct{}
 	errorCh  chan<- error
-	//states
-	pending *LinkedQueue
+	done     <-chan struct{}
+	conf     *CacheConf
+	//states only accessed by the run goroutine
+	queue *diskQueue
+	// the sequence of the next data to read
+	readSeq int64
+	// the sequences of the data to replay
+	replay []int64
+	// the sequences of the failed data which are replayed after the next success
+	failed  []int64
+	barrier interface{}
 	changed bool
-	//serialize
-	key   string //the key for current cache
-	store kv.KeyValue
+	// whether the cache is saved by checkpoint
+	checkpoint bool
+	// the sequence of the next data when the last barrier arrives
+	barrierSeq int64
 }
 
-func NewTimebasedCache(in <-chan interface{}, limit int, saveInterval int, errCh chan<- error, ctx api.StreamContext) *Cache {
-	c := &Cache{
+func NewTimebasedCache(in <-chan interface{}, c *CacheConf, saveInterval int, errCh chan<- error, ctx api.StreamContext) *Cache {
+	cache := newCache(in, c, errCh, ctx)
+	ticker := conf.GetTicker(saveInterval)
+	go func() {
+		defer ticker.Stop()
+		cache.run(ctx, ticker.C)
+	}()
+	return cache
+}
+
+// NewCheckpointbasedCache saves the cache when the checkpoint is triggered by tch
+func NewCheckpointbasedCache(in <-chan interface{}, c *CacheConf, tch <-chan struct{}, errCh chan<- error, ctx api.StreamContext) *Cache {
+	cache := newCache(in, c, errCh, ctx)
+	cache.checkpoint = true
+	saveCh := make(chan time.Time)
+	go func() {
+		for {
+			select {
+			case _, ok := <-tch:
+				if !ok {
+					return
+				}
+				select {
+				case saveCh <- time.Time{}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go cache.run(ctx, saveCh)
+	return cache
+}
+
+func newCache(in <-chan interface{}, c *CacheConf, errCh chan<- error, ctx api.StreamContext) *Cache {
+	return &Cache{
 		in:       in,
-		Out:      make(chan *CacheTuple, limit),
-		Complete: make(chan int),
+		Out:      make(chan *CacheTuple, c.Length),
+		Complete: make(chan int, c.Length),
+		Failed:   make(chan int, c.Length),
+		Replay:   make(chan struct{}, 1),
 		errorCh:  errCh,
+		done:     ctx.Done(),
+		conf:     c,
 	}
-	go c.timebasedRun(ctx, saveInterval)
-	return c
 }
 
-func (c *Cache) initStore(ctx api.StreamContext) {
+func (c *Cache) run(ctx api.StreamContext, saveC <-chan time.Time) {
 	logger := ctx.GetLogger()
-	c.pending = &LinkedQueue{
-		Data: make(map[int]interface{}),
-		Tail: 0,
-	}
 	dbDir, err := conf.GetDataLoc()
-	logger.Debugf("cache saved to %s", dbDir)
 	if err != nil {
 		c.drainError(err)
+		return
 	}
-	c.store = kv.GetDefaultKVStore(path.Join(dbDir, "sink", ctx.GetRuleId()))
-	c.key = ctx.GetOpId() + strconv.Itoa(ctx.GetInstanceId())
-	logger.Debugf("cache saved to key %s", c.key)
-	//load cache
-	if err := c.loadCache(); err != nil {
-		go c.drainError(err)
+	dir := path.Join(dbDir, "sink", ctx.GetRuleId(), ctx.GetOpId()+strconv.Itoa(ctx.GetInstanceId()))
+	c.queue, err = openDiskQueue(dir, c.conf.SegmentBytes, c.checkpoint)
+	if err != nil {
+		c.drainError(err)
 		return
 	}
-}
+	defer c.queue.close()
+	// replay the data not sent before restart
+	for _, seg := range c.queue.segments {
+		for seq := seg.first; seq <= seg.last; seq++ {
+			if c.queue.has(seq) {
+				c.replay = append(c.replay, seq)
+			}
+		}
+	}
+	c.readSeq = c.queue.nextSeq
+	c.barrierSeq = c.queue.high
+	logger.Infof("sink node %s instance %d cache loaded %d data from %s", ctx.GetOpId(), ctx.GetInstanceId(), len(c.replay), dir)
 
-func (c *Cache) timebasedRun(ctx api.StreamContext, saveInterval int) {
-	logger := ctx.GetLogger()
-	c.initStore(ctx)
-	ticker := conf.GetTicker(saveInterval)
-	defer ticker.Stop()
-	var tcount = 0
+	replayReady := true
+	var replayC <-chan time.Time
+	if c.conf.ReplayRate > 0 {
+		interval := 1000 / c.conf.ReplayRate
+		if interval <= 0 {
+			interval = 1
+		}
+		ticker := conf.GetTicker(interval)
+		defer ticker.Stop()
+		replayC = ticker.C
+	}
+	var next *CacheTuple
 	for {
+		if next == nil {
+			var replayed bool
+			next, replayed = c.next(replayReady, logger)
+			if replayed && c.conf.ReplayRate > 0 {
+				replayReady = false
+			}
+		}
+		var outCh chan<- *CacheTuple
+		if next != nil {
+			outCh = c.Out
+		}
+		inCh := c.in
+		if c.barrier != nil || (c.conf.FullPolicy == CACHE_FULL_BLOCK && c.queue.size >= c.conf.MaxBytes) {
+			inCh = nil
+		}
 		select {
-		case item := <-c.in:
-			index := c.pending.Tail
-			c.pending.append(item)
-			//non blocking until limit exceeded
-			c.Out <- &CacheTuple{
-				index: index,
-				data:  item,
+		case item := <-inCh:
+			c.add(item, logger)
+		case outCh <- next:
+			if next.data == c.barrier {
+				logger.Debugf("sink cache send out barrier %v", next.data)
+				c.barrier = nil
 			}
-			c.changed = true
+			next = nil
 		case index := <-c.Complete:
-			c.pending.delete(index)
+			if err := c.queue.ack(int64(index)); err != nil {
+				logger.Warnf("sink cache fails to remove data %d: %v", index, err)
+			}
 			c.changed = true
-		case <-ticker.C:
-			tcount++
-			l := c.pending.length()
-			if l == 0 {
-				c.pending.reset()
+			if len(c.failed) > 0 {
+				logger.Infof("sink node %s instance %d recovers, replay %d failed data", ctx.GetOpId(), ctx.GetInstanceId(), len(c.failed))
+				c.replayAll()
 			}
-			//If the data is still changing, only do a save when the cache has more than threshold to prevent too much file IO
-			//If the data is not changing in the time slot and have not saved before, save it. This is to prevent the
-			//data won't be saved as the cache never pass the threshold
-			//logger.Infof("ticker %t, l=%d\n", c.changed, l)
-			if (c.changed && l > conf.Config.Sink.CacheThreshold) || (tcount == conf.Config.Sink.CacheTriggerCount && c.changed) {
-				logger.Infof("save cache for rule %s, %s", ctx.GetRuleId(), c.pending.String())
-				clone := c.pending.clone()
-				c.changed = false
-				go func() {
-					if err := c.saveCache(logger, clone); err != nil {
-						logger.Debugf("%v", err)
-						c.drainError(err)
-					}
-				}()
+		case index := <-c.Failed:
+			c.failed = append(c.failed, int64(index))
+		case <-c.Replay:
+			if len(c.failed) > 0 {
+				logger.Infof("sink node %s instance %d probes by replaying %d failed data", ctx.GetOpId(), ctx.GetInstanceId(), len(c.failed))
+				c.replayAll()
 			}
-			if tcount >= conf.Config.Sink.CacheThreshold {
-				tcount = 0
+		case <-replayC:
+			replayReady = true
+		case <-saveC:
+			if c.changed {
+				logger.Debugf("save cache for rule %s with %d data", ctx.GetRuleId(), c.queue.len())
+				c.mark()
+				if err := c.queue.save(); err != nil {
+					logger.Warnf("Error found during saving cache: %s", err)
+				}
+				c.changed = false
 			}
 		case <-ctx.Done():
-			err := c.saveCache(logger, c.pending)
-			if err != nil {
+			if !c.checkpoint {
+				c.mark()
+			}
+			if err := c.queue.save(); err != nil {
 				logger.Warnf("Error found during saving cache: %s \n ", err)
 			}
 			logger.Infof("sink node %s instance cache %d done", ctx.GetOpId(), ctx.GetInstanceId())
@@ -156,120 +220,203 @@ func (c *Cache) timebasedRun(ctx api.StreamContext, saveInterval int) {
 	}
 }
 
-func (c *Cache) loadCache() error {
-	gob.Register(c.pending)
-	err := c.store.Open()
-	if err != nil && err != io.EOF {
-		return err
+// mark sets the high sequence to save. It is the sequence when the barrier of the saved checkpoint arrives if the cache
+// is saved by checkpoint, otherwise all the appended data are saved.
+func (c *Cache) mark() {
+	if c.checkpoint {
+		c.queue.high = c.barrierSeq
+	} else {
+		c.queue.high = c.queue.nextSeq
 	}
-	defer c.store.Close()
-	if err == nil {
-		mt := new(LinkedQueue)
-		if f, err := c.store.Get(c.key, &mt); f {
-			if nil != err {
-				return fmt.Errorf("load malform cache, found %v(%v)", c.key, mt)
-			}
-			c.pending = mt
-			c.changed = true
-			// To store the keys in slice in sorted order
-			var keys []int
-			for k := range mt.Data {
-				keys = append(keys, k)
-			}
-			sort.Ints(keys)
-			for _, k := range keys {
-				t := &CacheTuple{
-					index: k,
-					data:  mt.Data[k],
+}
+
+// replayAll moves the failed data to replay in order
+func (c *Cache) replayAll() {
+	c.replay = append(c.replay, c.failed...)
+	sort.Slice(c.replay, func(i, j int) bool { return c.replay[i] < c.replay[j] })
+	c.failed = nil
+}
+
+// add appends the input data to the queue. The barrier is not saved but sent after all the data before it.
+func (c *Cache) add(item interface{}, logger api.Logger) {
+	if isBarrier(item) {
+		c.barrier = item
+		c.barrierSeq = c.queue.nextSeq
+		c.changed = true
+		return
+	}
+	payload, err := encodeCacheData(item)
+	if err != nil {
+		logger.Warnf("sink cache drops the data: %v", err)
+		return
+	}
+	size := recordSize(payload)
+	if size > c.conf.MaxBytes {
+		logger.Warnf("sink cache drops the data of %d bytes which is larger than the max bytes %d", size, c.conf.MaxBytes)
+		return
+	}
+	if c.queue.size+size > c.conf.MaxBytes {
+		switch c.conf.FullPolicy {
+		case CACHE_FULL_DROP_NEWEST:
+			logger.Warnf("sink cache is full with %d bytes, drop the newest data", c.queue.size)
+			return
+		case CACHE_FULL_DROP_OLDEST:
+			for c.queue.size+size > c.conf.MaxBytes {
+				n := c.queue.dropOldest()
+				if n == 0 {
+					break
 				}
-				c.Out <- t
+				logger.Warnf("sink cache is full with %d bytes, drop %d oldest data", c.queue.size, n)
+			}
+		}
+	}
+	if _, err := c.queue.append(payload); err != nil {
+		c.drainError(err)
+		return
+	}
+	c.changed = true
+}
+
+// next returns the next data to send and whether it is replayed. The replayed data is read first when the rate limit
+// is ready, then the new data in order and the barrier after them.
+func (c *Cache) next(replayReady bool, logger api.Logger) (*CacheTuple, bool) {
+	if replayReady {
+		for len(c.replay) > 0 {
+			seq := c.replay[0]
+			c.replay = c.replay[1:]
+			if t := c.read(seq, logger); t != nil {
+				return t, true
 			}
-			return nil
 		}
 	}
-	return nil
+	for c.readSeq < c.queue.nextSeq {
+		seq := c.readSeq
+		c.readSeq++
+		if t := c.read(seq, logger); t != nil {
+			return t, false
+		}
+	}
+	if c.barrier != nil {
+		return &CacheTuple{index: -1, data: c.barrier}, false
+	}
+	return nil, false
 }
 
-func (c *Cache) saveCache(logger api.Logger, p *LinkedQueue) error {
-	err := c.store.Open()
+func (c *Cache) read(seq int64, logger api.Logger) *CacheTuple {
+	payload, ok, err := c.queue.read(seq)
 	if err != nil {
-		logger.Errorf("save cache error while opening cache store: %s", err)
-		logger.Infof("clean the cache and reopen")
-		c.store.Close()
-		c.store.Clean()
-		err = c.store.Open()
-		if err != nil {
-			logger.Errorf("save cache error after reset the cache store: %s", err)
-			return err
+		logger.Warnf("sink cache fails to read data %d: %v", seq, err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+	data, err := decodeCacheData(payload)
+	if err != nil {
+		logger.Warnf("sink cache fails to decode data %d: %v", seq, err)
+		return nil
+	}
+	return &CacheTuple{index: int(seq), data: data}
+}
+
+// complete signals the data is sent so that it can be removed from the cache
+func (c *Cache) complete(indexes ...int) {
+	if c == nil {
+		return
+	}
+	for _, index := range indexes {
+		select {
+		case c.Complete <- index:
+		case <-c.done:
+			return
 		}
 	}
-	defer c.store.Close()
-	return c.store.Set(c.key, p)
 }
 
-func (c *Cache) drainError(err error) {
-	c.errorCh <- err
+// fail signals the data is not sent so that it is replayed when the sink recovers
+func (c *Cache) fail(indexes ...int) {
+	if c == nil {
+		return
+	}
+	for _, index := range indexes {
+		select {
+		case c.Failed <- index:
+		case <-c.done:
+			return
+		}
+	}
 }
 
-func (c *Cache) Length() int {
-	return c.pending.length()
+// replayFailed signals to replay the failed data without waiting for a success. It does not block if a signal is
+// pending.
+func (c *Cache) replayFailed() {
+	if c == nil {
+		return
+	}
+	select {
+	case c.Replay <- struct{}{}:
+	default:
+	}
 }
 
-func NewCheckpointbasedCache(in <-chan interface{}, limit int, tch <-chan struct{}, errCh chan<- error, ctx api.StreamContext) *Cache {
-	c := &Cache{
-		in:       in,
-		Out:      make(chan *CacheTuple, limit),
-		Complete: make(chan int),
-		errorCh:  errCh,
+func (c *Cache) drainError(err error) {
+	select {
+	case c.errorCh <- err:
+	case <-c.done:
 	}
-	go c.checkpointbasedRun(ctx, tch)
-	return c
 }
 
-func (c *Cache) checkpointbasedRun(ctx api.StreamContext, tch <-chan struct{}) {
-	logger := ctx.GetLogger()
-	c.initStore(ctx)
+// The saved format of the sink input data is a type byte followed by the content
+const (
+	cacheBytes  = 'b'
+	cacheError  = 'e'
+	cacheBuffer = 'c'
+)
 
-	for {
-		select {
-		case item := <-c.in:
-			// possibility of barrier, ignore if found
-			if boe, ok := item.(*checkpoint.BufferOrEvent); ok {
-				if _, ok := boe.Data.(*checkpoint.Barrier); ok {
-					c.Out <- &CacheTuple{
-						data: item,
-					}
-					logger.Debugf("sink cache send out barrier %v", boe.Data)
-					break
-				}
-			}
-			index := c.pending.Tail
-			c.pending.append(item)
-			//non blocking until limit exceeded
-			c.Out <- &CacheTuple{
-				index: index,
-				data:  item,
-			}
-			logger.Debugf("sink cache send out tuple %v", item)
-			c.changed = true
-		case index := <-c.Complete:
-			c.pending.delete(index)
-			c.changed = true
-		case <-tch:
-			logger.Infof("save cache for rule %s, %s", ctx.GetRuleId(), c.pending.String())
-			clone := c.pending.clone()
-			if c.changed {
-				go func() {
-					if err := c.saveCache(logger, clone); err != nil {
-						logger.Debugf("%v", err)
-						c.drainError(err)
-					}
-				}()
-			}
-			c.changed = false
-		case <-ctx.Done():
-			logger.Infof("sink node %s instance cache %d done", ctx.GetOpId(), ctx.GetInstanceId())
-			return
+func encodeCacheData(item interface{}) ([]byte, error) {
+	switch v := item.(type) {
+	case []byte:
+		return append([]byte{cacheBytes}, v...), nil
+	case error:
+		return append([]byte{cacheError}, v.Error()...), nil
+	case *checkpoint.BufferOrEvent:
+		inner, err := encodeCacheData(v.Data)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, 3, 3+len(v.Channel)+len(inner))
+		b[0] = cacheBuffer
+		binary.BigEndian.PutUint16(b[1:3], uint16(len(v.Channel)))
+		b = append(b, v.Channel...)
+		return append(b, inner...), nil
+	default:
+		return nil, fmt.Errorf("unsupported cache data %v of type %T", item, item)
+	}
+}
+
+func decodeCacheData(payload []byte) (interface{}, error) {
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("empty cache data")
+	}
+	switch payload[0] {
+	case cacheBytes:
+		return payload[1:], nil
+	case cacheError:
+		return fmt.Errorf("%s", payload[1:]), nil
+	case cacheBuffer:
+		if len(payload) < 3 {
+			return nil, fmt.Errorf("invalid cache data %v", payload)
+		}
+		l := int(binary.BigEndian.Uint16(payload[1:3]))
+		if len(payload) < 3+l {
+			return nil, fmt.Errorf("invalid cache data %v", payload)
+		}
+		inner, err := decodeCacheData(payload[3+l:])
+		if err != nil {
+			return nil, err
 		}
+		return &checkpoint.BufferOrEvent{Data: inner, Channel: string(payload[3 : 3+l])}, nil
+	default:
+		return nil, fmt.Errorf("invalid cache data type %c", payload[0])
 	}
 }
@@ -0,0 +1,350 @@
+package node
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, q *diskQueue) []string {
+	var result []string
+	for _, seg := range q.segments {
+		for seq := seg.first; seq <= seg.last; seq++ {
+			if b, ok, err := q.read(seq); err != nil {
+				t.Fatal(err)
+			} else if ok {
+				result = append(result, string(b))
+			}
+		}
+	}
+	return result
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir := t.TempDir()
+	// each record is 16 + 2 bytes, so each segment has 2 records
+	q, err := openDiskQueue(dir, 36, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if seq, err := q.append([]byte(fmt.Sprintf("m%d", i))); err != nil {
+			t.Fatal(err)
+		} else if seq != int64(i) {
+			t.Errorf("expect seq %d but got %d", i, seq)
+		}
+	}
+	if len(q.segments) != 3 || q.size != 90 {
+		t.Errorf("expect 3 segments of 90 bytes but got %d segments of %d bytes", len(q.segments), q.size)
+	}
+	q.ack(1)
+	q.ack(0)
+	if len(q.segments) != 2 || q.lowest() != 2 {
+		t.Errorf("expect the first segment is deleted but got %d segments with lowest %d", len(q.segments), q.lowest())
+	}
+	q.ack(3)
+	if q.liveBytes != 36 {
+		t.Errorf("expect 36 live bytes but got %d", q.liveBytes)
+	}
+	if err := q.save(); err != nil {
+		t.Fatal(err)
+	}
+	q.close()
+
+	// append a torn record to the last segment
+	f, err := os.OpenFile(filepath.Join(dir, segmentName(4)), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte{0, 0, 0})
+	_ = f.Close()
+
+	q, err = openDiskQueue(dir, 36, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 is acked but not saved as it is not the lowest
+	exp := []string{"m2", "m3", "m4"}
+	if result := readAll(t, q); !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	if seq, err := q.append([]byte("m5")); err != nil || seq != 5 {
+		t.Errorf("expect seq 5 after reload but got %d with error %v", seq, err)
+	}
+	if n := q.dropOldest(); n != 2 {
+		t.Errorf("expect to drop 2 data but got %d", n)
+	}
+	exp = []string{"m4", "m5"}
+	if result := readAll(t, q); !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	// the fully acknowledged active segment is truncated
+	q.ack(4)
+	q.ack(5)
+	if q.size != 0 || q.liveBytes != 0 {
+		t.Errorf("expect the active segment is truncated but got %d bytes with %d live bytes", q.size, q.liveBytes)
+	}
+	if seq, err := q.append([]byte("m6")); err != nil || seq != 6 {
+		t.Errorf("expect seq 6 after truncation but got %d with error %v", seq, err)
+	}
+	exp = []string{"m6"}
+	if result := readAll(t, q); !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	q.close()
+}
+
+func TestDiskQueue_Trim(t *testing.T) {
+	dir := t.TempDir()
+	q, err := openDiskQueue(dir, 36, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := q.append([]byte(fmt.Sprintf("m%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the checkpoint covers m0 and m1, m2 is appended after it and saved when closing
+	q.high = 2
+	if err := q.save(); err != nil {
+		t.Fatal(err)
+	}
+	q.close()
+
+	q, err = openDiskQueue(dir, 36, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"m0", "m1"}
+	if result := readAll(t, q); !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	if seq, err := q.append([]byte("m3")); err != nil || seq != 3 {
+		t.Errorf("expect seq 3 after reload but got %d with error %v", seq, err)
+	}
+	q.close()
+
+	// without trim, all the records not acknowledged are loaded
+	q, err = openDiskQueue(dir, 36, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp = []string{"m0", "m1", "m2", "m3"}
+	if result := readAll(t, q); !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	q.close()
+}
+
+func TestCacheData(t *testing.T) {
+	var tests = []interface{}{
+		[]byte(`[{"a":1}]`),
+		fmt.Errorf("an error"),
+		&checkpoint.BufferOrEvent{Data: []byte(`[{"a":1}]`), Channel: "op1"},
+	}
+	for i, tt := range tests {
+		b, err := encodeCacheData(tt)
+		if err != nil {
+			t.Errorf("%d: encode error %v", i, err)
+			continue
+		}
+		result, err := decodeCacheData(b)
+		if err != nil {
+			t.Errorf("%d: decode error %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt, result) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt, result)
+		}
+	}
+	if _, err := encodeCacheData(1); err == nil {
+		t.Errorf("should fail to encode the unsupported data")
+	}
+}
+
+func newCacheContext(rule string, op string) (api.StreamContext, func()) {
+	contextLogger := conf.Log.WithField("rule", rule)
+	tempStore, _ := state.CreateStore(rule, api.AtMostOnce)
+	return context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta(rule, op, tempStore).WithCancel()
+}
+
+func receive(t *testing.T, c *Cache, n int) []*CacheTuple {
+	var result []*CacheTuple
+	for i := 0; i < n; i++ {
+		select {
+		case r := <-c.Out:
+			result = append(result, r)
+		case <-time.After(time.Second):
+			t.Fatalf("expect %d data but only got %d", n, i)
+		}
+	}
+	return result
+}
+
+func TestCache_Replay(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Join(dataDir, "sink", "TestCache_Replay"))
+	ctx, cancel := newCacheContext("TestCache_Replay", "sink1")
+
+	in := make(chan interface{}, 10)
+	c := NewTimebasedCache(in, &CacheConf{Length: 10, MaxBytes: 1024, SegmentBytes: 1024, FullPolicy: CACHE_FULL_BLOCK}, 1000, make(chan error, 1), ctx)
+	for i := 0; i < 3; i++ {
+		in <- []byte(fmt.Sprintf("m%d", i))
+	}
+	result := receive(t, c, 3)
+	c.fail(result[0].index)
+	c.complete(result[1].index)
+	// the failed data is replayed after the success
+	result = receive(t, c, 1)
+	if string(result[0].data.([]byte)) != "m0" {
+		t.Errorf("expect to replay m0 but got %s", result[0].data)
+	}
+	c.complete(result[0].index)
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// m2 is not completed so that it is replayed after restart
+	ctx, cancel = newCacheContext("TestCache_Replay", "sink1")
+	defer cancel()
+	c = NewTimebasedCache(make(chan interface{}), &CacheConf{Length: 10, MaxBytes: 1024, SegmentBytes: 1024, FullPolicy: CACHE_FULL_BLOCK}, 1000, make(chan error, 1), ctx)
+	result = receive(t, c, 1)
+	if string(result[0].data.([]byte)) != "m2" {
+		t.Errorf("expect to replay m2 after restart but got %s", result[0].data)
+	}
+}
+
+func TestCache_FullPolicy(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Join(dataDir, "sink", "TestCache_FullPolicy"))
+	var tests = []struct {
+		policy string
+		result []string
+	}{
+		{
+			policy: CACHE_FULL_DROP_NEWEST,
+			result: []string{"m0", "m1", "m2", "m3"},
+		}, {
+			policy: CACHE_FULL_DROP_OLDEST,
+			result: []string{"m2", "m3", "m4", "m5"},
+		},
+	}
+	for i, tt := range tests {
+		ctx, cancel := newCacheContext("TestCache_FullPolicy", fmt.Sprintf("sink%d", i))
+		in := make(chan interface{}, 10)
+		// 4 records of 19 bytes, 2 records in a segment. The cache is not read so that all the data are kept
+		NewTimebasedCache(in, &CacheConf{Length: 0, MaxBytes: 76, SegmentBytes: 38, FullPolicy: tt.policy}, 1000, make(chan error, 1), ctx)
+		for j := 0; j < 6; j++ {
+			in <- []byte(fmt.Sprintf("m%d", j))
+		}
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+
+		q, err := openDiskQueue(path.Join(dataDir, "sink", "TestCache_FullPolicy", fmt.Sprintf("sink%d0", i)), 38, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, r := range readAll(t, q) {
+			// skip the type byte
+			result = append(result, r[1:])
+		}
+		q.close()
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+	}
+}
+
+func TestCache_PinnedSegments(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Join(dataDir, "sink", "TestCache_PinnedSegments"))
+	ctx, cancel := newCacheContext("TestCache_PinnedSegments", "sink1")
+	defer cancel()
+
+	in := make(chan interface{}, 10)
+	// 4 records of 19 bytes, 2 records in a segment
+	c := NewTimebasedCache(in, &CacheConf{Length: 10, MaxBytes: 76, SegmentBytes: 38, FullPolicy: CACHE_FULL_DROP_NEWEST}, 1000, make(chan error, 1), ctx)
+	for i := 0; i < 4; i++ {
+		in <- []byte(fmt.Sprintf("m%d", i))
+	}
+	result := receive(t, c, 4)
+	// m0 and m2 pin both segments with only 38 live bytes
+	c.complete(result[1].index, result[3].index)
+	time.Sleep(100 * time.Millisecond)
+	// the segment files are full so that the new data is dropped
+	in <- []byte("m4")
+	select {
+	case r := <-c.Out:
+		t.Errorf("expect the new data is dropped but got %s", r.data)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestCache_BlockPolicy(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Join(dataDir, "sink", "TestCache_BlockPolicy"))
+	ctx, cancel := newCacheContext("TestCache_BlockPolicy", "sink1")
+	defer cancel()
+
+	in := make(chan interface{})
+	// 4 records of 19 bytes fill the cache in the active segment
+	c := NewTimebasedCache(in, &CacheConf{Length: 10, MaxBytes: 76, SegmentBytes: 76, FullPolicy: CACHE_FULL_BLOCK}, 1000, make(chan error, 1), ctx)
+	send := func(data []byte) bool {
+		select {
+		case in <- data:
+			return true
+		case <-time.After(200 * time.Millisecond):
+			return false
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if !send([]byte(fmt.Sprintf("m%d", i))) {
+			t.Fatalf("cache blocks data %d before it is full", i)
+		}
+	}
+	if send([]byte("m4")) {
+		t.Fatalf("cache should block the input when it is full")
+	}
+	for _, r := range receive(t, c, 4) {
+		c.complete(r.index)
+	}
+	// the data larger than the max bytes is dropped
+	if !send(make([]byte, 100)) {
+		t.Fatalf("cache should accept the input after all the data are sent")
+	}
+	if !send([]byte("m4")) {
+		t.Fatalf("cache should accept the input after all the data are sent")
+	}
+	result := receive(t, c, 1)
+	if string(result[0].data.([]byte)) != "m4" {
+		t.Errorf("expect m4 but got %s", result[0].data)
+	}
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"sync/atomic"
+)
+
+// DeadLetter is the message sent to the dead letter sink when the data fails to be sent after all the retries
+type DeadLetter struct {
+	// The failed data. It is the raw json if the data is json, otherwise a string
+	Payload   interface{} `json:"payload"`
+	Error     string      `json:"error"`
+	Rule      string      `json:"rule"`
+	Sink      string      `json:"sink"`
+	Attempts  int         `json:"attempts"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+// deadLetter is the sink to receive the failed data of a sink instance. It is defined like an action such as
+// {"file":{"path":"dead.log"}}.
+type deadLetter struct {
+	sinkType string
+	sink     api.Sink
+	name     string
+}
+
+func newDeadLetter(name string, c interface{}) (*deadLetter, error) {
+	action, ok := c.(map[string]interface{})
+	if !ok || len(action) != 1 {
+		return nil, fmt.Errorf("invalid deadLetter property %v, must be an action with a sink type such as {\"file\":{\"path\":\"dead.log\"}}", c)
+	}
+	for t, v := range action {
+		props, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid deadLetter property of %s sink %v, must be a map", t, v)
+		}
+		s, err := getSink(t, props)
+		if err != nil {
+			return nil, fmt.Errorf("fail to create deadLetter sink %s: %v", t, err)
+		}
+		return &deadLetter{sinkType: t, sink: s, name: name}, nil
+	}
+	return nil, nil
+}
+
+func (d *deadLetter) open(ctx api.StreamContext) error {
+	if err := d.sink.Open(ctx); err != nil {
+		return fmt.Errorf("fail to open deadLetter sink %s: %v", d.sinkType, err)
+	}
+	return nil
+}
+
+// send sends the failed data with the error to the dead letter sink and returns true if succeeded
+func (d *deadLetter) send(ctx api.StreamContext, data []byte, e error, attempts int, stats StatManager) bool {
+	logger := ctx.GetLogger()
+	dl := &DeadLetter{
+		Error:     e.Error(),
+		Rule:      ctx.GetRuleId(),
+		Sink:      d.name,
+		Attempts:  attempts,
+		Timestamp: conf.GetNowInMilli(),
+	}
+	if json.Valid(data) {
+		dl.Payload = json.RawMessage(data)
+	} else {
+		dl.Payload = string(data)
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		logger.Errorf("sink node %s instance %d fails to encode the dead letter: %v", ctx.GetOpId(), ctx.GetInstanceId(), err)
+		return false
+	}
+	if err := d.sink.Collect(ctx, b); err != nil {
+		logger.Errorf("sink node %s instance %d fails to send the dead letter %s: %v", ctx.GetOpId(), ctx.GetInstanceId(), b, err)
+		return false
+	}
+	if s, ok := stats.(*sinkStatManager); ok {
+		s.IncTotalDeadLetters()
+	}
+	logger.Debugf("sink node %s instance %d sends the dead letter %s", ctx.GetOpId(), ctx.GetInstanceId(), b)
+	return true
+}
+
+func (d *deadLetter) close(ctx api.StreamContext) error {
+	return d.sink.Close(ctx)
+}
+
+// sinkStatManager adds the sink specific metrics in the order of SinkMetricNames
+type sinkStatManager struct {
+	StatManager
+	totalDeadLetters int64
+	breaker          *circuitBreaker
+}
+
+func (sm *sinkStatManager) IncTotalDeadLetters() {
+	atomic.AddInt64(&sm.totalDeadLetters, 1)
+}
+
+func (sm *sinkStatManager) GetMetrics() []interface{} {
+	return append(sm.StatManager.GetMetrics(), atomic.LoadInt64(&sm.totalDeadLetters), sm.breaker.getState())
+}
@@ -0,0 +1,360 @@
+package node
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	segmentSuffix = ".seg"
+	ackFile       = "ack"
+	// seq(8) + length(4) + crc32(4)
+	recordHeaderSize = 16
+)
+
+// diskQueue is an append-only queue of records saved in the segment files of a directory. Each record has a sequence
+// number which increases across restarts. The records are removed by acknowledgement and a segment file is deleted
+// when all its records are acknowledged, or truncated if it is the active one. The lowest unacknowledged sequence is
+// saved with the high sequence so that the acknowledged records, and optionally the records appended after the save,
+// are not loaded again after restart. It is not thread safe.
+type diskQueue struct {
+	dir          string
+	segmentBytes int64
+
+	// the segments in the order of the sequence, the last one is the active segment to append
+	segments []*segment
+	// the locations of the unacknowledged records
+	locs    map[int64]*recordLoc
+	nextSeq int64
+	// the total bytes of the segment files
+	size int64
+	// the bytes of the unacknowledged records
+	liveBytes int64
+	// the sequence above the records covered by the last save, which is saved with the lowest unacknowledged sequence
+	high int64
+}
+
+type segment struct {
+	first int64
+	path  string
+	file  *os.File
+	size  int64
+	// the number of the unacknowledged records
+	live int
+	// the bytes of the unacknowledged records
+	liveBytes int64
+	// the sequences of the records in the segment are [first, last]
+	last int64
+}
+
+type recordLoc struct {
+	seg    *segment
+	offset int64
+	length int
+}
+
+// openDiskQueue loads the unacknowledged records in the directory. If trim is true, the records at or above the saved
+// high sequence are ignored such as the records appended after the last checkpoint which are replayed by the source.
+func openDiskQueue(dir string, segmentBytes int64, trim bool) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, fmt.Errorf("fail to create the cache directory %s: %v", dir, err)
+	}
+	q := &diskQueue{
+		dir:          dir,
+		segmentBytes: segmentBytes,
+		locs:         make(map[int64]*recordLoc),
+	}
+	high := int64(-1)
+	if b, err := ioutil.ReadFile(filepath.Join(dir, ackFile)); err == nil {
+		// the ack file saves the lowest unacknowledged sequence and the high sequence, the latter is absent in old versions
+		fields := strings.Fields(string(b))
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, fmt.Errorf("invalid cache ack file in %s: %s", dir, b)
+		}
+		if q.nextSeq, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid cache ack file in %s: %v", dir, err)
+		}
+		if len(fields) == 2 && trim {
+			if high, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid cache ack file in %s: %v", dir, err)
+			}
+		}
+	}
+	acked := q.nextSeq
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var firsts []int64
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), segmentSuffix) {
+			continue
+		}
+		first, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+	for i, first := range firsts {
+		seg, err := q.loadSegment(first, acked, high, i == len(firsts)-1)
+		if err != nil {
+			q.close()
+			return nil, err
+		}
+		if seg.live == 0 && i < len(firsts)-1 {
+			q.removeSegment(seg)
+		}
+	}
+	if high >= 0 {
+		q.high = high
+	} else {
+		q.high = q.nextSeq
+	}
+	return q, nil
+}
+
+// loadSegment reads the records of a segment file. The records below acked, or at or above high if it is not negative,
+// are not loaded. The incomplete or corrupted records at the tail of the last segment, which may be written when the
+// process is killed, are truncated.
+func (q *diskQueue) loadSegment(first int64, acked int64, high int64, isLast bool) (*segment, error) {
+	p := filepath.Join(q.dir, segmentName(first))
+	f, err := os.OpenFile(p, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open the cache segment %s: %v", p, err)
+	}
+	seg := &segment{first: first, path: p, file: f, last: first - 1}
+	q.segments = append(q.segments, seg)
+	var (
+		offset int64
+		header = make([]byte, recordHeaderSize)
+	)
+	for {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			break
+		}
+		seq := int64(binary.BigEndian.Uint64(header[0:8]))
+		l := int(binary.BigEndian.Uint32(header[8:12]))
+		payload := make([]byte, l)
+		if _, err := f.ReadAt(payload, offset+recordHeaderSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[12:16]) {
+			break
+		}
+		if seq >= acked && (high < 0 || seq < high) {
+			q.locs[seq] = &recordLoc{seg: seg, offset: offset, length: l}
+			seg.live++
+			seg.liveBytes += int64(recordHeaderSize + l)
+		}
+		seg.last = seq
+		offset += int64(recordHeaderSize + l)
+	}
+	if isLast {
+		if err := f.Truncate(offset); err != nil {
+			return nil, fmt.Errorf("fail to truncate the cache segment %s: %v", p, err)
+		}
+	}
+	seg.size = offset
+	q.size += offset
+	q.liveBytes += seg.liveBytes
+	if seg.last+1 > q.nextSeq {
+		q.nextSeq = seg.last + 1
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+func segmentName(first int64) string {
+	return fmt.Sprintf("%020d%s", first, segmentSuffix)
+}
+
+// recordSize returns the bytes in the segment file to save the payload
+func recordSize(payload []byte) int64 {
+	return int64(recordHeaderSize + len(payload))
+}
+
+// append appends the payload to the active segment and returns the sequence of the record
+func (q *diskQueue) append(payload []byte) (int64, error) {
+	seg := q.active()
+	if seg == nil || seg.size >= q.segmentBytes {
+		var err error
+		if seg, err = q.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	seq := q.nextSeq
+	b := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint64(b[0:8], uint64(seq))
+	binary.BigEndian.PutUint32(b[8:12], uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[12:16], crc32.ChecksumIEEE(payload))
+	copy(b[recordHeaderSize:], payload)
+	if _, err := seg.file.Write(b); err != nil {
+		return 0, fmt.Errorf("fail to write the cache segment %s: %v", seg.path, err)
+	}
+	q.locs[seq] = &recordLoc{seg: seg, offset: seg.size, length: len(payload)}
+	seg.size += int64(len(b))
+	seg.live++
+	seg.liveBytes += int64(len(b))
+	seg.last = seq
+	q.size += int64(len(b))
+	q.liveBytes += int64(len(b))
+	q.nextSeq++
+	return seq, nil
+}
+
+func (q *diskQueue) active() *segment {
+	if len(q.segments) == 0 {
+		return nil
+	}
+	return q.segments[len(q.segments)-1]
+}
+
+// rotate creates a new active segment. The previous active segment is removed if all its records are acknowledged
+func (q *diskQueue) rotate() (*segment, error) {
+	if prev := q.active(); prev != nil && prev.live == 0 {
+		q.removeSegment(prev)
+	}
+	p := filepath.Join(q.dir, segmentName(q.nextSeq))
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("fail to create the cache segment %s: %v", p, err)
+	}
+	seg := &segment{first: q.nextSeq, path: p, file: f, last: q.nextSeq - 1}
+	q.segments = append(q.segments, seg)
+	return seg, nil
+}
+
+// read returns the payload of the unacknowledged record. It returns false if the record is acknowledged or dropped
+func (q *diskQueue) read(seq int64) ([]byte, bool, error) {
+	loc, ok := q.locs[seq]
+	if !ok {
+		return nil, false, nil
+	}
+	payload := make([]byte, loc.length)
+	if _, err := loc.seg.file.ReadAt(payload, loc.offset+recordHeaderSize); err != nil {
+		return nil, false, fmt.Errorf("fail to read the cache segment %s: %v", loc.seg.path, err)
+	}
+	return payload, true, nil
+}
+
+func (q *diskQueue) has(seq int64) bool {
+	_, ok := q.locs[seq]
+	return ok
+}
+
+// ack removes the record. If all the records of the segment are acknowledged, the segment is deleted or truncated if
+// it is active so that the disk space is released
+func (q *diskQueue) ack(seq int64) error {
+	loc, ok := q.locs[seq]
+	if !ok {
+		return nil
+	}
+	delete(q.locs, seq)
+	size := int64(recordHeaderSize + loc.length)
+	loc.seg.live--
+	loc.seg.liveBytes -= size
+	q.liveBytes -= size
+	if loc.seg.live == 0 {
+		if loc.seg != q.active() {
+			q.removeSegment(loc.seg)
+		} else {
+			return q.truncate(loc.seg)
+		}
+	}
+	return nil
+}
+
+// truncate empties the fully acknowledged active segment to append the next records from the beginning
+func (q *diskQueue) truncate(seg *segment) error {
+	if err := seg.file.Truncate(0); err != nil {
+		return fmt.Errorf("fail to truncate the cache segment %s: %v", seg.path, err)
+	}
+	if _, err := seg.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("fail to truncate the cache segment %s: %v", seg.path, err)
+	}
+	q.size -= seg.size
+	seg.size = 0
+	seg.first = q.nextSeq
+	seg.last = q.nextSeq - 1
+	return nil
+}
+
+// dropOldest removes the oldest segment with all its records and returns the number of the dropped records
+func (q *diskQueue) dropOldest() int {
+	if len(q.segments) == 0 {
+		return 0
+	}
+	seg := q.segments[0]
+	n := seg.live
+	for seq := seg.first; seq <= seg.last; seq++ {
+		delete(q.locs, seq)
+	}
+	q.removeSegment(seg)
+	return n
+}
+
+func (q *diskQueue) removeSegment(seg *segment) {
+	for i, s := range q.segments {
+		if s == seg {
+			q.segments = append(q.segments[:i], q.segments[i+1:]...)
+			break
+		}
+	}
+	_ = seg.file.Close()
+	_ = os.Remove(seg.path)
+	q.size -= seg.size
+	q.liveBytes -= seg.liveBytes
+}
+
+// lowest returns the lowest unacknowledged sequence
+func (q *diskQueue) lowest() int64 {
+	for _, seg := range q.segments {
+		if seg.live == 0 {
+			continue
+		}
+		for seq := seg.first; seq <= seg.last; seq++ {
+			if _, ok := q.locs[seq]; ok {
+				return seq
+			}
+		}
+	}
+	return q.nextSeq
+}
+
+// len returns the number of the unacknowledged records
+func (q *diskQueue) len() int {
+	return len(q.locs)
+}
+
+// save syncs the active segment to the disk and saves the lowest unacknowledged sequence with the high sequence
+func (q *diskQueue) save() error {
+	if seg := q.active(); seg != nil {
+		if err := seg.file.Sync(); err != nil {
+			return fmt.Errorf("fail to sync the cache segment %s: %v", seg.path, err)
+		}
+	}
+	p := filepath.Join(q.dir, ackFile)
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", q.lowest(), q.high)), 0644); err != nil {
+		return fmt.Errorf("fail to save the cache ack: %v", err)
+	}
+	return os.Rename(tmp, p)
+}
+
+func (q *diskQueue) close() {
+	for _, seg := range q.segments {
+		_ = seg.file.Close()
+	}
+}
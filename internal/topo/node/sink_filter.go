@@ -0,0 +1,324 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"strings"
+	"sync"
+)
+
+// The state key prefix of the emission state of a sink instance
+const SINK_EMIT_KEY = "$$sinkEmit"
+
+// sinkFilter selects the result rows to send by the condition of the action and projects them to the fields, so that
+// the sinks of a rule can receive different subsets of the result. It also controls the emission of the rows by
+// onChange and debounce, and limits the rate of the data to send by maxRate.
+type sinkFilter struct {
+	condition ast.Expr
+	fields    []string
+	// the max number of the data to send per second
+	maxRate float64
+	// the milliseconds to suppress the repeated rows
+	debounce    int
+	debounceKey string
+	onChange    bool
+	onChangeKey string
+
+	// states of an instance
+	fv      *xsql.FunctionValuer
+	mutex   sync.Mutex
+	tokens  float64
+	lastRef int64
+	// the last emission time of the rows by debounce key
+	emitted   map[string]int64
+	lastPrune int64
+	// the last row by onChange key
+	lastRows map[string]string
+
+	// the filter of the sink node and the instances created from it, so that the states of all the instances are saved
+	// when any of them receives the barrier
+	parent    *sinkFilter
+	instances map[int]*sinkFilter
+}
+
+// newSinkFilter parses the filter properties of the action. It returns nil if none of them is set
+func newSinkFilter(props map[string]interface{}) (*sinkFilter, error) {
+	f := &sinkFilter{}
+	if c, ok := props["condition"]; ok {
+		s, ok := c.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid type for condition property, should be a string but found %v", c)
+		}
+		if strings.TrimSpace(s) != "" {
+			expr, err := xsql.NewParser(strings.NewReader(s)).ParseExpr()
+			if err != nil {
+				return nil, fmt.Errorf("property condition %s is invalid: %v", s, err)
+			}
+			f.condition = expr
+		}
+	}
+	if c, ok := props["fields"]; ok {
+		fields, err := cast.ToStringSlice(c, cast.STRICT)
+		if err != nil {
+			return nil, fmt.Errorf("invalid type for fields property, should be a string array but found %v", c)
+		}
+		f.fields = fields
+	}
+	if c, ok := props["maxRate"]; ok {
+		t, err := cast.ToFloat64(c, cast.CONVERT_SAMEKIND)
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid maxRate property, should be a positive number but found %v", c)
+		}
+		f.maxRate = t
+	}
+	if c, ok := props["debounce"]; ok {
+		t, err := cast.ToInt(c, cast.STRICT)
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid type for debounce property, should be positive integer but found %v", c)
+		}
+		f.debounce = t
+	}
+	if c, ok := props["onChange"]; ok {
+		t, ok := c.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid type for onChange property, should be a bool value but found %v", c)
+		}
+		f.onChange = t
+	}
+	for k, p := range map[string]*string{"debounceKey": &f.debounceKey, "onChangeKey": &f.onChangeKey} {
+		if c, ok := props[k]; ok {
+			t, ok := c.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for %s property, should be a string but found %v", k, c)
+			}
+			*p = t
+		}
+	}
+	if f.condition == nil && len(f.fields) == 0 && f.maxRate == 0 && !f.selective() {
+		return nil, nil
+	}
+	return f, nil
+}
+
+// selective returns true if the rows are selected by the previous rows
+func (f *sinkFilter) selective() bool {
+	return f.debounce > 0 || f.onChange
+}
+
+// forInstance returns a copy of the filter with its own states for a sink instance. The emission states are restored
+// from the state of the instance and the copy is registered to the filter to save the states.
+func (f *sinkFilter) forInstance(ctx api.StreamContext, instance int) *sinkFilter {
+	if f == nil {
+		return nil
+	}
+	fv, _ := xsql.NewFunctionValuersForOp(ctx, xsql.FuncRegisters)
+	r := &sinkFilter{
+		condition:   f.condition,
+		fields:      f.fields,
+		maxRate:     f.maxRate,
+		debounce:    f.debounce,
+		debounceKey: f.debounceKey,
+		onChange:    f.onChange,
+		onChangeKey: f.onChangeKey,
+		fv:          fv,
+		tokens:      f.burst(),
+		lastRef:     conf.GetNowInMilli(),
+		emitted:     make(map[string]int64),
+		lastRows:    make(map[string]string),
+		parent:      f,
+	}
+	if r.selective() {
+		if s, err := ctx.GetState(fmt.Sprintf("%s%d", SINK_EMIT_KEY, instance)); err == nil && s != nil {
+			r.restore(s)
+		}
+	}
+	f.mutex.Lock()
+	if f.instances == nil {
+		f.instances = make(map[int]*sinkFilter)
+	}
+	f.instances[instance] = r
+	f.mutex.Unlock()
+	return r
+}
+
+// burst is the capacity of the token bucket, which allows to send a data at least
+func (f *sinkFilter) burst() float64 {
+	if f.maxRate < 1 {
+		return 1
+	}
+	return f.maxRate
+}
+
+// apply returns the rows matching the condition with only the selected fields. The row which fails to evaluate the
+// condition is dropped with an error. Then the rows are selected by onChange and debounce.
+func (f *sinkFilter) apply(rows []map[string]interface{}) ([]map[string]interface{}, []error) {
+	var (
+		result []map[string]interface{}
+		errs   []error
+	)
+	for _, r := range rows {
+		if f.condition != nil {
+			ve := &xsql.ValuerEval{Valuer: xsql.MultiValuer(xsql.Message(r), f.fv)}
+			switch v := ve.Eval(f.condition).(type) {
+			case error:
+				errs = append(errs, fmt.Errorf("run condition error: %s", v))
+				continue
+			case bool:
+				if !v {
+					continue
+				}
+			case nil:
+				continue
+			default:
+				errs = append(errs, fmt.Errorf("run condition error: invalid condition that returns non-bool value %[1]T(%[1]v)", v))
+				continue
+			}
+		}
+		if len(f.fields) > 0 {
+			p := make(map[string]interface{}, len(f.fields))
+			for _, k := range f.fields {
+				if v, ok := xsql.Message(r).Value(k); ok {
+					p[k] = v
+				}
+			}
+			r = p
+		}
+		if f.selective() && !f.emit(r) {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result, errs
+}
+
+// emit returns true if the row changes from the last row of the same onChange key, and the row of the same debounce
+// key is not emitted in the debounce interval.
+func (f *sinkFilter) emit(r map[string]interface{}) bool {
+	b, _ := json.Marshal(r)
+	row := string(b)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var changeKey string
+	if f.onChange {
+		changeKey = rowKey(r, f.onChangeKey, "")
+		if last, ok := f.lastRows[changeKey]; ok && last == row {
+			return false
+		}
+	}
+	if f.debounce > 0 {
+		now := conf.GetNowInMilli()
+		if now-f.lastPrune >= int64(f.debounce) {
+			for k, t := range f.emitted {
+				if now-t >= int64(f.debounce) {
+					delete(f.emitted, k)
+				}
+			}
+			f.lastPrune = now
+		}
+		k := rowKey(r, f.debounceKey, row)
+		if t, ok := f.emitted[k]; ok && now-t < int64(f.debounce) {
+			return false
+		}
+		f.emitted[k] = now
+	}
+	if f.onChange {
+		f.lastRows[changeKey] = row
+	}
+	return true
+}
+
+func rowKey(r map[string]interface{}, field string, def string) string {
+	if field == "" {
+		return def
+	}
+	v, _ := xsql.Message(r).Value(field)
+	return cast.ToStringAlways(v)
+}
+
+// limit drops the data exceeding maxRate by a token bucket
+func (f *sinkFilter) limit(outdatas []*sinkOutput) ([]*sinkOutput, int) {
+	if f == nil || f.maxRate <= 0 {
+		return outdatas, 0
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	now := conf.GetNowInMilli()
+	f.tokens += float64(now-f.lastRef) * f.maxRate / 1000
+	if f.tokens > f.burst() {
+		f.tokens = f.burst()
+	}
+	f.lastRef = now
+	var (
+		result  []*sinkOutput
+		dropped int
+	)
+	for _, d := range outdatas {
+		if f.tokens >= 1 {
+			f.tokens--
+			result = append(result, d)
+		} else {
+			dropped++
+		}
+	}
+	return result, dropped
+}
+
+// state returns a copy of the emission states to save in the checkpoint
+func (f *sinkFilter) state() map[string]interface{} {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	emitted := make(map[string]interface{}, len(f.emitted))
+	for k, v := range f.emitted {
+		emitted[k] = v
+	}
+	lastRows := make(map[string]interface{}, len(f.lastRows))
+	for k, v := range f.lastRows {
+		lastRows[k] = v
+	}
+	return map[string]interface{}{"debounce": emitted, "onChange": lastRows}
+}
+
+func (f *sinkFilter) restore(s interface{}) {
+	m, ok := s.(map[string]interface{})
+	if !ok {
+		return
+	}
+	if emitted, ok := m["debounce"].(map[string]interface{}); ok {
+		for k, v := range emitted {
+			if t, err := cast.ToInt64(v, cast.CONVERT_SAMEKIND); err == nil {
+				f.emitted[k] = t
+			}
+		}
+	}
+	if lastRows, ok := m["onChange"].(map[string]interface{}); ok {
+		for k, v := range lastRows {
+			if t, ok := v.(string); ok {
+				f.lastRows[k] = t
+			}
+		}
+	}
+}
+
+// saveState puts the emission states of all the instances to the context before the checkpoint is taken. The barrier
+// is received by only one of the concurrent instances, so the states of the others are saved at the same time.
+func (f *sinkFilter) saveState(ctx api.StreamContext) {
+	if f == nil || !f.selective() || f.parent == nil {
+		return
+	}
+	f.parent.mutex.Lock()
+	instances := make(map[int]*sinkFilter, len(f.parent.instances))
+	for i, r := range f.parent.instances {
+		instances[i] = r
+	}
+	f.parent.mutex.Unlock()
+	for i, r := range instances {
+		if err := ctx.PutState(fmt.Sprintf("%s%d", SINK_EMIT_KEY, i), r.state()); err != nil {
+			ctx.GetLogger().Warnf("sink node %s instance %d fails to save the emission state: %v", ctx.GetOpId(), i, err)
+		}
+	}
+}
@@ -6,10 +6,15 @@ import (
 	"fmt"
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/plugin"
+	// register the builtin formats of the sink encoders and source decoders
+	_ "github.com/lf-edge/ekuiper/internal/converter"
 	ct "github.com/lf-edge/ekuiper/internal/template"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
 	"github.com/lf-edge/ekuiper/internal/topo/sink"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"strings"
 	"sync"
 	"text/template"
 	"time"
@@ -26,6 +31,7 @@ type SinkNode struct {
 	//states varies after restart
 	sinks []api.Sink
 	tch   chan struct{} //channel to trigger cache saved, will be trigger by checkpoint only
+	txns  []*sinkTxn
 }
 
 func NewSinkNode(name string, sinkType string, props map[string]interface{}) *SinkNode {
@@ -107,6 +113,57 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 				retryCount = t
 			}
 		}
+		policy := &retryPolicy{
+			interval:    retryInterval,
+			count:       retryCount,
+			backoff:     BACKOFF_FIXED,
+			maxInterval: 30000,
+			multiplier:  2,
+		}
+		if c, ok := m.options["retryBackoff"]; ok {
+			if t, ok := c.(string); !ok || (t != BACKOFF_FIXED && t != BACKOFF_EXPONENTIAL) {
+				logger.Warnf("invalid retryBackoff property, should be fixed or exponential but found %v", c)
+			} else {
+				policy.backoff = t
+			}
+		}
+		if c, ok := m.options["retryMaxInterval"]; ok {
+			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t < 0 {
+				logger.Warnf("invalid type for retryMaxInterval property, should be positive integer but found %t", c)
+			} else {
+				policy.maxInterval = t
+			}
+		}
+		if c, ok := m.options["retryMultiplier"]; ok {
+			if t, err := cast.ToFloat64(c, cast.CONVERT_SAMEKIND); err != nil || t < 1 {
+				logger.Warnf("invalid retryMultiplier property, should be a number not less than 1 but found %v", c)
+			} else {
+				policy.multiplier = t
+			}
+		}
+		if c, ok := m.options["retryJitter"]; ok {
+			if t, err := cast.ToFloat64(c, cast.CONVERT_SAMEKIND); err != nil || t < 0 || t > 1 {
+				logger.Warnf("invalid retryJitter property, should be a ratio between 0 and 1 but found %v", c)
+			} else {
+				policy.jitter = t
+			}
+		}
+		breakerThreshold := 0
+		if c, ok := m.options["breakerThreshold"]; ok {
+			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t < 0 {
+				logger.Warnf("invalid type for breakerThreshold property, should be positive integer but found %t", c)
+			} else {
+				breakerThreshold = t
+			}
+		}
+		breakerOpenInterval := 10000
+		if c, ok := m.options["breakerOpenInterval"]; ok {
+			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t <= 0 {
+				logger.Warnf("invalid type for breakerOpenInterval property, should be positive integer but found %t", c)
+			} else {
+				breakerOpenInterval = t
+			}
+		}
 		cacheLength := 1024
 		if c, ok := m.options["cacheLength"]; ok {
 			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t < 0 {
@@ -123,6 +180,46 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 				cacheSaveInterval = t
 			}
 		}
+		cacheConf := &CacheConf{
+			Length:       cacheLength,
+			MaxBytes:     100 * 1024 * 1024,
+			SegmentBytes: 4 * 1024 * 1024,
+			FullPolicy:   CACHE_FULL_BLOCK,
+		}
+		if c, ok := m.options["cacheMaxBytes"]; ok {
+			if t, err := cast.ToInt64(c, cast.STRICT); err != nil || t <= 0 {
+				logger.Warnf("invalid type for cacheMaxBytes property, should be positive integer but found %t", c)
+			} else {
+				cacheConf.MaxBytes = t
+			}
+		}
+		if c, ok := m.options["cacheSegmentBytes"]; ok {
+			if t, err := cast.ToInt64(c, cast.STRICT); err != nil || t <= 0 {
+				logger.Warnf("invalid type for cacheSegmentBytes property, should be positive integer but found %t", c)
+			} else {
+				cacheConf.SegmentBytes = t
+			}
+		}
+		if cacheConf.MaxBytes < cacheConf.SegmentBytes {
+			msg := fmt.Sprintf("cacheMaxBytes %d should not be less than cacheSegmentBytes %d", cacheConf.MaxBytes, cacheConf.SegmentBytes)
+			logger.Warnf(msg)
+			result <- fmt.Errorf(msg)
+			return
+		}
+		if c, ok := m.options["cacheFullPolicy"]; ok {
+			if t, ok := c.(string); !ok || (t != CACHE_FULL_BLOCK && t != CACHE_FULL_DROP_OLDEST && t != CACHE_FULL_DROP_NEWEST) {
+				logger.Warnf("invalid cacheFullPolicy property, should be block, dropOldest or dropNewest but found %v", c)
+			} else {
+				cacheConf.FullPolicy = t
+			}
+		}
+		if c, ok := m.options["cacheReplayRate"]; ok {
+			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t < 0 {
+				logger.Warnf("invalid type for cacheReplayRate property, should be positive integer but found %t", c)
+			} else {
+				cacheConf.ReplayRate = t
+			}
+		}
 		omitIfEmpty := false
 		if c, ok := m.options["omitIfEmpty"]; ok {
 			if t, ok := c.(bool); !ok {
@@ -139,6 +236,22 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 				sendSingle = t
 			}
 		}
+		batchSize := 0
+		if c, ok := m.options["batchSize"]; ok {
+			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t < 0 {
+				logger.Warnf("invalid type for batchSize property, should be positive integer but found %t", c)
+			} else {
+				batchSize = t
+			}
+		}
+		lingerMs := 0
+		if c, ok := m.options["lingerMs"]; ok {
+			if t, err := cast.ToInt(c, cast.STRICT); err != nil || t < 0 {
+				logger.Warnf("invalid type for lingerMs property, should be positive integer but found %t", c)
+			} else {
+				lingerMs = t
+			}
+		}
 		var tp *template.Template = nil
 		if c, ok := m.options["dataTemplate"]; ok {
 			if t, ok := c.(string); !ok {
@@ -156,6 +269,35 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 				}
 			}
 		}
+		format := ""
+		if c, ok := m.options["format"]; ok {
+			if t, ok := c.(string); !ok {
+				logger.Warnf("invalid type for format property, should be a string value but found %v", c)
+			} else {
+				format = t
+			}
+		}
+		sf, err := newSinkFilter(m.options)
+		if err != nil {
+			logger.Warnf(err.Error())
+			result <- err
+			return
+		}
+		resource := ""
+		if c, ok := m.options["shared"]; ok {
+			if t, ok := c.(bool); !ok {
+				logger.Warnf("invalid type for shared property, should be a bool value but found %v", c)
+			} else if t {
+				if r, ok := m.options["resource"].(string); !ok || r == "" {
+					msg := fmt.Sprintf("shared sink %s requires the resource property", m.name)
+					logger.Warnf(msg)
+					result <- fmt.Errorf(msg)
+					return
+				} else {
+					resource = r
+				}
+			}
+		}
 
 		m.reset()
 		logger.Infof("open sink node %d instances", m.concurrency)
@@ -163,7 +305,19 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 			go func(instance int) {
 				var sink api.Sink
 				var err error
-				if !m.isMock {
+				// the properties of the sink to evaluate the dynamic properties
+				sinkProps := m.options
+				if !m.isMock && resource != "" {
+					sink, sinkProps, err = attachSharedSink(m.sinkType, resource, fmt.Sprintf("%s.%s.%d", ctx.GetRuleId(), m.name, instance))
+					if err != nil {
+						m.drainError(result, err, ctx, logger)
+						return
+					}
+					m.mutex.Lock()
+					m.sinks = append(m.sinks, sink)
+					m.mutex.Unlock()
+					logger.Infof("sink node %s instance %d attaches to shared sink %s.%s", m.name, instance, m.sinkType, resource)
+				} else if !m.isMock {
 					logger.Debugf("Trying to get sink for rule %s with options %v\n", ctx.GetRuleId(), m.options)
 					sink, err = getSink(m.sinkType, m.options)
 					if err != nil {
@@ -184,35 +338,133 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 					sink = m.sinks[instance]
 				}
 
-				stats, err := NewStatManager("sink", ctx)
+				var dl *deadLetter
+				if c, ok := m.options["deadLetter"]; ok {
+					dl, err = newDeadLetter(m.name, c)
+					if err == nil {
+						err = dl.open(ctx)
+					}
+					if err != nil {
+						m.drainError(result, err, ctx, logger)
+						return
+					}
+					logger.Infof("sink node %s instance %d sends the failed data to the deadLetter sink %s", m.name, instance, dl.sinkType)
+				}
+
+				enc, err := newSinkEncoder(sink, format, m.options)
+				if err != nil {
+					m.drainError(result, err, ctx, logger)
+					return
+				}
+				txn, err := newSinkTxn(sink, m.qos, ctx, instance, m.concurrency, runAsync)
+				if err != nil {
+					m.drainError(result, err, ctx, logger)
+					return
+				}
+				if txn != nil {
+					m.mutex.Lock()
+					m.txns = append(m.txns, txn)
+					m.mutex.Unlock()
+				}
+				props, err := sinkDynamicProps(sink, sinkProps)
 				if err != nil {
 					m.drainError(result, err, ctx, logger)
 					return
 				}
+
+				sm, err := NewStatManager("sink", ctx)
+				if err != nil {
+					m.drainError(result, err, ctx, logger)
+					return
+				}
+				breaker := newCircuitBreaker(breakerThreshold, breakerOpenInterval)
+				stats := &sinkStatManager{StatManager: sm, breaker: breaker}
 				m.mutex.Lock()
 				m.statManagers = append(m.statManagers, stats)
 				m.mutex.Unlock()
 
+				filter := sf.forInstance(ctx, instance)
+				oc := &outputConf{
+					omitIfEmpty: omitIfEmpty,
+					sendSingle:  sendSingle,
+					tp:          tp,
+					filter:      filter,
+					enc:         enc,
+					props:       props,
+				}
+				if _, ok := sink.(api.RawSink); ok {
+					oc.raw = true
+				}
+				batch := newSinkBatch(batchSize, lingerMs)
+				sendBatch := func(policy *retryPolicy, cache *Cache) {
+					data, indexes := batch.take()
+					if runAsync {
+						go doCollectBatch(sink, data, indexes, props, stats, policy, breaker, cache, dl, ctx)
+					} else {
+						doCollectBatch(sink, data, indexes, props, stats, policy, breaker, cache, dl, ctx)
+					}
+				}
+				// best effort to send the pending batch when the context is done, so it is sent without retry
+				flushPending := func(cache *Cache) {
+					if batch == nil {
+						return
+					}
+					data, indexes := batch.take()
+					if len(data) == 0 {
+						return
+					}
+					if err := collectBatch(sink, ctx, data, props); err != nil {
+						logger.Warnf("sink node %s instance %d fails to send the pending batch: %v", m.name, instance, err)
+						return
+					}
+					cache.complete(distinctIndexes(indexes)...)
+				}
+				noRetry := &retryPolicy{}
+
 				if conf.Config.Sink.DisableCache {
 					for {
 						select {
 						case data := <-m.input:
+							if isBarrier(data) {
+								if batch != nil {
+									sendBatch(noRetry, nil)
+								}
+								filter.saveState(ctx)
+							}
+							if !m.flushOnBarrier(sink, data) || !txn.preCommitOnBarrier(data) {
+								break
+							}
 							if newdata, processed := m.preprocess(data); processed {
 								break
 							} else {
 								data = newdata
 							}
 							stats.SetBufferLength(int64(len(m.input)))
-							if runAsync {
-								go doCollect(sink, data, stats, omitIfEmpty, sendSingle, tp, ctx)
+							if batch != nil {
+								if addToBatch(batch, data, -1, nil, stats, oc, ctx) {
+									sendBatch(noRetry, nil)
+								}
+							} else if runAsync {
+								go doCollect(sink, data, stats, breaker, oc, dl, ctx)
 							} else {
-								doCollect(sink, data, stats, omitIfEmpty, sendSingle, tp, ctx)
+								doCollect(sink, data, stats, breaker, oc, dl, ctx)
 							}
+						case <-batch.lingerC():
+							batch.lingerFired()
+							sendBatch(noRetry, nil)
+						case <-txn.commitReady():
+							txn.commit()
 						case <-ctx.Done():
 							logger.Infof("sink node %s instance %d done", m.name, instance)
+							flushPending(nil)
 							if err := sink.Close(ctx); err != nil {
 								logger.Warnf("close sink node %s instance %d fails: %v", m.name, instance, err)
 							}
+							if dl != nil {
+								if err := dl.close(ctx); err != nil {
+									logger.Warnf("close deadLetter sink of sink node %s instance %d fails: %v", m.name, instance, err)
+								}
+							}
 							return
 						case <-m.tch:
 							logger.Debugf("rule %s sink receive checkpoint, do nothing", ctx.GetRuleId())
@@ -222,29 +474,64 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 					logger.Infof("Creating sink cache")
 					var cache *Cache
 					if m.qos >= api.AtLeastOnce {
-						cache = NewCheckpointbasedCache(m.input, cacheLength, m.tch, result, ctx)
+						cache = NewCheckpointbasedCache(m.input, cacheConf, m.tch, result, ctx)
 					} else {
-						cache = NewTimebasedCache(m.input, cacheLength, cacheSaveInterval, result, ctx)
+						cache = NewTimebasedCache(m.input, cacheConf, cacheSaveInterval, result, ctx)
+					}
+					// the data rejected by the open breaker is failed in the cache and replayed to probe
+					var probeC <-chan time.Time
+					if breaker != nil {
+						ticker := conf.GetTicker(breakerOpenInterval)
+						defer ticker.Stop()
+						probeC = ticker.C
 					}
 					for {
 						select {
 						case data := <-cache.Out:
+							if isBarrier(data.data) {
+								if batch != nil {
+									sendBatch(policy, cache)
+								}
+								filter.saveState(ctx)
+							}
+							if !m.flushOnBarrier(sink, data.data) || !txn.preCommitOnBarrier(data.data) {
+								break
+							}
 							if newdata, processed := m.preprocess(data.data); processed {
 								break
 							} else {
 								data.data = newdata
 							}
 							stats.SetBufferLength(int64(len(m.input)))
-							if runAsync {
-								go doCollectCacheTuple(sink, data, stats, retryInterval, retryCount, omitIfEmpty, sendSingle, tp, cache.Complete, ctx)
+							if batch != nil {
+								if addToBatch(batch, data.data, data.index, cache, stats, oc, ctx) {
+									sendBatch(policy, cache)
+								}
+							} else if runAsync {
+								go doCollectCacheTuple(sink, data, stats, policy, breaker, oc, cache, dl, ctx)
 							} else {
-								doCollectCacheTuple(sink, data, stats, retryInterval, retryCount, omitIfEmpty, sendSingle, tp, cache.Complete, ctx)
+								doCollectCacheTuple(sink, data, stats, policy, breaker, oc, cache, dl, ctx)
+							}
+						case <-batch.lingerC():
+							batch.lingerFired()
+							sendBatch(policy, cache)
+						case <-probeC:
+							if breaker.probeReady() {
+								cache.replayFailed()
 							}
+						case <-txn.commitReady():
+							txn.commit()
 						case <-ctx.Done():
 							logger.Infof("sink node %s instance %d done", m.name, instance)
+							flushPending(cache)
 							if err := sink.Close(ctx); err != nil {
 								logger.Warnf("close sink node %s instance %d fails: %v", m.name, instance, err)
 							}
+							if dl != nil {
+								if err := dl.close(ctx); err != nil {
+									logger.Warnf("close deadLetter sink of sink node %s instance %d fails: %v", m.name, instance, err)
+								}
+							}
 							return
 						}
 					}
@@ -254,11 +541,34 @@ func (m *SinkNode) Open(ctx api.StreamContext, result chan<- error) {
 	}()
 }
 
+// flushOnBarrier flushes the flushable sink before the barrier is processed. It returns false if the flush fails so
+// that the barrier is dropped and the checkpoint is not acknowledged.
+func (m *SinkNode) flushOnBarrier(sink api.Sink, data interface{}) bool {
+	f, ok := sink.(api.Flushable)
+	if !ok || m.qos < api.AtLeastOnce || !isBarrier(data) {
+		return true
+	}
+	if err := f.Flush(m.ctx); err != nil {
+		m.ctx.GetLogger().Errorf("sink node %s fails to flush for the checkpoint: %v", m.name, err)
+		return false
+	}
+	return true
+}
+
+func isBarrier(data interface{}) bool {
+	if b, ok := data.(*checkpoint.BufferOrEvent); ok {
+		_, ok = b.Data.(*checkpoint.Barrier)
+		return ok
+	}
+	return false
+}
+
 func (m *SinkNode) reset() {
 	if !m.isMock {
 		m.sinks = nil
 	}
 	m.statManagers = nil
+	m.txns = nil
 }
 
 func extractInput(v []byte) ([]map[string]interface{}, error) {
@@ -269,36 +579,83 @@ func extractInput(v []byte) ([]map[string]interface{}, error) {
 	return j, nil
 }
 
-func doCollect(sink api.Sink, item interface{}, stats StatManager, omitIfEmpty bool, sendSingle bool, tp *template.Template, ctx api.StreamContext) {
+func doCollect(sink api.Sink, item interface{}, stats StatManager, breaker *circuitBreaker, oc *outputConf, dl *deadLetter, ctx api.StreamContext) {
 	stats.IncTotalRecordsIn()
 	stats.ProcessTimeStart()
 	defer stats.ProcessTimeEnd()
 	logger := ctx.GetLogger()
-	outdatas := getOutData(stats, ctx, item, omitIfEmpty, sendSingle, tp)
+	outs := getOutData(stats, ctx, item, oc)
 
-	for _, outdata := range outdatas {
-		if err := sink.Collect(ctx, outdata); err != nil {
+	for _, out := range outs {
+		if !breaker.allow() {
+			// no cache to keep the data
+			rejectData(ctx, []*sinkOutput{out}, nil, nil, dl, stats)
+			continue
+		}
+		if err := collectOutput(sink, ctx, out); err != nil {
 			stats.IncTotalExceptions()
-			logger.Warnf("sink node %s instance %d publish %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), outdata, err)
+			logger.Warnf("sink node %s instance %d publish %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), out.data, err)
+			breaker.failure()
+			if dl != nil {
+				dl.send(ctx, out.data, err, 1, stats)
+			}
 		} else {
+			breaker.success()
 			stats.IncTotalRecordsOut()
 		}
 	}
 }
 
-func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omitIfEmpty bool, sendSingle bool, tp *template.Template) [][]byte {
+// outputConf is the configuration of a sink instance to convert the input to the output data
+type outputConf struct {
+	omitIfEmpty bool
+	sendSingle  bool
+	tp          *template.Template
+	filter      *sinkFilter
+	enc         message.Converter
+	props       dynamicProps
+	// whether the sink receives the rows before encoding
+	raw bool
+}
+
+// sinkOutput is an output data to send. The rows are the result before encoding which is a row for sendSingle or the
+// rows, and nil if the input is not decoded. The data is encoded from the rows by the dataTemplate or the format if
+// encoded is true. The props are the dynamic properties evaluated by the rows.
+type sinkOutput struct {
+	data    []byte
+	rows    interface{}
+	encoded bool
+	props   map[string]string
+}
+
+// collectOutput sends the output data with the dynamic properties if any. The rows are sent to the RawSink if they are
+// not encoded.
+func collectOutput(sink api.Sink, ctx api.StreamContext, out *sinkOutput) error {
+	if out.props != nil {
+		if ds, ok := sink.(api.DynamicPropsSink); ok {
+			return ds.CollectWithProps(ctx, out.data, out.props)
+		}
+	}
+	if rs, ok := sink.(api.RawSink); ok && out.rows != nil && !out.encoded {
+		return rs.CollectRaw(ctx, out.rows)
+	}
+	return sink.Collect(ctx, out.data)
+}
+
+func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, oc *outputConf) []*sinkOutput {
 	logger := ctx.GetLogger()
-	var outdatas [][]byte
+	var outs []*sinkOutput
 	switch val := item.(type) {
 	case []byte:
-		if omitIfEmpty && string(val) == "[{}]" {
+		if oc.omitIfEmpty && string(val) == "[{}]" {
 			return nil
 		}
 		var (
 			err error
 			j   []map[string]interface{}
 		)
-		if sendSingle || tp != nil {
+		decoded := oc.sendSingle || oc.tp != nil || oc.filter != nil || oc.props != nil || oc.raw
+		if decoded {
 			j, err = extractInput(val)
 			if err != nil {
 				logger.Warnf("sink node %s instance %d publish %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), val, err)
@@ -307,57 +664,178 @@ func getOutData(stats StatManager, ctx api.StreamContext, item interface{}, omit
 			}
 			logger.Debugf("receive %d records", len(j))
 		}
-		if !sendSingle {
-			if tp != nil {
+		if oc.filter != nil {
+			var errs []error
+			j, errs = oc.filter.apply(j)
+			for _, e := range errs {
+				logger.Warnf("sink node %s instance %d filter %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), val, e)
+				stats.IncTotalExceptions()
+			}
+			if len(j) == 0 {
+				logger.Debugf("no record matches the condition")
+				return nil
+			}
+			if !oc.sendSingle && oc.tp == nil {
+				if val, err = json.Marshal(j); err != nil {
+					logger.Warnf("sink node %s instance %d publish %s marshal error: %v", ctx.GetOpId(), ctx.GetInstanceId(), j, err)
+					stats.IncTotalExceptions()
+					return nil
+				}
+			}
+		}
+		if !oc.sendSingle {
+			out := &sinkOutput{data: val}
+			if decoded {
+				out.rows = j
+			}
+			if oc.tp != nil {
 				var output bytes.Buffer
-				err := tp.Execute(&output, j)
+				err := oc.tp.Execute(&output, j)
 				if err != nil {
 					logger.Warnf("sink node %s instance %d publish %s decode template error: %v", ctx.GetOpId(), ctx.GetInstanceId(), val, err)
 					stats.IncTotalExceptions()
 					return nil
 				}
-				outdatas = append(outdatas, output.Bytes())
-			} else {
-				outdatas = [][]byte{val}
+				out.data = output.Bytes()
+				out.encoded = true
 			}
+			outs = []*sinkOutput{out}
 		} else {
 			for _, r := range j {
-				if tp != nil {
+				out := &sinkOutput{rows: r}
+				if oc.tp != nil {
 					var output bytes.Buffer
-					err := tp.Execute(&output, r)
+					err := oc.tp.Execute(&output, r)
 					if err != nil {
 						logger.Warnf("sink node %s instance %d publish %s decode template error: %v", ctx.GetOpId(), ctx.GetInstanceId(), val, err)
 						stats.IncTotalExceptions()
 						return nil
 					}
-					outdatas = append(outdatas, output.Bytes())
+					out.data = output.Bytes()
+					out.encoded = true
 				} else {
 					if ot, e := json.Marshal(r); e != nil {
 						logger.Warnf("sink node %s instance %d publish %s marshal error: %v", ctx.GetOpId(), ctx.GetInstanceId(), r, e)
 						stats.IncTotalExceptions()
 						return nil
 					} else {
-						outdatas = append(outdatas, ot)
+						out.data = ot
 					}
 				}
+				outs = append(outs, out)
 			}
 		}
 
 	case error:
-		outdatas = [][]byte{[]byte(fmt.Sprintf(`[{"error":"%s"}]`, val.Error()))}
+		outs = []*sinkOutput{{
+			data: []byte(fmt.Sprintf(`[{"error":"%s"}]`, val.Error())),
+			rows: []map[string]interface{}{{"error": val.Error()}},
+		}}
 	default:
-		outdatas = [][]byte{[]byte(fmt.Sprintf(`[{"error":"result is not a string but found %#v"}]`, val))}
+		msg := fmt.Sprintf("result is not a string but found %#v", val)
+		outs = []*sinkOutput{{
+			data: []byte(fmt.Sprintf(`[{"error":"%s"}]`, msg)),
+			rows: []map[string]interface{}{{"error": msg}},
+		}}
+	}
+	if oc.filter != nil {
+		var dropped int
+		if outs, dropped = oc.filter.limit(outs); dropped > 0 {
+			logger.Debugf("sink node %s instance %d drops %d data exceeding the maxRate", ctx.GetOpId(), ctx.GetInstanceId(), dropped)
+		}
+	}
+	if oc.props != nil {
+		for _, out := range outs {
+			props, err := oc.props.eval(out.rows)
+			if err != nil {
+				logger.Warnf("sink node %s instance %d publish %s dynamic properties error: %v", ctx.GetOpId(), ctx.GetInstanceId(), out.data, err)
+				stats.IncTotalExceptions()
+				return nil
+			}
+			out.props = props
+		}
+	}
+	if oc.enc != nil {
+		for _, out := range outs {
+			encoded, err := encodeOutData(oc.enc, out.data)
+			if err != nil {
+				logger.Warnf("sink node %s instance %d publish %s encode error: %v", ctx.GetOpId(), ctx.GetInstanceId(), out.data, err)
+				stats.IncTotalExceptions()
+				return nil
+			}
+			out.data = encoded
+			out.encoded = true
+		}
+	}
+	return outs
+}
+
+// newSinkEncoder returns the converter of the format property to encode the output data. It is nil for the default
+// json format or the format supported by the sink itself.
+func newSinkEncoder(sink api.Sink, format string, props map[string]interface{}) (message.Converter, error) {
+	if format == "" || strings.ToLower(format) == message.FormatJson {
+		return nil, nil
+	}
+	if fs, ok := sink.(api.FormatSink); ok && fs.SupportFormat(format) {
+		return nil, nil
 	}
-	return outdatas
+	return message.GetConverter(format, props)
 }
 
-func doCollectCacheTuple(sink api.Sink, item *CacheTuple, stats StatManager, retryInterval, retryCount int, omitIfEmpty bool, sendSingle bool, tp *template.Template, signalCh chan<- int, ctx api.StreamContext) {
+// encodeOutData decodes the json output data and encodes it by the converter. The integers are decoded as int64
+func encodeOutData(enc message.Converter, data []byte) ([]byte, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, fmt.Errorf("the result is not json: %v", err)
+	}
+	return enc.Encode(convertNumber(v))
+}
+
+func convertNumber(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = convertNumber(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = convertNumber(e)
+		}
+	}
+	return v
+}
+
+func doCollectCacheTuple(sink api.Sink, item *CacheTuple, stats StatManager, policy *retryPolicy, breaker *circuitBreaker, oc *outputConf, cache *Cache, dl *deadLetter, ctx api.StreamContext) {
 	stats.IncTotalRecordsIn()
 	stats.ProcessTimeStart()
 	defer stats.ProcessTimeEnd()
+	outs := getOutData(stats, ctx, item.data, oc)
+	if len(outs) == 0 {
+		// nothing to send, such as all the rows are filtered out
+		cache.complete(item.index)
+		return
+	}
+	sendCacheTuple(sink, item.index, outs, stats, policy, breaker, cache, dl, ctx)
+}
+
+// sendCacheTuple sends the output data of a cached tuple and retries by the policy. If the circuit breaker is open, the
+// tuple is failed in the cache instead of retrying so that it is replayed by the probe.
+func sendCacheTuple(sink api.Sink, index int, outs []*sinkOutput, stats StatManager, policy *retryPolicy, breaker *circuitBreaker, cache *Cache, dl *deadLetter, ctx api.StreamContext) {
 	logger := ctx.GetLogger()
-	outdatas := getOutData(stats, ctx, item.data, omitIfEmpty, sendSingle, tp)
-	for _, outdata := range outdatas {
+	retryCount := policy.count
+	// the cache is signaled once for all the outs, the data is completed only if all the outs are sent or kept by the
+	// dead letter sink
+	sent := true
+	for i, out := range outs {
+		attempts := 0
 	outerloop:
 		for {
 			select {
@@ -365,30 +843,42 @@ func doCollectCacheTuple(sink api.Sink, item *CacheTuple, stats StatManager, ret
 				logger.Infof("sink node %s instance %d stops data resending", ctx.GetOpId(), ctx.GetInstanceId())
 				return
 			default:
-				if err := sink.Collect(ctx, outdata); err != nil {
+				if !breaker.allow() {
+					rejectData(ctx, outs[i:], []int{index}, cache, dl, stats)
+					return
+				}
+				attempts++
+				if err := collectOutput(sink, ctx, out); err != nil {
 					stats.IncTotalExceptions()
-					logger.Warnf("sink node %s instance %d publish %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), outdata, err)
-					if retryInterval > 0 && retryCount > 0 {
+					logger.Warnf("sink node %s instance %d publish %s error: %v", ctx.GetOpId(), ctx.GetInstanceId(), out.data, err)
+					if breaker.failure() {
+						// reject the data in the next loop
+						continue
+					}
+					if policy.enabled() && retryCount > 0 {
 						retryCount--
-						time.Sleep(time.Duration(retryInterval) * time.Millisecond)
+						time.Sleep(policy.delay(attempts))
 						logger.Debugf("try again")
 					} else {
+						if dl == nil || !dl.send(ctx, out.data, err, attempts, stats) {
+							sent = false
+						}
 						break outerloop
 					}
 				} else {
 					logger.Debugf("success")
+					breaker.success()
 					stats.IncTotalRecordsOut()
-					select {
-					case signalCh <- item.index:
-					default:
-						logger.Warnf("sink cache missing response for %d", item.index)
-					}
-
 					break outerloop
 				}
 			}
 		}
 	}
+	if sent {
+		cache.complete(index)
+	} else {
+		cache.fail(index)
+	}
 }
 
 func doGetSink(name string, action map[string]interface{}) (api.Sink, error) {
@@ -407,6 +897,18 @@ func doGetSink(name string, action map[string]interface{}) (api.Sink, error) {
 		s = &sink.RestSink{}
 	case "nop":
 		s = &sink.NopSink{}
+	case "websocket":
+		s = &sink.WebsocketSink{}
+	case "memory":
+		s = &sink.MemorySink{}
+	case "kafka":
+		s = &sink.KafkaSink{}
+	case "sql":
+		s = &sink.SQLSink{}
+	case "redis":
+		s = &sink.RedisSink{}
+	case "file":
+		s = &sink.FileSink{}
 	default:
 		s, err = plugin.GetSink(name)
 		if err != nil {
@@ -457,3 +959,13 @@ func (m *SinkNode) close(ctx api.StreamContext, logger api.Logger) {
 func (m *SinkNode) SaveCache() {
 	m.tch <- struct{}{}
 }
+
+// CommitCheckpoint requests the workers of the sink instances which support two phase commit to commit the transactions
+func (m *SinkNode) CommitCheckpoint(checkpointId int64) {
+	m.mutex.RLock()
+	txns := m.txns
+	m.mutex.RUnlock()
+	for _, t := range txns {
+		t.requestCommit(checkpointId)
+	}
+}
@@ -1,11 +1,23 @@
 package node
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
 	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
 	"github.com/lf-edge/ekuiper/internal/topo/topotest/mocknode"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 )
@@ -107,3 +119,759 @@ func TestSinkTemplate_Apply(t *testing.T) {
 		}
 	}
 }
+
+type mockBatchSink struct {
+	*mocknode.MockSink
+	batches [][]interface{}
+}
+
+func (m *mockBatchSink) CollectBatch(_ api.StreamContext, data []interface{}) error {
+	m.batches = append(m.batches, data)
+	return nil
+}
+
+func TestSinkFilter_Apply(t *testing.T) {
+	conf.InitConf()
+	var tests = []struct {
+		config map[string]interface{}
+		data   []byte
+		result [][]byte
+	}{
+		{
+			config: map[string]interface{}{
+				"condition": "level > 2",
+			},
+			data:   []byte(`[{"a":"x","level":1},{"a":"y","level":3}]`),
+			result: [][]byte{[]byte(`[{"a":"y","level":3}]`)},
+		}, {
+			config: map[string]interface{}{
+				"condition":  "level > 2",
+				"fields":     []interface{}{"a"},
+				"sendSingle": true,
+			},
+			data:   []byte(`[{"a":"x","level":3},{"a":"y","level":4}]`),
+			result: [][]byte{[]byte(`{"a":"x"}`), []byte(`{"a":"y"}`)},
+		}, {
+			config: map[string]interface{}{
+				"condition": "level > 5",
+			},
+			data:   []byte(`[{"a":"x","level":1},{"a":"y","level":3}]`),
+			result: nil,
+		}, {
+			config: map[string]interface{}{
+				"condition": `upper(a) = "Y"`,
+			},
+			data:   []byte(`[{"a":"x","level":1},{"a":"y","level":3}]`),
+			result: [][]byte{[]byte(`[{"a":"y","level":3}]`)},
+		}, {
+			config: map[string]interface{}{
+				"fields":       []interface{}{"level", "b"},
+				"dataTemplate": `{{range .}}{{.level}};{{end}}`,
+			},
+			data:   []byte(`[{"a":"x","level":1},{"a":"y","level":3}]`),
+			result: [][]byte{[]byte(`1;3;`)},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := conf.Log.WithField("rule", "TestSinkFilter_Apply")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	for i, tt := range tests {
+		mockSink := mocknode.NewMockSink()
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		s.input <- tt.data
+		time.Sleep(1 * time.Second)
+		s.close(ctx, contextLogger)
+		results := mockSink.GetResults()
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.result, results)
+		}
+	}
+
+	var errTests = []map[string]interface{}{
+		{"condition": "level >"},
+		{"condition": 1},
+		{"fields": "a"},
+	}
+	for i, tt := range errTests {
+		if _, err := newSinkFilter(tt); err == nil {
+			t.Errorf("%d: expect error for %v", i, tt)
+		}
+	}
+}
+
+func TestSinkEmission(t *testing.T) {
+	conf.InitConf()
+	type step struct {
+		// the milliseconds to advance before sending the data
+		advance int
+		data    []byte
+	}
+	var tests = []struct {
+		config map[string]interface{}
+		steps  []step
+		result [][]byte
+	}{
+		{
+			config: map[string]interface{}{
+				"onChange":    true,
+				"onChangeKey": "id",
+				"sendSingle":  true,
+			},
+			steps: []step{
+				{data: []byte(`[{"id":1,"v":1},{"id":2,"v":1}]`)},
+				{data: []byte(`[{"id":1,"v":1},{"id":2,"v":2}]`)},
+				{data: []byte(`[{"id":1,"v":1},{"id":2,"v":1}]`)},
+			},
+			result: [][]byte{[]byte(`{"id":1,"v":1}`), []byte(`{"id":2,"v":1}`), []byte(`{"id":2,"v":2}`), []byte(`{"id":2,"v":1}`)},
+		}, {
+			config: map[string]interface{}{
+				"debounce": 1000,
+			},
+			steps: []step{
+				{data: []byte(`[{"v":1}]`)},
+				{advance: 500, data: []byte(`[{"v":1}]`)},
+				{data: []byte(`[{"v":2}]`)},
+				{advance: 500, data: []byte(`[{"v":1}]`)},
+			},
+			result: [][]byte{[]byte(`[{"v":1}]`), []byte(`[{"v":2}]`), []byte(`[{"v":1}]`)},
+		}, {
+			config: map[string]interface{}{
+				"debounce":    1000,
+				"debounceKey": "id",
+				"fields":      []interface{}{"id"},
+			},
+			steps: []step{
+				{data: []byte(`[{"id":1,"v":1}]`)},
+				{advance: 100, data: []byte(`[{"id":1,"v":2}]`)},
+				{advance: 100, data: []byte(`[{"id":2,"v":2}]`)},
+			},
+			result: [][]byte{[]byte(`[{"id":1}]`), []byte(`[{"id":2}]`)},
+		}, {
+			config: map[string]interface{}{
+				"maxRate": 2,
+			},
+			steps: []step{
+				{data: []byte(`[{"v":1}]`)},
+				{data: []byte(`[{"v":2}]`)},
+				{data: []byte(`[{"v":3}]`)},
+				{advance: 500, data: []byte(`[{"v":4}]`)},
+				{data: []byte(`[{"v":5}]`)},
+			},
+			result: [][]byte{[]byte(`[{"v":1}]`), []byte(`[{"v":2}]`), []byte(`[{"v":4}]`)},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := conf.Log.WithField("rule", "TestSinkEmission")
+
+	for i, tt := range tests {
+		mockclock.ResetClock(1000)
+		ctx, cancel := newCacheContext("TestSinkEmission", fmt.Sprintf("sink%d", i))
+		mockSink := mocknode.NewMockSink()
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		time.Sleep(100 * time.Millisecond)
+		for _, st := range tt.steps {
+			if st.advance > 0 {
+				mockclock.GetMockClock().Add(time.Duration(st.advance) * time.Millisecond)
+			}
+			s.input <- st.data
+			time.Sleep(50 * time.Millisecond)
+		}
+		time.Sleep(500 * time.Millisecond)
+		s.close(ctx, contextLogger)
+		cancel()
+		results := mockSink.GetResults()
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.result, results)
+		}
+	}
+
+	var errTests = []map[string]interface{}{
+		{"maxRate": "fast"},
+		{"debounce": -1},
+		{"onChange": "true"},
+		{"onChangeKey": 1},
+	}
+	for i, tt := range errTests {
+		if _, err := newSinkFilter(tt); err == nil {
+			t.Errorf("%d: expect error for %v", i, tt)
+		}
+	}
+}
+
+func TestSinkEmission_State(t *testing.T) {
+	conf.InitConf()
+	mockclock.ResetClock(1000)
+	ctx, cancel := newCacheContext("TestSinkEmission_State", "sink")
+	defer cancel()
+	sf, err := newSinkFilter(map[string]interface{}{"onChange": true, "debounce": 1000, "debounceKey": "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := sf.forInstance(ctx, 0)
+	rows, _ := f.apply([]map[string]interface{}{{"id": 1}})
+	if len(rows) != 1 {
+		t.Fatalf("expect to emit the first row but got %v", rows)
+	}
+	f1 := sf.forInstance(ctx, 1)
+	if rows, _ = f1.apply([]map[string]interface{}{{"id": 2}}); len(rows) != 1 {
+		t.Fatalf("expect to emit the first row of instance 1 but got %v", rows)
+	}
+	// the barrier received by instance 0 saves the states of all the instances
+	f.saveState(ctx)
+	// the restored instances suppress the same rows
+	sf, _ = newSinkFilter(map[string]interface{}{"onChange": true, "debounce": 1000, "debounceKey": "id"})
+	f = sf.forInstance(ctx, 0)
+	if rows, _ = f.apply([]map[string]interface{}{{"id": 1}}); len(rows) != 0 {
+		t.Errorf("expect the row to be suppressed after restore but got %v", rows)
+	}
+	f1 = sf.forInstance(ctx, 1)
+	if rows, _ = f1.apply([]map[string]interface{}{{"id": 2}}); len(rows) != 0 {
+		t.Errorf("expect the row of instance 1 to be suppressed after restore but got %v", rows)
+	}
+	if rows, _ = f1.apply([]map[string]interface{}{{"id": 1}}); len(rows) != 1 {
+		t.Errorf("expect the row to be emitted by another instance but got %v", rows)
+	}
+}
+
+func TestSinkFormat_Apply(t *testing.T) {
+	conf.InitConf()
+	var tests = []struct {
+		config map[string]interface{}
+		data   []byte
+		result [][]byte
+	}{
+		{
+			config: map[string]interface{}{
+				"format": "csv",
+				"fields": []interface{}{"b", "a"},
+			},
+			data:   []byte(`[{"a":1,"b":"hello"},{"a":2.5,"b":"world"}]`),
+			result: [][]byte{[]byte("hello,1\nworld,2.5")},
+		}, {
+			config: map[string]interface{}{
+				"format":      "influx",
+				"measurement": "m1",
+				"tags":        []interface{}{"b"},
+				"sendSingle":  true,
+			},
+			data:   []byte(`[{"a":1,"b":"hello"},{"a":2.5,"b":"world"}]`),
+			result: [][]byte{[]byte("m1,b=hello a=1i"), []byte("m1,b=world a=2.5")},
+		}, {
+			config: map[string]interface{}{
+				"format":       "csv",
+				"dataTemplate": `{"c":"{{.a}}"}`,
+				"sendSingle":   true,
+			},
+			data:   []byte(`[{"a":1,"b":"hello"}]`),
+			result: [][]byte{[]byte("1")},
+		}, {
+			config: map[string]interface{}{
+				"format":       "csv",
+				"dataTemplate": `a is {{.a}}`,
+				"sendSingle":   true,
+			},
+			data:   []byte(`[{"a":1,"b":"hello"}]`),
+			result: nil,
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := conf.Log.WithField("rule", "TestSinkFormat_Apply")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	for i, tt := range tests {
+		mockSink := mocknode.NewMockSink()
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		s.input <- tt.data
+		time.Sleep(1 * time.Second)
+		s.close(ctx, contextLogger)
+		results := mockSink.GetResults()
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.result, results)
+		}
+	}
+
+	s := NewSinkNodeWithSink("mockSink", mocknode.NewMockSink(), map[string]interface{}{"format": "xml"})
+	errCh := make(chan error, 1)
+	s.Open(ctx, errCh)
+	select {
+	case err := <-errCh:
+		if err.Error() != "invalid format xml" {
+			t.Errorf("expect invalid format error but got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expect invalid format error")
+	}
+}
+
+type mockPropsSink struct {
+	*mocknode.MockSink
+	props []map[string]string
+}
+
+func (m *mockPropsSink) CollectWithProps(ctx api.StreamContext, data interface{}, props map[string]string) error {
+	m.props = append(m.props, props)
+	return m.Collect(ctx, data)
+}
+
+func TestSinkDynamicProps(t *testing.T) {
+	conf.InitConf()
+	var tests = []struct {
+		config map[string]interface{}
+		data   [][]byte
+		result []map[string]string
+	}{
+		{
+			config: map[string]interface{}{
+				"sendSingle":   true,
+				"topic":        "alerts/{{.deviceId}}",
+				"static":       "s1",
+				"dataTemplate": `{{.deviceId}}`,
+			},
+			data:   [][]byte{[]byte(`[{"deviceId":"d1"},{"deviceId":"d2"}]`)},
+			result: []map[string]string{{"topic": "alerts/d1"}, {"topic": "alerts/d2"}},
+		}, {
+			config: map[string]interface{}{
+				"dataTemplate": `{{range .}}{{.deviceId}} {{end}}`,
+				"headers":      map[string]interface{}{"id": "{{(index . 0).deviceId}}", "static": "s1"},
+			},
+			data:   [][]byte{[]byte(`[{"deviceId":"d1"},{"deviceId":"d2"}]`)},
+			result: []map[string]string{{"headers.id": "d1"}},
+		}, {
+			config: map[string]interface{}{
+				"sendSingle": true,
+				"topic":      "alerts/{{.deviceId}}",
+				"static":     "s1",
+			},
+			data:   [][]byte{[]byte(`[{"deviceId":"d1"},{"deviceId":"d2"}]`)},
+			result: []map[string]string{{"topic": "alerts/d1"}, {"topic": "alerts/d2"}},
+		}, {
+			config: map[string]interface{}{
+				"batchSize": 2,
+				"topic":     `{{len .}}/{{(index . 0).deviceId}}`,
+			},
+			data:   [][]byte{[]byte(`[{"deviceId":"d1"}]`), []byte(`[{"deviceId":"d2"}]`)},
+			result: []map[string]string{{"topic": "2/d1"}},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := conf.Log.WithField("rule", "TestSinkDynamicProps")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	for i, tt := range tests {
+		mockSink := &mockPropsSink{MockSink: mocknode.NewMockSink()}
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		for _, d := range tt.data {
+			s.input <- d
+		}
+		time.Sleep(1 * time.Second)
+		s.close(ctx, contextLogger)
+		if !reflect.DeepEqual(tt.result, mockSink.props) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, mockSink.props)
+		}
+	}
+}
+
+type mockRawSink struct {
+	*mocknode.MockSink
+	raw []interface{}
+}
+
+func (m *mockRawSink) CollectRaw(_ api.StreamContext, data interface{}) error {
+	m.raw = append(m.raw, data)
+	return nil
+}
+
+func TestSinkRaw(t *testing.T) {
+	conf.InitConf()
+	var tests = []struct {
+		config map[string]interface{}
+		data   [][]byte
+		raw    []interface{}
+		result [][]byte
+	}{
+		{
+			config: map[string]interface{}{},
+			data:   [][]byte{[]byte(`[{"a":1},{"a":2}]`)},
+			raw:    []interface{}{[]map[string]interface{}{{"a": float64(1)}, {"a": float64(2)}}},
+		}, {
+			config: map[string]interface{}{"sendSingle": true},
+			data:   [][]byte{[]byte(`[{"a":1},{"a":2}]`)},
+			raw:    []interface{}{map[string]interface{}{"a": float64(1)}, map[string]interface{}{"a": float64(2)}},
+		}, {
+			config: map[string]interface{}{"dataTemplate": `{"b":{{(index . 0).a}}}`},
+			data:   [][]byte{[]byte(`[{"a":1},{"a":2}]`)},
+			result: [][]byte{[]byte(`{"b":1}`)},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := conf.Log.WithField("rule", "TestSinkRaw")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	for i, tt := range tests {
+		mockSink := &mockRawSink{MockSink: mocknode.NewMockSink()}
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		for _, d := range tt.data {
+			s.input <- d
+		}
+		time.Sleep(100 * time.Millisecond)
+		s.close(ctx, contextLogger)
+		if !reflect.DeepEqual(tt.raw, mockSink.raw) || !reflect.DeepEqual(tt.result, mockSink.GetResults()) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v %s\n\ngot=%v %s\n\n", i, tt.raw, tt.result, mockSink.raw, mockSink.GetResults())
+		}
+	}
+}
+
+func TestNewDynamicProps(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		keys  []string
+		err   string
+	}{
+		{
+			props: map[string]interface{}{
+				"topic":        "alerts/{{.deviceId}}",
+				"qos":          1,
+				"static":       "s1",
+				"dataTemplate": "{{.deviceId}}",
+				"headers":      map[string]interface{}{"id": "{{.deviceId}}", "static": "s1"},
+			},
+			keys: []string{"headers.id", "topic"},
+		}, {
+			props: map[string]interface{}{"topic": "result/{{.a"},
+			err:   "property topic result/{{.a is invalid: template: topic:1: unclosed action",
+		},
+	}
+	for i, tt := range tests {
+		p, err := newDynamicProps(tt.props)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%d: error mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: error %v", i, err)
+			continue
+		}
+		var keys []string
+		for k := range p {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(tt.keys, keys) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.keys, keys)
+		}
+	}
+}
+
+func TestSinkBatch_Apply(t *testing.T) {
+	conf.InitConf()
+	var tests = []struct {
+		config map[string]interface{}
+		data   [][]byte
+		result [][]byte
+	}{
+		{
+			config: map[string]interface{}{
+				"batchSize": 3,
+			},
+			data:   [][]byte{[]byte(`[{"a":1}]`), []byte(`[{"a":2}]`), []byte(`[{"a":3}]`), []byte(`[{"a":4}]`)},
+			result: [][]byte{[]byte(`[{"a":1},{"a":2},{"a":3}]`)},
+		}, {
+			config: map[string]interface{}{
+				"batchSize": 3,
+			},
+			data:   [][]byte{[]byte(`[{"a":1},{"a":2}]`), []byte(`[{"a":3},{"a":4}]`), []byte(`[{"a":5}]`)},
+			result: [][]byte{[]byte(`[{"a":1},{"a":2},{"a":3},{"a":4}]`)},
+		}, {
+			config: map[string]interface{}{
+				"batchSize":  2,
+				"sendSingle": true,
+			},
+			data:   [][]byte{[]byte(`[{"a":1},{"a":2},{"a":3}]`)},
+			result: [][]byte{[]byte(`[{"a":1},{"a":2},{"a":3}]`)},
+		}, {
+			config: map[string]interface{}{
+				"batchSize":    2,
+				"sendSingle":   true,
+				"dataTemplate": `a={{.a}}`,
+			},
+			data:   [][]byte{[]byte(`[{"a":1}]`), []byte(`[{"a":2}]`)},
+			result: [][]byte{[]byte("a=1\na=2")},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	contextLogger := conf.Log.WithField("rule", "TestSinkBatch_Apply")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	for i, tt := range tests {
+		mockSink := mocknode.NewMockSink()
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.config)
+		s.Open(ctx, make(chan error))
+		for _, d := range tt.data {
+			s.input <- d
+		}
+		time.Sleep(1 * time.Second)
+		s.close(ctx, contextLogger)
+		results := mockSink.GetResults()
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.result, results)
+		}
+	}
+}
+
+func TestSinkBatch_Linger(t *testing.T) {
+	conf.InitConf()
+	mockclock.ResetClock(1000)
+	contextLogger := conf.Log.WithField("rule", "TestSinkBatch_Linger")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	mockSink := &mockBatchSink{MockSink: mocknode.NewMockSink()}
+	s := NewSinkNodeWithSink("mockSink", mockSink, map[string]interface{}{
+		"batchSize": 10,
+		"lingerMs":  500,
+	})
+	s.Open(ctx, make(chan error))
+	s.input <- []byte(`[{"a":1}]`)
+	s.input <- []byte(`[{"a":2}]`)
+	time.Sleep(100 * time.Millisecond)
+	if len(mockSink.batches) != 0 {
+		t.Errorf("should not send before linger but got %s", mockSink.batches)
+	}
+	mockclock.GetMockClock().Add(500 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	exp := [][]interface{}{{[]byte(`[{"a":1}]`), []byte(`[{"a":2}]`)}}
+	if !reflect.DeepEqual(exp, mockSink.batches) {
+		t.Errorf("result mismatch:\n\nexp=%s\n\ngot=%s\n\n", exp, mockSink.batches)
+	}
+	if len(mockSink.GetResults()) != 0 {
+		t.Errorf("batch sink should not receive data by collect but got %s", mockSink.GetResults())
+	}
+}
+
+func TestSinkBatch_FlushOnDone(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	disableCache := conf.Config.Sink.DisableCache
+	defer func() {
+		conf.Config.Sink.DisableCache = disableCache
+	}()
+	for i, dc := range []bool{true, false} {
+		conf.Config.Sink.DisableCache = dc
+		rule := fmt.Sprintf("TestSinkBatch_FlushOnDone%d", i)
+		defer os.RemoveAll(path.Join(dataDir, "sink", rule))
+		ctx, cancel := newCacheContext(rule, "sink")
+		mockSink := &mockBatchSink{MockSink: mocknode.NewMockSink()}
+		s := NewSinkNodeWithSink("mockSink", mockSink, map[string]interface{}{
+			"batchSize": 10,
+		})
+		s.Open(ctx, make(chan error))
+		s.input <- []byte(`[{"a":1}]`)
+		s.input <- []byte(`[{"a":2}]`)
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+		exp := [][]interface{}{{[]byte(`[{"a":1}]`), []byte(`[{"a":2}]`)}}
+		if !reflect.DeepEqual(exp, mockSink.batches) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, exp, mockSink.batches)
+		}
+	}
+}
+
+type mockErrorSink struct {
+	*mocknode.MockSink
+}
+
+func (m *mockErrorSink) Collect(_ api.StreamContext, _ interface{}) error {
+	return errors.New("connection refused")
+}
+
+func TestSinkDeadLetter(t *testing.T) {
+	conf.InitConf()
+	mockclock.ResetClock(1000)
+	p := filepath.Join(t.TempDir(), "dead.log")
+	contextLogger := conf.Log.WithField("rule", "TestSinkDeadLetter")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+
+	s := NewSinkNodeWithSink("mockSink", &mockErrorSink{MockSink: mocknode.NewMockSink()}, map[string]interface{}{
+		"deadLetter": map[string]interface{}{
+			"file": map[string]interface{}{
+				"path": p,
+			},
+		},
+	})
+	s.Open(ctx, make(chan error))
+	s.input <- []byte(`[{"a":1}]`)
+	s.input <- []byte(`not json`)
+	time.Sleep(100 * time.Millisecond)
+	metrics := s.GetMetrics()
+	if len(metrics) != 1 || metrics[0][len(MetricNames)] != int64(2) {
+		t.Errorf("dead letter metrics mismatch, got %v", metrics)
+	}
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []DeadLetter
+	for _, l := range bytesLines(content) {
+		var r DeadLetter
+		if err := json.Unmarshal(l, &r); err != nil {
+			t.Fatalf("invalid dead letter %s: %v", l, err)
+		}
+		results = append(results, r)
+	}
+	exp := []DeadLetter{
+		{Payload: []interface{}{map[string]interface{}{"a": float64(1)}}, Error: "connection refused", Sink: "mockSink", Attempts: 1, Timestamp: 1000},
+		{Payload: "not json", Error: "connection refused", Sink: "mockSink", Attempts: 1, Timestamp: 1000},
+	}
+	if !reflect.DeepEqual(exp, results) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, results)
+	}
+}
+
+func bytesLines(b []byte) [][]byte {
+	var lines [][]byte
+	for _, l := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(l)) > 0 {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+type mockTxnSink struct {
+	*mocknode.MockSink
+	calls []string
+	mutex sync.Mutex
+}
+
+func (m *mockTxnSink) call(name string, ctx api.StreamContext, checkpointId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.calls = append(m.calls, fmt.Sprintf("%s %d-%d", name, ctx.GetInstanceId(), checkpointId))
+	return nil
+}
+
+func (m *mockTxnSink) BeginTransaction(ctx api.StreamContext, checkpointId int64) error {
+	return m.call("begin", ctx, checkpointId)
+}
+
+func (m *mockTxnSink) PreCommit(ctx api.StreamContext, checkpointId int64) error {
+	return m.call("preCommit", ctx, checkpointId)
+}
+
+func (m *mockTxnSink) Commit(ctx api.StreamContext, checkpointId int64) error {
+	return m.call("commit", ctx, checkpointId)
+}
+
+func (m *mockTxnSink) Abort(ctx api.StreamContext, checkpointId int64) error {
+	return m.call("abort", ctx, checkpointId)
+}
+
+func (m *mockTxnSink) getCalls() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.calls
+}
+
+type mockBarrierHandler struct{}
+
+func (h *mockBarrierHandler) Process(_ *checkpoint.BufferOrEvent, _ api.StreamContext) bool {
+	return true
+}
+
+func (h *mockBarrierHandler) SetOutput(_ chan<- *checkpoint.BufferOrEvent) {}
+
+func TestSinkTxn(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Join(dataDir, "sink", "TestSinkTxn"))
+	ctx, cancel := newCacheContext("TestSinkTxn", "sink")
+
+	mockSink := &mockTxnSink{MockSink: mocknode.NewMockSink()}
+	s := NewSinkNodeWithSink("mockSink", mockSink, map[string]interface{}{})
+	s.SetQos(api.ExactlyOnce)
+	s.SetBarrierHandler(&mockBarrierHandler{})
+	s.Open(ctx, make(chan error))
+	s.input <- []byte(`[{"a":1}]`)
+	s.input <- &checkpoint.BufferOrEvent{Data: &checkpoint.Barrier{CheckpointId: 1, OpId: "op"}, Channel: "op"}
+	time.Sleep(200 * time.Millisecond)
+	s.CommitCheckpoint(1)
+	// the commit is run by the worker
+	time.Sleep(100 * time.Millisecond)
+	exp := []string{"abort 0-0", "begin 0-0", "preCommit 0-1", "begin 0-1", "commit 0-1"}
+	if !reflect.DeepEqual(exp, mockSink.getCalls()) {
+		t.Errorf("calls mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, mockSink.getCalls())
+	}
+	if v, _ := ctx.GetState(SINK_TXN_KEY + "0"); v != int64(1) {
+		t.Errorf("expect the transaction state 1 but got %v", v)
+	}
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+
+	// the transactions of the restored checkpoint are committed after restart
+	ctx, cancel = ctx.WithCancel()
+	defer cancel()
+	mockSink = &mockTxnSink{MockSink: mocknode.NewMockSink()}
+	s = NewSinkNodeWithSink("mockSink", mockSink, map[string]interface{}{})
+	s.SetQos(api.ExactlyOnce)
+	s.SetBarrierHandler(&mockBarrierHandler{})
+	s.Open(ctx, make(chan error))
+	time.Sleep(100 * time.Millisecond)
+	exp = []string{"commit 0-1", "abort 0-1", "begin 0-1"}
+	if !reflect.DeepEqual(exp, mockSink.getCalls()) {
+		t.Errorf("calls mismatch after restart:\n\nexp=%v\n\ngot=%v\n\n", exp, mockSink.getCalls())
+	}
+}
+
+func TestSinkTxn_Concurrency(t *testing.T) {
+	conf.InitConf()
+	ctx, cancel := newCacheContext("TestSinkTxn_Concurrency", "sink")
+	defer cancel()
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{"concurrency": 2},
+			err:   "concurrency 2 is not supported by the transactional sink for exactly once qos",
+		}, {
+			props: map[string]interface{}{"runAsync": true},
+			err:   "runAsync is not supported by the transactional sink for exactly once qos",
+		},
+	}
+	for i, tt := range tests {
+		mockSink := &mockTxnSink{MockSink: mocknode.NewMockSink()}
+		s := NewSinkNodeWithSink("mockSink", mockSink, tt.props)
+		// the mock sink node has a sink for each instance
+		s.sinks = []api.Sink{mockSink, mockSink}
+		s.SetQos(api.ExactlyOnce)
+		s.SetBarrierHandler(&mockBarrierHandler{})
+		errCh := make(chan error, 2)
+		s.Open(ctx, errCh)
+		select {
+		case err := <-errCh:
+			if err.Error() != tt.err {
+				t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.err, err)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("%d \texpect error %s", i, tt.err)
+		}
+	}
+}
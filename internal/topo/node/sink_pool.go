@@ -0,0 +1,256 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	kctx "github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"gopkg.in/yaml.v3"
+	"sync"
+)
+
+// SharedSinkConf is the file to define the named sink resources grouped by the sink type. A resource is referred by
+// the resource property of the actions whose shared property is true.
+const SharedSinkConf = "sinks/shared.yaml"
+
+//// Package vars and funcs
+
+var (
+	sinkPoolInstance = &sinkPool{
+		registry: make(map[string]*sinkSingleton),
+	}
+)
+
+// attachSharedSink returns the sink of the named resource for a sink instance of a rule and the properties of the
+// resource. The resource is configured and opened when it is attached for the first time. Close the returned sink to
+// detach it, and the resource is closed after all the instances are detached.
+func attachSharedSink(sinkType string, resource string, instanceKey string) (api.Sink, map[string]interface{}, error) {
+	rkey := fmt.Sprintf("%s.%s", sinkType, resource)
+	s, err := sinkPoolInstance.attach(rkey, sinkType, resource, instanceKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return newSharedSink(&sharedSink{sinkSingleton: s, rkey: rkey, instanceKey: instanceKey}), s.props, nil
+}
+
+func getSharedSinkConf(sinkType string, resource string) (map[string]interface{}, error) {
+	b, err := conf.LoadConf(SharedSinkConf)
+	if err != nil {
+		return nil, fmt.Errorf("fail to load shared sink file %s: %v", SharedSinkConf, err)
+	}
+	resources := make(map[string]map[string]interface{})
+	if err := yaml.Unmarshal(b, &resources); err != nil {
+		return nil, fmt.Errorf("fail to parse shared sink file %s: %v", SharedSinkConf, err)
+	}
+	props, ok := resources[sinkType][resource].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("shared sink %s.%s is not found in %s", sinkType, resource, SharedSinkConf)
+	}
+	return props, nil
+}
+
+//// data types
+
+/*
+ *	Pool for all the shared sink resources.
+ *  Create and open the sink when the resource is attached the first time, later attaches reuse the sink.
+ *  When a rule is closed, its sink instances are detached. If all instances are detached, close the sink and remove it
+ *  from the pool.
+ */
+type sinkPool struct {
+	registry map[string]*sinkSingleton
+	sync.RWMutex
+}
+
+func (p *sinkPool) attach(k string, sinkType string, resource string, instanceKey string) (*sinkSingleton, error) {
+	p.Lock()
+	defer p.Unlock()
+	s, ok := p.registry[k]
+	if !ok {
+		props, err := getSharedSinkConf(sinkType, resource)
+		if err != nil {
+			return nil, err
+		}
+		sink, err := getSink(sinkType, props)
+		if err != nil {
+			return nil, err
+		}
+		contextLogger := conf.Log.WithField("sink_pool", k)
+		ctx, cancel := kctx.WithValue(kctx.Background(), kctx.LoggerKey, contextLogger).WithCancel()
+		if err := sink.Open(ctx); err != nil {
+			cancel()
+			return nil, err
+		}
+		s = &sinkSingleton{
+			sink:   sink,
+			props:  props,
+			ctx:    ctx,
+			cancel: cancel,
+			refs:   make(map[string]bool),
+		}
+		p.registry[k] = s
+		contextLogger.Infof("Open sink %s shared instance %s successfully", sinkType, resource)
+	}
+	if s.refs[instanceKey] {
+		// should not happen
+		return nil, fmt.Errorf("fail to attach shared sink %s, already attached by %s", k, instanceKey)
+	}
+	s.refs[instanceKey] = true
+	return s, nil
+}
+
+// detach detaches an instance and closes the sink if all instances are detached. It does nothing if the instance is
+// already detached.
+func (p *sinkPool) detach(k string, instanceKey string) error {
+	p.Lock()
+	defer p.Unlock()
+	s, ok := p.registry[k]
+	if !ok || !s.refs[instanceKey] {
+		return nil
+	}
+	delete(s.refs, instanceKey)
+	if len(s.refs) > 0 {
+		return nil
+	}
+	delete(p.registry, k)
+	s.cancel()
+	s.ctx.GetLogger().Infof("Close shared sink %s as all instances are detached", k)
+	return s.sink.Close(s.ctx)
+}
+
+// Hold the only sink for a shared resource and the instances attached to it. The calls to the sink are serialized as
+// the sinks are not required to be thread safe.
+type sinkSingleton struct {
+	sink   api.Sink               // immutable
+	props  map[string]interface{} // immutable
+	ctx    api.StreamContext      // immutable
+	cancel context.CancelFunc     // immutable
+	refs   map[string]bool        // guarded by the pool lock
+	mutex  sync.Mutex
+}
+
+// sharedSink is the sink of an instance attached to a shared resource. The optional interfaces of the sink are
+// forwarded except the TwoPhaseCommitSink as the transactions cannot be shared by the rules.
+type sharedSink struct {
+	*sinkSingleton
+	rkey        string
+	instanceKey string
+}
+
+// newSharedSink returns the sink of the instance which implements the BatchSink, DynamicPropsSink and RawSink only if
+// the shared sink implements them, so that the sink node handles the others as for the sinks not shared.
+func newSharedSink(s *sharedSink) api.Sink {
+	_, bs := s.sink.(api.BatchSink)
+	_, ds := s.sink.(api.DynamicPropsSink)
+	_, rs := s.sink.(api.RawSink)
+	switch {
+	case bs && ds && rs:
+		return &struct {
+			*sharedSink
+			sharedBatchSink
+			sharedPropsSink
+			sharedRawSink
+		}{s, sharedBatchSink{s}, sharedPropsSink{s}, sharedRawSink{s}}
+	case bs && ds:
+		return &struct {
+			*sharedSink
+			sharedBatchSink
+			sharedPropsSink
+		}{s, sharedBatchSink{s}, sharedPropsSink{s}}
+	case bs && rs:
+		return &struct {
+			*sharedSink
+			sharedBatchSink
+			sharedRawSink
+		}{s, sharedBatchSink{s}, sharedRawSink{s}}
+	case ds && rs:
+		return &struct {
+			*sharedSink
+			sharedPropsSink
+			sharedRawSink
+		}{s, sharedPropsSink{s}, sharedRawSink{s}}
+	case bs:
+		return &struct {
+			*sharedSink
+			sharedBatchSink
+		}{s, sharedBatchSink{s}}
+	case ds:
+		return &struct {
+			*sharedSink
+			sharedPropsSink
+		}{s, sharedPropsSink{s}}
+	case rs:
+		return &struct {
+			*sharedSink
+			sharedRawSink
+		}{s, sharedRawSink{s}}
+	default:
+		return s
+	}
+}
+
+// Open does nothing as the sink is opened by the pool
+func (s *sharedSink) Open(_ api.StreamContext) error {
+	return nil
+}
+
+// Configure does nothing as the sink is configured by the resource
+func (s *sharedSink) Configure(_ map[string]interface{}) error {
+	return nil
+}
+
+func (s *sharedSink) Collect(ctx api.StreamContext, data interface{}) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.sink.Collect(ctx, data)
+}
+
+type sharedBatchSink struct {
+	s *sharedSink
+}
+
+func (b sharedBatchSink) CollectBatch(ctx api.StreamContext, data []interface{}) error {
+	b.s.mutex.Lock()
+	defer b.s.mutex.Unlock()
+	return b.s.sink.(api.BatchSink).CollectBatch(ctx, data)
+}
+
+type sharedPropsSink struct {
+	s *sharedSink
+}
+
+func (p sharedPropsSink) CollectWithProps(ctx api.StreamContext, data interface{}, props map[string]string) error {
+	p.s.mutex.Lock()
+	defer p.s.mutex.Unlock()
+	return p.s.sink.(api.DynamicPropsSink).CollectWithProps(ctx, data, props)
+}
+
+type sharedRawSink struct {
+	s *sharedSink
+}
+
+func (r sharedRawSink) CollectRaw(ctx api.StreamContext, data interface{}) error {
+	r.s.mutex.Lock()
+	defer r.s.mutex.Unlock()
+	return r.s.sink.(api.RawSink).CollectRaw(ctx, data)
+}
+
+func (s *sharedSink) SupportFormat(format string) bool {
+	fs, ok := s.sink.(api.FormatSink)
+	return ok && fs.SupportFormat(format)
+}
+
+func (s *sharedSink) Flush(ctx api.StreamContext) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if f, ok := s.sink.(api.Flushable); ok {
+		return f.Flush(ctx)
+	}
+	return nil
+}
+
+// Close detaches the instance from the shared resource
+func (s *sharedSink) Close(_ api.StreamContext) error {
+	return sinkPoolInstance.detach(s.rkey, s.instanceKey)
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mocknode"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSinkPool(t *testing.T) {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(path.Join(dataDir, "shared"))
+	var nodes []*SinkNode
+	var cancels []func()
+	for i, rule := range []string{"TestSinkPool0", "TestSinkPool1"} {
+		defer os.RemoveAll(path.Join(dataDir, "sink", rule))
+		ctx, cancel := newCacheContext(rule, "file")
+		n := NewSinkNode("file", "file", map[string]interface{}{
+			"shared":   true,
+			"resource": "sharedFile",
+		})
+		n.Open(ctx, make(chan error))
+		time.Sleep(100 * time.Millisecond)
+		n.input <- []byte(fmt.Sprintf(`[{"rule":%d}]`, i))
+		nodes = append(nodes, n)
+		cancels = append(cancels, cancel)
+	}
+	time.Sleep(200 * time.Millisecond)
+	s, ok := sinkPoolInstance.registry["file.sharedFile"]
+	if !ok || len(sinkPoolInstance.registry) != 1 || len(s.refs) != 2 {
+		t.Fatalf("expect 1 shared sink attached by 2 instances but got %v", sinkPoolInstance.registry)
+	}
+	// the metrics are separated by rules
+	for i, n := range nodes {
+		if metrics := n.GetMetrics(); len(metrics) != 1 || metrics[0][1] != int64(1) {
+			t.Errorf("%d: expect 1 record out but got metrics %v", i, metrics)
+		}
+	}
+
+	cancels[0]()
+	time.Sleep(100 * time.Millisecond)
+	if len(sinkPoolInstance.registry) != 1 || len(s.refs) != 1 {
+		t.Errorf("expect the shared sink is kept for the other rule but got %v", sinkPoolInstance.registry)
+	}
+	cancels[1]()
+	time.Sleep(100 * time.Millisecond)
+	if len(sinkPoolInstance.registry) != 0 {
+		t.Errorf("expect the shared sink is closed but got %v", sinkPoolInstance.registry)
+	}
+	content, err := ioutil.ReadFile(path.Join(dataDir, "shared", "result.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for _, l := range bytesLines(content) {
+		lines = append(lines, string(l))
+	}
+	sort.Strings(lines)
+	exp := []string{`{"rule":0}`, `{"rule":1}`}
+	if !reflect.DeepEqual(exp, lines) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, lines)
+	}
+
+	if _, _, err := attachSharedSink("file", "notExist", "rule.file.0"); err == nil || err.Error() != "shared sink file.notExist is not found in sinks/shared.yaml" {
+		t.Errorf("expect not found error but got %v", err)
+	}
+}
+
+func TestSharedSinkInterfaces(t *testing.T) {
+	var tests = []struct {
+		sink  api.Sink
+		props bool
+		raw   bool
+		batch bool
+	}{
+		{sink: mocknode.NewMockSink()},
+		{sink: &mockPropsSink{MockSink: mocknode.NewMockSink()}, props: true},
+		{sink: &mockRawSink{MockSink: mocknode.NewMockSink()}, raw: true},
+	}
+	for i, tt := range tests {
+		s := newSharedSink(&sharedSink{sinkSingleton: &sinkSingleton{sink: tt.sink}})
+		_, props := s.(api.DynamicPropsSink)
+		_, raw := s.(api.RawSink)
+		_, batch := s.(api.BatchSink)
+		if props != tt.props || raw != tt.raw || batch != tt.batch {
+			t.Errorf("%d: expect props %v, raw %v and batch %v but got %v, %v and %v", i, tt.props, tt.raw, tt.batch, props, raw, batch)
+		}
+	}
+}
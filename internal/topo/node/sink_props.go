@@ -0,0 +1,77 @@
+package node
+
+import (
+	"bytes"
+	"fmt"
+	ct "github.com/lf-edge/ekuiper/internal/template"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"strings"
+	"text/template"
+)
+
+// dynamicProps are the string properties of the action which are go templates. The string values of a map property
+// such as the headers are keyed by "<property>.<key>".
+type dynamicProps map[string]*template.Template
+
+// newDynamicProps parses the string properties containing "{{" except the dataTemplate which is handled by the sink node
+func newDynamicProps(props map[string]interface{}) (dynamicProps, error) {
+	result := make(dynamicProps)
+	for k, v := range props {
+		if k == "dataTemplate" {
+			continue
+		}
+		switch t := v.(type) {
+		case string:
+			if err := result.parse(k, t); err != nil {
+				return nil, err
+			}
+		case map[string]interface{}:
+			for mk, mv := range t {
+				if s, ok := mv.(string); ok {
+					if err := result.parse(k+"."+mk, s); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+func (p dynamicProps) parse(k string, s string) error {
+	if !strings.Contains(s, "{{") {
+		return nil
+	}
+	tp, err := template.New(k).Funcs(ct.FuncMap).Parse(s)
+	if err != nil {
+		return fmt.Errorf("property %s %s is invalid: %v", k, s, err)
+	}
+	p[k] = tp
+	return nil
+}
+
+// eval evaluates the templates by the result before encoding, which is a row or the rows
+func (p dynamicProps) eval(data interface{}) (map[string]string, error) {
+	result := make(map[string]string, len(p))
+	for k, tp := range p {
+		var output bytes.Buffer
+		if err := tp.Execute(&output, data); err != nil {
+			return nil, fmt.Errorf("run template of property %s with data %v error: %v", k, data, err)
+		}
+		result[k] = output.String()
+	}
+	return result, nil
+}
+
+// sinkDynamicProps returns the dynamic properties of the action if the sink supports them and any property is a
+// template. The properties are evaluated by each output data and passed to CollectWithProps.
+func sinkDynamicProps(sink api.Sink, props map[string]interface{}) (dynamicProps, error) {
+	if _, ok := sink.(api.DynamicPropsSink); !ok {
+		return nil, nil
+	}
+	dp, err := newDynamicProps(props)
+	if err != nil || len(dp) == 0 {
+		return nil, err
+	}
+	return dp, nil
+}
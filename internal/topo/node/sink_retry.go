@@ -0,0 +1,164 @@
+package node
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	BACKOFF_FIXED       = "fixed"
+	BACKOFF_EXPONENTIAL = "exponential"
+)
+
+// retryPolicy defines how many times and how long to wait before retrying to send the data of the sink
+type retryPolicy struct {
+	// the interval in milliseconds before the first retry
+	interval int
+	count    int
+	backoff  string
+	// for exponential backoff, the interval is multiplied by the multiplier for each retry until maxInterval
+	maxInterval int
+	multiplier  float64
+	// the interval is randomized by ±jitter ratio so that the sinks of different rules do not retry in lockstep
+	jitter float64
+}
+
+// delay returns the wait time before the n-th retry which starts from 1
+func (p *retryPolicy) delay(n int) time.Duration {
+	d := float64(p.interval)
+	if p.backoff == BACKOFF_EXPONENTIAL && n > 1 {
+		d = d * math.Pow(p.multiplier, float64(n-1))
+		if p.maxInterval > 0 && d > float64(p.maxInterval) {
+			d = float64(p.maxInterval)
+		}
+	}
+	if p.jitter > 0 {
+		d = d * (1 + p.jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(d) * time.Millisecond
+}
+
+func (p *retryPolicy) enabled() bool {
+	return p.interval > 0 && p.count > 0
+}
+
+const (
+	BREAKER_CLOSED    = "closed"
+	BREAKER_OPEN      = "open"
+	BREAKER_HALF_OPEN = "half_open"
+)
+
+// circuitBreaker stops sending to the external system of a sink instance after the threshold of consecutive failures.
+// After openMs, it turns half open to allow a probe. If the probe succeeds, the breaker is closed; otherwise it is
+// opened again. The data which is not allowed to send is kept in the sink cache and replayed to probe.
+type circuitBreaker struct {
+	threshold int
+	openMs    int64
+
+	mutex    sync.Mutex
+	state    string
+	failures int
+	openedAt int64
+}
+
+func newCircuitBreaker(threshold int, openMs int) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &circuitBreaker{
+		threshold: threshold,
+		openMs:    int64(openMs),
+		state:     BREAKER_CLOSED,
+	}
+}
+
+// allow returns whether the data can be sent. If the breaker has been open for openMs, it turns half open and only
+// allows one probe until the result is reported by success or failure.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.state {
+	case BREAKER_CLOSED:
+		return true
+	case BREAKER_OPEN:
+		if conf.GetNowInMilli()-b.openedAt >= b.openMs {
+			b.state = BREAKER_HALF_OPEN
+			return true
+		}
+	}
+	return false
+}
+
+func (b *circuitBreaker) success() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures = 0
+	b.state = BREAKER_CLOSED
+}
+
+// failure reports a failure and returns true if the breaker is open
+func (b *circuitBreaker) failure() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.failures++
+	if b.state == BREAKER_HALF_OPEN || (b.state == BREAKER_CLOSED && b.failures >= b.threshold) {
+		b.state = BREAKER_OPEN
+		b.openedAt = conf.GetNowInMilli()
+	}
+	return b.state == BREAKER_OPEN
+}
+
+// probeReady returns whether the breaker has been open for openMs so that the failed data can be replayed to probe
+func (b *circuitBreaker) probeReady() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state == BREAKER_OPEN && conf.GetNowInMilli()-b.openedAt >= b.openMs
+}
+
+func (b *circuitBreaker) getState() string {
+	if b == nil {
+		return BREAKER_CLOSED
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.state
+}
+
+var errBreakerOpen = fmt.Errorf("circuit breaker is open")
+
+// rejectData handles the data which is not sent as the breaker is open. If the cache is enabled, the data is failed in
+// the cache to replay by the probe. Otherwise, the data is sent to the dead letter sink, or dropped and counted as an
+// exception.
+func rejectData(ctx api.StreamContext, data []*sinkOutput, indexes []int, cache *Cache, dl *deadLetter, stats StatManager) {
+	logger := ctx.GetLogger()
+	if cache != nil {
+		stats.IncTotalExceptions()
+		logger.Debugf("sink node %s instance %d keeps %d data in the cache as the circuit breaker is open", ctx.GetOpId(), ctx.GetInstanceId(), len(data))
+		cache.fail(indexes...)
+		return
+	}
+	for _, d := range data {
+		if dl != nil && dl.send(ctx, d.data, errBreakerOpen, 0, stats) {
+			continue
+		}
+		stats.IncTotalExceptions()
+		logger.Warnf("sink node %s instance %d drops %s as the circuit breaker is open", ctx.GetOpId(), ctx.GetInstanceId(), d.data)
+	}
+}
@@ -0,0 +1,280 @@
+package node
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mocknode"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	var tests = []struct {
+		policy *retryPolicy
+		delays []time.Duration
+	}{
+		{
+			policy: &retryPolicy{interval: 1000, count: 3, backoff: BACKOFF_FIXED},
+			delays: []time.Duration{time.Second, time.Second, time.Second},
+		}, {
+			policy: &retryPolicy{interval: 100, count: 5, backoff: BACKOFF_EXPONENTIAL, multiplier: 2, maxInterval: 500},
+			delays: []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 500 * time.Millisecond, 500 * time.Millisecond},
+		}, {
+			policy: &retryPolicy{interval: 100, count: 3, backoff: BACKOFF_EXPONENTIAL, multiplier: 1.5},
+			delays: []time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 225 * time.Millisecond},
+		},
+	}
+	fmt.Printf("The test bucket size is %d.\n\n", len(tests))
+	for i, tt := range tests {
+		var delays []time.Duration
+		for n := 1; n <= len(tt.delays); n++ {
+			delays = append(delays, tt.policy.delay(n))
+		}
+		if !reflect.DeepEqual(tt.delays, delays) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.delays, delays)
+		}
+	}
+	p := &retryPolicy{interval: 1000, count: 3, backoff: BACKOFF_FIXED, jitter: 0.2}
+	for i := 0; i < 100; i++ {
+		if d := p.delay(1); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Errorf("delay %v with jitter is out of range", d)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	mockclock.ResetClock(1000)
+	b := newCircuitBreaker(2, 500)
+	if !b.allow() || b.failure() || b.getState() != BREAKER_CLOSED {
+		t.Errorf("breaker should be closed after 1 failure")
+	}
+	if !b.allow() || !b.failure() || b.getState() != BREAKER_OPEN {
+		t.Errorf("breaker should be open after 2 failures")
+	}
+	if b.allow() {
+		t.Errorf("open breaker should not allow")
+	}
+	if b.probeReady() {
+		t.Errorf("breaker should not probe before the open interval")
+	}
+	mockclock.GetMockClock().Add(500 * time.Millisecond)
+	if !b.probeReady() {
+		t.Errorf("breaker should probe after the open interval")
+	}
+	if !b.allow() || b.getState() != BREAKER_HALF_OPEN || b.allow() {
+		t.Errorf("breaker should allow one probe in half open")
+	}
+	if !b.failure() || b.getState() != BREAKER_OPEN {
+		t.Errorf("breaker should be open after the probe fails")
+	}
+	mockclock.GetMockClock().Add(500 * time.Millisecond)
+	if !b.allow() {
+		t.Errorf("breaker should allow the probe")
+	}
+	b.success()
+	if b.getState() != BREAKER_CLOSED || !b.allow() {
+		t.Errorf("breaker should be closed after the probe succeeds")
+	}
+	if newCircuitBreaker(0, 500) != nil {
+		t.Errorf("breaker should be disabled by 0 threshold")
+	}
+}
+
+type mockCountSink struct {
+	*mocknode.MockSink
+	mutex sync.Mutex
+	count int
+}
+
+func (m *mockCountSink) Collect(_ api.StreamContext, _ interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.count++
+	return fmt.Errorf("connection refused")
+}
+
+func (m *mockCountSink) getCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.count
+}
+
+func TestSinkBreaker(t *testing.T) {
+	conf.InitConf()
+	mockclock.ResetClock(1000)
+	contextLogger := conf.Log.WithField("rule", "TestSinkBreaker")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	mockSink := &mockCountSink{MockSink: mocknode.NewMockSink()}
+	s := NewSinkNodeWithSink("mockSink", mockSink, map[string]interface{}{
+		"breakerThreshold":    2,
+		"breakerOpenInterval": 500,
+	})
+	s.Open(ctx, make(chan error))
+	for i := 0; i < 5; i++ {
+		s.input <- []byte(fmt.Sprintf(`[{"a":%d}]`, i))
+	}
+	time.Sleep(100 * time.Millisecond)
+	if c := mockSink.getCount(); c != 2 {
+		t.Errorf("sink should be called 2 times before the breaker is open but got %d", c)
+	}
+	metrics := s.GetMetrics()
+	if len(metrics) != 1 || metrics[0][len(SinkMetricNames)-1] != BREAKER_OPEN {
+		t.Errorf("breaker state metrics mismatch, got %v", metrics)
+	}
+	mockclock.GetMockClock().Add(500 * time.Millisecond)
+	s.input <- []byte(`[{"a":5}]`)
+	time.Sleep(100 * time.Millisecond)
+	if c := mockSink.getCount(); c != 3 {
+		t.Errorf("sink should be called once by the probe but got %d", c-2)
+	}
+	// without the cache, the data rejected by the open breaker is dropped and counted as exceptions
+	metrics = s.GetMetrics()
+	if dl := metrics[0][len(SinkMetricNames)-2]; dl != int64(0) {
+		t.Errorf("dead letter metrics should be 0 but got %v", dl)
+	}
+	if e := metrics[0][2]; e != int64(6) {
+		t.Errorf("exception metrics should be 6 but got %v", e)
+	}
+}
+
+// mockRecoverSink fails for the first n data and then succeeds
+type mockRecoverSink struct {
+	*mocknode.MockSink
+	mutex sync.Mutex
+	fails int
+	sent  []string
+}
+
+func (m *mockRecoverSink) Collect(_ api.StreamContext, item interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.fails > 0 {
+		m.fails--
+		return fmt.Errorf("connection refused")
+	}
+	m.sent = append(m.sent, string(item.([]byte)))
+	return nil
+}
+
+func (m *mockRecoverSink) getSent() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]string(nil), m.sent...)
+}
+
+func TestSinkBreaker_Cache(t *testing.T) {
+	conf.InitConf()
+	mockclock.ResetClock(1000)
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	disableCache := conf.Config.Sink.DisableCache
+	defer func() {
+		conf.Config.Sink.DisableCache = disableCache
+	}()
+	conf.Config.Sink.DisableCache = false
+	defer os.RemoveAll(path.Join(dataDir, "sink", "TestSinkBreaker_Cache"))
+	ctx, cancel := newCacheContext("TestSinkBreaker_Cache", "sink")
+	defer cancel()
+
+	mockSink := &mockRecoverSink{MockSink: mocknode.NewMockSink(), fails: 2}
+	s := NewSinkNodeWithSink("mockSink", mockSink, map[string]interface{}{
+		"retryCount":          0,
+		"breakerThreshold":    2,
+		"breakerOpenInterval": 500,
+	})
+	s.Open(ctx, make(chan error))
+	for i := 0; i < 4; i++ {
+		s.input <- []byte(fmt.Sprintf(`[{"a":%d}]`, i))
+	}
+	time.Sleep(100 * time.Millisecond)
+	if sent := mockSink.getSent(); len(sent) != 0 {
+		t.Errorf("no data should be sent while the breaker is open but got %v", sent)
+	}
+	// the probe ticker replays the failed data in the cache after the open interval
+	mockclock.GetMockClock().Add(500 * time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	exp := []string{`[{"a":0}]`, `[{"a":1}]`, `[{"a":2}]`, `[{"a":3}]`}
+	if sent := mockSink.getSent(); !reflect.DeepEqual(exp, sent) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, sent)
+	}
+}
+
+func TestSendCacheTuple(t *testing.T) {
+	conf.InitConf()
+	ctx, cancel := newCacheContext("TestSendCacheTuple", "sink")
+	defer cancel()
+	stats, err := NewStatManager("sink", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs := []*sinkOutput{{data: []byte(`[{"a":0}]`)}, {data: []byte(`[{"a":1}]`)}}
+	var tests = []struct {
+		fails    int
+		complete []int
+		failed   []int
+	}{
+		{fails: 0, complete: []int{1}},
+		{fails: 1, failed: []int{1}},
+		{fails: 2, failed: []int{1}},
+	}
+	for i, tt := range tests {
+		c := &Cache{Complete: make(chan int, 2), Failed: make(chan int, 2), done: ctx.Done()}
+		mockSink := &mockRecoverSink{MockSink: mocknode.NewMockSink(), fails: tt.fails}
+		sendCacheTuple(mockSink, 1, outs, stats, &retryPolicy{}, nil, c, nil, ctx)
+		close(c.Complete)
+		close(c.Failed)
+		var complete, failed []int
+		for index := range c.Complete {
+			complete = append(complete, index)
+		}
+		for index := range c.Failed {
+			failed = append(failed, index)
+		}
+		if !reflect.DeepEqual(tt.complete, complete) || !reflect.DeepEqual(tt.failed, failed) {
+			t.Errorf("%d: expect complete %v and fail %v but got %v and %v", i, tt.complete, tt.failed, complete, failed)
+		}
+	}
+}
+
+func TestDoCollectBatch_DeadLetter(t *testing.T) {
+	conf.InitConf()
+	ctx, cancel := newCacheContext("TestDoCollectBatch_DeadLetter", "sink")
+	defer cancel()
+	stats, err := NewStatManager("sink", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the data of tuple 3 and 4, the dead letter of the first data fails
+	data := []*sinkOutput{{data: []byte(`[{"a":0}]`)}, {data: []byte(`[{"a":1}]`)}, {data: []byte(`[{"a":2}]`)}}
+	indexes := []int{3, 3, 4}
+	dlSink := &mockRecoverSink{MockSink: mocknode.NewMockSink(), fails: 1}
+	dl := &deadLetter{sinkType: "mock", sink: dlSink, name: "sink"}
+	c := &Cache{Complete: make(chan int, 3), Failed: make(chan int, 3), done: ctx.Done()}
+	doCollectBatch(&mockErrorSink{MockSink: mocknode.NewMockSink()}, data, indexes, nil, stats, &retryPolicy{}, nil, c, dl, ctx)
+	close(c.Complete)
+	close(c.Failed)
+	var complete, failed []int
+	for index := range c.Complete {
+		complete = append(complete, index)
+	}
+	for index := range c.Failed {
+		failed = append(failed, index)
+	}
+	if !reflect.DeepEqual([]int{4}, complete) || !reflect.DeepEqual([]int{3}, failed) {
+		t.Errorf("expect complete [4] and fail [3] but got %v and %v", complete, failed)
+	}
+	if sent := dlSink.getSent(); len(sent) != 2 {
+		t.Errorf("expect 2 dead letters but got %v", sent)
+	}
+}
@@ -0,0 +1,125 @@
+package node
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/topo/checkpoint"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"sync"
+)
+
+// The state key prefix of the last pre-committed checkpoint of a sink instance
+const SINK_TXN_KEY = "$$sinkTxn"
+
+// sinkTxn drives the transactions of a TwoPhaseCommitSink instance by the checkpoints. All the calls to the sink are
+// made by the worker of the instance so that they are serialized with Collect. The commit triggered by the checkpoint
+// coordinator is requested to the worker by commitC.
+type sinkTxn struct {
+	sink api.TwoPhaseCommitSink
+	// the context of the sink instance
+	ctx api.StreamContext
+	key string
+	// signals the worker to commit up to the pending checkpoint
+	commitC chan struct{}
+	mutex   sync.Mutex
+	pending int64
+}
+
+// newSinkTxn recovers the transactions of the sink instance from the restored checkpoint and begins a new transaction.
+// It returns nil if the sink does not support transactions or the qos is not exactly once. As the barrier is received
+// by only one instance and the collecting must be serialized with the transaction, the concurrency and runAsync are
+// not supported.
+func newSinkTxn(sink api.Sink, qos api.Qos, ctx api.StreamContext, instance int, concurrency int, runAsync bool) (*sinkTxn, error) {
+	s, ok := sink.(api.TwoPhaseCommitSink)
+	if !ok || qos < api.ExactlyOnce {
+		return nil, nil
+	}
+	if concurrency > 1 {
+		return nil, fmt.Errorf("concurrency %d is not supported by the transactional sink for exactly once qos", concurrency)
+	}
+	if runAsync {
+		return nil, fmt.Errorf("runAsync is not supported by the transactional sink for exactly once qos")
+	}
+	t := &sinkTxn{
+		sink:    s,
+		ctx:     ctx.WithInstance(instance),
+		key:     fmt.Sprintf("%s%d", SINK_TXN_KEY, instance),
+		commitC: make(chan struct{}, 1),
+	}
+	var restored int64
+	if v, err := ctx.GetState(t.key); err == nil && v != nil {
+		if restored, err = cast.ToInt64(v, cast.CONVERT_SAMEKIND); err != nil {
+			return nil, fmt.Errorf("invalid transaction state %v", v)
+		}
+	}
+	if restored > 0 {
+		if err := s.Commit(t.ctx, restored); err != nil {
+			return nil, fmt.Errorf("fail to commit the transactions of checkpoint %d: %v", restored, err)
+		}
+	}
+	if err := s.Abort(t.ctx, restored); err != nil {
+		return nil, fmt.Errorf("fail to abort the transactions after checkpoint %d: %v", restored, err)
+	}
+	if err := s.BeginTransaction(t.ctx, restored); err != nil {
+		return nil, fmt.Errorf("fail to begin transaction: %v", err)
+	}
+	ctx.GetLogger().Infof("sink instance %d begins transaction after checkpoint %d", instance, restored)
+	return t, nil
+}
+
+// preCommitOnBarrier pre-commits the current transaction and begins a new one when the barrier is received. It returns
+// false if it fails so that the barrier is dropped and the checkpoint is not acknowledged. The transaction continues
+// and is pre-committed by the next checkpoint.
+func (t *sinkTxn) preCommitOnBarrier(data interface{}) bool {
+	if t == nil || !isBarrier(data) {
+		return true
+	}
+	checkpointId := data.(*checkpoint.BufferOrEvent).Data.(*checkpoint.Barrier).CheckpointId
+	logger := t.ctx.GetLogger()
+	if err := t.sink.PreCommit(t.ctx, checkpointId); err != nil {
+		logger.Errorf("sink fails to pre-commit the transaction of checkpoint %d: %v", checkpointId, err)
+		return false
+	}
+	if err := t.sink.BeginTransaction(t.ctx, checkpointId); err != nil {
+		logger.Errorf("sink fails to begin transaction after checkpoint %d: %v", checkpointId, err)
+		return false
+	}
+	if err := t.ctx.PutState(t.key, checkpointId); err != nil {
+		logger.Errorf("sink fails to save the transaction state of checkpoint %d: %v", checkpointId, err)
+		return false
+	}
+	return true
+}
+
+// requestCommit requests the worker to commit the pre-committed transactions up to the completed checkpoint. It does
+// not block, the pending requests are merged into the latest checkpoint.
+func (t *sinkTxn) requestCommit(checkpointId int64) {
+	t.mutex.Lock()
+	if checkpointId > t.pending {
+		t.pending = checkpointId
+	}
+	t.mutex.Unlock()
+	select {
+	case t.commitC <- struct{}{}:
+	default:
+	}
+}
+
+// commitReady returns the channel to receive the commit requests, which is nil if there is no transaction
+func (t *sinkTxn) commitReady() <-chan struct{} {
+	if t == nil {
+		return nil
+	}
+	return t.commitC
+}
+
+// commit commits the pre-committed transactions up to the requested checkpoint in the worker. If it fails, they are
+// committed by the next checkpoint or after restart.
+func (t *sinkTxn) commit() {
+	t.mutex.Lock()
+	checkpointId := t.pending
+	t.mutex.Unlock()
+	if err := t.sink.Commit(t.ctx, checkpointId); err != nil {
+		t.ctx.GetLogger().Errorf("sink fails to commit the transactions of checkpoint %d: %v", checkpointId, err)
+	}
+}
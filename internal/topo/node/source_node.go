@@ -20,6 +20,7 @@ type SourceNode struct {
 	props        map[string]interface{}
 	mutex        sync.RWMutex
 	sources      []api.Source
+	recorder     *sourceRecorder
 }
 
 func NewSourceNode(name string, st ast.StreamType, options *ast.Options) *SourceNode {
@@ -68,6 +69,17 @@ func (m *SourceNode) Open(ctx api.StreamContext, errCh chan<- error) {
 			}
 		}
 		m.bufferLength = bl
+		if c, ok := props["recordFile"]; ok {
+			if p, ok := c.(string); !ok || p == "" {
+				logger.Warnf("invalid type for recordFile property, should be a path but found %v", c)
+			} else if r, err := newSourceRecorder(p); err != nil {
+				m.drainError(errCh, err, ctx, logger)
+				return
+			} else {
+				logger.Infof("source node %s records the tuples to %s", m.name, r.path)
+				m.recorder = r
+			}
+		}
 		// Set retain size for table type
 		if m.options.RETAIN_SIZE > 0 && m.streamType == ast.TypeTable {
 			props["$retainSize"] = m.options.RETAIN_SIZE
@@ -113,10 +125,18 @@ func (m *SourceNode) Open(ctx api.StreamContext, errCh chan<- error) {
 						m.drainError(errCh, err, ctx, logger)
 						return
 					case data := <-buffer.Out:
+						if t, ok := data.(*xsql.ErrorSourceTuple); ok {
+							logger.Errorf("source %s error: %v", m.name, t.Error)
+							stats.IncTotalExceptions()
+							break
+						}
 						stats.IncTotalRecordsIn()
 						stats.ProcessTimeStart()
 						tuple := &xsql.Tuple{Emitter: m.name, Message: data.Message(), Timestamp: conf.GetNowInMilli(), Metadata: data.Meta()}
 						stats.ProcessTimeEnd()
+						if m.recorder != nil {
+							m.recorder.record(tuple, logger)
+						}
 						logger.Debugf("source node %s is sending tuple %+v of timestamp %d", m.name, tuple, tuple.Timestamp)
 						//blocking
 						m.Broadcast(tuple)
@@ -155,8 +175,28 @@ func doGetSource(t string) (api.Source, error) {
 		s = &source.MQTTSource{}
 	case "httppull":
 		s = &source.HTTPPullSource{}
+	case "httppush":
+		s = &source.HTTPPushSource{}
+	case "websocket":
+		s = &source.WebsocketSource{}
 	case "file":
 		s = &source.FileSource{}
+	case "socket":
+		s = &source.SocketSource{}
+	case "syslog":
+		s = &source.SyslogSource{}
+	case "memory":
+		s = &source.MemorySource{}
+	case "kafka":
+		s = &source.KafkaSource{}
+	case "sql":
+		s = &source.SQLSource{}
+	case "redis":
+		s = &source.RedisSource{}
+	case "simulator":
+		s = &source.SimulatorSource{}
+	case "replay":
+		s = &source.ReplaySource{}
 	default:
 		s, err = plugin.GetSource(t)
 		if err != nil {
@@ -185,4 +225,9 @@ func (m *SourceNode) close(ctx api.StreamContext, logger api.Logger) {
 	} else {
 		removeSourceInstance(m)
 	}
+	if m.recorder != nil {
+		if err := m.recorder.close(); err != nil {
+			logger.Warnf("close record file fails: %v", err)
+		}
+	}
 }
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/source"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// sourceRecorder appends the tuples received by the source node to a json lines file which can be replayed by the
+// replay source. It is shared by all the instances of the source node.
+type sourceRecorder struct {
+	path  string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+func newSourceRecorder(p string) (*sourceRecorder, error) {
+	if !filepath.IsAbs(p) {
+		dir, err := conf.GetDataLoc()
+		if err != nil {
+			return nil, err
+		}
+		p = filepath.Join(dir, p)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("fail to create the directory of record file %s: %v", p, err)
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("fail to open record file %s: %v", p, err)
+	}
+	return &sourceRecorder{path: p, file: f}, nil
+}
+
+func (r *sourceRecorder) record(tuple *xsql.Tuple, logger api.Logger) {
+	b, err := json.Marshal(&source.ReplayRecord{
+		Timestamp: tuple.Timestamp,
+		Message:   tuple.Message,
+		Meta:      tuple.Metadata,
+	})
+	if err != nil {
+		logger.Warnf("fail to record tuple %v: %v", tuple, err)
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return
+	}
+	if _, err := r.file.Write(append(b, '\n')); err != nil {
+		logger.Warnf("fail to write record file %s: %v", r.path, err)
+	}
+}
+
+func (r *sourceRecorder) close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,53 @@
+package node
+
+import (
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/source"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSourceRecorder(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSourceRecorder")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	file := filepath.Join(t.TempDir(), "record", "test.jsonl")
+	tuples := []*xsql.Tuple{
+		{Emitter: "demo", Message: map[string]interface{}{"a": 1.0, "b": "x"}, Timestamp: 1000, Metadata: map[string]interface{}{"topic": "t1"}},
+		{Emitter: "demo", Message: map[string]interface{}{"a": 2.0}, Timestamp: 1200},
+	}
+	// append to the existing recording
+	for _, tt := range tuples {
+		r, err := newSourceRecorder(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.record(tt, contextLogger)
+		if err := r.close(); err != nil {
+			t.Fatal(err)
+		}
+		// ignored after closed
+		r.record(tt, contextLogger)
+	}
+	s := &source.ReplaySource{}
+	if err := s.Configure(file, map[string]interface{}{"speed": 0, "timestampField": "ts"}); err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	s.Open(ctx, consumer, make(chan error, 1))
+	close(consumer)
+	var result []api.SourceTuple
+	for tuple := range consumer {
+		result = append(result, tuple)
+	}
+	exp := []api.SourceTuple{
+		api.NewDefaultSourceTuple(map[string]interface{}{"a": 1.0, "b": "x", "ts": int64(1000)}, map[string]interface{}{"topic": "t1"}),
+		api.NewDefaultSourceTuple(map[string]interface{}{"a": 2.0, "ts": int64(1200)}, nil),
+	}
+	if !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+}
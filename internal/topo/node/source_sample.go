@@ -0,0 +1,62 @@
+package node
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"time"
+)
+
+// SampleSource opens a temporary instance of the source defined by the options and returns the messages received
+// until the count or the timeout is reached. It is used to infer the schema of the source.
+func SampleSource(st ast.StreamType, options *ast.Options, count int, timeout time.Duration) ([]map[string]interface{}, error) {
+	n := NewSourceNode("$$sample", st, options)
+	contextLogger := conf.Log.WithField("sample", n.sourceType)
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	props := getSourceConf(ctx, n.sourceType, options)
+	if options.RETAIN_SIZE > 0 && st == ast.TypeTable {
+		props["$retainSize"] = options.RETAIN_SIZE
+	}
+	s, err := doGetSource(n.sourceType)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Configure(options.DATASOURCE, props); err != nil {
+		return nil, err
+	}
+	consumer := make(chan api.SourceTuple, count)
+	errCh := make(chan error, 1)
+	go s.Open(ctx, consumer, errCh)
+	defer func() {
+		if err := s.Close(ctx); err != nil {
+			contextLogger.Warnf("close sample source fails: %v", err)
+		}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var result []map[string]interface{}
+	for len(result) < count {
+		select {
+		case tuple := <-consumer:
+			// the EOF of the batch table sources
+			if tuple.Message() == nil {
+				return result, nil
+			}
+			result = append(result, tuple.Message())
+		case err := <-errCh:
+			if len(result) > 0 {
+				return result, nil
+			}
+			return nil, fmt.Errorf("sample source %s error: %v", n.sourceType, err)
+		case <-timer.C:
+			if len(result) == 0 {
+				return nil, fmt.Errorf("no message is received from source %s in %v", n.sourceType, timeout)
+			}
+			return result, nil
+		}
+	}
+	return result, nil
+}
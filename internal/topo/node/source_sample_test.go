@@ -0,0 +1,58 @@
+package node
+
+import (
+	"github.com/lf-edge/ekuiper/pkg/ast"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampleSource(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.jsonl")
+	err := ioutil.WriteFile(file, []byte(`{"timestamp":1000,"message":{"a":1}}
+{"timestamp":1000,"message":{"a":2}}
+{"timestamp":1000,"message":{"a":3}}
+`), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		datasource string
+		count      int
+		result     []map[string]interface{}
+		err        string
+	}{
+		{
+			datasource: file,
+			count:      2,
+			result:     []map[string]interface{}{{"a": 1.0}, {"a": 2.0}},
+		}, {
+			datasource: file,
+			count:      10,
+			result:     []map[string]interface{}{{"a": 1.0}, {"a": 2.0}, {"a": 3.0}},
+		}, {
+			datasource: filepath.Join(t.TempDir(), "none.jsonl"),
+			count:      10,
+			err:        "sample source replay error: fail to open recording file",
+		},
+	}
+	for i, tt := range tests {
+		result, err := SampleSource(ast.TypeStream, &ast.Options{TYPE: "replay", DATASOURCE: tt.datasource}, tt.count, 100*time.Millisecond)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+	}
+}
@@ -81,5 +81,5 @@ func (p *TableProcessor) Apply(ctx api.StreamContext, data interface{}, fv *xsql
 }
 
 func isBatch(t string) bool {
-	return t == "file" || t == ""
+	return t == "file" || t == "redis" || t == ""
 }
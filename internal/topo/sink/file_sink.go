@@ -0,0 +1,551 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FILE_FORMAT_JSON = "json"
+	FILE_FORMAT_CSV  = "csv"
+)
+
+type FileSinkConfig struct {
+	// The file path which can include go templates evaluated by each row and the time patterns like %Y%m%d
+	Path   string `json:"path"`
+	Format string `json:"format"`
+	// The columns of the csv file, the sorted fields of the first row are used if not specified
+	Fields    []string `json:"fields"`
+	Delimiter string   `json:"delimiter"`
+	HasHeader bool     `json:"hasHeader"`
+	// Roll the file when the size in bytes, the time in milliseconds or the number of rows is reached
+	RollingSize     int64 `json:"rollingSize"`
+	RollingInterval int64 `json:"rollingInterval"`
+	RollingCount    int   `json:"rollingCount"`
+	// The compression of the rolled files, only gzip is supported
+	Compression string `json:"compression"`
+	// The interval in milliseconds to flush the buffered rows to the files
+	FlushInterval int `json:"flushInterval"`
+}
+
+// FileSink writes each row of the results as a line of json or csv to the files. The path can be a go template which is
+// evaluated by the sink node and passed to CollectWithProps so that the results are written to different files, and it
+// can include the time patterns so that the files are split by time. The
+// active file is renamed with the rolling time when it is rolled by size, interval or count, and the rolled files can
+// be compressed. The rows are buffered and flushed by interval. For the rules with qos >= 1, the files are flushed and
+// synced to the disk when the checkpoint is taken. For the rules with qos 2, the results are staged in transactions
+// and written to the files when the checkpoint is completed.
+type FileSink struct {
+	cfg *FileSinkConfig
+	// the data directory to resolve the relative paths
+	dir string
+	// whether the path includes time patterns
+	timed bool
+
+	writers map[string]*fileWriter
+	// the transactions, only set for the rules with qos 2
+	stage  *txnStage
+	mutex  sync.Mutex
+	cancel func()
+}
+
+// fileWriter writes to an active file
+type fileWriter struct {
+	path string
+	// the time patterns of the path is expanded by the open time
+	timeKey  string
+	file     *os.File
+	buf      *bufio.Writer
+	csv      *csv.Writer
+	fields   []string
+	size     int64
+	count    int
+	openTime int64
+}
+
+func (m *FileSink) Configure(props map[string]interface{}) error {
+	cfg := &FileSinkConfig{
+		Format:        FILE_FORMAT_JSON,
+		Delimiter:     ",",
+		HasHeader:     true,
+		FlushInterval: 1000,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Path == "" {
+		return fmt.Errorf("file sink is missing property path")
+	}
+	switch cfg.Format {
+	case FILE_FORMAT_JSON:
+	case FILE_FORMAT_CSV:
+		if len([]rune(cfg.Delimiter)) != 1 {
+			return fmt.Errorf("invalid delimiter %s, must be a single character", cfg.Delimiter)
+		}
+	default:
+		// the data is encoded by the sink node and written as lines
+		if !message.IsFormatSupported(cfg.Format) {
+			return fmt.Errorf("invalid format %s", cfg.Format)
+		}
+	}
+	if cfg.RollingSize < 0 || cfg.RollingInterval < 0 || cfg.RollingCount < 0 {
+		return fmt.Errorf("invalid rollingSize %d, rollingInterval %d or rollingCount %d", cfg.RollingSize, cfg.RollingInterval, cfg.RollingCount)
+	}
+	if cfg.Compression != "" && cfg.Compression != "gzip" {
+		return fmt.Errorf("invalid compression %s, only gzip is supported", cfg.Compression)
+	}
+	if cfg.FlushInterval <= 0 {
+		return fmt.Errorf("invalid flushInterval %d", cfg.FlushInterval)
+	}
+	m.timed = formatTimePath(cfg.Path, time.Unix(0, 0)) != cfg.Path
+	m.cfg = cfg
+	return nil
+}
+
+// SupportFormat returns true for json and csv which are written by the file sink. The other formats are encoded by the
+// sink node.
+func (m *FileSink) SupportFormat(format string) bool {
+	return format == FILE_FORMAT_JSON || format == FILE_FORMAT_CSV
+}
+
+func (m *FileSink) Open(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	dir, err := conf.GetDataLoc()
+	if err != nil {
+		return err
+	}
+	m.dir = dir
+	if !filepath.IsAbs(m.cfg.Path) && !strings.HasPrefix(m.cfg.Path, "{{") {
+		m.cfg.Path = filepath.Join(dir, m.cfg.Path)
+	}
+	m.writers = make(map[string]*fileWriter)
+	exeCtx, cancel := ctx.WithCancel()
+	m.cancel = cancel
+	ticker := conf.GetTicker(m.cfg.FlushInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				m.checkFiles(logger)
+			case <-exeCtx.Done():
+				return
+			}
+		}
+	}()
+	logger.Infof("file sink writes to %s", m.cfg.Path)
+	return nil
+}
+
+func (m *FileSink) Collect(ctx api.StreamContext, item interface{}) error {
+	return m.collect(ctx, item, nil)
+}
+
+// CollectWithProps writes the data to the path evaluated by the data
+func (m *FileSink) CollectWithProps(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	return m.collect(ctx, item, props)
+}
+
+func (m *FileSink) collect(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	logger := ctx.GetLogger()
+	payload, ok := item.([]byte)
+	if !ok {
+		return fmt.Errorf("file sink receives non []byte data %v", item)
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stage != nil {
+		return m.stage.append(payload, props)
+	}
+	return m.writeRows(logger, payload, props)
+}
+
+// writeRows writes each row of the result which is a json array, or the result itself, to the path by the
+// configuration overridden by the dynamic properties
+func (m *FileSink) writeRows(logger api.Logger, payload []byte, props map[string]string) error {
+	p := m.cfg.Path
+	if v, ok := props["path"]; ok {
+		p = v
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(m.dir, p)
+		}
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(payload, &rows); err != nil {
+		// the result of dataTemplate may be any text
+		rows = []json.RawMessage{payload}
+	}
+	for _, row := range rows {
+		if err := m.write(logger, p, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BeginTransaction stages the results to the files of the data directory until the checkpoint is completed
+func (m *FileSink) BeginTransaction(ctx api.StreamContext, _ int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.openStage(ctx)
+}
+
+func (m *FileSink) PreCommit(ctx api.StreamContext, checkpointId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.openStage(ctx); err != nil {
+		return err
+	}
+	return m.stage.preCommit(checkpointId)
+}
+
+// Commit writes the staged results of the pre-committed transactions to the files and syncs the files. The committed
+// transactions are recorded so that they are not written again after restart.
+func (m *FileSink) Commit(ctx api.StreamContext, checkpointId int64) error {
+	logger := ctx.GetLogger()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.openStage(ctx); err != nil {
+		return err
+	}
+	ids, err := m.stage.pending(checkpointId)
+	if err != nil {
+		return err
+	}
+	committed, err := m.stage.committed()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		// the transaction is written but not removed before restart
+		if id <= committed {
+			if err := m.stage.remove(id); err != nil {
+				return err
+			}
+			logger.Debugf("file sink skips the committed transaction %d", id)
+			continue
+		}
+		err := m.stage.read(id, func(data []byte, props map[string]string) error {
+			return m.writeRows(logger, data, props)
+		})
+		if err != nil {
+			return fmt.Errorf("file sink fails to commit transaction %d: %v", id, err)
+		}
+		for p, w := range m.writers {
+			if err := w.flush(true); err != nil {
+				return fmt.Errorf("file sink fails to flush %s: %v", p, err)
+			}
+		}
+		if err := m.stage.markCommitted(id); err != nil {
+			return err
+		}
+		if err := m.stage.remove(id); err != nil {
+			return err
+		}
+		logger.Debugf("file sink commits transaction %d", id)
+	}
+	return nil
+}
+
+func (m *FileSink) Abort(ctx api.StreamContext, checkpointId int64) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.openStage(ctx); err != nil {
+		return err
+	}
+	return m.stage.abort(checkpointId)
+}
+
+func (m *FileSink) openStage(ctx api.StreamContext) error {
+	if m.stage != nil {
+		return nil
+	}
+	s, err := openTxnStage(ctx)
+	if err != nil {
+		return err
+	}
+	m.stage = s
+	return nil
+}
+
+func (m *FileSink) write(logger api.Logger, p string, row []byte) error {
+	var data map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(row))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		data = nil
+	}
+	if data == nil && m.cfg.Format == FILE_FORMAT_CSV {
+		return fmt.Errorf("file sink requires the result %s to be json object", row)
+	}
+	now := time.Unix(0, conf.GetNowInMilli()*int64(time.Millisecond))
+	p = formatTimePath(p, now)
+	var err error
+	w, ok := m.writers[p]
+	if !ok {
+		w, err = m.openWriter(p, now)
+		if err != nil {
+			return err
+		}
+		m.writers[p] = w
+	}
+	if m.cfg.Format == FILE_FORMAT_CSV {
+		err = w.writeCsv(data, m.cfg.HasHeader)
+	} else {
+		err = w.writeLine(row)
+	}
+	if err != nil {
+		return fmt.Errorf("file sink fails to write to %s: %v", p, err)
+	}
+	if (m.cfg.RollingSize > 0 && w.size >= m.cfg.RollingSize) || (m.cfg.RollingCount > 0 && w.count >= m.cfg.RollingCount) {
+		m.roll(logger, p, w)
+	}
+	return nil
+}
+
+func (m *FileSink) openWriter(p string, now time.Time) (*fileWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return nil, fmt.Errorf("file sink fails to create the directory of %s: %v", p, err)
+	}
+	f, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("file sink fails to open %s: %v", p, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("file sink fails to open %s: %v", p, err)
+	}
+	w := &fileWriter{
+		path:     p,
+		timeKey:  formatTimePath(m.cfg.Path, now),
+		file:     f,
+		buf:      bufio.NewWriter(f),
+		fields:   m.cfg.Fields,
+		size:     fi.Size(),
+		openTime: now.UnixNano() / int64(time.Millisecond),
+	}
+	if m.cfg.Format == FILE_FORMAT_CSV {
+		w.csv = csv.NewWriter(w)
+		w.csv.Comma = []rune(m.cfg.Delimiter)[0]
+	}
+	return w, nil
+}
+
+// roll closes the active file and renames it with the rolling time
+func (m *FileSink) roll(logger api.Logger, p string, w *fileWriter) {
+	delete(m.writers, p)
+	if err := w.close(); err != nil {
+		logger.Errorf("file sink fails to close %s: %v", p, err)
+	}
+	ext := filepath.Ext(p)
+	base := fmt.Sprintf("%s-%d", strings.TrimSuffix(p, ext), conf.GetNowInMilli())
+	rolled := base + ext
+	// several files may be rolled in the same millisecond
+	for i := 1; fileExists(rolled) || fileExists(rolled+".gz"); i++ {
+		rolled = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	if err := os.Rename(p, rolled); err != nil {
+		logger.Errorf("file sink fails to roll %s: %v", p, err)
+		return
+	}
+	logger.Debugf("file sink rolls %s to %s", p, rolled)
+	m.compress(logger, rolled)
+}
+
+// compress compresses the completed file in background
+func (m *FileSink) compress(logger api.Logger, p string) {
+	if m.cfg.Compression == "" {
+		return
+	}
+	go func() {
+		if err := gzipFile(p); err != nil {
+			logger.Errorf("file sink fails to compress %s: %v", p, err)
+		}
+	}()
+}
+
+// checkFiles flushes the files, rolls the files by interval and closes the files whose time patterns are expired
+func (m *FileSink) checkFiles(logger api.Logger) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	nowMilli := conf.GetNowInMilli()
+	now := time.Unix(0, nowMilli*int64(time.Millisecond))
+	for p, w := range m.writers {
+		switch {
+		case m.timed && w.timeKey != formatTimePath(m.cfg.Path, now):
+			delete(m.writers, p)
+			if err := w.close(); err != nil {
+				logger.Errorf("file sink fails to close %s: %v", p, err)
+			}
+			m.compress(logger, p)
+		case m.cfg.RollingInterval > 0 && nowMilli-w.openTime >= m.cfg.RollingInterval:
+			m.roll(logger, p, w)
+		default:
+			if err := w.flush(false); err != nil {
+				logger.Errorf("file sink fails to flush %s: %v", p, err)
+			}
+		}
+	}
+}
+
+// Flush flushes all the buffered rows and syncs the files to the disk
+func (m *FileSink) Flush(ctx api.StreamContext) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for p, w := range m.writers {
+		if err := w.flush(true); err != nil {
+			return fmt.Errorf("file sink fails to flush %s: %v", p, err)
+		}
+	}
+	ctx.GetLogger().Debugf("file sink flushes %d files", len(m.writers))
+	return nil
+}
+
+func (m *FileSink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing file sink")
+	if m.cancel != nil {
+		m.cancel()
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var result error
+	for p, w := range m.writers {
+		if err := w.close(); err != nil {
+			result = fmt.Errorf("file sink fails to close %s: %v", p, err)
+		}
+	}
+	m.writers = nil
+	if m.stage != nil {
+		if err := m.stage.close(); err != nil {
+			result = fmt.Errorf("file sink fails to close the transaction: %v", err)
+		}
+	}
+	return result
+}
+
+// Write writes to the buffer and counts the size for the csv writer
+func (w *fileWriter) Write(p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *fileWriter) writeLine(row []byte) error {
+	if _, err := w.Write(row); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{'\n'}); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *fileWriter) writeCsv(data map[string]interface{}, hasHeader bool) error {
+	if w.fields == nil {
+		w.fields = make([]string, 0, len(data))
+		for k := range data {
+			w.fields = append(w.fields, k)
+		}
+		sort.Strings(w.fields)
+	}
+	if hasHeader && w.size == 0 {
+		if err := w.csv.Write(w.fields); err != nil {
+			return err
+		}
+	}
+	record := make([]string, len(w.fields))
+	for i, f := range w.fields {
+		record[i] = hashValue(data[f])
+	}
+	if err := w.csv.Write(record); err != nil {
+		return err
+	}
+	// csv writer buffers the record and it must be written to count the size
+	w.csv.Flush()
+	w.count++
+	return w.csv.Error()
+}
+
+func (w *fileWriter) flush(sync bool) error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+func (w *fileWriter) close() error {
+	if err := w.flush(true); err != nil {
+		_ = w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// formatTimePath replaces the time patterns %Y, %m, %d, %H, %M and %S of the path with the time
+func formatTimePath(p string, t time.Time) string {
+	if !strings.Contains(p, "%") {
+		return p
+	}
+	return strings.NewReplacer(
+		"%Y", t.Format("2006"),
+		"%m", t.Format("01"),
+		"%d", t.Format("02"),
+		"%H", t.Format("15"),
+		"%M", t.Format("04"),
+		"%S", t.Format("05"),
+	).Replace(p)
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// gzipFile compresses the file to the file with .gz suffix and removes the original file
+func gzipFile(p string) error {
+	src, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(p+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		_ = zw.Close()
+		_ = dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(p)
+}
@@ -0,0 +1,355 @@
+package sink
+
+import (
+	"compress/gzip"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/state"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileSink(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestFileSink")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	// 2021-10-18 08:00:00 UTC
+	mockclock.ResetClock(1634544000000)
+	now := time.Unix(1634544000, 0).Format("20060102")
+	var tests = []struct {
+		props map[string]interface{}
+		data  [][]byte
+		// the evaluated dynamic paths of the data relative to the directory
+		paths []string
+		// the content of the files relative to the directory
+		result map[string]string
+	}{
+		{
+			props: map[string]interface{}{
+				"path":         "{{.device}}/%Y%m%d.jsonl",
+				"rollingCount": 2,
+				"compression":  "gzip",
+			},
+			data: [][]byte{
+				[]byte(`[{"device":"d1","v":1},{"device":"d1","v":2},{"device":"d1","v":3}]`),
+				[]byte(`[{"device":"d2","v":4}]`),
+			},
+			paths: []string{"d1/%Y%m%d.jsonl", "d2/%Y%m%d.jsonl"},
+			result: map[string]string{
+				"d1/" + now + "-1634544000000.jsonl.gz": "{\"device\":\"d1\",\"v\":1}\n{\"device\":\"d1\",\"v\":2}\n",
+				"d1/" + now + ".jsonl":                  "{\"device\":\"d1\",\"v\":3}\n",
+				"d2/" + now + ".jsonl":                  "{\"device\":\"d2\",\"v\":4}\n",
+			},
+		}, {
+			props: map[string]interface{}{
+				"path":   "out.csv",
+				"format": "csv",
+			},
+			data: [][]byte{
+				[]byte(`[{"b":"x","a":1},{"b":"y,z","a":2.5}]`),
+				[]byte(`[{"a":3,"c":true}]`),
+			},
+			result: map[string]string{
+				"out.csv": "a,b\n1,x\n2.5,\"y,z\"\n3,\n",
+			},
+		}, {
+			props: map[string]interface{}{
+				"path":        "out.txt",
+				"rollingSize": 10,
+			},
+			data: [][]byte{
+				[]byte(`hello`),
+				[]byte(`world`),
+				[]byte(`!`),
+			},
+			result: map[string]string{
+				"out-1634544000000.txt": "hello\nworld\n",
+				"out.txt":               "!\n",
+			},
+		},
+	}
+	for i, tt := range tests {
+		dir := t.TempDir()
+		tt.props["path"] = filepath.Join(dir, tt.props["path"].(string))
+		s := &FileSink{}
+		if err := s.Configure(tt.props); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if err := s.Open(ctx); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		for j, d := range tt.data {
+			var err error
+			if tt.paths != nil {
+				err = s.CollectWithProps(ctx, d, map[string]string{"path": filepath.Join(dir, tt.paths[j])})
+			} else {
+				err = s.Collect(ctx, d)
+			}
+			if err != nil {
+				t.Errorf("%d: %v", i, err)
+			}
+		}
+		if err := s.Close(ctx); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+		result, err := readFiles(dir, tt.result)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+	}
+}
+
+func TestFileSinkRolling(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestFileSinkRolling")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	mockclock.ResetClock(1634544000000)
+	dir := t.TempDir()
+	s := &FileSink{}
+	err := s.Configure(map[string]interface{}{
+		"path":            filepath.Join(dir, "%H.jsonl"),
+		"rollingInterval": 60000,
+		// the files are checked by the test instead of the ticker
+		"flushInterval": 86400000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	hour := time.Unix(1634544000, 0).Format("15")
+	if err := s.Collect(ctx, []byte(`[{"v":1}]`)); err != nil {
+		t.Fatal(err)
+	}
+	// the rows are visible after flush
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]string{hour + ".jsonl": "{\"v\":1}\n"}
+	if result, _ := readFiles(dir, exp); !reflect.DeepEqual(exp, result) {
+		t.Errorf("flush result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	// roll by interval
+	mockclock.GetMockClock().Add(time.Minute)
+	s.checkFiles(contextLogger)
+	if err := s.Collect(ctx, []byte(`[{"v":2}]`)); err != nil {
+		t.Fatal(err)
+	}
+	// close the file of the last hour
+	mockclock.GetMockClock().Add(time.Hour)
+	s.checkFiles(contextLogger)
+	exp = map[string]string{
+		hour + "-1634544060000.jsonl": "{\"v\":1}\n",
+		hour + ".jsonl":               "{\"v\":2}\n",
+	}
+	if result, _ := readFiles(dir, exp); !reflect.DeepEqual(exp, result) {
+		t.Errorf("rolling result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+	if len(s.writers) != 0 {
+		t.Errorf("the expired file is not closed")
+	}
+}
+
+func TestFileSinkFlushInterval(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestFileSinkFlushInterval")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	mockclock.ResetClock(1634544000000)
+	dir := t.TempDir()
+	s := &FileSink{}
+	if err := s.Configure(map[string]interface{}{"path": filepath.Join(dir, "out.jsonl")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	if err := s.Collect(ctx, map[string]interface{}{"v": 1}); err == nil {
+		t.Errorf("should fail to collect non []byte data")
+	}
+	if err := s.Collect(ctx, []byte(`[{"v":1}]`)); err != nil {
+		t.Fatal(err)
+	}
+	// the rows are flushed by the ticker of the flush interval
+	mockclock.GetMockClock().Add(time.Second)
+	exp := map[string]string{"out.jsonl": "{\"v\":1}\n"}
+	if result, _ := readFiles(dir, exp); !reflect.DeepEqual(exp, result) {
+		t.Errorf("flush result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+}
+
+// readFiles reads all the files in the directory and waits for the compression
+func readFiles(dir string, exp map[string]string) (map[string]string, error) {
+	var (
+		result map[string]string
+		err    error
+	)
+	for i := 0; i < 10; i++ {
+		result, err = readDir(dir)
+		if err == nil && reflect.DeepEqual(exp, result) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return result, err
+}
+
+func readDir(dir string) (map[string]string, error) {
+	result := make(map[string]string)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		var b []byte
+		if filepath.Ext(p) == ".gz" {
+			zr, err := gzip.NewReader(f)
+			if err != nil {
+				return err
+			}
+			b, err = ioutil.ReadAll(zr)
+		} else {
+			b, err = ioutil.ReadAll(f)
+		}
+		if err != nil {
+			return err
+		}
+		result[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	return result, err
+}
+
+func TestFormatTimePath(t *testing.T) {
+	tm := time.Date(2021, 10, 18, 9, 5, 3, 0, time.Local)
+	var tests = []struct {
+		path   string
+		result string
+	}{
+		{path: "/data/%Y%m%d.jsonl", result: "/data/20211018.jsonl"},
+		{path: "/data/%Y/%m/%d/%H%M%S.csv", result: "/data/2021/10/18/090503.csv"},
+		{path: "/data/out.jsonl", result: "/data/out.jsonl"},
+	}
+	for i, tt := range tests {
+		if r := formatTimePath(tt.path, tm); r != tt.result {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, tt.result, r)
+		}
+	}
+}
+
+func newTxnContext(t *testing.T, rule string) api.StreamContext {
+	conf.InitConf()
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(filepath.Join(dataDir, "sink", rule))
+	})
+	contextLogger := conf.Log.WithField("rule", rule)
+	tempStore, _ := state.CreateStore(rule, api.AtMostOnce)
+	return context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithMeta(rule, "op1", tempStore).WithInstance(0)
+}
+
+func TestFileSinkTransaction(t *testing.T) {
+	ctx := newTxnContext(t, "TestFileSinkTransaction")
+	mockclock.ResetClock(1634544000000)
+	p := filepath.Join(t.TempDir(), "out.jsonl")
+	open := func() *FileSink {
+		s := &FileSink{}
+		if err := s.Configure(map[string]interface{}{"path": p}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	s := open()
+	steps := []func() error{
+		func() error { return s.Abort(ctx, 0) },
+		func() error { return s.BeginTransaction(ctx, 0) },
+		func() error { return s.Collect(ctx, []byte(`[{"v":1},{"v":2}]`)) },
+		func() error { return s.PreCommit(ctx, 1) },
+		func() error { return s.BeginTransaction(ctx, 1) },
+		func() error { return s.Collect(ctx, []byte(`[{"v":3}]`)) },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("should not write before commit")
+	}
+	if err := s.Commit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PreCommit(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Collect(ctx, []byte(`[{"v":4}]`))
+	// restart before the commit of checkpoint 2, the current transaction is aborted
+	_ = s.Close(ctx)
+	s = open()
+	for i := 0; i < 2; i++ {
+		if err := s.Commit(ctx, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Abort(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	// restart after the commit of checkpoint 3 but before the transaction file is removed
+	if err := s.BeginTransaction(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Collect(ctx, []byte(`[{"v":5}]`))
+	if err := s.PreCommit(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	txn := filepath.Join(s.stage.dir, "3"+txnExt)
+	staged, err := ioutil.ReadFile(txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(txn, staged, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Close(ctx)
+	s = open()
+	if err := s.Commit(ctx, 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(txn); !os.IsNotExist(err) {
+		t.Errorf("the committed transaction should be removed")
+	}
+	_ = s.Close(ctx)
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := "{\"v\":1}\n{\"v\":2}\n{\"v\":3}\n{\"v\":5}\n"
+	if string(content) != exp {
+		t.Errorf("result mismatch:\n\nexp=%s\n\ngot=%s\n\n", exp, content)
+	}
+}
@@ -0,0 +1,205 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/lf-edge/ekuiper/internal/pkg/kafkax"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"strings"
+	"time"
+)
+
+type KafkaSinkConfig struct {
+	kafkax.ClientConf
+	Topic       string            `json:"topic"`
+	Key         string            `json:"key"`
+	Headers     map[string]string `json:"headers"`
+	Partitioner string            `json:"partitioner"`
+	Partition   int32             `json:"partition"`
+	Acks        string            `json:"acks"`
+	Compression string            `json:"compression"`
+	// The producer batches the messages until the number of messages or the time in milliseconds is reached
+	FlushMessages  int `json:"flushMessages"`
+	FlushFrequency int `json:"flushFrequency"`
+}
+
+// KafkaSink produces the results to a kafka topic. If a result is an array, each row is a kafka message and all the
+// rows are sent to the producer together so that they can be batched. The key and the header values can be go
+// templates which are evaluated by the sink node and passed to CollectWithProps.
+type KafkaSink struct {
+	cfg *KafkaSinkConfig
+	sc  *sarama.Config
+
+	producer sarama.SyncProducer
+}
+
+func (ks *KafkaSink) Configure(ps map[string]interface{}) error {
+	cfg := &KafkaSinkConfig{
+		Partitioner: "hash",
+		Acks:        "leader",
+		Compression: "none",
+	}
+	err := cast.MapToStruct(ps, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", ps, err)
+	}
+	if cfg.Topic == "" {
+		return fmt.Errorf("kafka sink is missing property topic")
+	}
+	sc, err := kafkax.NewConfig(&cfg.ClientConf)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(cfg.Partitioner) {
+	case "hash":
+		sc.Producer.Partitioner = sarama.NewHashPartitioner
+	case "random":
+		sc.Producer.Partitioner = sarama.NewRandomPartitioner
+	case "roundrobin":
+		sc.Producer.Partitioner = sarama.NewRoundRobinPartitioner
+	case "manual":
+		sc.Producer.Partitioner = sarama.NewManualPartitioner
+	default:
+		return fmt.Errorf("invalid partitioner %s, must be hash, random, roundrobin or manual", cfg.Partitioner)
+	}
+	switch strings.ToLower(cfg.Acks) {
+	case "none", "0":
+		sc.Producer.RequiredAcks = sarama.NoResponse
+	case "leader", "1":
+		sc.Producer.RequiredAcks = sarama.WaitForLocal
+	case "all", "-1":
+		sc.Producer.RequiredAcks = sarama.WaitForAll
+	default:
+		return fmt.Errorf("invalid acks %s, must be none, leader or all", cfg.Acks)
+	}
+	switch strings.ToLower(cfg.Compression) {
+	case "none":
+		sc.Producer.Compression = sarama.CompressionNone
+	case "gzip":
+		sc.Producer.Compression = sarama.CompressionGZIP
+	case "snappy":
+		sc.Producer.Compression = sarama.CompressionSnappy
+	case "lz4":
+		sc.Producer.Compression = sarama.CompressionLZ4
+	case "zstd":
+		sc.Producer.Compression = sarama.CompressionZSTD
+	default:
+		return fmt.Errorf("invalid compression %s, must be none, gzip, snappy, lz4 or zstd", cfg.Compression)
+	}
+	if cfg.FlushMessages < 0 || cfg.FlushFrequency < 0 {
+		return fmt.Errorf("invalid flushMessages %d or flushFrequency %d", cfg.FlushMessages, cfg.FlushFrequency)
+	}
+	if cfg.FlushMessages > 1 && cfg.FlushFrequency == 0 {
+		return fmt.Errorf("flushFrequency is required for flushMessages to send the incomplete batch")
+	}
+	sc.Producer.Flush.Messages = cfg.FlushMessages
+	sc.Producer.Flush.Frequency = time.Duration(cfg.FlushFrequency) * time.Millisecond
+	sc.Producer.Return.Successes = true
+	ks.cfg = cfg
+	ks.sc = sc
+	return nil
+}
+
+func (ks *KafkaSink) Open(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	p, err := sarama.NewSyncProducer(ks.cfg.Brokers, ks.sc)
+	if err != nil {
+		return fmt.Errorf("fail to connect kafka %v: %v", ks.cfg.Brokers, err)
+	}
+	ks.producer = p
+	logger.Infof("kafka sink connects to %v", ks.cfg.Brokers)
+	return nil
+}
+
+func (ks *KafkaSink) Collect(ctx api.StreamContext, item interface{}) error {
+	return ks.produce(ctx, item, nil)
+}
+
+// CollectWithProps produces the messages of the data with the key and headers evaluated by the data
+func (ks *KafkaSink) CollectWithProps(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	return ks.produce(ctx, item, props)
+}
+
+func (ks *KafkaSink) produce(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	logger := ctx.GetLogger()
+	payload, ok := item.([]byte)
+	if !ok {
+		return fmt.Errorf("kafka sink receives non []byte data %v", item)
+	}
+	msgs, err := ks.messages(payload, props)
+	if err != nil {
+		return err
+	}
+	if err := ks.producer.SendMessages(msgs); err != nil {
+		return fmt.Errorf("kafka sink fails to produce to topic %s: %v", ks.cfg.Topic, err)
+	}
+	logger.Debugf("kafka sink produces %d messages to topic %s", len(msgs), ks.cfg.Topic)
+	return nil
+}
+
+// CollectBatch produces the messages of all the data in one request
+func (ks *KafkaSink) CollectBatch(ctx api.StreamContext, items []interface{}) error {
+	logger := ctx.GetLogger()
+	var msgs []*sarama.ProducerMessage
+	for _, item := range items {
+		payload, ok := item.([]byte)
+		if !ok {
+			return fmt.Errorf("kafka sink receives non []byte data %v", item)
+		}
+		m, err := ks.messages(payload, nil)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, m...)
+	}
+	if err := ks.producer.SendMessages(msgs); err != nil {
+		return fmt.Errorf("kafka sink fails to produce to topic %s: %v", ks.cfg.Topic, err)
+	}
+	logger.Debugf("kafka sink produces %d messages of %d data to topic %s", len(msgs), len(items), ks.cfg.Topic)
+	return nil
+}
+
+// messages splits the result array into the kafka messages of each row. The key and headers are overridden by the
+// dynamic properties.
+func (ks *KafkaSink) messages(payload []byte, props map[string]string) ([]*sarama.ProducerMessage, error) {
+	var rows []json.RawMessage
+	if err := json.Unmarshal(payload, &rows); err != nil {
+		// the result of dataTemplate may be any text
+		rows = []json.RawMessage{payload}
+	}
+	key := ks.cfg.Key
+	if p, ok := props["key"]; ok {
+		key = p
+	}
+	var headers []sarama.RecordHeader
+	for k, v := range ks.cfg.Headers {
+		if p, ok := props["headers."+k]; ok {
+			v = p
+		}
+		headers = append(headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	msgs := make([]*sarama.ProducerMessage, 0, len(rows))
+	for _, row := range rows {
+		msg := &sarama.ProducerMessage{
+			Topic:     ks.cfg.Topic,
+			Value:     sarama.ByteEncoder(row),
+			Partition: ks.cfg.Partition,
+			Headers:   headers,
+		}
+		if key != "" {
+			msg.Key = sarama.StringEncoder(key)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (ks *KafkaSink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing kafka sink")
+	if ks.producer != nil {
+		return ks.producer.Close()
+	}
+	return nil
+}
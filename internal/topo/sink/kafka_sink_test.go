@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"reflect"
+	"testing"
+)
+
+func TestKafkaSink_Messages(t *testing.T) {
+	var tests = []struct {
+		props   map[string]interface{}
+		payload string
+		dynamic map[string]string
+		result  []*sarama.ProducerMessage
+	}{
+		{
+			props:   map[string]interface{}{},
+			payload: `[{"id":"d1","t":20},{"id":"d2","t":21}]`,
+			result: []*sarama.ProducerMessage{
+				{Topic: "test", Value: sarama.ByteEncoder(`{"id":"d1","t":20}`)},
+				{Topic: "test", Value: sarama.ByteEncoder(`{"id":"d2","t":21}`)},
+			},
+		},
+		{
+			props:   map[string]interface{}{"key": "{{.id}}", "headers": map[string]interface{}{"source": "ekuiper", "device": "dev-{{.id}}"}},
+			payload: `[{"id":"d1","t":20}]`,
+			dynamic: map[string]string{"key": "d1", "headers.device": "dev-d1"},
+			result: []*sarama.ProducerMessage{
+				{Topic: "test", Value: sarama.ByteEncoder(`{"id":"d1","t":20}`), Key: sarama.StringEncoder("d1"), Headers: []sarama.RecordHeader{
+					{Key: []byte("device"), Value: []byte("dev-d1")}, {Key: []byte("source"), Value: []byte("ekuiper")},
+				}},
+			},
+		},
+		{
+			props:   map[string]interface{}{"key": "k1", "partitioner": "manual", "partition": 2},
+			payload: `temperature is 20`,
+			result: []*sarama.ProducerMessage{
+				{Topic: "test", Value: sarama.ByteEncoder(`temperature is 20`), Key: sarama.StringEncoder("k1"), Partition: 2},
+			},
+		},
+	}
+	for i, tt := range tests {
+		tt.props["brokers"] = []interface{}{"127.0.0.1:9092"}
+		tt.props["topic"] = "test"
+		s := &KafkaSink{}
+		if err := s.Configure(tt.props); err != nil {
+			t.Errorf("%d \tconfigure error: %v", i, err)
+			continue
+		}
+		msgs, err := s.messages([]byte(tt.payload), tt.dynamic)
+		if err != nil {
+			t.Errorf("%d \tmessages error: %v", i, err)
+			continue
+		}
+		for _, m := range msgs {
+			// sort the headers to compare
+			if len(m.Headers) == 2 && string(m.Headers[0].Key) > string(m.Headers[1].Key) {
+				m.Headers[0], m.Headers[1] = m.Headers[1], m.Headers[0]
+			}
+		}
+		if !reflect.DeepEqual(tt.result, msgs) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, msgs)
+		}
+	}
+}
+
+func TestKafkaSink_Collect(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).SetVersion(3),
+	})
+	contextLogger := conf.Log.WithField("rule", "TestKafkaSink_Collect")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	s := &KafkaSink{}
+	err := s.Configure(map[string]interface{}{
+		"brokers": []interface{}{broker.Addr()},
+		"topic":   "test",
+		"key":     "k1",
+		"acks":    "all",
+		// batch the rows of a result
+		"flushMessages":  2,
+		"flushFrequency": 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	if err := s.Collect(ctx, []byte(`[{"id":"d1","t":20},{"id":"d2","t":21}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Collect(ctx, map[string]interface{}{"id": "d3"}); err == nil {
+		t.Errorf("should fail to collect non []byte data")
+	}
+	produced := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.ProduceRequest); ok {
+			produced++
+		}
+	}
+	if produced != 1 {
+		t.Errorf("expect 1 produce request but got %d", produced)
+	}
+}
+
+func TestKafkaSink_Configure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{props: map[string]interface{}{"topic": "test"}, err: "missing property brokers"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}}, err: "kafka sink is missing property topic"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "topic": "test", "acks": "2"}, err: "invalid acks 2, must be none, leader or all"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "topic": "test", "partitioner": "sticky"}, err: "invalid partitioner sticky, must be hash, random, roundrobin or manual"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "topic": "test", "version": "x"}, err: "invalid kafka version x: invalid version `x`"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "topic": "test", "flushMessages": 10}, err: "flushFrequency is required for flushMessages to send the incomplete batch"},
+	}
+	for i, tt := range tests {
+		err := (&KafkaSink{}).Configure(tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/pkg/pubsub"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+type MemorySinkConfig struct {
+	Topic string `json:"topic"`
+}
+
+// MemorySink publishes the results to an in-process topic which can be subscribed by the memory sources of other
+// rules. The results are passed as maps, which are received by CollectRaw without encoding.
+type MemorySink struct {
+	topic string
+}
+
+func (ms *MemorySink) Configure(ps map[string]interface{}) error {
+	cfg := &MemorySinkConfig{}
+	err := cast.MapToStruct(ps, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", ps, err)
+	}
+	if cfg.Topic == "" {
+		return fmt.Errorf("memory sink is missing property topic")
+	}
+	if err := pubsub.ValidateTopic(cfg.Topic, false); err != nil {
+		return err
+	}
+	ms.topic = cfg.Topic
+	return nil
+}
+
+func (ms *MemorySink) Open(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("memory sink publishes to topic %s", ms.topic)
+	return nil
+}
+
+// Collect publishes the result customized by the dataTemplate or the format, which must be json
+func (ms *MemorySink) Collect(ctx api.StreamContext, item interface{}) error {
+	d, ok := item.([]byte)
+	if !ok {
+		return fmt.Errorf("memory sink receives unsupported data %v", item)
+	}
+	var results []map[string]interface{}
+	if err := json.Unmarshal(d, &results); err != nil {
+		// the result of sendSingle or dataTemplate may be a single object
+		var m map[string]interface{}
+		if err := json.Unmarshal(d, &m); err != nil {
+			return fmt.Errorf("memory sink can only publish json objects or arrays, but got %s", d)
+		}
+		results = []map[string]interface{}{m}
+	}
+	return ms.CollectRaw(ctx, results)
+}
+
+// CollectRaw publishes the rows without encoding
+func (ms *MemorySink) CollectRaw(ctx api.StreamContext, item interface{}) error {
+	logger := ctx.GetLogger()
+	switch d := item.(type) {
+	case map[string]interface{}:
+		pubsub.Publish(ms.topic, d)
+	case []map[string]interface{}:
+		for _, r := range d {
+			pubsub.Publish(ms.topic, r)
+		}
+	default:
+		return fmt.Errorf("memory sink receives unsupported data %v", item)
+	}
+	logger.Debugf("memory sink publishes to topic %s", ms.topic)
+	return nil
+}
+
+func (ms *MemorySink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing memory sink")
+	return nil
+}
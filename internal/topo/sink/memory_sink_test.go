@@ -0,0 +1,66 @@
+package sink
+
+import (
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/pubsub"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemorySink(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestMemorySink")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	sub, err := pubsub.Subscribe("results/#", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pubsub.Unsubscribe(sub)
+	s := &MemorySink{}
+	if err := s.Configure(map[string]interface{}{"topic": "results/r1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	data := [][]byte{
+		[]byte(`[{"a":1},{"a":2}]`),
+		[]byte(`{"a":3}`),
+	}
+	for _, d := range data {
+		if err := s.Collect(ctx, d); err != nil {
+			t.Error(err)
+		}
+	}
+	raw := []interface{}{
+		map[string]interface{}{"a": 4},
+		[]map[string]interface{}{{"a": 5}, {"a": 6}},
+	}
+	for _, d := range raw {
+		if err := s.CollectRaw(ctx, d); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := s.Collect(ctx, []byte("invalid")); err == nil {
+		t.Errorf("should fail for invalid data")
+	}
+	if err := s.CollectRaw(ctx, []byte(`{"a":7}`)); err == nil {
+		t.Errorf("should fail for encoded data")
+	}
+	exp := []map[string]interface{}{{"a": float64(1)}, {"a": float64(2)}, {"a": float64(3)}, {"a": 4}, {"a": 5}, {"a": 6}}
+	for i, e := range exp {
+		select {
+		case m := <-sub.C():
+			if m.Topic != "results/r1" || !reflect.DeepEqual(e, m.Data) {
+				t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, e, m)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout to receive data")
+		}
+	}
+	s.Close(ctx)
+	if err := (&MemorySink{}).Configure(map[string]interface{}{"topic": "results/+"}); err == nil {
+		t.Errorf("should fail for topic with wildcards")
+	}
+}
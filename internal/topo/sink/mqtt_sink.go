@@ -1,196 +1,189 @@
 package sink
 
 import (
-	"crypto/tls"
 	"fmt"
-	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
-	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/mqttx"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/cast"
 	"strings"
 )
 
+type MQTTSinkConfig struct {
+	Server             string            `json:"server"`
+	Selector           string            `json:"connectionSelector"`
+	Topic              string            `json:"topic"`
+	ClientId           string            `json:"clientId"`
+	ProtocolVersion    string            `json:"protocolVersion"`
+	Qos                interface{}       `json:"qos"`
+	Username           string            `json:"username"`
+	Password           string            `json:"password"`
+	CertificationPath  string            `json:"certificationPath"`
+	PrivateKeyPath     string            `json:"privateKeyPath"`
+	InsecureSkipVerify bool              `json:"insecureSkipVerify"`
+	Retained           bool              `json:"retained"`
+	ResponseTopic      string            `json:"responseTopic"`
+	CorrelationData    string            `json:"correlationData"`
+	UserProperties     map[string]string `json:"userProperties"`
+	MessageExpiry      int               `json:"messageExpiry"`
+}
+
+// MQTTSink publishes the results to the MQTT broker. The topic, qos, responseTopic, correlationData and the values
+// of userProperties can be go templates which are evaluated by the sink node and passed to CollectWithProps, so that
+// each message can be sent to a dynamic topic.
 type MQTTSink struct {
-	srv      string
-	tpc      string
-	clientid string
+	cfg      *MQTTSinkConfig
 	pVersion uint
-	qos      byte
-	uName    string
-	password string
-	certPath string
-	pkeyPath string
 
-	insecureSkipVerify bool
-	retained           bool
-
-	conn MQTT.Client
+	conn mqttx.Client
 }
 
 func (ms *MQTTSink) Configure(ps map[string]interface{}) error {
-	srv, ok := ps["server"]
-	if !ok {
+	cfg := &MQTTSinkConfig{}
+	err := cast.MapToStruct(ps, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", ps, err)
+	}
+	if cfg.Server == "" && cfg.Selector == "" {
 		return fmt.Errorf("mqtt sink is missing property server")
 	}
-	tpc, ok := ps["topic"]
-	if !ok {
+	if cfg.Topic == "" {
 		return fmt.Errorf("mqtt sink is missing property topic")
 	}
-	clientid, ok := ps["clientId"]
-	if !ok {
+	if cfg.ClientId == "" {
 		if uuid, err := uuid.NewUUID(); err != nil {
 			return fmt.Errorf("mqtt sink fails to get uuid, the error is %s", err)
 		} else {
-
-			clientid = uuid.String()
+			cfg.ClientId = uuid.String()
 		}
 	}
-	var pVersion uint = 3
-	pVersionStr, ok := ps["protocolVersion"]
-	if ok {
-		v, _ := pVersionStr.(string)
-		if v == "3.1" {
-			pVersion = 3
-		} else if v == "3.1.1" {
-			pVersion = 4
-		} else {
-			return fmt.Errorf("unknown protocol version %s, the value could be only 3.1 or 3.1.1 (also refers to MQTT version 4)", pVersionStr)
-		}
+	ms.pVersion, err = mqttx.ParseProtocolVersion(cfg.ProtocolVersion)
+	if err != nil {
+		return err
 	}
-
-	var qos byte = 0
-	if qosRec, ok := ps["qos"]; ok {
-		if v, err := cast.ToInt(qosRec, cast.STRICT); err == nil {
-			qos = byte(v)
-		}
-		if qos != 0 && qos != 1 && qos != 2 {
-			return fmt.Errorf("not valid qos value %v, the value could be only int 0 or 1 or 2", qos)
-		}
+	if cfg.MessageExpiry < 0 {
+		return fmt.Errorf("invalid messageExpiry %d, it must not be negative", cfg.MessageExpiry)
 	}
-
-	uName := ""
-	un, ok := ps["username"]
-	if ok {
-		v, _ := un.(string)
-		if strings.Trim(v, " ") != "" {
-			uName = v
-		}
-	}
-
-	password := ""
-	pwd, ok := ps["password"]
-	if ok {
-		v, _ := pwd.(string)
-		if strings.Trim(v, " ") != "" {
-			password = v
-		}
+	if cfg.Selector == "" && ms.pVersion != 5 && (cfg.ResponseTopic != "" || cfg.CorrelationData != "" || len(cfg.UserProperties) > 0 || cfg.MessageExpiry > 0) {
+		return fmt.Errorf("responseTopic, correlationData, userProperties and messageExpiry are only supported by protocolVersion 5")
 	}
-
-	certPath := ""
-	if cp, ok := ps["certificationPath"]; ok {
-		if v, ok := cp.(string); ok {
-			certPath = v
-		}
-	}
-
-	pKeyPath := ""
-	if pk, ok := ps["privateKeyPath"]; ok {
-		if v, ok := pk.(string); ok {
-			pKeyPath = v
-		}
-	}
-
-	insecureSkipVerify := false
-	if pk, ok := ps["insecureSkipVerify"]; ok {
-		if v, ok := pk.(bool); ok {
-			insecureSkipVerify = v
+	cfg.Username = strings.Trim(cfg.Username, " ")
+	cfg.Password = strings.Trim(cfg.Password, " ")
+
+	if cfg.Qos != nil {
+		// the dynamic qos is validated when publishing
+		if qos := fmt.Sprintf("%v", cfg.Qos); !strings.Contains(qos, "{{") {
+			if _, err := parseQos(qos); err != nil {
+				return err
+			}
 		}
 	}
+	ms.cfg = cfg
+	return nil
+}
 
-	retained := false
-	if pk, ok := ps["retained"]; ok {
-		if v, ok := pk.(bool); ok {
-			retained = v
-		}
+func parseQos(v string) (byte, error) {
+	qos, err := cast.ToInt(strings.TrimSpace(v), cast.CONVERT_ALL)
+	if err != nil || qos < 0 || qos > 2 {
+		return 0, fmt.Errorf("not valid qos value %v, the value could be only int 0 or 1 or 2", v)
 	}
-
-	ms.srv = srv.(string)
-	ms.tpc = tpc.(string)
-	ms.clientid = clientid.(string)
-	ms.pVersion = pVersion
-	ms.qos = qos
-	ms.uName = uName
-	ms.password = password
-	ms.certPath = certPath
-	ms.pkeyPath = pKeyPath
-	ms.insecureSkipVerify = insecureSkipVerify
-	ms.retained = retained
-
-	return nil
+	return byte(qos), nil
 }
 
 func (ms *MQTTSink) Open(ctx api.StreamContext) error {
 	log := ctx.GetLogger()
 	log.Infof("Opening mqtt sink for rule %s.", ctx.GetRuleId())
-	opts := MQTT.NewClientOptions().AddBroker(ms.srv).SetClientID(ms.clientid)
-
-	if ms.certPath != "" || ms.pkeyPath != "" {
-		log.Infof("Connect MQTT broker with certification and keys.")
-		if cp, err := conf.ProcessPath(ms.certPath); err == nil {
-			if kp, err1 := conf.ProcessPath(ms.pkeyPath); err1 == nil {
-				if cer, err2 := tls.LoadX509KeyPair(cp, kp); err2 != nil {
-					return err2
-				} else {
-					opts.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cer}, InsecureSkipVerify: ms.insecureSkipVerify})
-				}
-			} else {
-				return err1
-			}
-		} else {
+	if ms.cfg.Selector != "" {
+		c, err := mqttx.AttachConnection(ms.cfg.Selector)
+		if err != nil {
 			return err
 		}
-	} else {
-		log.Infof("Connect MQTT broker with username and password.")
-		if ms.uName != "" {
-			opts = opts.SetUsername(ms.uName)
-		}
-
-		if ms.password != "" {
-			opts = opts.SetPassword(ms.password)
-		}
+		log.Infof("Use the shared connection %s", ms.cfg.Selector)
+		ms.conn = c
+		return nil
 	}
-
-	opts.SetAutoReconnect(true)
-	var reconn = false
-	opts.SetConnectionLostHandler(func(client MQTT.Client, e error) {
-		log.Errorf("The connection %s is disconnected due to error %s, will try to re-connect later.", ms.srv+": "+ms.clientid, e)
-		ms.conn = client
-		reconn = true
+	c, err := mqttx.NewClient(ctx, &mqttx.ClientConf{
+		Server:             ms.cfg.Server,
+		ClientId:           ms.cfg.ClientId,
+		ProtocolVersion:    ms.pVersion,
+		Username:           ms.cfg.Username,
+		Password:           ms.cfg.Password,
+		CertificationPath:  ms.cfg.CertificationPath,
+		PrivateKeyPath:     ms.cfg.PrivateKeyPath,
+		InsecureSkipVerify: ms.cfg.InsecureSkipVerify,
 	})
-
-	opts.SetOnConnectHandler(func(client MQTT.Client) {
-		if reconn {
-			log.Infof("The connection is %s re-established successfully.", ms.srv+": "+ms.clientid)
-		}
-	})
-
-	c := MQTT.NewClient(opts)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("Found error: %s", token.Error())
+	if err != nil {
+		return fmt.Errorf("Found error: %s", err)
 	}
-
-	log.Infof("The connection to server %s was established successfully", ms.srv)
 	ms.conn = c
 	return nil
 }
 
+// publishArgs returns the topic and publish options by the configuration overridden by the dynamic properties
+func (ms *MQTTSink) publishArgs(props map[string]string) (string, *mqttx.PublishOptions, error) {
+	value := func(k string, v string) string {
+		if p, ok := props[k]; ok {
+			return p
+		}
+		return v
+	}
+	qos := "0"
+	if ms.cfg.Qos != nil {
+		qos = fmt.Sprintf("%v", ms.cfg.Qos)
+	}
+	q, err := parseQos(value("qos", qos))
+	if err != nil {
+		return "", nil, err
+	}
+	opts := &mqttx.PublishOptions{
+		Qos:           q,
+		Retained:      ms.cfg.Retained,
+		ResponseTopic: value("responseTopic", ms.cfg.ResponseTopic),
+		MessageExpiry: uint32(ms.cfg.MessageExpiry),
+	}
+	if cd := value("correlationData", ms.cfg.CorrelationData); cd != "" {
+		opts.CorrelationData = []byte(cd)
+	}
+	if len(ms.cfg.UserProperties) > 0 {
+		opts.UserProperties = make(map[string]string, len(ms.cfg.UserProperties))
+		for k, v := range ms.cfg.UserProperties {
+			opts.UserProperties[k] = value("userProperties."+k, v)
+		}
+	}
+	topic := value("topic", ms.cfg.Topic)
+	if topic == "" {
+		return "", nil, fmt.Errorf("the evaluated topic is empty")
+	}
+	return topic, opts, nil
+}
+
 func (ms *MQTTSink) Collect(ctx api.StreamContext, item interface{}) error {
+	return ms.publish(ctx, item, nil)
+}
+
+// CollectWithProps publishes the data by the topic and options evaluated by the data
+func (ms *MQTTSink) CollectWithProps(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	return ms.publish(ctx, item, props)
+}
+
+func (ms *MQTTSink) publish(ctx api.StreamContext, item interface{}, props map[string]string) error {
 	logger := ctx.GetLogger()
-	c := ms.conn
-	logger.Debugf("%s publish %s", ctx.GetOpId(), item)
-	if token := c.Publish(ms.tpc, ms.qos, ms.retained, item); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("publish error: %s", token.Error())
+	var payload []byte
+	switch v := item.(type) {
+	case []byte:
+		payload = v
+	case string:
+		payload = []byte(v)
+	default:
+		return fmt.Errorf("mqtt sink receive unsupported data %v", item)
+	}
+	topic, opts, err := ms.publishArgs(props)
+	if err != nil {
+		return err
+	}
+	logger.Debugf("%s publish %s to %s", ctx.GetOpId(), item, topic)
+	if err := ms.conn.Publish(topic, payload, opts); err != nil {
+		return fmt.Errorf("publish error: %s", err)
 	}
 	return nil
 }
@@ -198,8 +191,8 @@ func (ms *MQTTSink) Collect(ctx api.StreamContext, item interface{}) error {
 func (ms *MQTTSink) Close(ctx api.StreamContext) error {
 	logger := ctx.GetLogger()
 	logger.Infof("Closing mqtt sink")
-	if ms.conn != nil && ms.conn.IsConnected() {
-		ms.conn.Disconnect(5000)
+	if ms.conn != nil {
+		ms.conn.Disconnect()
 	}
 	return nil
 }
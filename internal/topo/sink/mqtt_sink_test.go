@@ -0,0 +1,124 @@
+package sink
+
+import (
+	"github.com/lf-edge/ekuiper/internal/pkg/mqttx"
+	"reflect"
+	"testing"
+)
+
+func TestMQTTSink_publishArgs(t *testing.T) {
+	var tests = []struct {
+		props   map[string]interface{}
+		dynamic map[string]string
+		topic   string
+		opts    *mqttx.PublishOptions
+		err     string
+	}{
+		{
+			props: map[string]interface{}{
+				"server": "tcp://127.0.0.1:1883",
+				"topic":  "result",
+				"qos":    1,
+			},
+			topic: "result",
+			opts:  &mqttx.PublishOptions{Qos: 1},
+		}, {
+			props: map[string]interface{}{
+				"server":   "tcp://127.0.0.1:1883",
+				"topic":    "devices/{{.device}}/result",
+				"qos":      "{{.level}}",
+				"retained": true,
+			},
+			dynamic: map[string]string{"topic": "devices/d1/result", "qos": "2"},
+			topic:   "devices/d1/result",
+			opts:    &mqttx.PublishOptions{Qos: 2, Retained: true},
+		}, {
+			props: map[string]interface{}{
+				"server":          "tcp://127.0.0.1:1883",
+				"topic":           "devices/{{(index . 0).device}}/result",
+				"protocolVersion": "5",
+				"responseTopic":   "reply/{{(index . 0).device}}",
+				"correlationData": "{{(index . 0).id}}",
+				"userProperties":  map[string]interface{}{"source": "ekuiper", "device": "{{(index . 0).device}}"},
+				"messageExpiry":   60,
+			},
+			dynamic: map[string]string{
+				"topic":                 "devices/d2/result",
+				"responseTopic":         "reply/d2",
+				"correlationData":       "req1",
+				"userProperties.device": "d2",
+			},
+			topic: "devices/d2/result",
+			opts: &mqttx.PublishOptions{
+				ResponseTopic:   "reply/d2",
+				CorrelationData: []byte("req1"),
+				UserProperties:  map[string]string{"source": "ekuiper", "device": "d2"},
+				MessageExpiry:   60,
+			},
+		}, {
+			props: map[string]interface{}{
+				"server": "tcp://127.0.0.1:1883",
+				"topic":  "result",
+				"qos":    "{{.level}}",
+			},
+			dynamic: map[string]string{"qos": "3"},
+			err:     "not valid qos value 3, the value could be only int 0 or 1 or 2",
+		}, {
+			props: map[string]interface{}{
+				"server": "tcp://127.0.0.1:1883",
+				"topic":  "result/{{.device}}",
+			},
+			dynamic: map[string]string{"topic": ""},
+			err:     "the evaluated topic is empty",
+		},
+	}
+	for i, tt := range tests {
+		ms := &MQTTSink{}
+		if err := ms.Configure(tt.props); err != nil {
+			t.Errorf("%d: configure error %v", i, err)
+			continue
+		}
+		topic, opts, err := ms.publishArgs(tt.dynamic)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%d: error mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: error %v", i, err)
+			continue
+		}
+		if topic != tt.topic || !reflect.DeepEqual(opts, tt.opts) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s %+v\n\ngot=%s %+v\n\n", i, tt.topic, tt.opts, topic, opts)
+		}
+	}
+}
+
+func TestMQTTSink_Configure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{"topic": "result"},
+			err:   "mqtt sink is missing property server",
+		}, {
+			props: map[string]interface{}{"server": "tcp://127.0.0.1:1883", "topic": "result", "qos": 3},
+			err:   "not valid qos value 3, the value could be only int 0 or 1 or 2",
+		}, {
+			props: map[string]interface{}{"server": "tcp://127.0.0.1:1883", "topic": "result", "protocolVersion": "4.0"},
+			err:   "unknown protocol version 4.0, the value could be only 3.1, 3.1.1 (also refers to MQTT version 4) or 5",
+		}, {
+			props: map[string]interface{}{"server": "tcp://127.0.0.1:1883", "topic": "result", "messageExpiry": 10},
+			err:   "responseTopic, correlationData, userProperties and messageExpiry are only supported by protocolVersion 5",
+		},
+	}
+	for i, tt := range tests {
+		ms := &MQTTSink{}
+		err := ms.Configure(tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d: error mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
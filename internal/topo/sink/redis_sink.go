@@ -0,0 +1,210 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"github.com/lf-edge/ekuiper/internal/pkg/redisx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"strings"
+	"time"
+)
+
+const (
+	REDIS_SET     = "set"
+	REDIS_HSET    = "hset"
+	REDIS_LPUSH   = "lpush"
+	REDIS_RPUSH   = "rpush"
+	REDIS_PUBLISH = "publish"
+)
+
+type RedisSinkConfig struct {
+	redisx.ClientConf
+	Command string `json:"command"`
+	// The key to write or the channel to publish
+	Key string `json:"key"`
+	// The hash field to write the row for hset. If not set, each field of the row is a hash field
+	Field string `json:"field"`
+	// The fields of the row to write, all the fields are written if not specified
+	Fields []string `json:"fields"`
+	// The time to live of the key in milliseconds
+	Ttl int `json:"ttl"`
+}
+
+// RedisSink writes each row of the results to redis by the command. The key and the hash field can be go templates
+// which are evaluated by the sink node and passed to CollectWithProps. All the commands of a result are sent in one
+// pipeline.
+type RedisSink struct {
+	cfg *RedisSinkConfig
+
+	cli *redis.Client
+}
+
+func (r *RedisSink) Configure(ps map[string]interface{}) error {
+	cfg := &RedisSinkConfig{
+		ClientConf: redisx.ClientConf{Addr: "127.0.0.1:6379"},
+		Command:    REDIS_SET,
+	}
+	err := cast.MapToStruct(ps, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", ps, err)
+	}
+	cfg.Command = strings.ToLower(cfg.Command)
+	switch cfg.Command {
+	case REDIS_SET, REDIS_HSET, REDIS_LPUSH, REDIS_RPUSH:
+	case REDIS_PUBLISH:
+		if cfg.Ttl > 0 {
+			return fmt.Errorf("ttl is not supported by publish command")
+		}
+	default:
+		return fmt.Errorf("invalid command %s, must be set, hset, lpush, rpush or publish", cfg.Command)
+	}
+	if cfg.Key == "" {
+		return fmt.Errorf("redis sink is missing property key")
+	}
+	if cfg.Field != "" && cfg.Command != REDIS_HSET {
+		return fmt.Errorf("field is only supported by hset command")
+	}
+	if cfg.Ttl < 0 {
+		return fmt.Errorf("invalid ttl %d", cfg.Ttl)
+	}
+	if r.cli, err = redisx.NewClient(&cfg.ClientConf); err != nil {
+		return err
+	}
+	r.cfg = cfg
+	return nil
+}
+
+func (r *RedisSink) Open(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	if err := r.cli.Ping().Err(); err != nil {
+		return fmt.Errorf("fail to connect redis %s: %v", r.cfg.Addr, err)
+	}
+	logger.Infof("redis sink connects to %s", r.cfg.Addr)
+	return nil
+}
+
+func (r *RedisSink) Collect(ctx api.StreamContext, item interface{}) error {
+	return r.collect(ctx, item, nil)
+}
+
+// CollectWithProps writes the data by the key and hash field evaluated by the data
+func (r *RedisSink) CollectWithProps(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	return r.collect(ctx, item, props)
+}
+
+func (r *RedisSink) collect(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	logger := ctx.GetLogger()
+	payload, ok := item.([]byte)
+	if !ok {
+		logger.Warnf("redis sink receive non []byte data: %v", item)
+		return nil
+	}
+	var rows []json.RawMessage
+	if err := json.Unmarshal(payload, &rows); err != nil {
+		// the result of dataTemplate may be any text
+		rows = []json.RawMessage{payload}
+	}
+	key, field := r.cfg.Key, r.cfg.Field
+	if v, ok := props["key"]; ok {
+		key = v
+	}
+	if v, ok := props["field"]; ok {
+		field = v
+	}
+	if key == "" {
+		return fmt.Errorf("redis sink gets empty key for %s", payload)
+	}
+	pipe := r.cli.Pipeline()
+	for _, row := range rows {
+		if err := r.write(pipe, key, field, row); err != nil {
+			_ = pipe.Close()
+			return err
+		}
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return fmt.Errorf("redis sink fails to write: %v", err)
+	}
+	logger.Debugf("redis sink writes %d rows", len(rows))
+	return nil
+}
+
+func (r *RedisSink) write(pipe redis.Pipeliner, key string, field string, row []byte) error {
+	var data map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(row))
+	d.UseNumber()
+	if err := d.Decode(&data); err != nil {
+		data = nil
+	}
+	if data == nil && (len(r.cfg.Fields) > 0 || (r.cfg.Command == REDIS_HSET && r.cfg.Field == "")) {
+		return fmt.Errorf("redis sink requires the result %s to be json object", row)
+	}
+	var value interface{} = string(row)
+	if len(r.cfg.Fields) > 0 {
+		m := make(map[string]interface{}, len(r.cfg.Fields))
+		for _, f := range r.cfg.Fields {
+			if v, ok := data[f]; ok {
+				m[f] = v
+			}
+		}
+		data = m
+		b, _ := json.Marshal(m)
+		value = string(b)
+	}
+	ttl := time.Duration(r.cfg.Ttl) * time.Millisecond
+	switch r.cfg.Command {
+	case REDIS_SET:
+		pipe.Set(key, value, ttl)
+	case REDIS_HSET:
+		if r.cfg.Field != "" {
+			pipe.HSet(key, field, value)
+		} else {
+			if len(data) == 0 {
+				return nil
+			}
+			fields := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				fields[k] = hashValue(v)
+			}
+			pipe.HSet(key, fields)
+		}
+	case REDIS_LPUSH:
+		pipe.LPush(key, value)
+	case REDIS_RPUSH:
+		pipe.RPush(key, value)
+	case REDIS_PUBLISH:
+		pipe.Publish(key, value)
+	}
+	// set applies the ttl by itself
+	if ttl > 0 && r.cfg.Command != REDIS_SET {
+		pipe.PExpire(key, ttl)
+	}
+	return nil
+}
+
+// hashValue converts the field value to the string of the hash. The objects and arrays are json strings.
+func hashValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
+
+func (r *RedisSink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing redis sink")
+	if r.cli != nil {
+		return r.cli.Close()
+	}
+	return nil
+}
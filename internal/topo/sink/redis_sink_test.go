@@ -0,0 +1,115 @@
+package sink
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedisSink(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestRedisSink")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	data := []byte(`[{"id":"d1","temperature":20.5,"tags":["a"]},{"id":"d2","temperature":1000000,"tags":null}]`)
+	// the rows sent by sendSingle with the dynamic properties evaluated by the sink node
+	d1 := []byte(`{"id":"d1","temperature":20.5,"tags":["a"]}`)
+	d2 := []byte(`{"id":"d2","temperature":1000000,"tags":null}`)
+	type item struct {
+		data  []byte
+		props map[string]string
+	}
+	var tests = []struct {
+		props map[string]interface{}
+		items []item
+		check func() interface{}
+		exp   interface{}
+	}{
+		{
+			props: map[string]interface{}{"key": "device:{{.id}}", "fields": []interface{}{"temperature"}, "ttl": 60000},
+			items: []item{{d1, map[string]string{"key": "device:d1"}}, {d2, map[string]string{"key": "device:d2"}}},
+			check: func() interface{} {
+				v, _ := mr.Get("device:d1")
+				return []interface{}{v, mr.TTL("device:d1")}
+			},
+			exp: []interface{}{`{"temperature":20.5}`, time.Minute},
+		}, {
+			props: map[string]interface{}{"command": "hset", "key": "status:{{.id}}"},
+			items: []item{{d1, map[string]string{"key": "status:d1"}}, {d2, map[string]string{"key": "status:d2"}}},
+			check: func() interface{} {
+				return []string{mr.HGet("status:d1", "temperature"), mr.HGet("status:d1", "tags"), mr.HGet("status:d2", "temperature"), mr.HGet("status:d2", "tags")}
+			},
+			exp: []string{"20.5", `["a"]`, "1000000", ""},
+		}, {
+			props: map[string]interface{}{"command": "hset", "key": "devices", "field": "{{.id}}"},
+			items: []item{{d1, map[string]string{"field": "d1"}}, {d2, map[string]string{"field": "d2"}}},
+			check: func() interface{} {
+				keys, _ := mr.HKeys("devices")
+				return keys
+			},
+			exp: []string{"d1", "d2"},
+		}, {
+			props: map[string]interface{}{"command": "rpush", "key": "history", "ttl": 1000},
+			items: []item{{data, nil}},
+			check: func() interface{} {
+				l, _ := mr.List("history")
+				return []interface{}{l, mr.TTL("history")}
+			},
+			exp: []interface{}{[]string{`{"id":"d1","temperature":20.5,"tags":["a"]}`, `{"id":"d2","temperature":1000000,"tags":null}`}, time.Second},
+		},
+	}
+	for i, tt := range tests {
+		tt.props["addr"] = mr.Addr()
+		s := &RedisSink{}
+		if err := s.Configure(tt.props); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if err := s.Open(ctx); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		for _, it := range tt.items {
+			if err := s.CollectWithProps(ctx, it.data, it.props); err != nil {
+				t.Errorf("%d: %v", i, err)
+			}
+		}
+		s.Close(ctx)
+		if r := tt.check(); !reflect.DeepEqual(tt.exp, r) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.exp, r)
+		}
+	}
+}
+
+func TestRedisSinkConfigure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{},
+			err:   "redis sink is missing property key",
+		}, {
+			props: map[string]interface{}{"command": "del", "key": "a"},
+			err:   "invalid command del, must be set, hset, lpush, rpush or publish",
+		}, {
+			props: map[string]interface{}{"command": "publish", "key": "a", "ttl": 1000},
+			err:   "ttl is not supported by publish command",
+		}, {
+			props: map[string]interface{}{"key": "a", "field": "b"},
+			err:   "field is only supported by hset command",
+		},
+	}
+	for i, tt := range tests {
+		err := (&RedisSink{}).Configure(tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package sink
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
 	"github.com/lf-edge/ekuiper/pkg/api"
@@ -21,6 +23,7 @@ type RestSink struct {
 	sendSingle         bool
 	debugResp          bool
 	insecureSkipVerify bool
+	auth               *httpx.TokenSource
 
 	client *http.Client
 }
@@ -126,6 +129,15 @@ func (ms *RestSink) Configure(ps map[string]interface{}) error {
 			return fmt.Errorf("rest sink property insecureSkipVerify %v is not a bool", temp)
 		}
 	}
+
+	temp, ok = ps["auth"]
+	if ok {
+		ts, err := httpx.NewTokenSource(temp)
+		if err != nil {
+			return fmt.Errorf("rest sink property auth %v is invalid: %v", temp, err)
+		}
+		ms.auth = ts
+	}
 	return nil
 }
 
@@ -161,13 +173,68 @@ func (me MultiErrors) Error() string {
 }
 
 func (ms *RestSink) Collect(ctx api.StreamContext, item interface{}) error {
+	return ms.collect(ctx, item, ms.url)
+}
+
+// CollectWithProps sends the data to the url evaluated by the data if the url is a template
+func (ms *RestSink) CollectWithProps(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	u := ms.url
+	if p, ok := props["url"]; ok {
+		u = p
+	}
+	return ms.collect(ctx, item, u)
+}
+
+// CollectBatch sends the batch in one request whose body is the json array of all the rows. If the body type is not
+// json or any data is not json, such as the result of dataTemplate, the data are sent one by one.
+func (ms *RestSink) CollectBatch(ctx api.StreamContext, items []interface{}) error {
+	if ms.bodyType == "json" {
+		if body, ok := mergeJsonRows(items); ok {
+			return ms.collect(ctx, body, ms.url)
+		}
+	}
+	for _, item := range items {
+		if err := ms.collect(ctx, item, ms.url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeJsonRows merges the json objects or arrays of the data into one json array
+func mergeJsonRows(items []interface{}) ([]byte, bool) {
+	var rows []json.RawMessage
+	for _, item := range items {
+		b, ok := item.([]byte)
+		if !ok {
+			return nil, false
+		}
+		t := bytes.TrimSpace(b)
+		switch {
+		case len(t) > 0 && t[0] == '[':
+			var r []json.RawMessage
+			if err := json.Unmarshal(t, &r); err != nil {
+				return nil, false
+			}
+			rows = append(rows, r...)
+		case len(t) > 0 && t[0] == '{' && json.Valid(t):
+			rows = append(rows, t)
+		default:
+			return nil, false
+		}
+	}
+	result, err := json.Marshal(rows)
+	return result, err == nil
+}
+
+func (ms *RestSink) collect(ctx api.StreamContext, item interface{}, u string) error {
 	logger := ctx.GetLogger()
 	v, ok := item.([]byte)
 	if !ok {
 		logger.Warnf("rest sink receive non []byte data: %v", item)
 	}
 	logger.Debugf("rest sink receive %s", item)
-	resp, err := ms.Send(v, logger)
+	resp, err := httpx.SendWithAuth(logger, ms.client, ms.auth, ms.bodyType, ms.method, u, ms.headers, ms.sendSingle, v)
 	if err != nil {
 		return fmt.Errorf("rest sink fails to send out the data: %s", err)
 	} else {
@@ -190,7 +257,7 @@ func (ms *RestSink) Collect(ctx api.StreamContext, item interface{}) error {
 }
 
 func (ms *RestSink) Send(v interface{}, logger api.Logger) (*http.Response, error) {
-	return httpx.Send(logger, ms.client, ms.bodyType, ms.method, ms.url, ms.headers, ms.sendSingle, v)
+	return httpx.SendWithAuth(logger, ms.client, ms.auth, ms.bodyType, ms.method, ms.url, ms.headers, ms.sendSingle, v)
 }
 
 func (ms *RestSink) Close(ctx api.StreamContext) error {
@@ -355,3 +355,77 @@ func TestRestSinkTemplate_Apply(t *testing.T) {
 		}
 	}
 }
+
+func TestRestSink_CollectWithProps(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestRestSink_CollectWithProps")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	s := &RestSink{}
+	if err := s.Configure(map[string]interface{}{
+		"method":     "post",
+		"url":        ts.URL + "/devices/{{.id}}",
+		"sendSingle": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CollectWithProps(ctx, []byte(`{"id":"d1"}`), map[string]string{"url": ts.URL + "/devices/d1"}); err != nil {
+		t.Error(err)
+	}
+	if err := s.CollectWithProps(ctx, []byte(`{"id":"d2"}`), map[string]string{"url": ts.URL + "/devices/d2"}); err != nil {
+		t.Error(err)
+	}
+	s.Close(ctx)
+	exp := []string{"/devices/d1", "/devices/d2"}
+	if !reflect.DeepEqual(exp, paths) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, paths)
+	}
+}
+
+func TestRestSink_CollectBatch(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestRestSink_CollectBatch")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+
+	var tests = []struct {
+		items  []interface{}
+		result []string
+	}{
+		{
+			items:  []interface{}{[]byte(`[{"a":1}]`), []byte(`{"a":2}`)},
+			result: []string{`[{"a":1},{"a":2}]`},
+		}, {
+			items:  []interface{}{[]byte(`{"a":1}`), []byte(`a is 2`)},
+			result: []string{`{"a":1}`, `a is 2`},
+		},
+	}
+	for i, tt := range tests {
+		var bodies []string
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			bodies = append(bodies, string(body))
+		}))
+		s := &RestSink{}
+		if err := s.Configure(map[string]interface{}{"method": "post", "url": ts.URL}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Open(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CollectBatch(ctx, tt.items); err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+		s.Close(ctx)
+		ts.Close()
+		if !reflect.DeepEqual(tt.result, bodies) {
+			t.Errorf("%d: result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, bodies)
+		}
+	}
+}
@@ -0,0 +1,443 @@
+package sink
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/pkg/sqlx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	SQL_MODE_INSERT = "insert"
+	SQL_MODE_UPSERT = "upsert"
+	// The table to save the last committed checkpoint of each sink instance for the rules with qos 2
+	SQL_COMMIT_TABLE = "kuiper_sink_commit"
+)
+
+type SQLSinkConfig struct {
+	sqlx.ClientConf
+	Table string `json:"table"`
+	// The fields of the result to write, all the fields are written if not specified
+	Fields []string `json:"fields"`
+	Mode   string   `json:"mode"`
+	// The unique columns to detect the conflict for upsert
+	Keys        []string `json:"keys"`
+	CreateTable bool     `json:"createTable"`
+}
+
+// SQLSink writes each row of the results to a database table whose columns are the field names. All the rows of a
+// result, or of a batch, are written in one transaction. The table can be a go template which is evaluated by the sink
+// node and passed to CollectWithProps. For the rules with qos 2, the results are staged until the checkpoint is
+// completed, then the results of the checkpoint are written in one transaction with the checkpoint id saved in the
+// commit table so that they are never written twice.
+type SQLSink struct {
+	cfg     *SQLSinkConfig
+	dialect sqlx.Dialect
+
+	db *sql.DB
+	// the tables which have been created
+	created map[string]bool
+	mutex   sync.Mutex
+	// the transactions, only set for the rules with qos 2
+	stage *txnStage
+	// the mutex of the commit and the creation of the stage
+	txnMutex sync.Mutex
+}
+
+func (s *SQLSink) Configure(ps map[string]interface{}) error {
+	cfg := &SQLSinkConfig{
+		ClientConf: sqlx.ClientConf{Driver: "sqlite3"},
+		Mode:       SQL_MODE_INSERT,
+	}
+	err := cast.MapToStruct(ps, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", ps, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.Table == "" {
+		return fmt.Errorf("sql sink is missing property table")
+	}
+	switch cfg.Mode {
+	case SQL_MODE_INSERT:
+	case SQL_MODE_UPSERT:
+		if len(cfg.Keys) == 0 {
+			return fmt.Errorf("property keys is required for upsert mode")
+		}
+	default:
+		return fmt.Errorf("invalid mode %s, must be insert or upsert", cfg.Mode)
+	}
+	if len(cfg.Fields) > 0 {
+		for _, k := range cfg.Keys {
+			if !containsString(cfg.Fields, k) {
+				return fmt.Errorf("key %s must be one of the fields", k)
+			}
+		}
+	}
+	s.cfg = cfg
+	s.dialect = sqlx.GetDialect(cfg.Driver)
+	s.created = make(map[string]bool)
+	return nil
+}
+
+func (s *SQLSink) Open(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	db, err := sqlx.Open(&s.cfg.ClientConf)
+	if err != nil {
+		return err
+	}
+	s.db = db
+	logger.Infof("sql sink opens %s database", s.cfg.Driver)
+	return nil
+}
+
+func (s *SQLSink) Collect(ctx api.StreamContext, item interface{}) error {
+	return s.collect(ctx, []interface{}{item}, nil)
+}
+
+// CollectWithProps writes the data to the table evaluated by the data
+func (s *SQLSink) CollectWithProps(ctx api.StreamContext, item interface{}, props map[string]string) error {
+	return s.collect(ctx, []interface{}{item}, props)
+}
+
+// CollectBatch writes the rows of all the data in one transaction
+func (s *SQLSink) CollectBatch(ctx api.StreamContext, items []interface{}) error {
+	return s.collect(ctx, items, nil)
+}
+
+func (s *SQLSink) collect(ctx api.StreamContext, items []interface{}, props map[string]string) error {
+	logger := ctx.GetLogger()
+	payloads := make([][]byte, 0, len(items))
+	for _, item := range items {
+		payload, ok := item.([]byte)
+		if !ok {
+			return fmt.Errorf("sql sink receives non []byte data %v", item)
+		}
+		payloads = append(payloads, payload)
+	}
+	s.txnMutex.Lock()
+	stage := s.stage
+	s.txnMutex.Unlock()
+	if stage != nil {
+		for _, payload := range payloads {
+			if err := stage.append(payload, props); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var rows []map[string]interface{}
+	for _, payload := range payloads {
+		r, err := decodeRows(payload)
+		if err != nil {
+			return fmt.Errorf("sql sink fails to decode the result %s: %v", payload, err)
+		}
+		rows = append(rows, r...)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql sink fails to begin the transaction: %v", err)
+	}
+	table := s.table(props)
+	created := make(map[string]bool)
+	for _, row := range rows {
+		if err := s.write(tx, table, row, created); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql sink fails to commit the transaction: %v", err)
+	}
+	s.markCreated(created)
+	logger.Debugf("sql sink writes %d rows", len(rows))
+	return nil
+}
+
+// BeginTransaction stages the results to the files of the data directory until the checkpoint is completed
+func (s *SQLSink) BeginTransaction(ctx api.StreamContext, _ int64) error {
+	_, err := s.getStage(ctx)
+	return err
+}
+
+func (s *SQLSink) PreCommit(ctx api.StreamContext, checkpointId int64) error {
+	stage, err := s.getStage(ctx)
+	if err != nil {
+		return err
+	}
+	return stage.preCommit(checkpointId)
+}
+
+// Commit writes the staged results of the pre-committed transactions which are not committed yet in one transaction
+func (s *SQLSink) Commit(ctx api.StreamContext, checkpointId int64) error {
+	logger := ctx.GetLogger()
+	stage, err := s.getStage(ctx)
+	if err != nil {
+		return err
+	}
+	s.txnMutex.Lock()
+	defer s.txnMutex.Unlock()
+	ids, err := stage.pending(checkpointId)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	sinkId := fmt.Sprintf("%s/%s/%d", ctx.GetRuleId(), ctx.GetOpId(), ctx.GetInstanceId())
+	committed, err := s.lastCommit(sinkId)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sql sink fails to begin the transaction: %v", err)
+	}
+	count := 0
+	created := make(map[string]bool)
+	for _, id := range ids {
+		if id <= committed {
+			continue
+		}
+		err := stage.read(id, func(data []byte, props map[string]string) error {
+			rows, err := decodeRows(data)
+			if err != nil {
+				return fmt.Errorf("sql sink fails to decode the result %s: %v", data, err)
+			}
+			table := s.table(props)
+			for _, row := range rows {
+				if err := s.write(tx, table, row, created); err != nil {
+					return err
+				}
+			}
+			count += len(rows)
+			return nil
+		})
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	last := ids[len(ids)-1]
+	if last > committed {
+		cols := []string{"sink_id", "checkpoint_id"}
+		stmt := fmt.Sprintf("INSERT INTO %s (%s,%s) VALUES (%s,%s)", s.dialect.Quote(SQL_COMMIT_TABLE), s.dialect.Quote(cols[0]), s.dialect.Quote(cols[1]), s.dialect.Placeholder(1), s.dialect.Placeholder(2)) + s.dialect.Upsert(cols[:1], cols)
+		if _, err := tx.Exec(stmt, sinkId, last); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("sql sink fails to save the commit of checkpoint %d: %v", last, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sql sink fails to commit the transaction: %v", err)
+	}
+	s.markCreated(created)
+	for _, id := range ids {
+		if err := stage.remove(id); err != nil {
+			return err
+		}
+	}
+	logger.Debugf("sql sink commits %d rows up to checkpoint %d", count, last)
+	return nil
+}
+
+func (s *SQLSink) Abort(ctx api.StreamContext, checkpointId int64) error {
+	stage, err := s.getStage(ctx)
+	if err != nil {
+		return err
+	}
+	return stage.abort(checkpointId)
+}
+
+// getStage opens the stage and creates the commit table for the first transaction
+func (s *SQLSink) getStage(ctx api.StreamContext) (*txnStage, error) {
+	s.txnMutex.Lock()
+	defer s.txnMutex.Unlock()
+	if s.stage != nil {
+		return s.stage, nil
+	}
+	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s %s PRIMARY KEY,%s %s)", s.dialect.Quote(SQL_COMMIT_TABLE),
+		s.dialect.Quote("sink_id"), s.dialect.ColumnType("", true), s.dialect.Quote("checkpoint_id"), s.dialect.ColumnType(int64(0), false))
+	if _, err := s.db.Exec(stmt); err != nil {
+		return nil, fmt.Errorf("sql sink fails to create the commit table: %v", err)
+	}
+	stage, err := openTxnStage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.stage = stage
+	return stage, nil
+}
+
+// lastCommit returns the last committed checkpoint id of the sink instance
+func (s *SQLSink) lastCommit(sinkId string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s = %s", s.dialect.Quote("checkpoint_id"), s.dialect.Quote(SQL_COMMIT_TABLE), s.dialect.Quote("sink_id"), s.dialect.Placeholder(1)), sinkId).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("sql sink fails to read the last commit: %v", err)
+	}
+	return id, nil
+}
+
+// table returns the table by the configuration overridden by the dynamic properties
+func (s *SQLSink) table(props map[string]string) string {
+	if t, ok := props["table"]; ok {
+		return t
+	}
+	return s.cfg.Table
+}
+
+// write inserts the row in the transaction. The tables created in the transaction are added to created.
+func (s *SQLSink) write(tx *sql.Tx, table string, row map[string]interface{}, created map[string]bool) error {
+	if table == "" {
+		return fmt.Errorf("sql sink gets empty table name for %v", row)
+	}
+	cols := s.cfg.Fields
+	if len(cols) == 0 {
+		cols = make([]string, 0, len(row))
+		for k := range row {
+			cols = append(cols, k)
+		}
+		sort.Strings(cols)
+	}
+	if s.cfg.CreateTable {
+		if err := s.createTable(tx, table, cols, row, created); err != nil {
+			return err
+		}
+	}
+	values := make([]interface{}, len(cols))
+	for i, c := range cols {
+		values[i] = sqlValue(row[c])
+	}
+	if _, err := tx.Exec(s.insertStatement(table, cols), values...); err != nil {
+		return fmt.Errorf("sql sink fails to write %v to table %s: %v", row, table, err)
+	}
+	return nil
+}
+
+func (s *SQLSink) insertStatement(table string, cols []string) string {
+	qc := make([]string, len(cols))
+	ph := make([]string, len(cols))
+	for i, c := range cols {
+		qc[i] = s.dialect.Quote(c)
+		ph[i] = s.dialect.Placeholder(i + 1)
+	}
+	stmt := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", sqlx.QuoteTable(s.dialect, table), strings.Join(qc, ","), strings.Join(ph, ","))
+	if s.cfg.Mode == SQL_MODE_UPSERT {
+		stmt += s.dialect.Upsert(s.cfg.Keys, cols)
+	}
+	return stmt
+}
+
+// createTable creates the table if not exists with the column types inferred from the row. The table is not marked as
+// created until the transaction is committed.
+func (s *SQLSink) createTable(tx *sql.Tx, table string, cols []string, row map[string]interface{}, created map[string]bool) error {
+	s.mutex.Lock()
+	exists := s.created[table]
+	s.mutex.Unlock()
+	if exists || created[table] {
+		return nil
+	}
+	defs := make([]string, len(cols))
+	for i, c := range cols {
+		defs[i] = s.dialect.Quote(c) + " " + s.dialect.ColumnType(sqlValue(row[c]), containsString(s.cfg.Keys, c))
+	}
+	if len(s.cfg.Keys) > 0 {
+		qk := make([]string, len(s.cfg.Keys))
+		for i, k := range s.cfg.Keys {
+			qk[i] = s.dialect.Quote(k)
+		}
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(qk, ",")))
+	}
+	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", sqlx.QuoteTable(s.dialect, table), strings.Join(defs, ","))
+	if _, err := tx.Exec(stmt); err != nil {
+		return fmt.Errorf("sql sink fails to create table %s: %v", table, err)
+	}
+	created[table] = true
+	return nil
+}
+
+// markCreated marks the tables created by the committed transaction
+func (s *SQLSink) markCreated(created map[string]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for table := range created {
+		s.created[table] = true
+	}
+}
+
+func (s *SQLSink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing sql sink")
+	if s.stage != nil {
+		if err := s.stage.close(); err != nil {
+			ctx.GetLogger().Warnf("sql sink fails to close the transaction: %v", err)
+		}
+	}
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
+
+// decodeRows decodes the result which is an array of rows or a single row. The numbers are kept as json.Number to
+// distinguish the integers.
+func decodeRows(payload []byte) ([]map[string]interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(payload))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	switch t := v.(type) {
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(t))
+		for _, r := range t {
+			m, ok := r.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("row %v is not an object", r)
+			}
+			rows = append(rows, m)
+		}
+		return rows, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{t}, nil
+	default:
+		return nil, fmt.Errorf("result is not an object or array")
+	}
+}
+
+// sqlValue converts the decoded json value to the value supported by database/sql. The objects and arrays are saved
+// as json strings.
+func sqlValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(t)
+		return string(b)
+	default:
+		return v
+	}
+}
+
+func containsString(arr []string, s string) bool {
+	for _, a := range arr {
+		if a == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,241 @@
+package sink
+
+import (
+	"database/sql"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/sqlx"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSQLSink(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSQLSink")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	s := &SQLSink{}
+	err := s.Configure(map[string]interface{}{
+		"dsn":         dsn,
+		"table":       "{{.device}}_status",
+		"mode":        "upsert",
+		"keys":        []interface{}{"id"},
+		"createTable": true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the table is evaluated by the sink node for each data
+	data := []struct {
+		table string
+		data  []byte
+	}{
+		{"d1_status", []byte(`[{"device":"d1","id":1,"temperature":20.5,"tags":["a"]}]`)},
+		{"d2_status", []byte(`[{"device":"d2","id":1,"temperature":30,"tags":[]}]`)},
+		{"d1_status", []byte(`{"device":"d1","id":1,"temperature":21.5,"tags":["b"]}`)},
+		{"d1_status", []byte(`{"device":"d1","id":2,"temperature":22,"tags":null}`)},
+	}
+	for _, d := range data {
+		if err := s.CollectWithProps(ctx, d.data, map[string]string{"table": d.table}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the transaction is rolled back for the invalid row
+	if err := s.CollectWithProps(ctx, []byte(`[{"device":"d1","id":3},{"device":"d1","id":4,"unknown":1}]`), map[string]string{"table": "d1_status"}); err == nil {
+		t.Errorf("should fail for unknown column")
+	}
+	s.Close(ctx)
+
+	db, err := sqlx.Open(&sqlx.ClientConf{Driver: "sqlite3", Dsn: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var tests = []struct {
+		table  string
+		result []map[string]interface{}
+	}{
+		{
+			table: "d1_status",
+			result: []map[string]interface{}{
+				{"device": "d1", "id": int64(1), "temperature": 21.5, "tags": `["b"]`},
+				{"device": "d1", "id": int64(2), "temperature": float64(22), "tags": nil},
+			},
+		}, {
+			table: "d2_status",
+			// the column type is inferred from the integer of the first row
+			result: []map[string]interface{}{
+				{"device": "d2", "id": int64(1), "temperature": int64(30), "tags": `[]`},
+			},
+		},
+	}
+	for i, tt := range tests {
+		result, err := queryAll(db, tt.table)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+	}
+}
+
+func queryAll(db *sql.DB, table string) ([]map[string]interface{}, error) {
+	rows, err := db.Query(`SELECT * FROM "` + table + `" ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return sqlx.ScanRows(rows)
+}
+
+func TestSQLSinkConfigure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{"table": "t"},
+			err:   "missing property dsn",
+		}, {
+			props: map[string]interface{}{"driver": "unknown", "dsn": "test.db", "table": "t"},
+			err:   "sql driver unknown is not registered",
+		}, {
+			props: map[string]interface{}{"dsn": "test.db"},
+			err:   "sql sink is missing property table",
+		}, {
+			props: map[string]interface{}{"dsn": "test.db", "table": "t", "mode": "upsert"},
+			err:   "property keys is required for upsert mode",
+		}, {
+			props: map[string]interface{}{"dsn": "test.db", "table": "t", "mode": "replace"},
+			err:   "invalid mode replace, must be insert or upsert",
+		}, {
+			props: map[string]interface{}{"dsn": "test.db", "table": "t", "mode": "upsert", "keys": []interface{}{"id"}, "fields": []interface{}{"name"}},
+			err:   "key id must be one of the fields",
+		},
+	}
+	for i, tt := range tests {
+		err := (&SQLSink{}).Configure(tt.props)
+		if err == nil || len(err.Error()) < len(tt.err) || err.Error()[:len(tt.err)] != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
+
+func TestSQLSinkTransaction(t *testing.T) {
+	ctx := newTxnContext(t, "TestSQLSinkTransaction")
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	s := &SQLSink{}
+	if err := s.Configure(map[string]interface{}{"dsn": dsn, "table": "result", "createTable": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	if err := s.BeginTransaction(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Collect(ctx, []byte(`[{"id":1},{"id":2}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PreCommit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	// keep the pre-committed transaction to commit it again like the restart after the commit
+	staged := filepath.Join(s.stage.dir, "1.txn")
+	content, err := ioutil.ReadFile(staged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Collect(ctx, []byte(`{"id":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(staged, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Commit(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Errorf("the committed transaction should be removed")
+	}
+	result, err := queryAll(s.db, "result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}}
+	if !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+}
+
+func TestSQLSinkCollectBatch(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSQLSinkCollectBatch")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	s := &SQLSink{}
+	if err := s.Configure(map[string]interface{}{"dsn": dsn, "table": "result", "createTable": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	if err := s.CollectBatch(ctx, []interface{}{[]byte(`[{"id":1},{"id":2}]`), []byte(`{"id":3}`)}); err != nil {
+		t.Fatal(err)
+	}
+	// the whole batch is rolled back for the invalid row
+	if err := s.CollectBatch(ctx, []interface{}{[]byte(`{"id":4}`), []byte(`{"id":5,"unknown":1}`)}); err == nil {
+		t.Errorf("should fail for unknown column")
+	}
+	result, err := queryAll(s.db, "result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []map[string]interface{}{{"id": int64(1)}, {"id": int64(2)}, {"id": int64(3)}}
+	if !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+}
+
+func TestSQLSinkCreateTableRollback(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSQLSinkCreateTableRollback")
+	ctx := context.WithValue(context.Background(), context.LoggerKey, contextLogger)
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	s := &SQLSink{}
+	if err := s.Configure(map[string]interface{}{"dsn": dsn, "table": "result", "createTable": true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+	if err := s.Collect(ctx, map[string]interface{}{"id": 1}); err == nil {
+		t.Errorf("should fail to collect non []byte data")
+	}
+	// the table created in the rolled back transaction is created again
+	if err := s.Collect(ctx, []byte(`[{"id":1},{"id":2,"unknown":1}]`)); err == nil {
+		t.Errorf("should fail for unknown column")
+	}
+	if err := s.Collect(ctx, []byte(`{"id":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	result, err := queryAll(s.db, "result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []map[string]interface{}{{"id": int64(3)}}
+	if !reflect.DeepEqual(exp, result) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, result)
+	}
+}
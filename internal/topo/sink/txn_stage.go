@@ -0,0 +1,238 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	txnCurrent   = "current"
+	txnCommitted = "committed"
+	txnExt       = ".txn"
+)
+
+// txnStage stages the data of the transactions of a TwoPhaseCommitSink instance in the data directory. The data of the
+// current transaction is appended to the current file. When the transaction is pre-committed, the file is synced and
+// renamed by the checkpoint id so that it survives the restart until it is committed or aborted. Each data is saved
+// as a record of the json of the dynamic properties and the content, each of which is prefixed by the 4 bytes length.
+// The id of the last committed transaction is saved in the committed file so that it is not committed again if the
+// process stops before the transaction file is removed.
+type txnStage struct {
+	dir   string
+	file  *os.File
+	buf   *bufio.Writer
+	mutex sync.Mutex
+}
+
+func openTxnStage(ctx api.StreamContext) (*txnStage, error) {
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(dataDir, "sink", ctx.GetRuleId(), ctx.GetOpId()+strconv.Itoa(ctx.GetInstanceId())+txnExt)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("fail to create the transaction directory %s: %v", dir, err)
+	}
+	return &txnStage{dir: dir}, nil
+}
+
+// append appends the data and its dynamic properties to the current transaction
+func (s *txnStage) append(data []byte, props map[string]string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		f, err := os.OpenFile(filepath.Join(s.dir, txnCurrent), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("fail to open the transaction file: %v", err)
+		}
+		s.file = f
+		s.buf = bufio.NewWriter(f)
+	}
+	var p []byte
+	if len(props) > 0 {
+		var err error
+		if p, err = json.Marshal(props); err != nil {
+			return err
+		}
+	}
+	if err := s.writeBytes(p); err != nil {
+		return err
+	}
+	return s.writeBytes(data)
+}
+
+func (s *txnStage) writeBytes(b []byte) error {
+	var l [4]byte
+	binary.BigEndian.PutUint32(l[:], uint32(len(b)))
+	if _, err := s.buf.Write(l[:]); err != nil {
+		return err
+	}
+	_, err := s.buf.Write(b)
+	return err
+}
+
+// preCommit makes the current transaction durable as the transaction of the checkpoint. Nothing is saved if there is
+// no data in the current transaction.
+func (s *txnStage) preCommit(checkpointId int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	s.file, s.buf = nil, nil
+	return os.Rename(filepath.Join(s.dir, txnCurrent), filepath.Join(s.dir, strconv.FormatInt(checkpointId, 10)+txnExt))
+}
+
+// pending returns the checkpoint ids of the pre-committed transactions up to the checkpointId in order
+func (s *txnStage) pending(checkpointId int64) ([]int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int64
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), txnExt) {
+			continue
+		}
+		id, err := strconv.ParseInt(strings.TrimSuffix(e.Name(), txnExt), 10, 64)
+		if err != nil || id > checkpointId {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// read reads each data and its dynamic properties of the pre-committed transaction
+func (s *txnStage) read(checkpointId int64, f func(data []byte, props map[string]string) error) error {
+	file, err := os.Open(filepath.Join(s.dir, strconv.FormatInt(checkpointId, 10)+txnExt))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	for {
+		p, err := readBytes(r)
+		if err == io.EOF {
+			return nil
+		}
+		var data []byte
+		if err == nil {
+			data, err = readBytes(r)
+		}
+		var props map[string]string
+		if err == nil && len(p) > 0 {
+			err = json.Unmarshal(p, &props)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid transaction %d: %v", checkpointId, err)
+		}
+		if err := f(data, props); err != nil {
+			return err
+		}
+	}
+}
+
+func readBytes(r io.Reader) ([]byte, error) {
+	var l [4]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(l[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// committed returns the checkpoint id of the last committed transaction, or -1 if there is none
+func (s *txnStage) committed() (int64, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir, txnCommitted))
+	if os.IsNotExist(err) {
+		return -1, nil
+	} else if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid committed transaction file: %v", err)
+	}
+	return id, nil
+}
+
+// markCommitted saves the checkpoint id of the committed transaction atomically by rename
+func (s *txnStage) markCommitted(checkpointId int64) error {
+	p := filepath.Join(s.dir, txnCommitted)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatInt(checkpointId, 10)), 0644); err != nil {
+		return fmt.Errorf("fail to save the committed transaction %d: %v", checkpointId, err)
+	}
+	return os.Rename(tmp, p)
+}
+
+// remove removes the committed transaction
+func (s *txnStage) remove(checkpointId int64) error {
+	return os.Remove(filepath.Join(s.dir, strconv.FormatInt(checkpointId, 10)+txnExt))
+}
+
+// abort discards the current transaction and the pre-committed transactions after the checkpointId
+func (s *txnStage) abort(checkpointId int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file != nil {
+		_ = s.file.Close()
+		s.file, s.buf = nil, nil
+	}
+	if err := os.Remove(filepath.Join(s.dir, txnCurrent)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	ids, err := s.pending(math.MaxInt64)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id > checkpointId {
+			if err := s.remove(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// close closes the current transaction without commit, which is aborted after restart
+func (s *txnStage) close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file, s.buf = nil, nil
+	return err
+}
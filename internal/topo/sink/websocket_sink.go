@@ -0,0 +1,195 @@
+package sink
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type WebsocketConfig struct {
+	Mode                 string            `json:"mode"`
+	Url                  string            `json:"url"`
+	Server               string            `json:"server"`
+	Path                 string            `json:"path"`
+	Headers              map[string]string `json:"headers"`
+	InsecureSkipVerify   bool              `json:"insecureSkipVerify"`
+	CertificationPath    string            `json:"certificationPath"`
+	PrivateKeyPath       string            `json:"privateKeyPath"`
+	ReconnectInterval    int               `json:"reconnectInterval"`
+	MaxReconnectInterval int               `json:"maxReconnectInterval"`
+	AllowedOrigins       []string          `json:"allowedOrigins"`
+}
+
+// WebsocketSink sends the results by websocket. In client mode, it sends to the websocket server of the url and
+// reconnects with backoff when disconnected. In server mode, it broadcasts to all the clients connected to the path
+// of the embedded http server.
+type WebsocketSink struct {
+	cfg      *WebsocketConfig
+	certPath string
+	keyPath  string
+
+	conn *websocket.Conn
+	// broken notifies to reconnect the current connection
+	broken func()
+	ep     *httpx.WebsocketEndpoint
+	mutex  sync.Mutex
+}
+
+func (ms *WebsocketSink) Configure(ps map[string]interface{}) error {
+	cfg := &WebsocketConfig{
+		Mode:                 "client",
+		Server:               ":10081",
+		ReconnectInterval:    1000,
+		MaxReconnectInterval: 30000,
+	}
+	err := cast.MapToStruct(ps, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", ps, err)
+	}
+	if cfg.ReconnectInterval <= 0 || cfg.MaxReconnectInterval < cfg.ReconnectInterval {
+		return fmt.Errorf("invalid reconnectInterval %d or maxReconnectInterval %d", cfg.ReconnectInterval, cfg.MaxReconnectInterval)
+	}
+	cfg.Mode = strings.ToLower(cfg.Mode)
+	switch cfg.Mode {
+	case "client":
+		if cfg.Url == "" {
+			return fmt.Errorf("websocket sink is missing property url")
+		}
+		u, err := url.Parse(cfg.Url)
+		if err != nil {
+			return fmt.Errorf("invalid websocket url %s: %v", cfg.Url, err)
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return fmt.Errorf("invalid websocket url %s, the scheme must be ws or wss", cfg.Url)
+		}
+	case "server":
+		if cfg.Server == "" {
+			return fmt.Errorf("websocket sink is missing property server")
+		}
+		if cfg.Path == "" {
+			return fmt.Errorf("websocket sink is missing property path")
+		}
+		if !strings.HasPrefix(cfg.Path, "/") {
+			cfg.Path = "/" + cfg.Path
+		}
+		if cfg.CertificationPath != "" || cfg.PrivateKeyPath != "" {
+			if ms.certPath, err = conf.ProcessPath(cfg.CertificationPath); err != nil {
+				return fmt.Errorf("invalid certificationPath %s: %v", cfg.CertificationPath, err)
+			}
+			if ms.keyPath, err = conf.ProcessPath(cfg.PrivateKeyPath); err != nil {
+				return fmt.Errorf("invalid privateKeyPath %s: %v", cfg.PrivateKeyPath, err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid mode %s, must be client or server", cfg.Mode)
+	}
+	ms.cfg = cfg
+	return nil
+}
+
+func (ms *WebsocketSink) Open(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	if ms.cfg.Mode == "server" {
+		ep, err := httpx.AttachWebsocketEndpoint(ms.cfg.Server, ms.certPath, ms.keyPath, ms.cfg.Path, ms.cfg.AllowedOrigins)
+		if err != nil {
+			return err
+		}
+		ms.mutex.Lock()
+		ms.ep = ep
+		ms.mutex.Unlock()
+		logger.Infof("websocket sink broadcasts on path %s of server %s", ms.cfg.Path, ms.cfg.Server)
+		return nil
+	}
+	go ms.runClient(ctx)
+	return nil
+}
+
+// runClient keeps the client connection, reconnect it when failed to read or write
+func (ms *WebsocketSink) runClient(ctx api.StreamContext) {
+	logger := ctx.GetLogger()
+	for {
+		conn, err := httpx.DialWebsocket(ctx, ms.cfg.Url, ms.cfg.Headers, ms.cfg.InsecureSkipVerify, ms.cfg.ReconnectInterval, ms.cfg.MaxReconnectInterval)
+		if err != nil {
+			logger.Infof("websocket sink stops connecting: %v", err)
+			return
+		}
+		// the broken signal is bound to the connection, so that the failure of a closed connection does not affect
+		// the new one
+		done := make(chan struct{})
+		var once sync.Once
+		broken := func() {
+			once.Do(func() { close(done) })
+		}
+		ms.mutex.Lock()
+		ms.conn = conn
+		ms.broken = broken
+		ms.mutex.Unlock()
+		// read to process the control messages and detect the disconnection
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					broken()
+					return
+				}
+			}
+		}()
+		select {
+		case <-ctx.Done():
+			return
+		case <-done:
+			logger.Warnf("websocket sink disconnected from %s, reconnecting", ms.cfg.Url)
+			ms.mutex.Lock()
+			ms.conn = nil
+			ms.broken = nil
+			ms.mutex.Unlock()
+			_ = conn.Close()
+		}
+	}
+}
+
+func (ms *WebsocketSink) Collect(ctx api.StreamContext, item interface{}) error {
+	logger := ctx.GetLogger()
+	v, ok := item.([]byte)
+	if !ok {
+		return fmt.Errorf("websocket sink receive non []byte data: %v", item)
+	}
+	logger.Debugf("websocket sink receive %s", item)
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if ms.ep != nil {
+		ms.ep.Broadcast(v)
+		return nil
+	}
+	if ms.conn == nil {
+		return fmt.Errorf("websocket sink is not connected to %s", ms.cfg.Url)
+	}
+	_ = ms.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	if err := ms.conn.WriteMessage(websocket.TextMessage, v); err != nil {
+		ms.broken()
+		return fmt.Errorf("websocket sink fails to send out the data: %v", err)
+	}
+	return nil
+}
+
+func (ms *WebsocketSink) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing websocket sink")
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	if ms.conn != nil {
+		_ = ms.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		_ = ms.conn.Close()
+		ms.conn = nil
+	}
+	if ms.ep != nil {
+		httpx.DetachEndpoint(ms.cfg.Server, ms.cfg.Path)
+		ms.ep = nil
+	}
+	return nil
+}
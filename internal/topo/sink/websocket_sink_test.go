@@ -0,0 +1,131 @@
+package sink
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebsocketSink_Client(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestWebsocketSink_Client")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	upgrader := websocket.Upgrader{}
+	received := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(data)
+		}
+	}))
+	defer ts.Close()
+
+	s := &WebsocketSink{}
+	err := s.Configure(map[string]interface{}{
+		"url": "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{`[{"ab":"hello1"}]`, `[{"ab":"hello2"}]`}
+	for _, d := range exp {
+		// wait for the connection
+		for i := 0; i < 50; i++ {
+			if err = s.Collect(ctx, []byte(d)); err == nil {
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var results []string
+	for range exp {
+		select {
+		case r := <-received:
+			results = append(results, r)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout to receive data, got %v", results)
+		}
+	}
+	if !reflect.DeepEqual(exp, results) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, results)
+	}
+	s.Close(ctx)
+}
+
+func TestWebsocketSink_Server(t *testing.T) {
+	const addr = "127.0.0.1:0"
+	contextLogger := conf.Log.WithField("rule", "TestWebsocketSink_Server")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	s := &WebsocketSink{}
+	err := s.Configure(map[string]interface{}{
+		"mode":           "server",
+		"server":         addr,
+		"path":           "/results",
+		"allowedOrigins": []interface{}{"http://dashboard.example.com"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Open(ctx); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := httpx.GetServerAddr(addr)
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+a.String()+"/results", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	// the browser clients of other origins are rejected
+	for origin, ok := range map[string]bool{"http://evil.example.com": false, "http://dashboard.example.com": true, "http://" + a.String(): true} {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+a.String()+"/results", http.Header{"Origin": []string{origin}})
+		if ok != (err == nil) {
+			t.Errorf("origin %s: expect accepted %v but got error %v", origin, ok, err)
+		}
+		if err == nil {
+			_ = conn.Close()
+		}
+	}
+	for s.ep.ClientCount() < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	exp := `[{"ab":"hello1"}]`
+	if err := s.Collect(ctx, []byte(exp)); err != nil {
+		t.Fatal(err)
+	}
+	for i, conn := range conns {
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Errorf("client %d read error: %v", i, err)
+		} else if string(data) != exp {
+			t.Errorf("client %d result mismatch:\n\nexp=%s\n\ngot=%s\n\n", i, exp, data)
+		}
+	}
+	s.Close(ctx)
+}
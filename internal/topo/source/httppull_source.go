@@ -1,11 +1,17 @@
 package source
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
 	"github.com/lf-edge/ekuiper/internal/conf"
 	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	ct "github.com/lf-edge/ekuiper/internal/template"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/cast"
 	"github.com/lf-edge/ekuiper/pkg/message"
@@ -13,11 +19,40 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
 const DEFAULT_INTERVAL = 10000
 const DEFAULT_TIMEOUT = 5000
+const DEFAULT_MAX_PAGES = 100
+
+const (
+	PAGINATION_LINK   = "link"
+	PAGINATION_CURSOR = "cursor"
+)
+
+type PaginationConf struct {
+	// link: request the url of the next page. cursor: request again with the cursor of the next page in the template
+	Type string `json:"type"`
+	// The JSONPath to get the next page url or cursor from the response. For link type, the url is read from the
+	// Link header of the response if not specified
+	NextPage string `json:"nextPage"`
+	MaxPages int    `json:"maxPages"`
+}
+
+// pullTemplateData is the data to render the url and body templates
+type pullTemplateData struct {
+	// The time of the last successful pull in unix epoch milliseconds
+	LastPullTime int64
+	// The time of the current pull in unix epoch milliseconds
+	PullTime int64
+	// The last cursor got from the responses
+	Cursor interface{}
+	// The cursor of the next page of the current pull
+	PageCursor interface{}
+}
 
 type HTTPPullSource struct {
 	url           string
@@ -29,8 +64,21 @@ type HTTPPullSource struct {
 	bodyType      string
 	headers       map[string]string
 	messageFormat string
+	decoder       *payloadDecoder
+
+	urlTemplate  *template.Template
+	bodyTemplate *template.Template
+	split        gval.Evaluable
+	cursorPath   gval.Evaluable
+	pagination   *PaginationConf
+	nextPagePath gval.Evaluable
+	auth         *httpx.TokenSource
 
 	client *http.Client
+	// the states to restore by rewind
+	lastPullTime int64
+	cursor       interface{}
+	stateMutex   sync.RWMutex
 }
 
 var bodyTypeMap = map[string]string{"none": "", "text": "text/plain", "json": "application/json", "html": "text/html", "xml": "application/xml", "javascript": "application/javascript", "form": ""}
@@ -103,6 +151,11 @@ func (hps *HTTPPullSource) Configure(device string, props map[string]interface{}
 			return fmt.Errorf("Not valid format value %v.", c)
 		}
 	}
+	if d, err := newPayloadDecoder(hps.messageFormat, props); err != nil {
+		return err
+	} else {
+		hps.decoder = d
+	}
 
 	if b, ok := props["body"]; ok {
 		if b1, ok1 := b.(string); ok1 {
@@ -125,15 +178,98 @@ func (hps *HTTPPullSource) Configure(device string, props map[string]interface{}
 		}
 	}
 
+	if strings.Contains(hps.url, "{{") {
+		t, err := template.New("url").Funcs(ct.FuncMap).Parse(hps.url)
+		if err != nil {
+			return fmt.Errorf("Not valid url template %s: %v.", hps.url, err)
+		}
+		hps.urlTemplate = t
+	}
+	if strings.Contains(hps.body, "{{") {
+		t, err := template.New("body").Funcs(ct.FuncMap).Parse(hps.body)
+		if err != nil {
+			return fmt.Errorf("Not valid body template %s: %v.", hps.body, err)
+		}
+		hps.bodyTemplate = t
+	}
+
+	if s, ok := props["responseSplit"]; ok {
+		e, err := newJsonPath(s)
+		if err != nil {
+			return fmt.Errorf("Not valid responseSplit value %v: %v.", s, err)
+		}
+		hps.split = e
+	}
+
+	if c, ok := props["cursor"]; ok {
+		e, err := newJsonPath(c)
+		if err != nil {
+			return fmt.Errorf("Not valid cursor value %v: %v.", c, err)
+		}
+		hps.cursorPath = e
+	}
+
+	if p, ok := props["pagination"]; ok {
+		pc := &PaginationConf{MaxPages: DEFAULT_MAX_PAGES}
+		if err := cast.MapToStruct(p, pc); err != nil {
+			return fmt.Errorf("Not valid pagination value %v: %v.", p, err)
+		}
+		switch pc.Type {
+		case PAGINATION_LINK:
+		case PAGINATION_CURSOR:
+			if pc.NextPage == "" {
+				return fmt.Errorf("Pagination nextPage is required for cursor type.")
+			}
+		default:
+			return fmt.Errorf("Not valid pagination type %s, it must be link or cursor.", pc.Type)
+		}
+		if pc.Type == PAGINATION_CURSOR && hps.urlTemplate == nil && hps.bodyTemplate == nil {
+			return fmt.Errorf("Pagination of cursor type requires the url or body template to refer the {{.PageCursor}}.")
+		}
+		if pc.MaxPages <= 0 {
+			return fmt.Errorf("Not valid pagination maxPages %d.", pc.MaxPages)
+		}
+		if pc.NextPage != "" {
+			e, err := newJsonPath(pc.NextPage)
+			if err != nil {
+				return fmt.Errorf("Not valid pagination nextPage %s: %v.", pc.NextPage, err)
+			}
+			hps.nextPagePath = e
+		}
+		hps.pagination = pc
+	}
+
+	if a, ok := props["auth"]; ok {
+		ts, err := httpx.NewTokenSource(a)
+		if err != nil {
+			return fmt.Errorf("Not valid auth value %v: %v.", a, err)
+		}
+		hps.auth = ts
+	}
+
+	if (hps.split != nil || hps.cursorPath != nil || hps.nextPagePath != nil) && hps.messageFormat != message.FormatJson {
+		return fmt.Errorf("responseSplit, cursor and pagination nextPage are only supported by json format.")
+	}
+
 	conf.Log.Debugf("Initialized with configurations %#v.", hps)
 	return nil
 }
 
+func newJsonPath(v interface{}) (gval.Evaluable, error) {
+	p, ok := v.(string)
+	if !ok || p == "" {
+		return nil, fmt.Errorf("expect a JSONPath string")
+	}
+	return gval.Full(jsonpath.PlaceholderExtension()).NewEvaluable(p)
+}
+
 func (hps *HTTPPullSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
-	_, e := url.Parse(hps.url)
-	if e != nil {
-		errCh <- e
-		return
+	if hps.urlTemplate == nil {
+		_, e := url.Parse(hps.url)
+		if e != nil {
+			errCh <- e
+			return
+		}
 	}
 
 	hps.client = &http.Client{Timeout: time.Duration(hps.timeout) * time.Millisecond}
@@ -146,53 +282,314 @@ func (hps *HTTPPullSource) Close(ctx api.StreamContext) error {
 	return nil
 }
 
+// GetOffset returns the last pull time and the cursor to be saved as the source state
+func (hps *HTTPPullSource) GetOffset() (interface{}, error) {
+	hps.stateMutex.RLock()
+	defer hps.stateMutex.RUnlock()
+	offset := map[string]interface{}{
+		"lastPullTime": hps.lastPullTime,
+	}
+	if hps.cursor != nil {
+		offset["cursor"] = hps.cursor
+	}
+	return offset, nil
+}
+
+// Rewind restores the last pull time and the cursor from the source state
+func (hps *HTTPPullSource) Rewind(offset interface{}) error {
+	m, ok := offset.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid http pull source offset %v", offset)
+	}
+	hps.stateMutex.Lock()
+	defer hps.stateMutex.Unlock()
+	if t, ok := m["lastPullTime"]; ok {
+		lt, err := cast.ToInt64(t, cast.CONVERT_SAMEKIND)
+		if err != nil {
+			return fmt.Errorf("invalid http pull source offset lastPullTime %v", t)
+		}
+		hps.lastPullTime = lt
+	}
+	hps.cursor = m["cursor"]
+	return nil
+}
+
 func (hps *HTTPPullSource) initTimerPull(ctx api.StreamContext, consumer chan<- api.SourceTuple, _ chan<- error) {
 	ticker := time.NewTicker(time.Millisecond * time.Duration(hps.interval))
-	logger := ctx.GetLogger()
 	defer ticker.Stop()
+	hps.stateMutex.Lock()
+	if hps.lastPullTime == 0 {
+		hps.lastPullTime = conf.GetNowInMilli() - int64(hps.interval)
+	}
+	hps.stateMutex.Unlock()
 	var omd5 = ""
 	for {
 		select {
 		case <-ticker.C:
-			if resp, e := httpx.Send(logger, hps.client, hps.bodyType, hps.method, hps.url, hps.headers, true, []byte(hps.body)); e != nil {
-				logger.Warnf("Found error %s when trying to reach %v ", e, hps)
+			hps.pull(ctx, consumer, &omd5)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pull requests all the pages of one pull and sends out the results
+func (hps *HTTPPullSource) pull(ctx api.StreamContext, consumer chan<- api.SourceTuple, omd5 *string) {
+	logger := ctx.GetLogger()
+	hps.stateMutex.RLock()
+	// render the empty cursors as empty strings instead of <no value>
+	data := &pullTemplateData{
+		LastPullTime: hps.lastPullTime,
+		PullTime:     conf.GetNowInMilli(),
+		Cursor:       "",
+		PageCursor:   "",
+	}
+	if hps.cursor != nil {
+		data.Cursor = hps.cursor
+	}
+	hps.stateMutex.RUnlock()
+	u, body, err := hps.render(data)
+	if err != nil {
+		logger.Errorf("Fail to render the request of http pull source: %v", err)
+		return
+	}
+	for page := 1; ; page++ {
+		c, header, err := hps.request(ctx, u, body)
+		if err != nil {
+			logger.Warnf("Found error %s when trying to reach %s ", err, u)
+			return
+		}
+		if hps.incremental && page == 1 {
+			nmd5 := getMD5Hash(c)
+			if *omd5 == nmd5 {
+				logger.Debugf("Content has not changed since last fetch, so skip processing.")
+				break
 			} else {
-				logger.Debugf("rest sink got response %v", resp)
-				if resp.StatusCode < 200 || resp.StatusCode > 299 {
-					logger.Warnf("Found error http return code: %d when trying to reach %v ", resp.StatusCode, hps)
-					break
-				}
-				defer resp.Body.Close()
-				c, err := ioutil.ReadAll(resp.Body)
-				if err != nil {
-					logger.Warnf("Found error %s when trying to reach %v ", err, hps)
-				}
-				if hps.incremental {
-					nmd5 := getMD5Hash(c)
-					if omd5 == nmd5 {
-						logger.Debugf("Content has not changed since last fetch, so skip processing.")
-						continue
-					} else {
-						omd5 = nmd5
-					}
+				*omd5 = nmd5
+			}
+		}
+		results, raw, err := hps.decode(c)
+		if err != nil {
+			logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(c), hps.messageFormat, err)
+			return
+		}
+		meta := map[string]interface{}{"url": u}
+		for _, result := range results {
+			select {
+			case consumer <- api.NewDefaultSourceTuple(result, meta):
+				logger.Debugf("send data to device node")
+			case <-ctx.Done():
+				return
+			}
+		}
+		if hps.cursorPath != nil {
+			cursor := evalJsonPath(hps.cursorPath, raw)
+			// for the path of multiple values such as $.data[*].id, the last value is the cursor
+			if arr, ok := cursor.([]interface{}); ok {
+				if len(arr) > 0 {
+					cursor = arr[len(arr)-1]
+				} else {
+					cursor = nil
 				}
+			}
+			if n, ok := cursor.(json.Number); ok {
+				cursor = numberValue(n)
+			}
+			if cursor != nil {
+				hps.stateMutex.Lock()
+				hps.cursor = cursor
+				hps.stateMutex.Unlock()
+				data.Cursor = cursor
+			}
+		}
+		if hps.pagination == nil {
+			break
+		}
+		if page >= hps.pagination.MaxPages {
+			logger.Warnf("Stop pulling the next page of %s because it reaches the maxPages %d", u, hps.pagination.MaxPages)
+			break
+		}
+		next := hps.nextPage(raw, header)
+		if next == nil || next == "" {
+			break
+		}
+		if hps.pagination.Type == PAGINATION_LINK {
+			nu, err := resolveUrl(u, fmt.Sprintf("%v", next))
+			if err != nil {
+				logger.Errorf("Invalid next page url %v: %v", next, err)
+				break
+			}
+			u = nu
+		} else {
+			data.PageCursor = next
+			u, body, err = hps.render(data)
+			if err != nil {
+				logger.Errorf("Fail to render the request of http pull source: %v", err)
+				break
+			}
+		}
+	}
+	hps.stateMutex.Lock()
+	hps.lastPullTime = data.PullTime
+	hps.stateMutex.Unlock()
+}
 
-				result, e := message.Decode(c, hps.messageFormat)
-				meta := make(map[string]interface{})
-				if e != nil {
-					logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(c), hps.messageFormat, e)
-					return
-				}
+// render returns the url and body of the request by rendering the templates
+func (hps *HTTPPullSource) render(data *pullTemplateData) (string, []byte, error) {
+	u, body := hps.url, []byte(hps.body)
+	if hps.urlTemplate != nil {
+		var output bytes.Buffer
+		if err := hps.urlTemplate.Execute(&output, data); err != nil {
+			return "", nil, fmt.Errorf("run url template error: %v", err)
+		}
+		u = output.String()
+		if _, err := url.Parse(u); err != nil {
+			return "", nil, fmt.Errorf("invalid url %s: %v", u, err)
+		}
+	}
+	if hps.bodyTemplate != nil {
+		var output bytes.Buffer
+		if err := hps.bodyTemplate.Execute(&output, data); err != nil {
+			return "", nil, fmt.Errorf("run body template error: %v", err)
+		}
+		body = output.Bytes()
+	}
+	return u, body, nil
+}
+
+func (hps *HTTPPullSource) request(ctx api.StreamContext, u string, body []byte) ([]byte, http.Header, error) {
+	logger := ctx.GetLogger()
+	resp, err := httpx.SendWithAuth(logger, hps.client, hps.auth, hps.bodyType, hps.method, u, hps.headers, true, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	logger.Debugf("http pull source got response %v", resp)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, nil, fmt.Errorf("http return code: %d", resp.StatusCode)
+	}
+	c, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, resp.Header, nil
+}
+
+// decode returns the messages of the response and the raw decoded json for the JSONPath evaluation
+func (hps *HTTPPullSource) decode(c []byte) ([]map[string]interface{}, interface{}, error) {
+	if hps.split == nil && hps.cursorPath == nil && hps.nextPagePath == nil {
+		result, err := hps.decoder.decodeOne(c)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []map[string]interface{}{result}, nil, nil
+	}
+	// keep the numbers of the raw json as json.Number so that the cursors such as a timestamp are not rendered as float
+	var raw interface{}
+	d := json.NewDecoder(bytes.NewReader(c))
+	d.UseNumber()
+	if err := d.Decode(&raw); err != nil {
+		return nil, nil, err
+	}
+	if hps.split == nil {
+		m, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("the response is not a json object")
+		}
+		return []map[string]interface{}{floatNumbers(m).(map[string]interface{})}, raw, nil
+	}
+	var results []map[string]interface{}
+	switch r := evalJsonPath(hps.split, raw).(type) {
+	case nil:
+	case []interface{}:
+		for _, item := range r {
+			if m, ok := item.(map[string]interface{}); ok {
+				results = append(results, floatNumbers(m).(map[string]interface{}))
+			} else {
+				return nil, nil, fmt.Errorf("the item %v split from the response is not a json object", item)
+			}
+		}
+	case map[string]interface{}:
+		results = append(results, floatNumbers(r).(map[string]interface{}))
+	default:
+		return nil, nil, fmt.Errorf("the result %v split from the response is not a json array", r)
+	}
+	return results, raw, nil
+}
 
-				select {
-				case consumer <- api.NewDefaultSourceTuple(result, meta):
-					logger.Debugf("send data to device node")
+// nextPage returns the url or cursor of the next page, nil if there is no next page
+func (hps *HTTPPullSource) nextPage(raw interface{}, header http.Header) interface{} {
+	if hps.nextPagePath != nil {
+		return evalJsonPath(hps.nextPagePath, raw)
+	}
+	// read the url of rel="next" from the Link header such as <https://api.example.com/items?page=2>; rel="next"
+	for _, link := range header.Values("Link") {
+		for _, l := range strings.Split(link, ",") {
+			parts := strings.Split(l, ";")
+			if len(parts) < 2 {
+				continue
+			}
+			for _, param := range parts[1:] {
+				if strings.ReplaceAll(strings.TrimSpace(param), " ", "") == `rel="next"` {
+					return strings.Trim(strings.TrimSpace(parts[0]), "<>")
 				}
 			}
-		case <-ctx.Done():
-			return
 		}
 	}
+	return nil
+}
+
+// floatNumbers returns a copy of the json value decoded with json.Number, in which the numbers are float64 like the
+// other decoded messages
+func floatNumbers(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		f, _ := t.Float64()
+		return f
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			r[k] = floatNumbers(e)
+		}
+		return r
+	case []interface{}:
+		r := make([]interface{}, len(t))
+		for i, e := range t {
+			r[i] = floatNumbers(e)
+		}
+		return r
+	}
+	return v
+}
+
+// numberValue returns the integer value of the number if possible so that it is rendered without exponent
+func numberValue(n json.Number) interface{} {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// evalJsonPath returns the value of the JSONPath, or nil if the path is not found
+func evalJsonPath(path gval.Evaluable, raw interface{}) interface{} {
+	r, err := path(context.Background(), raw)
+	if err != nil {
+		return nil
+	}
+	return r
+}
+
+func resolveUrl(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
 }
 
 func getMD5Hash(text []byte) string {
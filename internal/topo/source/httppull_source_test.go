@@ -0,0 +1,210 @@
+package source
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// pull the results until the count is reached
+func pullResults(t *testing.T, s *HTTPPullSource, count int) ([]map[string]interface{}, []map[string]interface{}) {
+	contextLogger := conf.Log.WithField("rule", t.Name())
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	consumer := make(chan api.SourceTuple, count)
+	go s.Open(ctx, consumer, make(chan error))
+	var (
+		results []map[string]interface{}
+		metas   []map[string]interface{}
+	)
+	for i := 0; i < count; i++ {
+		select {
+		case tuple := <-consumer:
+			results = append(results, tuple.Message())
+			metas = append(metas, tuple.Meta())
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout to receive data, got %v", results)
+		}
+	}
+	return results, metas
+}
+
+func TestHTTPPullSource_LinkPagination(t *testing.T) {
+	var requests []string
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		since, _ := strconv.Atoi(r.URL.Query().Get("since"))
+		page := r.URL.Query().Get("page")
+		switch page {
+		case "":
+			w.Header().Set("Link", fmt.Sprintf(`<%s/items?since=%d&page=2>; rel="next", <%s/items?page=1>; rel="first"`, ts.URL, since, ts.URL))
+			fmt.Fprintf(w, `{"data":[{"id":%d},{"id":%d}]}`, since+1, since+2)
+		case "2":
+			fmt.Fprintf(w, `{"data":[{"id":%d}]}`, since+3)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	s := &HTTPPullSource{}
+	err := s.Configure("/items?since={{.Cursor}}", map[string]interface{}{
+		"url":           ts.URL,
+		"method":        "get",
+		"interval":      50,
+		"bodyType":      "none",
+		"responseSplit": "$.data",
+		"cursor":        "$.data[*].id",
+		"pagination":    map[string]interface{}{"type": "link"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rewind(map[string]interface{}{"lastPullTime": int64(1000), "cursor": 10}); err != nil {
+		t.Fatal(err)
+	}
+	results, metas := pullResults(t, s, 6)
+	exp := []map[string]interface{}{
+		{"id": float64(11)}, {"id": float64(12)}, {"id": float64(13)},
+		{"id": float64(14)}, {"id": float64(15)}, {"id": float64(16)},
+	}
+	if !reflect.DeepEqual(exp, results) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, results)
+	}
+	if metas[2]["url"] != ts.URL+"/items?since=10&page=2" {
+		t.Errorf("meta mismatch, got %v", metas[2])
+	}
+	expRequests := []string{"/items?since=10", "/items?since=10&page=2", "/items?since=13", "/items?since=13&page=2"}
+	if !reflect.DeepEqual(expRequests, requests[:4]) {
+		t.Errorf("requests mismatch:\n\nexp=%v\n\ngot=%v\n\n", expRequests, requests)
+	}
+	offset, _ := s.GetOffset()
+	if c := offset.(map[string]interface{})["cursor"]; c != int64(16) {
+		t.Errorf("cursor mismatch, expect 16 but got %v", c)
+	}
+}
+
+func TestHTTPPullSource_TimestampCursor(t *testing.T) {
+	requests := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.RequestURI()
+		fmt.Fprint(w, `{"events":[{"ts":1700000000122},{"ts":1700000000123}]}`)
+	}))
+	defer ts.Close()
+
+	s := &HTTPPullSource{}
+	err := s.Configure("/events?after={{.Cursor}}", map[string]interface{}{
+		"url":           ts.URL,
+		"method":        "get",
+		"interval":      50,
+		"bodyType":      "none",
+		"responseSplit": "$.events",
+		"cursor":        "$.events[*].ts",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, _ := pullResults(t, s, 3)
+	exp := []map[string]interface{}{{"ts": float64(1700000000122)}, {"ts": float64(1700000000123)}, {"ts": float64(1700000000122)}}
+	if !reflect.DeepEqual(exp, results) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, results)
+	}
+	<-requests
+	if r := <-requests; r != "/events?after=1700000000123" {
+		t.Errorf("the cursor should be rendered as integer but got request %s", r)
+	}
+	offset, _ := s.GetOffset()
+	if c := offset.(map[string]interface{})["cursor"]; c != int64(1700000000123) {
+		t.Errorf("cursor mismatch, expect 1700000000123 but got %v", c)
+	}
+}
+
+func TestHTTPPullSource_CursorPagination(t *testing.T) {
+	bodies := make(chan string, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, r.ContentLength)
+		_, _ = r.Body.Read(b)
+		bodies <- string(b)
+		switch r.URL.Query().Get("page") {
+		case "":
+			fmt.Fprint(w, `{"items":[{"v":1}],"next":"p2"}`)
+		case "p2":
+			fmt.Fprint(w, `{"items":[{"v":2}],"next":"p3"}`)
+		default:
+			fmt.Fprint(w, `{"items":[{"v":3}],"next":"p4"}`)
+		}
+	}))
+	defer ts.Close()
+
+	s := &HTTPPullSource{}
+	err := s.Configure("/list?page={{.PageCursor}}", map[string]interface{}{
+		"url":           ts.URL,
+		"method":        "post",
+		"interval":      50,
+		"body":          `{"from":{{.LastPullTime}},"to":{{.PullTime}}}`,
+		"responseSplit": "$.items",
+		"pagination":    map[string]interface{}{"type": "cursor", "nextPage": "$.next", "maxPages": 3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rewind(map[string]interface{}{"lastPullTime": int64(1000)}); err != nil {
+		t.Fatal(err)
+	}
+	mockclock.ResetClock(2000)
+	results, _ := pullResults(t, s, 3)
+	exp := []map[string]interface{}{{"v": float64(1)}, {"v": float64(2)}, {"v": float64(3)}}
+	if !reflect.DeepEqual(exp, results) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, results)
+	}
+	first := <-bodies
+	if first != `{"from":1000,"to":2000}` {
+		t.Errorf("body mismatch, got %s", first)
+	}
+	// the pages of the same pull use the same body
+	for i := 0; i < 2; i++ {
+		if b := <-bodies; b != first {
+			t.Errorf("page %d body mismatch:\n\nexp=%s\n\ngot=%s\n\n", i+2, first, b)
+		}
+	}
+}
+
+func TestHTTPPullSource_Configure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{"pagination": map[string]interface{}{"type": "offset"}},
+			err:   "Not valid pagination type offset, it must be link or cursor.",
+		}, {
+			props: map[string]interface{}{"pagination": map[string]interface{}{"type": "cursor"}},
+			err:   "Pagination nextPage is required for cursor type.",
+		}, {
+			props: map[string]interface{}{"pagination": map[string]interface{}{"type": "cursor", "nextPage": "$.next"}},
+			err:   "Pagination of cursor type requires the url or body template to refer the {{.PageCursor}}.",
+		}, {
+			props: map[string]interface{}{"responseSplit": "$.data", "format": "binary"},
+			err:   "responseSplit, cursor and pagination nextPage are only supported by json format.",
+		}, {
+			props: map[string]interface{}{"url": "http://localhost/{{.Cursor"},
+			err:   "Not valid url template http://localhost/{{.Cursor: template: url:1: unclosed action.",
+		},
+	}
+	for i, tt := range tests {
+		s := &HTTPPullSource{}
+		err := s.Configure("", tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d: error mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package source
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// pushEndpointConf is the endpoint level configuration. It must be comparable to detect conflicts of the same path
+type pushEndpointConf struct {
+	method      string
+	authType    string
+	username    string
+	password    string
+	token       string
+	successCode int
+	errorCode   int
+	format      string
+	maxBodySize int64
+}
+
+type pushConsumer struct {
+	ctx      api.StreamContext
+	consumer chan<- api.SourceTuple
+}
+
+// pushEndpoint is the handler of a path on the shared http server. Several source instances of the same path
+// (e.g. several rules of the same stream) are all attached to one endpoint and receive every pushed message.
+type pushEndpoint struct {
+	conf *pushEndpointConf
+	// the decoder of the format created by the source which registers the endpoint
+	decoder   *payloadDecoder
+	consumers map[*pushConsumer]bool
+	sync.RWMutex
+}
+
+func attachPushEndpoint(addr, certPath, keyPath, path string, c *pushEndpointConf, d *payloadDecoder, pc *pushConsumer) (*pushEndpoint, error) {
+	h, err := httpx.AttachEndpoint(addr, certPath, keyPath, path, func() http.Handler {
+		return &pushEndpoint{
+			conf:      c,
+			decoder:   d,
+			consumers: make(map[*pushConsumer]bool),
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	ep, ok := h.(*pushEndpoint)
+	if !ok {
+		httpx.DetachEndpoint(addr, path)
+		return nil, fmt.Errorf("http push path %s of server %s is already used by other source or sink", path, addr)
+	}
+	ep.Lock()
+	defer ep.Unlock()
+	if *ep.conf != *c {
+		httpx.DetachEndpoint(addr, path)
+		return nil, fmt.Errorf("http push path %s of server %s is already registered with different settings", path, addr)
+	}
+	ep.consumers[pc] = true
+	return ep, nil
+}
+
+func (ep *pushEndpoint) detach(addr, path string, pc *pushConsumer) {
+	ep.Lock()
+	delete(ep.consumers, pc)
+	ep.Unlock()
+	httpx.DetachEndpoint(addr, path)
+}
+
+func (ep *pushEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ep.RLock()
+	consumers := make([]*pushConsumer, 0, len(ep.consumers))
+	for pc := range ep.consumers {
+		consumers = append(consumers, pc)
+	}
+	ep.RUnlock()
+	c := ep.conf
+	if r.Method != c.method {
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.authenticate(r) {
+		if c.authType == "basic" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ekuiper"`)
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.ContentLength > c.maxBodySize {
+		http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, c.maxBodySize))
+	if err != nil {
+		// the error of MaxBytesReader is not typed, check by the message
+		if err.Error() == "http: request body too large" {
+			http.Error(w, "request body is too large", http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, fmt.Sprintf("fail to read body: %v", err), c.errorCode)
+		}
+		return
+	}
+	results, err := ep.decoder.decode(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid data format, cannot decode to %s format: %v", c.format, err), c.errorCode)
+		return
+	}
+	meta := map[string]interface{}{
+		"method":     r.Method,
+		"path":       r.URL.Path,
+		"remoteAddr": r.RemoteAddr,
+	}
+	headers := make(map[string]interface{})
+	for k := range r.Header {
+		headers[k] = r.Header.Get(k)
+	}
+	meta["headers"] = headers
+	for _, result := range results {
+		for _, pc := range consumers {
+			select {
+			case pc.consumer <- api.NewDefaultSourceTuple(result, meta):
+				pc.ctx.GetLogger().Debugf("send pushed data to source node")
+			case <-pc.ctx.Done():
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+	w.WriteHeader(c.successCode)
+}
+
+func (c *pushEndpointConf) authenticate(r *http.Request) bool {
+	switch c.authType {
+	case "basic":
+		u, p, ok := r.BasicAuth()
+		return ok && secureEqual(u, c.username) && secureEqual(p, c.password)
+	case "bearer":
+		h := r.Header.Get("Authorization")
+		if len(h) < 7 || !strings.EqualFold(h[:7], "bearer ") {
+			return false
+		}
+		return secureEqual(strings.TrimSpace(h[7:]), c.token)
+	default:
+		return true
+	}
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,151 @@
+package source
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"net/http"
+	"strings"
+)
+
+type HTTPPushConfig struct {
+	Server            string `json:"server"`
+	Method            string `json:"method"`
+	CertificationPath string `json:"certificationPath"`
+	PrivateKeyPath    string `json:"privateKeyPath"`
+	AuthType          string `json:"authType"`
+	Username          string `json:"username"`
+	Password          string `json:"password"`
+	Token             string `json:"token"`
+	SuccessCode       int    `json:"successCode"`
+	ErrorCode         int    `json:"errorCode"`
+	Format            string `json:"format"`
+	MaxBodySize       int64  `json:"maxBodySize"`
+}
+
+// HTTPPushSource receives the data pushed by HTTP requests. The endpoint is registered to an embedded HTTP server
+// which can be shared by several streams
+type HTTPPushSource struct {
+	path     string
+	server   string
+	certPath string
+	keyPath  string
+	epConf   *pushEndpointConf
+	decoder  *payloadDecoder
+
+	pc *pushConsumer
+	ep *pushEndpoint
+}
+
+func (hps *HTTPPushSource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &HTTPPushConfig{
+		Server:      ":10081",
+		Method:      http.MethodPost,
+		AuthType:    "none",
+		SuccessCode: http.StatusOK,
+		ErrorCode:   http.StatusBadRequest,
+		Format:      message.FormatJson,
+		MaxBodySize: 10 << 20,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if datasource == "" {
+		return fmt.Errorf("missing datasource, it must be the path of the http push endpoint")
+	}
+	if !strings.HasPrefix(datasource, "/") {
+		datasource = "/" + datasource
+	}
+	hps.path = datasource
+	if cfg.Server == "" {
+		return fmt.Errorf("missing property server")
+	}
+	hps.server = cfg.Server
+
+	cfg.Method = strings.ToUpper(cfg.Method)
+	switch cfg.Method {
+	case http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("not supported http method %s, must be POST or PUT", cfg.Method)
+	}
+
+	cfg.AuthType = strings.ToLower(cfg.AuthType)
+	switch cfg.AuthType {
+	case "", "none":
+		cfg.AuthType = "none"
+	case "basic":
+		if cfg.Username == "" {
+			return fmt.Errorf("missing property username for basic authentication")
+		}
+	case "bearer":
+		if cfg.Token == "" {
+			return fmt.Errorf("missing property token for bearer authentication")
+		}
+	default:
+		return fmt.Errorf("not supported authType %s, must be none, basic or bearer", cfg.AuthType)
+	}
+
+	if cfg.SuccessCode < 200 || cfg.SuccessCode > 299 {
+		return fmt.Errorf("invalid successCode %d, must be a 2xx http status code", cfg.SuccessCode)
+	}
+	if cfg.ErrorCode < 400 || cfg.ErrorCode > 599 {
+		return fmt.Errorf("invalid errorCode %d, must be a 4xx or 5xx http status code", cfg.ErrorCode)
+	}
+	if cfg.MaxBodySize <= 0 {
+		return fmt.Errorf("invalid maxBodySize %d, must be a positive number", cfg.MaxBodySize)
+	}
+
+	if cfg.CertificationPath != "" || cfg.PrivateKeyPath != "" {
+		if hps.certPath, err = conf.ProcessPath(cfg.CertificationPath); err != nil {
+			return fmt.Errorf("invalid certificationPath %s: %v", cfg.CertificationPath, err)
+		}
+		if hps.keyPath, err = conf.ProcessPath(cfg.PrivateKeyPath); err != nil {
+			return fmt.Errorf("invalid privateKeyPath %s: %v", cfg.PrivateKeyPath, err)
+		}
+	}
+
+	if hps.decoder, err = newPayloadDecoder(cfg.Format, props); err != nil {
+		return err
+	}
+	hps.epConf = &pushEndpointConf{
+		method:      cfg.Method,
+		authType:    cfg.AuthType,
+		username:    cfg.Username,
+		password:    cfg.Password,
+		token:       cfg.Token,
+		successCode: cfg.SuccessCode,
+		errorCode:   cfg.ErrorCode,
+		format:      cfg.Format,
+		maxBodySize: cfg.MaxBodySize,
+	}
+	conf.Log.Debugf("Initialized http push source with server %s and path %s.", hps.server, hps.path)
+	return nil
+}
+
+func (hps *HTTPPushSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	hps.pc = &pushConsumer{
+		ctx:      ctx,
+		consumer: consumer,
+	}
+	ep, err := attachPushEndpoint(hps.server, hps.certPath, hps.keyPath, hps.path, hps.epConf, hps.decoder, hps.pc)
+	if err != nil {
+		errCh <- err
+		return
+	}
+	hps.ep = ep
+	logger.Infof("http push source registers endpoint %s on server %s", hps.path, hps.server)
+}
+
+func (hps *HTTPPushSource) Close(ctx api.StreamContext) error {
+	logger := ctx.GetLogger()
+	logger.Infof("Closing HTTP push source")
+	if hps.ep != nil {
+		hps.ep.detach(hps.server, hps.path, hps.pc)
+		hps.ep = nil
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHTTPPushSource_Open(t *testing.T) {
+	const addr = "127.0.0.1:0"
+	contextLogger := conf.Log.WithField("rule", "TestHTTPPushSource_Open")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	s1 := &HTTPPushSource{}
+	err := s1.Configure("/s1", map[string]interface{}{"server": addr, "format": "json", "maxBodySize": 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2 := &HTTPPushSource{}
+	err = s2.Configure("s2", map[string]interface{}{"server": addr, "format": "json", "authType": "bearer", "token": "abc", "successCode": 202})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3 := &HTTPPushSource{}
+	err = s3.Configure("/s2", map[string]interface{}{"server": addr, "format": "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 3)
+	c1 := make(chan api.SourceTuple, 10)
+	c2 := make(chan api.SourceTuple, 10)
+	s1.Open(ctx, c1, errCh)
+	s2.Open(ctx, c2, errCh)
+	// conflict with s2 settings
+	s3.Open(ctx, make(chan api.SourceTuple), errCh)
+	select {
+	case err := <-errCh:
+		exp := fmt.Sprintf("http push path /s2 of server %s is already registered with different settings", addr)
+		if err.Error() != exp {
+			t.Errorf("error mismatch:\n\nexp=%s\n\ngot=%s\n\n", exp, err)
+		}
+	default:
+		t.Errorf("should fail to register the same path with different settings")
+	}
+
+	a, ok := httpx.GetServerAddr(addr)
+	if !ok {
+		t.Fatalf("server %s is not started", addr)
+	}
+	host := a.String()
+
+	var tests = []struct {
+		path   string
+		method string
+		token  string
+		body   string
+		code   int
+		ch     chan api.SourceTuple
+		result []map[string]interface{}
+	}{
+		{
+			path:   "/s1",
+			method: http.MethodPost,
+			body:   `{"temperature":20}`,
+			code:   http.StatusOK,
+			ch:     c1,
+			result: []map[string]interface{}{{"temperature": float64(20)}},
+		}, {
+			path:   "/s1",
+			method: http.MethodPost,
+			body:   `[{"temperature":21},{"temperature":22}]`,
+			code:   http.StatusOK,
+			ch:     c1,
+			result: []map[string]interface{}{{"temperature": float64(21)}, {"temperature": float64(22)}},
+		}, {
+			path:   "/s1",
+			method: http.MethodPost,
+			body:   `{"temperature":`,
+			code:   http.StatusBadRequest,
+		}, {
+			path:   "/s1",
+			method: http.MethodPost,
+			body:   `[{"temperature":21},{"temperature":22},{"temperature":23},{"temperature":24}]`,
+			code:   http.StatusRequestEntityTooLarge,
+		}, {
+			path:   "/s1",
+			method: http.MethodGet,
+			code:   http.StatusMethodNotAllowed,
+		}, {
+			path:   "/s2",
+			method: http.MethodPost,
+			body:   `{"humidity":50}`,
+			code:   http.StatusUnauthorized,
+		}, {
+			path:   "/s2",
+			method: http.MethodPost,
+			token:  "abc",
+			body:   `{"humidity":50}`,
+			code:   http.StatusAccepted,
+			ch:     c2,
+			result: []map[string]interface{}{{"humidity": float64(50)}},
+		}, {
+			path:   "/s3",
+			method: http.MethodPost,
+			body:   `{"humidity":50}`,
+			code:   http.StatusNotFound,
+		},
+	}
+	for i, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "http://"+host+tt.path, bytes.NewBufferString(tt.body))
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Errorf("%d: request error %v", i, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%d: status code mismatch:\n\nexp=%d\n\ngot=%d\n\n", i, tt.code, resp.StatusCode)
+		}
+		var results []map[string]interface{}
+		for range tt.result {
+			select {
+			case tuple := <-tt.ch:
+				results = append(results, tuple.Message())
+				if tuple.Meta()["path"] != tt.path {
+					t.Errorf("%d: meta path mismatch, got %v", i, tuple.Meta()["path"])
+				}
+			case <-time.After(time.Second):
+				t.Errorf("%d: timeout to receive data", i)
+			}
+		}
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d: result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, results)
+		}
+	}
+
+	s1.Close(ctx)
+	s2.Close(ctx)
+	if _, ok := httpx.GetServerAddr(addr); ok {
+		t.Errorf("server %s should stop after all sources are closed", addr)
+	}
+}
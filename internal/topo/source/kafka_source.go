@@ -0,0 +1,311 @@
+package source
+
+import (
+	"fmt"
+	"github.com/Shopify/sarama"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/kafkax"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type KafkaSourceConfig struct {
+	kafkax.ClientConf
+	GroupId    string  `json:"groupId"`
+	Partitions []int32 `json:"partitions"`
+	Offset     string  `json:"offset"`
+	Format     string  `json:"format"`
+}
+
+// KafkaSource consumes the messages of a kafka topic which is the datasource. With the groupId, the partitions are
+// balanced among the consumers of the group and the offsets are committed to kafka. Otherwise, it consumes the
+// specified partitions or all the partitions of the topic. The consumed offsets are also saved as the source state
+// so that the rule with qos >= 1 rewinds to the last checkpoint after restarting.
+type KafkaSource struct {
+	cfg     *KafkaSourceConfig
+	topic   string
+	sc      *sarama.Config
+	initial int64
+	decoder *payloadDecoder
+
+	// partition -> the next offset to consume
+	offsets map[int32]int64
+	mutex   sync.Mutex
+}
+
+func (ks *KafkaSource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &KafkaSourceConfig{
+		Offset: "newest",
+		Format: message.FormatJson,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if ks.decoder, err = newPayloadDecoder(cfg.Format, props); err != nil {
+		return err
+	}
+	if datasource == "" {
+		return fmt.Errorf("missing datasource, it must be the kafka topic")
+	}
+	ks.topic = datasource
+	sc, err := kafkax.NewConfig(&cfg.ClientConf)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(cfg.Offset) {
+	case "newest":
+		ks.initial = sarama.OffsetNewest
+	case "oldest":
+		ks.initial = sarama.OffsetOldest
+	default:
+		return fmt.Errorf("invalid offset %s, must be newest or oldest", cfg.Offset)
+	}
+	if cfg.GroupId != "" && len(cfg.Partitions) > 0 {
+		return fmt.Errorf("partitions cannot be specified with groupId because the partitions are assigned by the group")
+	}
+	sc.Consumer.Offsets.Initial = ks.initial
+	sc.Consumer.Return.Errors = true
+	ks.sc = sc
+	ks.cfg = cfg
+	ks.offsets = make(map[int32]int64)
+	conf.Log.Debugf("Initialized kafka source with topic %s.", ks.topic)
+	return nil
+}
+
+func (ks *KafkaSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	var err error
+	if ks.cfg.GroupId != "" {
+		err = ks.consumeGroup(ctx, consumer)
+	} else {
+		err = ks.consumePartitions(ctx, consumer)
+	}
+	if err != nil {
+		select {
+		case errCh <- err:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (ks *KafkaSource) consumePartitions(ctx api.StreamContext, consumer chan<- api.SourceTuple) error {
+	logger := ctx.GetLogger()
+	c, err := sarama.NewConsumer(ks.cfg.Brokers, ks.sc)
+	if err != nil {
+		return fmt.Errorf("fail to connect kafka %v: %v", ks.cfg.Brokers, err)
+	}
+	defer c.Close()
+	partitions := ks.cfg.Partitions
+	if len(partitions) == 0 {
+		if partitions, err = c.Partitions(ks.topic); err != nil {
+			return fmt.Errorf("fail to get the partitions of topic %s: %v", ks.topic, err)
+		}
+	}
+	var wg sync.WaitGroup
+	for _, p := range partitions {
+		ks.mutex.Lock()
+		offset, ok := ks.offsets[p]
+		ks.mutex.Unlock()
+		if !ok {
+			offset = ks.initial
+		}
+		pc, err := c.ConsumePartition(ks.topic, p, offset)
+		if err == sarama.ErrOffsetOutOfRange && ok {
+			logger.Warnf("The saved offset %d of partition %d is out of range, consume from the %s offset", offset, p, ks.cfg.Offset)
+			pc, err = c.ConsumePartition(ks.topic, p, ks.initial)
+		}
+		if err != nil {
+			return fmt.Errorf("fail to consume partition %d of topic %s: %v", p, ks.topic, err)
+		}
+		wg.Add(1)
+		go func(pc sarama.PartitionConsumer) {
+			defer wg.Done()
+			defer pc.AsyncClose()
+			for {
+				select {
+				case msg := <-pc.Messages():
+					if !ks.send(ctx, consumer, msg) {
+						return
+					}
+				case e := <-pc.Errors():
+					if e != nil {
+						logger.Warnf("kafka source consume error: %v", e)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(pc)
+	}
+	logger.Infof("kafka source consumes partitions %v of topic %s", partitions, ks.topic)
+	wg.Wait()
+	return nil
+}
+
+func (ks *KafkaSource) consumeGroup(ctx api.StreamContext, consumer chan<- api.SourceTuple) error {
+	logger := ctx.GetLogger()
+	g, err := sarama.NewConsumerGroup(ks.cfg.Brokers, ks.cfg.GroupId, ks.sc)
+	if err != nil {
+		return fmt.Errorf("fail to connect kafka %v: %v", ks.cfg.Brokers, err)
+	}
+	defer g.Close()
+	go func() {
+		for e := range g.Errors() {
+			logger.Warnf("kafka source consumer group error: %v", e)
+		}
+	}()
+	h := &groupHandler{ks: ks, ctx: ctx, consumer: consumer}
+	logger.Infof("kafka source consumes topic %s by group %s", ks.topic, ks.cfg.GroupId)
+	for {
+		// Consume returns when the group is rebalanced, so it must be called in a loop
+		if err := g.Consume(ctx, []string{ks.topic}, h); err != nil {
+			logger.Warnf("kafka source consumer group %s error: %v", ks.cfg.GroupId, err)
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+	}
+}
+
+// send sends the message to the consumer and returns false if the rule is stopped
+func (ks *KafkaSource) send(ctx api.StreamContext, consumer chan<- api.SourceTuple, msg *sarama.ConsumerMessage) bool {
+	logger := ctx.GetLogger()
+	meta := map[string]interface{}{
+		"topic":     msg.Topic,
+		"partition": int(msg.Partition),
+		"offset":    msg.Offset,
+		"timestamp": msg.Timestamp.UnixNano() / int64(time.Millisecond),
+	}
+	if msg.Key != nil {
+		meta["key"] = string(msg.Key)
+	}
+	if len(msg.Headers) > 0 {
+		headers := make(map[string]interface{}, len(msg.Headers))
+		for _, h := range msg.Headers {
+			headers[string(h.Key)] = string(h.Value)
+		}
+		meta["headers"] = headers
+	}
+	var tuples []api.SourceTuple
+	results, err := ks.decoder.decode(msg.Value)
+	if err != nil {
+		tuples = []api.SourceTuple{&xsql.ErrorSourceTuple{
+			Error: fmt.Errorf("invalid data format, cannot decode kafka message of topic %s partition %d offset %d to %s format with error %s", msg.Topic, msg.Partition, msg.Offset, ks.cfg.Format, err),
+		}}
+	}
+	for _, result := range results {
+		tuples = append(tuples, api.NewDefaultSourceTuple(result, meta))
+	}
+	for _, tuple := range tuples {
+		select {
+		case consumer <- tuple:
+			logger.Debugf("send kafka data to source node")
+		case <-ctx.Done():
+			return false
+		}
+	}
+	ks.mutex.Lock()
+	ks.offsets[msg.Partition] = msg.Offset + 1
+	ks.mutex.Unlock()
+	return true
+}
+
+// GetOffset returns the next offsets to consume of the partitions
+func (ks *KafkaSource) GetOffset() (interface{}, error) {
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	result := make(map[string]interface{}, len(ks.offsets))
+	for p, o := range ks.offsets {
+		result[strconv.Itoa(int(p))] = o
+	}
+	return result, nil
+}
+
+// Rewind sets the offsets to consume from when opened
+func (ks *KafkaSource) Rewind(offset interface{}) error {
+	m, ok := offset.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid kafka offset %v", offset)
+	}
+	ks.mutex.Lock()
+	defer ks.mutex.Unlock()
+	for k, v := range m {
+		p, err := strconv.Atoi(k)
+		if err != nil {
+			return fmt.Errorf("invalid kafka partition %s", k)
+		}
+		o, err := cast.ToInt64(v, cast.CONVERT_SAMEKIND)
+		if err != nil {
+			return fmt.Errorf("invalid kafka offset %v of partition %s", v, k)
+		}
+		ks.offsets[int32(p)] = o
+	}
+	return nil
+}
+
+func (ks *KafkaSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing kafka source")
+	return nil
+}
+
+// groupHandler consumes the partitions assigned by the consumer group
+type groupHandler struct {
+	ks       *KafkaSource
+	ctx      api.StreamContext
+	consumer chan<- api.SourceTuple
+	// whether the rewound offsets have been applied
+	rewound bool
+}
+
+// Setup moves the committed offsets of the assigned partitions to the rewound offsets for the first session
+func (h *groupHandler) Setup(sess sarama.ConsumerGroupSession) error {
+	if h.rewound {
+		return nil
+	}
+	h.rewound = true
+	h.ks.mutex.Lock()
+	defer h.ks.mutex.Unlock()
+	for topic, partitions := range sess.Claims() {
+		for _, p := range partitions {
+			if o, ok := h.ks.offsets[p]; ok {
+				// reset moves the offset backward and mark moves it forward
+				sess.ResetOffset(topic, p, o, "")
+				sess.MarkOffset(topic, p, o, "")
+			}
+		}
+	}
+	return nil
+}
+
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *groupHandler) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !h.ks.send(h.ctx, h.consumer, msg) {
+				return nil
+			}
+			sess.MarkMessage(msg, "")
+		case <-sess.Context().Done():
+			return nil
+		}
+	}
+}
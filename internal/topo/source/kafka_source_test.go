@@ -0,0 +1,127 @@
+package source
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/xsql"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestKafkaSource(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("test", 0, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).SetVersion(1).
+			SetOffset("test", 0, sarama.OffsetOldest, 0).
+			SetOffset("test", 0, sarama.OffsetNewest, 4),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 1).SetVersion(3).
+			SetMessage("test", 0, 0, sarama.StringEncoder(`{"temperature":20}`)).
+			SetMessage("test", 0, 1, sarama.StringEncoder(`[{"temperature":21},{"temperature":22}]`)).
+			SetMessage("test", 0, 2, sarama.StringEncoder(`{"temperature":23}`)).
+			SetMessage("test", 0, 3, sarama.StringEncoder(`{"temperature":`)).
+			SetHighWaterMark("test", 0, 4),
+	})
+
+	var tests = []struct {
+		rewind interface{}
+		result []map[string]interface{}
+		// the number of the messages which cannot be decoded
+		errors int
+		offset interface{}
+	}{
+		{
+			result: []map[string]interface{}{{"temperature": float64(20)}, {"temperature": float64(21)}, {"temperature": float64(22)}, {"temperature": float64(23)}},
+			errors: 1,
+			offset: map[string]interface{}{"0": int64(4)},
+		},
+		{
+			rewind: map[string]interface{}{"0": int64(2)},
+			result: []map[string]interface{}{{"temperature": float64(23)}},
+			errors: 1,
+			offset: map[string]interface{}{"0": int64(4)},
+		},
+	}
+	for i, tt := range tests {
+		contextLogger := conf.Log.WithField("rule", "TestKafkaSource")
+		ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+		s := &KafkaSource{}
+		err := s.Configure("test", map[string]interface{}{
+			"brokers": []interface{}{broker.Addr()},
+			"version": "0.10.2.0",
+			"offset":  "oldest",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.rewind != nil {
+			if err := s.Rewind(tt.rewind); err != nil {
+				t.Fatal(err)
+			}
+		}
+		consumer := make(chan api.SourceTuple, 10)
+		errCh := make(chan error, 1)
+		go s.Open(ctx, consumer, errCh)
+		var (
+			results []map[string]interface{}
+			errors  int
+		)
+	loop:
+		for j := 0; j < len(tt.result)+tt.errors; j++ {
+			select {
+			case tuple := <-consumer:
+				if _, ok := tuple.(*xsql.ErrorSourceTuple); ok {
+					errors++
+					continue
+				}
+				results = append(results, tuple.Message())
+				if tuple.Meta()["topic"] != "test" || tuple.Meta()["partition"] != 0 {
+					t.Errorf("%d \tmeta mismatch %v", i, tuple.Meta())
+				}
+			case err := <-errCh:
+				t.Errorf("%d \topen error: %v", i, err)
+				break loop
+			case <-time.After(2 * time.Second):
+				break loop
+			}
+		}
+		if !reflect.DeepEqual(tt.result, results) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, results)
+		}
+		if tt.errors != errors {
+			t.Errorf("%d \texpect %d decode errors but got %d", i, tt.errors, errors)
+		}
+		// wait for the offset updated after the last message is sent
+		time.Sleep(10 * time.Millisecond)
+		offset, _ := s.GetOffset()
+		if !reflect.DeepEqual(tt.offset, offset) {
+			t.Errorf("%d \toffset mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.offset, offset)
+		}
+		cancel()
+		s.Close(ctx)
+	}
+}
+
+func TestKafkaSource_Configure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{props: map[string]interface{}{}, err: "missing property brokers"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "offset": "latest"}, err: "invalid offset latest, must be newest or oldest"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "groupId": "g1", "partitions": []interface{}{0}}, err: "partitions cannot be specified with groupId because the partitions are assigned by the group"},
+		{props: map[string]interface{}{"brokers": []interface{}{"127.0.0.1:9092"}, "saslMechanism": "gssapi"}, err: "invalid saslMechanism gssapi, must be none or plain"},
+	}
+	for i, tt := range tests {
+		err := (&KafkaSource{}).Configure("test", tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
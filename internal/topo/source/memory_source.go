@@ -0,0 +1,74 @@
+package source
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/pubsub"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+)
+
+type MemoryConfig struct {
+	BufferLength int `json:"bufferLength"`
+}
+
+// MemorySource subscribes the in-process topics published by the memory sinks of other rules. The datasource is the
+// topic filter which supports the MQTT wildcards.
+type MemorySource struct {
+	topic        string
+	bufferLength int
+
+	sub *pubsub.Subscriber
+}
+
+func (ms *MemorySource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &MemoryConfig{
+		BufferLength: 1024,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.BufferLength <= 0 {
+		return fmt.Errorf("invalid bufferLength %d", cfg.BufferLength)
+	}
+	if err := pubsub.ValidateTopic(datasource, true); err != nil {
+		return fmt.Errorf("invalid datasource: %v", err)
+	}
+	ms.topic = datasource
+	ms.bufferLength = cfg.BufferLength
+	conf.Log.Debugf("Initialized memory source with topic %s.", ms.topic)
+	return nil
+}
+
+func (ms *MemorySource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	sub, err := pubsub.Subscribe(ms.topic, ms.bufferLength)
+	if err != nil {
+		errCh <- err
+		return
+	}
+	ms.sub = sub
+	logger.Infof("memory source subscribes topic %s", ms.topic)
+	for {
+		select {
+		case m := <-sub.C():
+			select {
+			case consumer <- api.NewDefaultSourceTuple(m.Data, map[string]interface{}{"topic": m.Topic}):
+				logger.Debugf("send memory data to source node")
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ms *MemorySource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing memory source")
+	if ms.sub != nil {
+		pubsub.Unsubscribe(ms.sub)
+	}
+	return nil
+}
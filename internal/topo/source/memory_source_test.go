@@ -0,0 +1,47 @@
+package source
+
+import (
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/pubsub"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemorySource(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestMemorySource")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	s := &MemorySource{}
+	if err := s.Configure("devices/+/temperature", map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	go s.Open(ctx, consumer, make(chan error, 1))
+	// wait for the subscription
+	time.Sleep(10 * time.Millisecond)
+	pubsub.Publish("devices/d1/temperature", map[string]interface{}{"temperature": 20})
+	pubsub.Publish("devices/d1/humidity", map[string]interface{}{"humidity": 50})
+	pubsub.Publish("devices/d2/temperature", map[string]interface{}{"temperature": 21})
+	exp := []api.SourceTuple{
+		api.NewDefaultSourceTuple(map[string]interface{}{"temperature": 20}, map[string]interface{}{"topic": "devices/d1/temperature"}),
+		api.NewDefaultSourceTuple(map[string]interface{}{"temperature": 21}, map[string]interface{}{"topic": "devices/d2/temperature"}),
+	}
+	for i, e := range exp {
+		select {
+		case tuple := <-consumer:
+			if !reflect.DeepEqual(e, tuple) {
+				t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, e, tuple)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout to receive data")
+		}
+	}
+	cancel()
+	s.Close(ctx)
+	if err := (&MemorySource{}).Configure("devices/#/temperature", map[string]interface{}{}); err == nil {
+		t.Errorf("should fail for invalid topic filter")
+	}
+}
@@ -1,15 +1,13 @@
 package source
 
 import (
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	MQTT "github.com/eclipse/paho.mqtt.golang"
 	"github.com/google/uuid"
 	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/mqttx"
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/cast"
-	"github.com/lf-edge/ekuiper/pkg/message"
 	"path"
 	"strconv"
 	"strings"
@@ -19,16 +17,19 @@ type MQTTSource struct {
 	srv      string
 	format   string
 	tpc      string
+	qos      byte
 	clientid string
 	pVersion uint
 	uName    string
 	password string
 	certPath string
 	pkeyPath string
+	selector string
 
-	model  modelVersion
-	schema map[string]interface{}
-	conn   MQTT.Client
+	model   modelVersion
+	schema  map[string]interface{}
+	decoder *payloadDecoder
+	conn    mqttx.Client
 }
 
 type MQTTConfig struct {
@@ -37,6 +38,8 @@ type MQTTConfig struct {
 	Servers           []string `json:"servers"`
 	Clientid          string   `json:"clientid"`
 	PVersion          string   `json:"protocolVersion"`
+	ShareGroup        string   `json:"shareGroup"`
+	Selector          string   `json:"connectionSelector"`
 	Uname             string   `json:"username"`
 	Password          string   `json:"password"`
 	Certification     string   `json:"certificationPath"`
@@ -55,19 +58,27 @@ func (ms *MQTTSource) Configure(topic string, props map[string]interface{}) erro
 	if err != nil {
 		return fmt.Errorf("read properties %v fail with error: %v", props, err)
 	}
-	ms.tpc = topic
+	ms.tpc = mqttx.SharedTopic(cfg.ShareGroup, topic)
+	ms.selector = cfg.Selector
 	if srvs := cfg.Servers; srvs != nil && len(srvs) > 0 {
 		ms.srv = srvs[0]
-	} else {
+	} else if ms.selector == "" {
 		return fmt.Errorf("missing server property")
 	}
+	if cfg.Qos < 0 || cfg.Qos > 2 {
+		return fmt.Errorf("not valid qos value %v, the value could be only int 0 or 1 or 2", cfg.Qos)
+	}
+	ms.qos = byte(cfg.Qos)
 
 	ms.format = cfg.Format
+	if ms.decoder, err = newPayloadDecoder(cfg.Format, props); err != nil {
+		return err
+	}
 	ms.clientid = cfg.Clientid
 
-	ms.pVersion = 3
-	if cfg.PVersion == "3.1.1" {
-		ms.pVersion = 4
+	ms.pVersion, err = mqttx.ParseProtocolVersion(cfg.PVersion)
+	if err != nil {
+		return err
 	}
 
 	ms.uName = cfg.Uname
@@ -90,92 +101,57 @@ func (ms *MQTTSource) Configure(topic string, props map[string]interface{}) erro
 }
 
 func (ms *MQTTSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
-	log := ctx.GetLogger()
-
-	opts := MQTT.NewClientOptions().AddBroker(ms.srv).SetProtocolVersion(ms.pVersion)
+	if ms.selector != "" {
+		c, err := mqttx.AttachConnection(ms.selector)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		ctx.GetLogger().Infof("Use the shared connection %s", ms.selector)
+		ms.conn = c
+		subscribe(ms.tpc, ms.qos, c, ctx, consumer, ms.model, ms.format, ms.decoder)
+		return
+	}
 	if ms.clientid == "" {
 		if uuid, err := uuid.NewUUID(); err != nil {
 			errCh <- fmt.Errorf("failed to get uuid, the error is %s", err)
+			return
 		} else {
 			ms.clientid = uuid.String()
-			opts.SetClientID(uuid.String())
-		}
-	} else {
-		opts.SetClientID(ms.clientid)
-	}
-
-	if ms.certPath != "" || ms.pkeyPath != "" {
-		log.Infof("Connect MQTT broker with certification and keys.")
-		if cp, err := conf.ProcessPath(ms.certPath); err == nil {
-			log.Infof("The certification file is %s.", cp)
-			if kp, err1 := conf.ProcessPath(ms.pkeyPath); err1 == nil {
-				log.Infof("The private key file is %s.", kp)
-				if cer, err2 := tls.LoadX509KeyPair(cp, kp); err2 != nil {
-					errCh <- err2
-				} else {
-					opts.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cer}})
-				}
-			} else {
-				errCh <- err1
-			}
-		} else {
-			errCh <- err
-		}
-	} else {
-		log.Infof("Connect MQTT broker with username and password.")
-		if ms.uName != "" {
-			opts = opts.SetUsername(ms.uName)
-		} else {
-			log.Infof("The username is empty.")
-		}
-
-		if ms.password != "" {
-			opts = opts.SetPassword(ms.password)
-		} else {
-			log.Infof("The password is empty.")
 		}
 	}
-	opts.SetAutoReconnect(true)
-	var reconn = false
-	opts.SetConnectionLostHandler(func(client MQTT.Client, e error) {
-		log.Errorf("The connection %s is disconnected due to error %s, will try to re-connect later.", ms.srv+": "+ms.clientid, e)
-		reconn = true
-		subscribe(ms.tpc, client, ctx, consumer, ms.model, ms.format)
+	c, err := mqttx.NewClient(ctx, &mqttx.ClientConf{
+		Server:            ms.srv,
+		ClientId:          ms.clientid,
+		ProtocolVersion:   ms.pVersion,
+		Username:          ms.uName,
+		Password:          ms.password,
+		CertificationPath: ms.certPath,
+		PrivateKeyPath:    ms.pkeyPath,
 	})
-
-	opts.SetOnConnectHandler(func(client MQTT.Client) {
-		if reconn {
-			log.Infof("The connection is %s re-established successfully.", ms.srv+": "+ms.clientid)
-		}
-	})
-
-	c := MQTT.NewClient(opts)
-	if token := c.Connect(); token.Wait() && token.Error() != nil {
-		errCh <- fmt.Errorf("found error when connecting to %s: %s", ms.srv, token.Error())
+	if err != nil {
+		errCh <- err
+		return
 	}
-	log.Infof("The connection to server %s was established successfully", ms.srv)
 	ms.conn = c
-	subscribe(ms.tpc, c, ctx, consumer, ms.model, ms.format)
-	log.Infof("Successfully subscribe to topic %s", ms.srv+": "+ms.clientid)
+	subscribe(ms.tpc, ms.qos, c, ctx, consumer, ms.model, ms.format, ms.decoder)
 }
 
-func subscribe(topic string, client MQTT.Client, ctx api.StreamContext, consumer chan<- api.SourceTuple, model modelVersion, format string) {
+func subscribe(topic string, qos byte, client mqttx.Client, ctx api.StreamContext, consumer chan<- api.SourceTuple, model modelVersion, format string, decoder *payloadDecoder) {
 	log := ctx.GetLogger()
-	h := func(client MQTT.Client, msg MQTT.Message) {
-		log.Debugf("instance %d received %s", ctx.GetInstanceId(), msg.Payload())
-		result, e := message.Decode(msg.Payload(), format)
+	h := func(msg *mqttx.Message) {
+		log.Debugf("instance %d received %s", ctx.GetInstanceId(), msg.Payload)
+		result, e := decoder.decodeOne(msg.Payload)
 		//The unmarshal type can only be bool, float64, string, []interface{}, map[string]interface{}, nil
 		if e != nil {
-			log.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(msg.Payload()), format, e)
+			log.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(msg.Payload), format, e)
 			return
 		}
 
-		meta := make(map[string]interface{})
-		meta["topic"] = msg.Topic()
-		meta["messageid"] = strconv.Itoa(int(msg.MessageID()))
+		meta := mqttMeta(msg)
 
 		if nil != model {
-			sliErr := model.checkType(result, msg.Topic())
+			sliErr := model.checkType(result, msg.Topic)
 			for _, v := range sliErr {
 				log.Errorf(v)
 			}
@@ -189,17 +165,41 @@ func subscribe(topic string, client MQTT.Client, ctx api.StreamContext, consumer
 		}
 	}
 
-	if token := client.Subscribe(topic, 0, h); token.Wait() && token.Error() != nil {
-		log.Errorf("Found error: %s", token.Error())
+	if err := client.Subscribe(topic, qos, h); err != nil {
+		log.Errorf("Found error: %s", err)
 	} else {
 		log.Infof("Successfully subscribe to topic %s", topic)
 	}
 }
 
+// mqttMeta returns the metadata of the message. The MQTT v5 properties are added only if they are set.
+func mqttMeta(msg *mqttx.Message) map[string]interface{} {
+	meta := make(map[string]interface{})
+	meta["topic"] = msg.Topic
+	meta["messageid"] = strconv.Itoa(msg.MessageId)
+	if msg.ResponseTopic != "" {
+		meta["responseTopic"] = msg.ResponseTopic
+	}
+	if len(msg.CorrelationData) > 0 {
+		meta["correlationData"] = string(msg.CorrelationData)
+	}
+	if msg.ContentType != "" {
+		meta["contentType"] = msg.ContentType
+	}
+	if len(msg.UserProperties) > 0 {
+		props := make(map[string]interface{}, len(msg.UserProperties))
+		for k, v := range msg.UserProperties {
+			props[k] = v
+		}
+		meta["userProperties"] = props
+	}
+	return meta
+}
+
 func (ms *MQTTSource) Close(ctx api.StreamContext) error {
 	ctx.GetLogger().Infof("Mqtt Source instance %d Done", ctx.GetInstanceId())
-	if ms.conn != nil && ms.conn.IsConnected() {
-		ms.conn.Disconnect(5000)
+	if ms.conn != nil {
+		ms.conn.Disconnect()
 	}
 	return nil
 }
@@ -0,0 +1,79 @@
+package source
+
+import (
+	"github.com/lf-edge/ekuiper/internal/pkg/mqttx"
+	"reflect"
+	"testing"
+)
+
+func TestMQTTSource_Configure(t *testing.T) {
+	var tests = []struct {
+		topic string
+		props map[string]interface{}
+		tpc   string
+		qos   byte
+		pv    uint
+	}{
+		{
+			topic: "demo",
+			props: map[string]interface{}{"servers": []string{"tcp://127.0.0.1:1883"}, "qos": 1},
+			tpc:   "demo",
+			qos:   1,
+			pv:    3,
+		}, {
+			topic: "devices/+",
+			props: map[string]interface{}{"servers": []string{"tcp://127.0.0.1:1883"}, "shareGroup": "g1", "protocolVersion": "5"},
+			tpc:   "$share/g1/devices/+",
+			pv:    5,
+		}, {
+			topic: "$share/g2/devices/+",
+			props: map[string]interface{}{"servers": []string{"tcp://127.0.0.1:1883"}, "shareGroup": "g1", "protocolVersion": "3.1.1"},
+			tpc:   "$share/g2/devices/+",
+			pv:    4,
+		},
+	}
+	for i, tt := range tests {
+		ms := &MQTTSource{}
+		if err := ms.Configure(tt.topic, tt.props); err != nil {
+			t.Errorf("%d: configure error %v", i, err)
+			continue
+		}
+		if ms.tpc != tt.tpc || ms.qos != tt.qos || ms.pVersion != tt.pv {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s %d %d\n\ngot=%s %d %d\n\n", i, tt.tpc, tt.qos, tt.pv, ms.tpc, ms.qos, ms.pVersion)
+		}
+	}
+}
+
+func TestMQTTMeta(t *testing.T) {
+	var tests = []struct {
+		msg  *mqttx.Message
+		meta map[string]interface{}
+	}{
+		{
+			msg:  &mqttx.Message{Topic: "demo", MessageId: 1},
+			meta: map[string]interface{}{"topic": "demo", "messageid": "1"},
+		}, {
+			msg: &mqttx.Message{
+				Topic:           "demo",
+				MessageId:       2,
+				ResponseTopic:   "reply/demo",
+				CorrelationData: []byte("req1"),
+				ContentType:     "application/json",
+				UserProperties:  map[string]string{"device": "d1"},
+			},
+			meta: map[string]interface{}{
+				"topic":           "demo",
+				"messageid":       "2",
+				"responseTopic":   "reply/demo",
+				"correlationData": "req1",
+				"contentType":     "application/json",
+				"userProperties":  map[string]interface{}{"device": "d1"},
+			},
+		},
+	}
+	for i, tt := range tests {
+		if r := mqttMeta(tt.msg); !reflect.DeepEqual(r, tt.meta) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.meta, r)
+		}
+	}
+}
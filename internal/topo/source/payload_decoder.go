@@ -0,0 +1,49 @@
+package source
+
+import (
+	"encoding/json"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"strings"
+)
+
+// payloadDecoder decodes the payloads of a source by the stream format. The converter is created once by the source
+// properties which may include the options of the format, such as the schemaFile and schemaMessage of protobuf.
+type payloadDecoder struct {
+	json      bool
+	converter message.Converter
+}
+
+func newPayloadDecoder(format string, props map[string]interface{}) (*payloadDecoder, error) {
+	if format == "" {
+		format = message.FormatJson
+	}
+	c, err := message.GetConverter(format, props)
+	if err != nil {
+		return nil, err
+	}
+	return &payloadDecoder{json: strings.ToLower(format) == message.FormatJson, converter: c}, nil
+}
+
+// decodeOne decodes the payload as one message
+func (d *payloadDecoder) decodeOne(payload []byte) (map[string]interface{}, error) {
+	return d.converter.Decode(payload)
+}
+
+// decode decodes the payload as the messages. A json array is split into multiple messages
+func (d *payloadDecoder) decode(payload []byte) ([]map[string]interface{}, error) {
+	if d.json {
+		t := strings.TrimSpace(string(payload))
+		if strings.HasPrefix(t, "[") {
+			var results []map[string]interface{}
+			if err := json.Unmarshal(payload, &results); err != nil {
+				return nil, err
+			}
+			return results, nil
+		}
+	}
+	result, err := d.converter.Decode(payload)
+	if err != nil {
+		return nil, err
+	}
+	return []map[string]interface{}{result}, nil
+}
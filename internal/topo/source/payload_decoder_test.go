@@ -0,0 +1,67 @@
+package source
+
+import (
+	_ "github.com/lf-edge/ekuiper/internal/converter"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPayloadDecoder(t *testing.T) {
+	schema, err := filepath.Abs(filepath.Join("..", "..", "converter", "test", "demo.proto"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	props := map[string]interface{}{"schemaFile": schema, "schemaMessage": "Reading"}
+	c, err := message.GetConverter("protobuf", props)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := c.Encode(map[string]interface{}{"device_id": "d1", "alarm": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		format  string
+		props   map[string]interface{}
+		payload []byte
+		result  []map[string]interface{}
+		err     string
+	}{
+		{
+			format:  "",
+			payload: []byte(`[{"a":1},{"a":2}]`),
+			result:  []map[string]interface{}{{"a": 1.0}, {"a": 2.0}},
+		}, {
+			// the options of the format are read from the source properties
+			format:  "protobuf",
+			props:   props,
+			payload: payload,
+			result:  []map[string]interface{}{{"device_id": "d1", "alarm": true}},
+		}, {
+			format: "protobuf",
+			props:  map[string]interface{}{},
+			err:    "protobuf format requires the schemaFile and schemaMessage properties",
+		},
+	}
+	for i, tt := range tests {
+		d, err := newPayloadDecoder(tt.format, tt.props)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%d: error mismatch:\n  exp=%s\n  got=%v", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		result, err := d.decode(tt.payload)
+		if err != nil {
+			t.Errorf("%d: decode error %v", i, err)
+		} else if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d: result mismatch:\n  exp=%v\n  got=%v", i, tt.result, result)
+		}
+	}
+}
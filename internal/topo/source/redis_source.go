@@ -0,0 +1,215 @@
+package source
+
+import (
+	"fmt"
+	"github.com/go-redis/redis/v7"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/redisx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	REDIS_TYPE_STRING = "string"
+	REDIS_TYPE_HASH   = "hash"
+)
+
+type RedisSourceConfig struct {
+	redisx.ClientConf
+	// The type of the values, string or hash
+	DataType string `json:"dataType"`
+	// The field to put the key into the row
+	KeyField string `json:"keyField"`
+	// The interval to load the keys again in milliseconds, 0 means load only once
+	Interval   int    `json:"interval"`
+	Format     string `json:"format"`
+	RetainSize int    `json:"$retainSize"`
+}
+
+// RedisSource loads the values of the keys matching the datasource pattern as a batch. It is intended to be used as a
+// lookup table to enrich the streams by join. The string values are decoded by the format, and each field of the hash
+// values is a field of the row.
+type RedisSource struct {
+	cfg     *RedisSourceConfig
+	pattern string
+	decoder *payloadDecoder
+
+	cli *redis.Client
+}
+
+func (rs *RedisSource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &RedisSourceConfig{
+		ClientConf: redisx.ClientConf{Addr: "127.0.0.1:6379"},
+		DataType:   REDIS_TYPE_STRING,
+		Format:     message.FormatJson,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if rs.decoder, err = newPayloadDecoder(cfg.Format, props); err != nil {
+		return err
+	}
+	if datasource == "" {
+		return fmt.Errorf("missing datasource, it must be the key pattern")
+	}
+	cfg.DataType = strings.ToLower(cfg.DataType)
+	if cfg.DataType != REDIS_TYPE_STRING && cfg.DataType != REDIS_TYPE_HASH {
+		return fmt.Errorf("invalid dataType %s, must be string or hash", cfg.DataType)
+	}
+	if cfg.Interval < 0 {
+		return fmt.Errorf("invalid interval %d", cfg.Interval)
+	}
+	if rs.cli, err = redisx.NewClient(&cfg.ClientConf); err != nil {
+		return err
+	}
+	rs.cfg = cfg
+	rs.pattern = datasource
+	conf.Log.Debugf("Initialized redis source with pattern %s.", rs.pattern)
+	return nil
+}
+
+func (rs *RedisSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	if err := rs.Load(ctx, consumer); err != nil {
+		errCh <- err
+		return
+	}
+	if rs.cfg.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(rs.cfg.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			logger.Debugf("Load redis source again at %v", conf.GetNowInMilli())
+			if err := rs.Load(ctx, consumer); err != nil {
+				logger.Errorf("Fail to load redis keys %s: %v", rs.pattern, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Load sends the values of all the matched keys followed by an EOF to mark the end of the batch
+func (rs *RedisSource) Load(ctx api.StreamContext, consumer chan<- api.SourceTuple) error {
+	logger := ctx.GetLogger()
+	keys, err := rs.scan()
+	if err != nil {
+		return err
+	}
+	if rs.cfg.RetainSize > 0 && rs.cfg.RetainSize < len(keys) {
+		keys = keys[len(keys)-rs.cfg.RetainSize:]
+	}
+	rows, err := rs.read(keys)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		for _, m := range row {
+			if rs.cfg.KeyField != "" {
+				m[rs.cfg.KeyField] = keys[i]
+			}
+			select {
+			case consumer <- api.NewDefaultSourceTuple(m, map[string]interface{}{"key": keys[i]}):
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+	// Send EOF if retain size not set
+	if rs.cfg.RetainSize == 0 {
+		select {
+		case consumer <- api.NewDefaultSourceTuple(nil, nil):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	logger.Debugf("redis source loads %d keys", len(keys))
+	return nil
+}
+
+// scan returns the sorted keys matching the pattern
+func (rs *RedisSource) scan() ([]string, error) {
+	var (
+		keys   []string
+		cursor uint64
+	)
+	for {
+		ks, next, err := rs.cli.Scan(cursor, rs.pattern, 100).Result()
+		if err != nil {
+			return nil, fmt.Errorf("fail to scan redis keys %s: %v", rs.pattern, err)
+		}
+		keys = append(keys, ks...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// read reads the values of the keys and converts each value to the rows
+func (rs *RedisSource) read(keys []string) ([][]map[string]interface{}, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	pipe := rs.cli.Pipeline()
+	cmds := make([]redis.Cmder, len(keys))
+	for i, k := range keys {
+		if rs.cfg.DataType == REDIS_TYPE_HASH {
+			cmds[i] = pipe.HGetAll(k)
+		} else {
+			cmds[i] = pipe.Get(k)
+		}
+	}
+	// the errors of the keys deleted after scan or in wrong type are handled by each command
+	if _, err := pipe.Exec(); err != nil && err != redis.Nil {
+		if _, ok := err.(redis.Error); !ok {
+			return nil, fmt.Errorf("fail to read redis keys: %v", err)
+		}
+	}
+	result := make([][]map[string]interface{}, len(keys))
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			if err != redis.Nil {
+				conf.Log.Warnf("Fail to read redis key %s: %v", keys[i], err)
+			}
+			continue
+		}
+		switch c := cmd.(type) {
+		case *redis.StringStringMapCmd:
+			if len(c.Val()) == 0 {
+				continue
+			}
+			m := make(map[string]interface{}, len(c.Val()))
+			for k, v := range c.Val() {
+				m[k] = v
+			}
+			result[i] = []map[string]interface{}{m}
+		case *redis.StringCmd:
+			rows, err := rs.decoder.decode([]byte(c.Val()))
+			if err != nil {
+				conf.Log.Warnf("Invalid data format, cannot decode the value of key %s to %s format with error %s", keys[i], rs.cfg.Format, err)
+				continue
+			}
+			result[i] = rows
+		}
+	}
+	return result, nil
+}
+
+func (rs *RedisSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing redis source")
+	if rs.cli != nil {
+		return rs.cli.Close()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package source
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRedisSource(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestRedisSource")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	_ = mr.Set("device:d1", `{"name":"sensor1","size":10}`)
+	_ = mr.Set("device:d2", `{"name":"sensor2","size":20}`)
+	_ = mr.Set("other", `{"name":"other"}`)
+	mr.HSet("status:d1", "state", "on")
+	mr.HSet("status:d1", "since", "10")
+
+	var tests = []struct {
+		datasource string
+		props      map[string]interface{}
+		exp        []api.SourceTuple
+	}{
+		{
+			datasource: "device:*",
+			props:      map[string]interface{}{"keyField": "id"},
+			exp: []api.SourceTuple{
+				api.NewDefaultSourceTuple(map[string]interface{}{"id": "device:d1", "name": "sensor1", "size": float64(10)}, map[string]interface{}{"key": "device:d1"}),
+				api.NewDefaultSourceTuple(map[string]interface{}{"id": "device:d2", "name": "sensor2", "size": float64(20)}, map[string]interface{}{"key": "device:d2"}),
+				api.NewDefaultSourceTuple(nil, nil),
+			},
+		}, {
+			datasource: "status:*",
+			props:      map[string]interface{}{"dataType": "hash", "$retainSize": 1},
+			exp: []api.SourceTuple{
+				api.NewDefaultSourceTuple(map[string]interface{}{"state": "on", "since": "10"}, map[string]interface{}{"key": "status:d1"}),
+			},
+		},
+	}
+	for i, tt := range tests {
+		tt.props["addr"] = mr.Addr()
+		s := &RedisSource{}
+		if err := s.Configure(tt.datasource, tt.props); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		consumer := make(chan api.SourceTuple, 10)
+		go s.Open(ctx, consumer, make(chan error, 1))
+		for j, e := range tt.exp {
+			select {
+			case tuple := <-consumer:
+				if !reflect.DeepEqual(e, tuple) {
+					t.Errorf("%d.%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, j, e, tuple)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("timeout to receive data")
+			}
+		}
+		s.Close(ctx)
+	}
+}
+
+func TestRedisSourceConfigure(t *testing.T) {
+	var tests = []struct {
+		datasource string
+		props      map[string]interface{}
+		err        string
+	}{
+		{
+			datasource: "",
+			props:      map[string]interface{}{},
+			err:        "missing datasource, it must be the key pattern",
+		}, {
+			datasource: "device:*",
+			props:      map[string]interface{}{"dataType": "list"},
+			err:        "invalid dataType list, must be string or hash",
+		}, {
+			datasource: "device:*",
+			props:      map[string]interface{}{"addr": ""},
+			err:        "missing property addr",
+		},
+	}
+	for i, tt := range tests {
+		err := (&RedisSource{}).Configure(tt.datasource, tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package source
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ReplayRecord is a line of the recording file which is written by the source node with the recordFile property
+type ReplayRecord struct {
+	// The time in milliseconds when the source node received the tuple
+	Timestamp int64                  `json:"timestamp"`
+	Message   map[string]interface{} `json:"message"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+}
+
+type ReplaySourceConfig struct {
+	// The speed relative to the recording, 2 means twice as fast. If 0, replay as fast as possible
+	Speed float64 `json:"speed"`
+	// The field to put the recorded timestamp into each message so that it can be used as the event time
+	TimestampField string `json:"timestampField"`
+}
+
+// ReplaySource replays a recording file. The datasource is the path of the file, it is relative to the data
+// directory if not absolute. The interval between the messages is the same as the recording divided by the speed.
+// The replayed messages are processed at the current time, set timestampField to use the recorded time as the event
+// time. The number of replayed records is saved as the source state.
+type ReplaySource struct {
+	cfg  *ReplaySourceConfig
+	file string
+
+	// the number of records replayed
+	offset int64
+	mutex  sync.RWMutex
+}
+
+func (s *ReplaySource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &ReplaySourceConfig{
+		Speed: 1,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Speed < 0 {
+		return fmt.Errorf("invalid speed %v, must not be negative", cfg.Speed)
+	}
+	if datasource == "" {
+		return fmt.Errorf("missing datasource, it must be the path of the recording file")
+	}
+	if s.file, err = dataPath(datasource); err != nil {
+		return err
+	}
+	s.cfg = cfg
+	conf.Log.Debugf("Initialized replay source of %s with speed %v.", s.file, cfg.Speed)
+	return nil
+}
+
+func (s *ReplaySource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	f, err := os.Open(s.file)
+	if err != nil {
+		errCh <- fmt.Errorf("fail to open recording file %s: %v", s.file, err)
+		return
+	}
+	defer f.Close()
+	logger.Infof("replay source starts to replay %s from record %d", s.file, s.getOffset())
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var (
+		line int64
+		prev int64
+	)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		line++
+		if line <= s.getOffset() {
+			continue
+		}
+		var r ReplayRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			logger.Warnf("replay source ignores invalid record %d: %v", line, err)
+			continue
+		}
+		if prev > 0 && s.cfg.Speed > 0 && r.Timestamp > prev {
+			if !s.wait(ctx, int(float64(r.Timestamp-prev)/s.cfg.Speed)) {
+				return
+			}
+		}
+		prev = r.Timestamp
+		if r.Message == nil {
+			r.Message = make(map[string]interface{})
+		}
+		if s.cfg.TimestampField != "" {
+			r.Message[s.cfg.TimestampField] = r.Timestamp
+		}
+		select {
+		case consumer <- api.NewDefaultSourceTuple(r.Message, r.Meta):
+			logger.Debugf("send replayed record %d to source node", line)
+		case <-ctx.Done():
+			return
+		}
+		s.mutex.Lock()
+		s.offset = line
+		s.mutex.Unlock()
+	}
+	if err := scanner.Err(); err != nil {
+		errCh <- fmt.Errorf("fail to read recording file %s: %v", s.file, err)
+		return
+	}
+	logger.Infof("replay source finishes replaying %s", s.file)
+}
+
+func (s *ReplaySource) wait(ctx api.StreamContext, d int) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := conf.GetTimer(d)
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	}
+}
+
+func (s *ReplaySource) getOffset() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.offset
+}
+
+// GetOffset returns the number of records replayed
+func (s *ReplaySource) GetOffset() (interface{}, error) {
+	return s.getOffset(), nil
+}
+
+// Rewind restores the number of records replayed so that they are skipped when opening
+func (s *ReplaySource) Rewind(offset interface{}) error {
+	i, err := cast.ToInt64(offset, cast.CONVERT_SAMEKIND)
+	if err != nil {
+		return fmt.Errorf("invalid replay source offset %v", offset)
+	}
+	s.mutex.Lock()
+	s.offset = i
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *ReplaySource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing replay source")
+	return nil
+}
+
+// dataPath returns the path relative to the data directory if it is not absolute
+func dataPath(p string) (string, error) {
+	if filepath.IsAbs(p) {
+		return p, nil
+	}
+	dir, err := conf.GetDataLoc()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, p), nil
+}
@@ -0,0 +1,139 @@
+package source
+
+import (
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const recording = `{"timestamp":1000,"message":{"a":1},"meta":{"topic":"t1"}}
+{"timestamp":1500,"message":{"a":2}}
+
+invalid
+{"timestamp":3500,"message":{"a":3},"meta":{"topic":"t1"}}
+`
+
+func TestReplaySource(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestReplaySource")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	file := filepath.Join(t.TempDir(), "test.jsonl")
+	if err := ioutil.WriteFile(file, []byte(recording), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		props  map[string]interface{}
+		offset int64
+		result []api.SourceTuple
+	}{
+		{
+			props: map[string]interface{}{"speed": 0},
+			result: []api.SourceTuple{
+				api.NewDefaultSourceTuple(map[string]interface{}{"a": 1.0}, map[string]interface{}{"topic": "t1"}),
+				api.NewDefaultSourceTuple(map[string]interface{}{"a": 2.0}, nil),
+				api.NewDefaultSourceTuple(map[string]interface{}{"a": 3.0}, map[string]interface{}{"topic": "t1"}),
+			},
+		}, {
+			props:  map[string]interface{}{"speed": 0, "timestampField": "ts"},
+			offset: 1,
+			result: []api.SourceTuple{
+				api.NewDefaultSourceTuple(map[string]interface{}{"a": 2.0, "ts": int64(1500)}, nil),
+				api.NewDefaultSourceTuple(map[string]interface{}{"a": 3.0, "ts": int64(3500)}, map[string]interface{}{"topic": "t1"}),
+			},
+		},
+	}
+	for i, tt := range tests {
+		s := &ReplaySource{}
+		if err := s.Configure(file, tt.props); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if err := s.Rewind(tt.offset); err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		consumer := make(chan api.SourceTuple, 10)
+		errCh := make(chan error, 1)
+		s.Open(ctx, consumer, errCh)
+		close(consumer)
+		var result []api.SourceTuple
+		for tuple := range consumer {
+			result = append(result, tuple)
+		}
+		if !reflect.DeepEqual(tt.result, result) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, result)
+		}
+		if offset, _ := s.GetOffset(); offset != int64(4) {
+			t.Errorf("%d: offset mismatch, got %v", i, offset)
+		}
+	}
+}
+
+func TestReplaySourceSpeed(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestReplaySourceSpeed")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	mockclock.ResetClock(0)
+	file := filepath.Join(t.TempDir(), "test.jsonl")
+	if err := ioutil.WriteFile(file, []byte(recording), 0666); err != nil {
+		t.Fatal(err)
+	}
+	s := &ReplaySource{}
+	if err := s.Configure(file, map[string]interface{}{"speed": 2}); err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple)
+	go s.Open(ctx, consumer, make(chan error, 1))
+	// the intervals are 500ms and 2000ms in the recording
+	for i, d := range []time.Duration{0, 250 * time.Millisecond, time.Second} {
+		if d > 0 {
+			// wait for the timer
+			time.Sleep(20 * time.Millisecond)
+			mockclock.GetMockClock().Add(d - time.Millisecond)
+			select {
+			case tuple := <-consumer:
+				t.Fatalf("%d: receive %v too early", i, tuple.Message())
+			case <-time.After(20 * time.Millisecond):
+			}
+			mockclock.GetMockClock().Add(time.Millisecond)
+		}
+		select {
+		case tuple := <-consumer:
+			if tuple.Message()["a"] != float64(i+1) {
+				t.Errorf("%d: invalid message %v", i, tuple.Message())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d: timeout to receive data", i)
+		}
+	}
+}
+
+func TestReplaySourceConfigure(t *testing.T) {
+	var tests = []struct {
+		datasource string
+		props      map[string]interface{}
+		err        string
+	}{
+		{
+			datasource: "",
+			props:      map[string]interface{}{},
+			err:        "missing datasource, it must be the path of the recording file",
+		}, {
+			datasource: "test.jsonl",
+			props:      map[string]interface{}{"speed": -1},
+			err:        "invalid speed -1, must not be negative",
+		},
+	}
+	for i, tt := range tests {
+		err := (&ReplaySource{}).Configure(tt.datasource, tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
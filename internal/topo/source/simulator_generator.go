@@ -0,0 +1,282 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"strings"
+)
+
+const (
+	GEN_SEQUENCE  = "sequence"
+	GEN_RANDOM    = "random"
+	GEN_GAUSSIAN  = "gaussian"
+	GEN_SINE      = "sine"
+	GEN_ENUM      = "enum"
+	GEN_REPLAY    = "replay"
+	GEN_TIMESTAMP = "timestamp"
+	GEN_CONSTANT  = "constant"
+)
+
+// GeneratorConf is the configuration of a simulated field. Only the properties of the type are used.
+type GeneratorConf struct {
+	Type string `json:"type"`
+	// sequence: start + step * index
+	Start float64 `json:"start"`
+	Step  float64 `json:"step"`
+	// random: uniform in [min, max)
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+	// gaussian: normal distribution
+	Mean   float64 `json:"mean"`
+	Stddev float64 `json:"stddev"`
+	// sine: offset + amplitude * sin(2π * t / period + phase) where t is the time in milliseconds
+	Amplitude float64 `json:"amplitude"`
+	Period    int64   `json:"period"`
+	Phase     float64 `json:"phase"`
+	Offset    float64 `json:"offset"`
+	// The decimal places to round for random, gaussian and sine. If 0, the value is an integer
+	Decimals *int `json:"decimals"`
+	// enum: the values to choose randomly by the optional weights
+	Values  []interface{} `json:"values"`
+	Weights []float64     `json:"weights"`
+	// replay: the values of a json array file or json lines file in order
+	Path string `json:"path"`
+	// The field of the replayed object as the value. If not set, the whole value is used
+	Key  string `json:"key"`
+	Loop *bool  `json:"loop"`
+	// timestamp: the current time in milliseconds + skew + random jitter in [-jitter, jitter]. The value is moved back
+	// by a random duration in (0, lateness] by the outOfOrder probability to simulate the late events
+	Skew       int64   `json:"skew"`
+	Jitter     int64   `json:"jitter"`
+	OutOfOrder float64 `json:"outOfOrder"`
+	Lateness   int64   `json:"lateness"`
+	// constant
+	Value interface{} `json:"value"`
+}
+
+// generator generates the value of a field for the index-th message at the time now in milliseconds. The replay
+// generator returns errReplayEnd when all the values are replayed and not looping.
+type generator interface {
+	next(r *rand.Rand, index int64, now int64) (interface{}, error)
+}
+
+var errReplayEnd = fmt.Errorf("replay end")
+
+func newGenerator(name string, c *GeneratorConf) (generator, error) {
+	switch strings.ToLower(c.Type) {
+	case GEN_SEQUENCE:
+		if c.Step == 0 {
+			c.Step = 1
+		}
+		return &sequenceGen{c}, nil
+	case GEN_RANDOM:
+		if c.Max < c.Min {
+			return nil, fmt.Errorf("field %s: max %v must not be smaller than min %v", name, c.Max, c.Min)
+		}
+		return &randomGen{c}, nil
+	case GEN_GAUSSIAN:
+		if c.Stddev < 0 {
+			return nil, fmt.Errorf("field %s: invalid stddev %v", name, c.Stddev)
+		}
+		return &gaussianGen{c}, nil
+	case GEN_SINE:
+		if c.Period <= 0 {
+			return nil, fmt.Errorf("field %s: period must be a positive integer", name)
+		}
+		return &sineGen{c}, nil
+	case GEN_ENUM:
+		if len(c.Values) == 0 {
+			return nil, fmt.Errorf("field %s: values are required", name)
+		}
+		if len(c.Weights) > 0 && len(c.Weights) != len(c.Values) {
+			return nil, fmt.Errorf("field %s: the length of weights must be the same as values", name)
+		}
+		g := &enumGen{conf: c}
+		for _, w := range c.Weights {
+			if w < 0 {
+				return nil, fmt.Errorf("field %s: invalid weight %v", name, w)
+			}
+			g.total += w
+		}
+		if len(c.Weights) > 0 && g.total == 0 {
+			return nil, fmt.Errorf("field %s: the weights must not be all zero", name)
+		}
+		return g, nil
+	case GEN_REPLAY:
+		values, err := readReplayFile(c.Path)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", name, err)
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("field %s: replay file %s is empty", name, c.Path)
+		}
+		loop := c.Loop == nil || *c.Loop
+		return &replayGen{values: values, key: c.Key, loop: loop}, nil
+	case GEN_TIMESTAMP:
+		if c.Jitter < 0 || c.Lateness < 0 {
+			return nil, fmt.Errorf("field %s: jitter and lateness must not be negative", name)
+		}
+		if c.OutOfOrder < 0 || c.OutOfOrder > 1 {
+			return nil, fmt.Errorf("field %s: outOfOrder must be a probability between 0 and 1", name)
+		}
+		if c.OutOfOrder > 0 && c.Lateness == 0 {
+			return nil, fmt.Errorf("field %s: lateness is required for outOfOrder", name)
+		}
+		return &timestampGen{c}, nil
+	case GEN_CONSTANT:
+		return &constantGen{c.Value}, nil
+	default:
+		return nil, fmt.Errorf("field %s: invalid generator type %s", name, c.Type)
+	}
+}
+
+// round rounds the value to the decimal places. If the decimals is 0, the value is an int64
+func round(v float64, decimals *int) interface{} {
+	if decimals == nil {
+		return v
+	}
+	if *decimals <= 0 {
+		return int64(math.Round(v))
+	}
+	p := math.Pow10(*decimals)
+	return math.Round(v*p) / p
+}
+
+type sequenceGen struct {
+	conf *GeneratorConf
+}
+
+func (g *sequenceGen) next(_ *rand.Rand, index int64, _ int64) (interface{}, error) {
+	v := g.conf.Start + g.conf.Step*float64(index)
+	if v == math.Trunc(v) && g.conf.Step == math.Trunc(g.conf.Step) {
+		return int64(v), nil
+	}
+	return v, nil
+}
+
+type randomGen struct {
+	conf *GeneratorConf
+}
+
+func (g *randomGen) next(r *rand.Rand, _ int64, _ int64) (interface{}, error) {
+	return round(g.conf.Min+r.Float64()*(g.conf.Max-g.conf.Min), g.conf.Decimals), nil
+}
+
+type gaussianGen struct {
+	conf *GeneratorConf
+}
+
+func (g *gaussianGen) next(r *rand.Rand, _ int64, _ int64) (interface{}, error) {
+	return round(g.conf.Mean+r.NormFloat64()*g.conf.Stddev, g.conf.Decimals), nil
+}
+
+type sineGen struct {
+	conf *GeneratorConf
+}
+
+func (g *sineGen) next(_ *rand.Rand, _ int64, now int64) (interface{}, error) {
+	angle := 2*math.Pi*float64(now%g.conf.Period)/float64(g.conf.Period) + g.conf.Phase
+	return round(g.conf.Offset+g.conf.Amplitude*math.Sin(angle), g.conf.Decimals), nil
+}
+
+type enumGen struct {
+	conf  *GeneratorConf
+	total float64
+}
+
+func (g *enumGen) next(r *rand.Rand, _ int64, _ int64) (interface{}, error) {
+	if len(g.conf.Weights) == 0 {
+		return g.conf.Values[r.Intn(len(g.conf.Values))], nil
+	}
+	x := r.Float64() * g.total
+	for i, w := range g.conf.Weights {
+		if x < w {
+			return g.conf.Values[i], nil
+		}
+		x -= w
+	}
+	return g.conf.Values[len(g.conf.Values)-1], nil
+}
+
+type replayGen struct {
+	values []interface{}
+	key    string
+	loop   bool
+}
+
+func (g *replayGen) next(_ *rand.Rand, index int64, _ int64) (interface{}, error) {
+	if index >= int64(len(g.values)) && !g.loop {
+		return nil, errReplayEnd
+	}
+	v := g.values[index%int64(len(g.values))]
+	if g.key != "" {
+		if m, ok := v.(map[string]interface{}); ok {
+			return m[g.key], nil
+		}
+		return nil, nil
+	}
+	return v, nil
+}
+
+// readReplayFile reads the values of a json array file or a json lines file
+func readReplayFile(p string) ([]interface{}, error) {
+	if p == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	p, err := dataPath(p)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read replay file: %v", err)
+	}
+	var values []interface{}
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte("[")) {
+		if err := json.Unmarshal(content, &values); err != nil {
+			return nil, fmt.Errorf("invalid json array in replay file %s: %v", p, err)
+		}
+		return values, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		l := bytes.TrimSpace(scanner.Bytes())
+		if len(l) == 0 {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(l, &v); err != nil {
+			return nil, fmt.Errorf("invalid json in line %d of replay file %s: %v", line, p, err)
+		}
+		values = append(values, v)
+	}
+	return values, scanner.Err()
+}
+
+type timestampGen struct {
+	conf *GeneratorConf
+}
+
+func (g *timestampGen) next(r *rand.Rand, _ int64, now int64) (interface{}, error) {
+	t := now + g.conf.Skew
+	if g.conf.Jitter > 0 {
+		t += r.Int63n(2*g.conf.Jitter+1) - g.conf.Jitter
+	}
+	if g.conf.OutOfOrder > 0 && r.Float64() < g.conf.OutOfOrder {
+		t -= r.Int63n(g.conf.Lateness) + 1
+	}
+	return t, nil
+}
+
+type constantGen struct {
+	value interface{}
+}
+
+func (g *constantGen) next(_ *rand.Rand, _ int64, _ int64) (interface{}, error) {
+	return g.value, nil
+}
@@ -0,0 +1,177 @@
+package source
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+type SimulatorConfig struct {
+	// The number of messages per second in average
+	Rate float64 `json:"rate"`
+	// The number of messages sent together. The messages are sent every burst / rate seconds
+	Burst int `json:"burst"`
+	// The total number of messages to send, 0 means no limit
+	Count int64 `json:"count"`
+	// The seed of the random generators, 0 means a random seed
+	Seed   int64                     `json:"seed"`
+	Fields map[string]*GeneratorConf `json:"fields"`
+}
+
+// SimulatorSource generates the messages whose fields are produced by the generators. It is used to test the rules
+// without the real devices. The number of sent messages is saved as the source state, so that the sequence and
+// replay generators continue after restarting.
+type SimulatorSource struct {
+	cfg        *SimulatorConfig
+	names      []string
+	generators []generator
+	interval   int
+	rand       *rand.Rand
+
+	// the number of messages sent
+	index int64
+	mutex sync.RWMutex
+}
+
+func (s *SimulatorSource) Configure(_ string, props map[string]interface{}) error {
+	cfg := &SimulatorConfig{
+		Rate:  1,
+		Burst: 1,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if cfg.Rate <= 0 {
+		return fmt.Errorf("invalid rate %v, must be positive", cfg.Rate)
+	}
+	if cfg.Burst <= 0 {
+		return fmt.Errorf("invalid burst %d, must be positive", cfg.Burst)
+	}
+	if cfg.Count < 0 {
+		return fmt.Errorf("invalid count %d", cfg.Count)
+	}
+	if len(cfg.Fields) == 0 {
+		return fmt.Errorf("missing property fields")
+	}
+	s.interval = int(float64(cfg.Burst) * 1000 / cfg.Rate)
+	if s.interval <= 0 {
+		return fmt.Errorf("the rate %v is too high for the burst %d", cfg.Rate, cfg.Burst)
+	}
+	// generate the fields in a fixed order so that the results are repeatable by the seed
+	s.names = make([]string, 0, len(cfg.Fields))
+	for k := range cfg.Fields {
+		s.names = append(s.names, k)
+	}
+	sort.Strings(s.names)
+	s.generators = make([]generator, len(s.names))
+	for i, k := range s.names {
+		if cfg.Fields[k] == nil {
+			return fmt.Errorf("field %s: missing generator", k)
+		}
+		if s.generators[i], err = newGenerator(k, cfg.Fields[k]); err != nil {
+			return err
+		}
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s.rand = rand.New(rand.NewSource(seed))
+	s.cfg = cfg
+	conf.Log.Debugf("Initialized simulator source with %d fields every %d ms.", len(s.names), s.interval)
+	return nil
+}
+
+func (s *SimulatorSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, _ chan<- error) {
+	logger := ctx.GetLogger()
+	logger.Infof("simulator source sends %d messages every %d ms", s.cfg.Burst, s.interval)
+	ticker := conf.GetTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if !s.send(ctx, consumer) {
+				logger.Infof("simulator source stops sending after %d messages", s.getIndex())
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// send sends a burst of messages and returns false if there are no more messages to send
+func (s *SimulatorSource) send(ctx api.StreamContext, consumer chan<- api.SourceTuple) bool {
+	logger := ctx.GetLogger()
+	now := conf.GetNowInMilli()
+	for i := 0; i < s.cfg.Burst; i++ {
+		index := s.getIndex()
+		if s.cfg.Count > 0 && index >= s.cfg.Count {
+			return false
+		}
+		m, err := s.generate(index, now)
+		if err == errReplayEnd {
+			return false
+		}
+		if err != nil {
+			logger.Errorf("simulator source fails to generate: %v", err)
+			continue
+		}
+		select {
+		case consumer <- api.NewDefaultSourceTuple(m, map[string]interface{}{"index": index}):
+			logger.Debugf("send simulated data to source node")
+		case <-ctx.Done():
+			return false
+		}
+		s.mutex.Lock()
+		s.index = index + 1
+		s.mutex.Unlock()
+	}
+	return true
+}
+
+func (s *SimulatorSource) generate(index int64, now int64) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, len(s.names))
+	for i, g := range s.generators {
+		v, err := g.next(s.rand, index, now)
+		if err != nil {
+			return nil, err
+		}
+		m[s.names[i]] = v
+	}
+	return m, nil
+}
+
+func (s *SimulatorSource) getIndex() int64 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.index
+}
+
+// GetOffset returns the number of messages sent
+func (s *SimulatorSource) GetOffset() (interface{}, error) {
+	return s.getIndex(), nil
+}
+
+// Rewind restores the number of messages sent
+func (s *SimulatorSource) Rewind(offset interface{}) error {
+	i, err := cast.ToInt64(offset, cast.CONVERT_SAMEKIND)
+	if err != nil {
+		return fmt.Errorf("invalid simulator source offset %v", offset)
+	}
+	s.mutex.Lock()
+	s.index = i
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *SimulatorSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing simulator source")
+	return nil
+}
@@ -0,0 +1,216 @@
+package source
+
+import (
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/internal/topo/topotest/mockclock"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulatorGenerate(t *testing.T) {
+	replay := filepath.Join(t.TempDir(), "replay.jsonl")
+	if err := ioutil.WriteFile(replay, []byte("{\"v\":1.5}\n\n{\"v\":2.5}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	props := map[string]interface{}{
+		"seed": 1,
+		"fields": map[string]interface{}{
+			"id":    map[string]interface{}{"type": "sequence", "start": 10, "step": 2},
+			"name":  map[string]interface{}{"type": "constant", "value": "sensor"},
+			"level": map[string]interface{}{"type": "sine", "amplitude": 10, "offset": 50, "period": 4000, "decimals": 1},
+			"v":     map[string]interface{}{"type": "replay", "path": replay, "key": "v"},
+			"ts":    map[string]interface{}{"type": "timestamp", "skew": -1000},
+			"r":     map[string]interface{}{"type": "random", "min": 1, "max": 3, "decimals": 0},
+			"g":     map[string]interface{}{"type": "gaussian", "mean": 0, "stddev": 1},
+			"e":     map[string]interface{}{"type": "enum", "values": []interface{}{"a", "b"}, "weights": []interface{}{0, 1}},
+			"late":  map[string]interface{}{"type": "timestamp", "jitter": 10, "outOfOrder": 1, "lateness": 100},
+		},
+	}
+	var tests = []struct {
+		index  int64
+		now    int64
+		result map[string]interface{}
+	}{
+		{
+			index: 0,
+			now:   1000,
+			result: map[string]interface{}{
+				"id":    int64(10),
+				"name":  "sensor",
+				"level": 60.0,
+				"v":     1.5,
+				"ts":    int64(0),
+				"e":     "b",
+			},
+		}, {
+			index: 1,
+			now:   2000,
+			result: map[string]interface{}{
+				"id":    int64(12),
+				"name":  "sensor",
+				"level": 50.0,
+				"v":     2.5,
+				"ts":    int64(1000),
+				"e":     "b",
+			},
+		}, {
+			index: 2,
+			now:   3000,
+			result: map[string]interface{}{
+				"id":    int64(14),
+				"name":  "sensor",
+				"level": 40.0,
+				"v":     1.5,
+				"ts":    int64(2000),
+				"e":     "b",
+			},
+		},
+	}
+	s := &SimulatorSource{}
+	if err := s.Configure("test", props); err != nil {
+		t.Fatal(err)
+	}
+	another := &SimulatorSource{}
+	if err := another.Configure("test", props); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range tests {
+		m, err := s.generate(tt.index, tt.now)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		// the random values are the same with the same seed
+		m2, _ := another.generate(tt.index, tt.now)
+		if !reflect.DeepEqual(m, m2) {
+			t.Errorf("%d \tseed result mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, m, m2)
+		}
+		if r, ok := m["r"].(int64); !ok || r < 1 || r > 3 {
+			t.Errorf("%d: invalid random value %v", i, m["r"])
+		}
+		if _, ok := m["g"].(float64); !ok {
+			t.Errorf("%d: invalid gaussian value %v", i, m["g"])
+		}
+		if l, ok := m["late"].(int64); !ok || l < tt.now-110 || l >= tt.now+10 {
+			t.Errorf("%d: invalid late timestamp %v", i, m["late"])
+		}
+		delete(m, "r")
+		delete(m, "g")
+		delete(m, "late")
+		if !reflect.DeepEqual(tt.result, m) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.result, m)
+		}
+	}
+}
+
+func TestSimulatorSource(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSimulatorSource")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	mockclock.ResetClock(1000)
+	s := &SimulatorSource{}
+	err := s.Configure("test", map[string]interface{}{
+		"rate":  10,
+		"burst": 2,
+		"count": 7,
+		"fields": map[string]interface{}{
+			"id": map[string]interface{}{"type": "sequence", "start": 1},
+			"ts": map[string]interface{}{"type": "timestamp"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// continue from the saved state
+	if err := s.Rewind(int64(2)); err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	done := make(chan struct{})
+	go func() {
+		s.Open(ctx, consumer, make(chan error, 1))
+		close(done)
+	}()
+	var result []api.SourceTuple
+	for len(result) < 5 {
+		// the ticker may not be created yet, so move the clock until the data arrives
+		mockclock.GetMockClock().Add(200 * time.Millisecond)
+		for received := true; received; {
+			select {
+			case tuple := <-consumer:
+				result = append(result, tuple)
+			case <-time.After(20 * time.Millisecond):
+				received = false
+			}
+		}
+		if conf.GetNowInMilli() > 10000 {
+			t.Fatalf("timeout to receive data, got %v", result)
+		}
+	}
+	for i, tuple := range result {
+		msg, meta := tuple.Message(), tuple.Meta()
+		if msg["id"] != int64(i+3) || meta["index"] != int64(i+2) {
+			t.Errorf("%d: invalid message %v with meta %v", i, msg, meta)
+		}
+		if i > 0 && i%2 == 0 && msg["ts"].(int64)-result[i-1].Message()["ts"].(int64) != 200 {
+			t.Errorf("%d: invalid burst timestamp %v", i, msg["ts"])
+		}
+	}
+	mockclock.GetMockClock().Add(200 * time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("source does not stop after the count")
+	}
+	if offset, _ := s.GetOffset(); offset != int64(7) {
+		t.Errorf("offset mismatch, got %v", offset)
+	}
+	s.Close(ctx)
+}
+
+func TestSimulatorSourceConfigure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{
+			props: map[string]interface{}{},
+			err:   "missing property fields",
+		}, {
+			props: map[string]interface{}{"rate": 0, "fields": map[string]interface{}{"a": map[string]interface{}{"type": "sequence"}}},
+			err:   "invalid rate 0, must be positive",
+		}, {
+			props: map[string]interface{}{"burst": -1, "fields": map[string]interface{}{"a": map[string]interface{}{"type": "sequence"}}},
+			err:   "invalid burst -1, must be positive",
+		}, {
+			props: map[string]interface{}{"fields": map[string]interface{}{"a": map[string]interface{}{"type": "unknown"}}},
+			err:   "field a: invalid generator type unknown",
+		}, {
+			props: map[string]interface{}{"fields": map[string]interface{}{"a": map[string]interface{}{"type": "random", "min": 2, "max": 1}}},
+			err:   "field a: max 1 must not be smaller than min 2",
+		}, {
+			props: map[string]interface{}{"fields": map[string]interface{}{"a": map[string]interface{}{"type": "sine"}}},
+			err:   "field a: period must be a positive integer",
+		}, {
+			props: map[string]interface{}{"fields": map[string]interface{}{"a": map[string]interface{}{"type": "enum", "values": []interface{}{1, 2}, "weights": []interface{}{1}}}},
+			err:   "field a: the length of weights must be the same as values",
+		}, {
+			props: map[string]interface{}{"fields": map[string]interface{}{"a": map[string]interface{}{"type": "timestamp", "outOfOrder": 0.5}}},
+			err:   "field a: lateness is required for outOfOrder",
+		}, {
+			props: map[string]interface{}{"fields": map[string]interface{}{"a": map[string]interface{}{"type": "replay"}}},
+			err:   "field a: path is required",
+		},
+	}
+	for i, tt := range tests {
+		err := (&SimulatorSource{}).Configure("test", tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
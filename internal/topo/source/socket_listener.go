@@ -0,0 +1,282 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+const (
+	FramingNewline        = "newline"
+	FramingLengthPrefixed = "lengthPrefixed"
+	FramingOctetCounting  = "octetCounting"
+)
+
+// socketListenerConf is the listener level configuration. It must be comparable to detect conflicts of the same address
+type socketListenerConf struct {
+	protocol string
+	addr     string
+	framing  string
+	maxSize  int
+}
+
+// frameHandler handles a received frame. For tcp, a frame is split from the stream by the framing. For udp, a datagram
+// is a frame.
+type frameHandler func(frame []byte, remoteAddr string)
+
+// socketListener listens on an udp or tcp address. Several source instances of the same address (e.g. several rules
+// of the same stream) are all attached to one listener and receive every frame.
+type socketListener struct {
+	conf      *socketListenerConf
+	udpConn   net.PacketConn
+	tcpLis    net.Listener
+	conns     map[net.Conn]bool
+	receivers map[interface{}]frameHandler
+	refCount  int
+	sync.RWMutex
+}
+
+var (
+	listeners     = make(map[string]*socketListener)
+	listenerMutex sync.Mutex
+)
+
+func attachSocketListener(c *socketListenerConf, receiver interface{}, h frameHandler) (*socketListener, error) {
+	listenerMutex.Lock()
+	defer listenerMutex.Unlock()
+	key := c.protocol + "://" + c.addr
+	l, ok := listeners[key]
+	if ok {
+		if *l.conf != *c {
+			return nil, fmt.Errorf("%s is already listened with different settings", key)
+		}
+	} else {
+		l = &socketListener{
+			conf:      c,
+			conns:     make(map[net.Conn]bool),
+			receivers: make(map[interface{}]frameHandler),
+		}
+		if err := l.listen(); err != nil {
+			return nil, err
+		}
+		listeners[key] = l
+	}
+	l.Lock()
+	l.receivers[receiver] = h
+	l.Unlock()
+	l.refCount++
+	return l, nil
+}
+
+func (l *socketListener) detach(receiver interface{}) {
+	listenerMutex.Lock()
+	defer listenerMutex.Unlock()
+	l.Lock()
+	delete(l.receivers, receiver)
+	l.Unlock()
+	l.refCount--
+	if l.refCount > 0 {
+		return
+	}
+	delete(listeners, l.conf.protocol+"://"+l.conf.addr)
+	l.close()
+}
+
+// Addr returns the actual listening address which is useful when listening on port 0
+func (l *socketListener) Addr() net.Addr {
+	if l.udpConn != nil {
+		return l.udpConn.LocalAddr()
+	}
+	return l.tcpLis.Addr()
+}
+
+func (l *socketListener) listen() error {
+	switch l.conf.protocol {
+	case "udp":
+		conn, err := net.ListenPacket("udp", l.conf.addr)
+		if err != nil {
+			return fmt.Errorf("fail to listen udp %s: %v", l.conf.addr, err)
+		}
+		l.udpConn = conn
+		go l.serveUdp()
+	case "tcp":
+		lis, err := net.Listen("tcp", l.conf.addr)
+		if err != nil {
+			return fmt.Errorf("fail to listen tcp %s: %v", l.conf.addr, err)
+		}
+		l.tcpLis = lis
+		go l.serveTcp()
+	default:
+		return fmt.Errorf("invalid protocol %s, must be udp or tcp", l.conf.protocol)
+	}
+	conf.Log.Infof("socket listener starts on %s://%s", l.conf.protocol, l.conf.addr)
+	return nil
+}
+
+func (l *socketListener) close() {
+	if l.udpConn != nil {
+		_ = l.udpConn.Close()
+	}
+	if l.tcpLis != nil {
+		_ = l.tcpLis.Close()
+	}
+	l.Lock()
+	for c := range l.conns {
+		_ = c.Close()
+	}
+	l.Unlock()
+	conf.Log.Infof("socket listener on %s://%s is closed", l.conf.protocol, l.conf.addr)
+}
+
+func (l *socketListener) dispatch(frame []byte, remoteAddr string) {
+	if len(frame) == 0 {
+		return
+	}
+	l.RLock()
+	handlers := make([]frameHandler, 0, len(l.receivers))
+	for _, h := range l.receivers {
+		handlers = append(handlers, h)
+	}
+	l.RUnlock()
+	for _, h := range handlers {
+		h(frame, remoteAddr)
+	}
+}
+
+func (l *socketListener) serveUdp() {
+	buf := make([]byte, l.conf.maxSize)
+	for {
+		n, addr, err := l.udpConn.ReadFrom(buf)
+		if err != nil {
+			conf.Log.Debugf("udp listener %s stops reading: %v", l.conf.addr, err)
+			return
+		}
+		frame := make([]byte, n)
+		copy(frame, buf[:n])
+		l.dispatch(bytes.TrimRight(frame, "\r\n"), addr.String())
+	}
+}
+
+func (l *socketListener) serveTcp() {
+	for {
+		conn, err := l.tcpLis.Accept()
+		if err != nil {
+			conf.Log.Debugf("tcp listener %s stops accepting: %v", l.conf.addr, err)
+			return
+		}
+		l.Lock()
+		l.conns[conn] = true
+		l.Unlock()
+		go l.handleConn(conn)
+	}
+}
+
+func (l *socketListener) handleConn(conn net.Conn) {
+	defer func() {
+		l.Lock()
+		delete(l.conns, conn)
+		l.Unlock()
+		_ = conn.Close()
+	}()
+	remoteAddr := conn.RemoteAddr().String()
+	if err := readFrames(conn, l.conf.framing, l.conf.maxSize, func(frame []byte) {
+		l.dispatch(frame, remoteAddr)
+	}); err != nil && !errors.Is(err, net.ErrClosed) {
+		conf.Log.Warnf("tcp connection from %s is closed: %v", remoteAddr, err)
+	}
+}
+
+// readFrames splits the stream into frames by the framing until the end of the stream
+func readFrames(r io.Reader, framing string, maxSize int, f func(frame []byte)) error {
+	br := bufio.NewReader(r)
+	switch framing {
+	case FramingNewline:
+		scanner := bufio.NewScanner(br)
+		// the scanner allows the line as long as the initial buffer even if it exceeds the max size
+		initial := 4096
+		if maxSize < initial {
+			initial = maxSize
+		}
+		scanner.Buffer(make([]byte, initial), maxSize)
+		for scanner.Scan() {
+			frame := make([]byte, len(scanner.Bytes()))
+			copy(frame, scanner.Bytes())
+			f(bytes.TrimRight(frame, "\r"))
+		}
+		return scanner.Err()
+	case FramingLengthPrefixed:
+		header := make([]byte, 4)
+		for {
+			if _, err := io.ReadFull(br, header); err != nil {
+				return eofAsNil(err)
+			}
+			n := int(binary.BigEndian.Uint32(header))
+			if n > maxSize {
+				return fmt.Errorf("frame size %d exceeds the maxMessageSize %d", n, maxSize)
+			}
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(br, frame); err != nil {
+				return err
+			}
+			f(frame)
+		}
+	case FramingOctetCounting:
+		for {
+			n, err := readOctetLength(br)
+			if err != nil {
+				return eofAsNil(err)
+			}
+			if n > maxSize {
+				return fmt.Errorf("frame size %d exceeds the maxMessageSize %d", n, maxSize)
+			}
+			frame := make([]byte, n)
+			if _, err := io.ReadFull(br, frame); err != nil {
+				return err
+			}
+			f(bytes.TrimRight(frame, "\r\n"))
+		}
+	default:
+		return fmt.Errorf("invalid framing %s", framing)
+	}
+}
+
+// the max digits of the frame length in the octet counting framing
+const maxOctetDigits = 10
+
+// readOctetLength reads the frame length followed by a space in the octet counting framing. The line end after the
+// previous frame is skipped. It fails if the length has more than maxOctetDigits digits.
+func readOctetLength(br *bufio.Reader) (int, error) {
+	var digits []byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(digits) > 0 {
+				return 0, io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		switch {
+		case c == ' ' && len(digits) > 0:
+			return strconv.Atoi(string(digits))
+		case c >= '0' && c <= '9' && len(digits) < maxOctetDigits:
+			digits = append(digits, c)
+		case (c == '\r' || c == '\n') && len(digits) == 0:
+		default:
+			return 0, fmt.Errorf("invalid octet counting frame length %q", append(digits, c))
+		}
+	}
+}
+
+func eofAsNil(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
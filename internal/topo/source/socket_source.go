@@ -0,0 +1,139 @@
+package source
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"strings"
+)
+
+type SocketConfig struct {
+	Protocol       string `json:"protocol"`
+	Server         string `json:"server"`
+	Framing        string `json:"framing"`
+	MaxMessageSize int    `json:"maxMessageSize"`
+	TextField      string `json:"textField"`
+	Format         string `json:"format"`
+}
+
+// SocketSource receives the messages from the udp datagrams or the tcp connections. The tcp stream is split into
+// messages by the framing.
+type SocketSource struct {
+	lc        *socketListenerConf
+	textField string
+	format    string
+	decoder   *payloadDecoder
+
+	listener *socketListener
+}
+
+func (ss *SocketSource) Configure(_ string, props map[string]interface{}) error {
+	cfg := &SocketConfig{
+		Protocol:       "tcp",
+		Server:         ":10082",
+		Framing:        FramingNewline,
+		MaxMessageSize: 65536,
+		Format:         message.FormatJson,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if ss.decoder, err = newPayloadDecoder(cfg.Format, props); err != nil {
+		return err
+	}
+	lc, err := newSocketListenerConf(cfg.Protocol, cfg.Server, cfg.Framing, cfg.MaxMessageSize, FramingNewline, FramingLengthPrefixed)
+	if err != nil {
+		return err
+	}
+	ss.lc = lc
+	ss.textField = cfg.TextField
+	ss.format = cfg.Format
+	conf.Log.Debugf("Initialized socket source with %s server %s.", lc.protocol, lc.addr)
+	return nil
+}
+
+// newSocketListenerConf validates the listener properties. The framing is only used by tcp.
+func newSocketListenerConf(protocol, server, framing string, maxSize int, framings ...string) (*socketListenerConf, error) {
+	protocol = strings.ToLower(protocol)
+	if protocol != "udp" && protocol != "tcp" {
+		return nil, fmt.Errorf("invalid protocol %s, must be udp or tcp", protocol)
+	}
+	if server == "" {
+		return nil, fmt.Errorf("missing property server")
+	}
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid maxMessageSize %d", maxSize)
+	}
+	if protocol == "udp" {
+		framing = ""
+	} else {
+		valid := false
+		for _, f := range framings {
+			if f == framing {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid framing %s, must be one of %s", framing, strings.Join(framings, ", "))
+		}
+	}
+	return &socketListenerConf{
+		protocol: protocol,
+		addr:     server,
+		framing:  framing,
+		maxSize:  maxSize,
+	}, nil
+}
+
+func (ss *SocketSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	l, err := attachSocketListener(ss.lc, ss, func(frame []byte, remoteAddr string) {
+		ss.send(ctx, consumer, frame, remoteAddr)
+	})
+	if err != nil {
+		errCh <- err
+		return
+	}
+	ss.listener = l
+	logger.Infof("socket source listens on %s://%s", ss.lc.protocol, ss.lc.addr)
+}
+
+func (ss *SocketSource) send(ctx api.StreamContext, consumer chan<- api.SourceTuple, frame []byte, remoteAddr string) {
+	logger := ctx.GetLogger()
+	var results []map[string]interface{}
+	if ss.textField != "" {
+		results = []map[string]interface{}{{ss.textField: string(frame)}}
+	} else {
+		var err error
+		results, err = ss.decoder.decode(frame)
+		if err != nil {
+			logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(frame), ss.format, err)
+			return
+		}
+	}
+	meta := map[string]interface{}{
+		"protocol":   ss.lc.protocol,
+		"remoteAddr": remoteAddr,
+	}
+	for _, result := range results {
+		select {
+		case consumer <- api.NewDefaultSourceTuple(result, meta):
+			logger.Debugf("send data to source node")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ss *SocketSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing socket source")
+	if ss.listener != nil {
+		ss.listener.detach(ss)
+		ss.listener = nil
+	}
+	return nil
+}
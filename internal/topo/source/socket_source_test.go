@@ -0,0 +1,176 @@
+package source
+
+import (
+	"encoding/binary"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSocketSource(t *testing.T) {
+	lengthPrefixed := func(s string) []byte {
+		b := make([]byte, 4, 4+len(s))
+		binary.BigEndian.PutUint32(b, uint32(len(s)))
+		return append(b, s...)
+	}
+	var tests = []struct {
+		props   map[string]interface{}
+		payload [][]byte
+		result  []map[string]interface{}
+	}{
+		{
+			props:   map[string]interface{}{},
+			payload: [][]byte{[]byte("{\"temperature\":20}\r\n{\"temperature\":21}\n[{\"temperature\":22},{\"temperature\":23}]\n")},
+			result:  []map[string]interface{}{{"temperature": float64(20)}, {"temperature": float64(21)}, {"temperature": float64(22)}, {"temperature": float64(23)}},
+		},
+		{
+			props:   map[string]interface{}{"framing": "lengthPrefixed", "textField": "line"},
+			payload: [][]byte{append(lengthPrefixed("hello\nworld"), lengthPrefixed("second")...)},
+			result:  []map[string]interface{}{{"line": "hello\nworld"}, {"line": "second"}},
+		},
+		{
+			props:   map[string]interface{}{"protocol": "udp", "textField": "line"},
+			payload: [][]byte{[]byte("first\n"), []byte("second")},
+			result:  []map[string]interface{}{{"line": "first"}, {"line": "second"}},
+		},
+	}
+	for i, tt := range tests {
+		tt.props["server"] = "127.0.0.1:0"
+		contextLogger := conf.Log.WithField("rule", "TestSocketSource")
+		ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+		// two sources of the same server share the listener
+		sources := []*SocketSource{{}, {}}
+		consumers := []chan api.SourceTuple{make(chan api.SourceTuple, 10), make(chan api.SourceTuple, 10)}
+		for j, s := range sources {
+			if err := s.Configure("", tt.props); err != nil {
+				t.Fatal(err)
+			}
+			s.Open(ctx, consumers[j], make(chan error, 1))
+		}
+		if sources[0].listener != sources[1].listener {
+			t.Errorf("%d \tlisteners are not shared", i)
+		}
+		conn, err := net.Dial(sources[0].lc.protocol, sources[0].listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range tt.payload {
+			if _, err := conn.Write(p); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for j, consumer := range consumers {
+			var results []map[string]interface{}
+		loop:
+			for range tt.result {
+				select {
+				case tuple := <-consumer:
+					results = append(results, tuple.Message())
+					if tuple.Meta()["remoteAddr"] != conn.LocalAddr().String() {
+						t.Errorf("%d.%d \tmeta mismatch %v", i, j, tuple.Meta())
+					}
+				case <-time.After(2 * time.Second):
+					break loop
+				}
+			}
+			if !reflect.DeepEqual(tt.result, results) {
+				t.Errorf("%d.%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, j, tt.result, results)
+			}
+		}
+		conn.Close()
+		cancel()
+		for _, s := range sources {
+			s.Close(ctx)
+		}
+	}
+}
+
+func TestSyslogSource(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSyslogSource")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	s := &SyslogSource{}
+	if err := s.Configure("", map[string]interface{}{"protocol": "tcp", "server": "127.0.0.1:0", "framing": "octetCounting"}); err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	s.Open(ctx, consumer, make(chan error, 1))
+	defer s.Close(ctx)
+	conn, err := net.Dial("tcp", s.listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("28 <13>1 - host app - - - hello14 not a syslog!!")); err != nil {
+		t.Fatal(err)
+	}
+	exp := []map[string]interface{}{
+		{"priority": 13, "facility": 1, "severity": 5, "version": 1, "hostname": "host", "appName": "app", "message": "hello"},
+		{"message": "not a syslog!!"},
+	}
+	expMeta := []string{RFC5424, ""}
+	for i, e := range exp {
+		select {
+		case tuple := <-consumer:
+			if !reflect.DeepEqual(e, tuple.Message()) {
+				t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, e, tuple.Message())
+			}
+			if rfc, _ := tuple.Meta()["rfc"].(string); rfc != expMeta[i] {
+				t.Errorf("%d \trfc mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, expMeta[i], rfc)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout to receive data")
+		}
+	}
+}
+
+func TestSocketSource_Configure(t *testing.T) {
+	var tests = []struct {
+		props map[string]interface{}
+		err   string
+	}{
+		{props: map[string]interface{}{"protocol": "http"}, err: "invalid protocol http, must be udp or tcp"},
+		{props: map[string]interface{}{"framing": "octetCounting"}, err: "invalid framing octetCounting, must be one of newline, lengthPrefixed"},
+		{props: map[string]interface{}{"maxMessageSize": 0}, err: "invalid maxMessageSize 0"},
+		{props: map[string]interface{}{"protocol": "udp", "framing": "octetCounting"}},
+	}
+	for i, tt := range tests {
+		err := (&SocketSource{}).Configure("", tt.props)
+		if (tt.err == "" && err != nil) || (tt.err != "" && (err == nil || err.Error() != tt.err)) {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
+
+func TestReadFrames(t *testing.T) {
+	var tests = []struct {
+		framing string
+		input   string
+		maxSize int
+		frames  []string
+		err     bool
+	}{
+		{framing: FramingOctetCounting, input: "3 abc4 defg", maxSize: 10, frames: []string{"abc", "defg"}},
+		{framing: FramingOctetCounting, input: "3 abc\n4 defg\n", maxSize: 10, frames: []string{"abc", "defg"}},
+		{framing: FramingOctetCounting, input: "3 abc12345678901 a", maxSize: 10, frames: []string{"abc"}, err: true},
+		{framing: FramingOctetCounting, input: "3 abc4", maxSize: 10, frames: []string{"abc"}, err: true},
+		{framing: FramingNewline, input: "abc\n0123456789\n", maxSize: 8, frames: []string{"abc"}, err: true},
+	}
+	for i, tt := range tests {
+		var frames []string
+		err := readFrames(strings.NewReader(tt.input), tt.framing, tt.maxSize, func(frame []byte) {
+			frames = append(frames, string(frame))
+		})
+		if tt.err != (err != nil) {
+			t.Errorf("%d: expect error %v but got %v", i, tt.err, err)
+		}
+		if !reflect.DeepEqual(tt.frames, frames) {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, tt.frames, frames)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package source
+
+import (
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/sqlx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	// the datetime column value may be saved in the state
+	gob.Register(time.Time{})
+}
+
+type SQLSourceConfig struct {
+	sqlx.ClientConf
+	Interval int `json:"interval"`
+	// The columns to select, all the columns are selected if not specified
+	Fields []string `json:"fields"`
+	// The incremental column. If set, only the rows whose value is bigger than the last value are selected
+	IndexField string `json:"indexField"`
+	// The initial value of the incremental column
+	IndexValue interface{} `json:"indexValue"`
+	// The max number of rows to select each time for the incremental column
+	Limit int `json:"limit"`
+}
+
+// SQLSource polls the table which is the datasource by interval. Without the indexField, the whole table is selected
+// each time which is suitable for the reference tables. With the indexField, only the new rows ordered by the column
+// are selected, and the last value of the column is saved as the source state.
+type SQLSource struct {
+	cfg     *SQLSourceConfig
+	table   string
+	dialect sqlx.Dialect
+	// the select statement is split by the where clause of the indexField
+	queryHead string
+	queryTail string
+
+	db *sql.DB
+	// the last value of the indexField
+	index interface{}
+	mutex sync.RWMutex
+}
+
+func (s *SQLSource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &SQLSourceConfig{
+		ClientConf: sqlx.ClientConf{Driver: "sqlite3"},
+		Interval:   DEFAULT_INTERVAL,
+		Limit:      100,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if datasource == "" {
+		return fmt.Errorf("missing datasource, it must be the table name")
+	}
+	if cfg.Interval <= 0 {
+		return fmt.Errorf("invalid interval %d", cfg.Interval)
+	}
+	if cfg.Limit < 0 {
+		return fmt.Errorf("invalid limit %d", cfg.Limit)
+	}
+	s.cfg = cfg
+	s.table = datasource
+	s.dialect = sqlx.GetDialect(cfg.Driver)
+	s.buildQuery()
+	if cfg.IndexField != "" {
+		s.index = cfg.IndexValue
+	}
+	conf.Log.Debugf("Initialized sql source with table %s.", s.table)
+	return nil
+}
+
+func (s *SQLSource) buildQuery() {
+	cols := "*"
+	if len(s.cfg.Fields) > 0 {
+		qc := make([]string, len(s.cfg.Fields))
+		for i, f := range s.cfg.Fields {
+			qc[i] = s.dialect.Quote(f)
+		}
+		cols = strings.Join(qc, ",")
+	}
+	s.queryHead = fmt.Sprintf("SELECT %s FROM %s", cols, sqlx.QuoteTable(s.dialect, s.table))
+	if s.cfg.IndexField == "" {
+		return
+	}
+	s.queryTail = " ORDER BY " + s.dialect.Quote(s.cfg.IndexField) + " ASC"
+	if s.cfg.Limit > 0 {
+		s.queryTail += fmt.Sprintf(" LIMIT %d", s.cfg.Limit)
+	}
+}
+
+func (s *SQLSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	db, err := sqlx.Open(&s.cfg.ClientConf)
+	if err != nil {
+		errCh <- err
+		return
+	}
+	s.db = db
+	logger.Infof("sql source polls table %s every %d ms", s.table, s.cfg.Interval)
+	ticker := time.NewTicker(time.Duration(s.cfg.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.poll(ctx, consumer)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// poll selects the rows and sends them out. For the incremental column, it keeps selecting until all the new rows
+// are read.
+func (s *SQLSource) poll(ctx api.StreamContext, consumer chan<- api.SourceTuple) {
+	logger := ctx.GetLogger()
+	for {
+		q, args := s.statement()
+		rows, err := s.db.QueryContext(ctx, q, args...)
+		if err != nil {
+			logger.Errorf("sql source fails to query %s: %v", q, err)
+			return
+		}
+		results, err := sqlx.ScanRows(rows)
+		_ = rows.Close()
+		if err != nil {
+			logger.Errorf("sql source fails to read the rows of %s: %v", q, err)
+			return
+		}
+		meta := map[string]interface{}{"table": s.table}
+		for _, r := range results {
+			select {
+			case consumer <- api.NewDefaultSourceTuple(r, meta):
+				logger.Debugf("send sql data to source node")
+			case <-ctx.Done():
+				return
+			}
+			if s.cfg.IndexField != "" {
+				if v := r[s.cfg.IndexField]; v != nil {
+					s.mutex.Lock()
+					s.index = v
+					s.mutex.Unlock()
+				}
+			}
+		}
+		if s.cfg.IndexField == "" || s.cfg.Limit == 0 || len(results) < s.cfg.Limit {
+			return
+		}
+	}
+}
+
+func (s *SQLSource) statement() (string, []interface{}) {
+	s.mutex.RLock()
+	index := s.index
+	s.mutex.RUnlock()
+	// the where clause is added when there is a last value
+	if s.cfg.IndexField == "" || index == nil {
+		return s.queryHead + s.queryTail, nil
+	}
+	return s.queryHead + " WHERE " + s.dialect.Quote(s.cfg.IndexField) + " > " + s.dialect.Placeholder(1) + s.queryTail, []interface{}{index}
+}
+
+// GetOffset returns the last value of the indexField
+func (s *SQLSource) GetOffset() (interface{}, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	offset := make(map[string]interface{})
+	if s.index != nil {
+		offset["indexValue"] = s.index
+	}
+	return offset, nil
+}
+
+// Rewind restores the last value of the indexField
+func (s *SQLSource) Rewind(offset interface{}) error {
+	m, ok := offset.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid sql source offset %v", offset)
+	}
+	if v, ok := m["indexValue"]; ok {
+		s.mutex.Lock()
+		s.index = v
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+func (s *SQLSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing sql source")
+	if s.db != nil {
+		return s.db.Close()
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package source
+
+import (
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/sqlx"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSQLSource(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestSQLSource")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+	dsn := filepath.Join(t.TempDir(), "test.db")
+	db, err := sqlx.Open(&sqlx.ClientConf{Driver: "sqlite3", Dsn: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	stmts := []string{
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO events VALUES (1, 'a'), (2, 'b'), (3, 'c'), (4, 'd')",
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := &SQLSource{}
+	err = s.Configure("events", map[string]interface{}{
+		"dsn":        dsn,
+		"interval":   100000,
+		"indexField": "id",
+		"limit":      2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// continue from the saved state
+	if err := s.Rewind(map[string]interface{}{"indexValue": int64(1)}); err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	go s.Open(ctx, consumer, make(chan error, 1))
+	meta := map[string]interface{}{"table": "events"}
+	exp := []api.SourceTuple{
+		api.NewDefaultSourceTuple(map[string]interface{}{"id": int64(2), "name": "b"}, meta),
+		api.NewDefaultSourceTuple(map[string]interface{}{"id": int64(3), "name": "c"}, meta),
+		api.NewDefaultSourceTuple(map[string]interface{}{"id": int64(4), "name": "d"}, meta),
+	}
+	for i, e := range exp {
+		select {
+		case tuple := <-consumer:
+			if !reflect.DeepEqual(e, tuple) {
+				t.Errorf("%d \tresult mismatch:\n\nexp=%v\n\ngot=%v\n\n", i, e, tuple)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout to receive data")
+		}
+	}
+	// wait for the last poll of the limit
+	time.Sleep(50 * time.Millisecond)
+	offset, _ := s.GetOffset()
+	if !reflect.DeepEqual(map[string]interface{}{"indexValue": int64(4)}, offset) {
+		t.Errorf("offset mismatch, got %v", offset)
+	}
+	cancel()
+	s.Close(ctx)
+}
+
+func TestSQLSourceConfigure(t *testing.T) {
+	var tests = []struct {
+		datasource string
+		props      map[string]interface{}
+		err        string
+	}{
+		{
+			datasource: "events",
+			props:      map[string]interface{}{},
+			err:        "missing property dsn",
+		}, {
+			datasource: "",
+			props:      map[string]interface{}{"dsn": "test.db"},
+			err:        "missing datasource, it must be the table name",
+		}, {
+			datasource: "events",
+			props:      map[string]interface{}{"dsn": "test.db", "interval": 0},
+			err:        "invalid interval 0",
+		}, {
+			datasource: "events",
+			props:      map[string]interface{}{"dsn": "test.db", "limit": -1},
+			err:        "invalid limit -1",
+		},
+	}
+	for i, tt := range tests {
+		err := (&SQLSource{}).Configure(tt.datasource, tt.props)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+		}
+	}
+}
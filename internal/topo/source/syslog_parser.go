@@ -0,0 +1,179 @@
+package source
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RFC3164 = "3164"
+	RFC5424 = "5424"
+
+	syslogNil = "-"
+)
+
+// parseSyslog parses a RFC 5424 or RFC 3164 syslog message. The header parts which are not present are not set in the
+// result. The timestamp is converted to unix epoch milliseconds. For RFC 3164 messages without the year, the year is
+// inferred from now.
+func parseSyslog(msg []byte, now time.Time) (map[string]interface{}, string, error) {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	if len(msg) < 3 || msg[0] != '<' {
+		return nil, "", fmt.Errorf("missing priority")
+	}
+	end := bytes.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return nil, "", fmt.Errorf("invalid priority")
+	}
+	pri, err := strconv.Atoi(string(msg[1:end]))
+	if err != nil || pri > 191 {
+		return nil, "", fmt.Errorf("invalid priority %s", msg[1:end])
+	}
+	result := map[string]interface{}{
+		"priority": pri,
+		"facility": pri / 8,
+		"severity": pri % 8,
+	}
+	rest := string(msg[end+1:])
+	// the version of RFC 5424 is a non-zero digit followed by a space
+	if len(rest) > 1 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		if err := parse5424(rest, result); err != nil {
+			return nil, "", err
+		}
+		return result, RFC5424, nil
+	}
+	parse3164(rest, now, result)
+	return result, RFC3164, nil
+}
+
+func parse5424(s string, result map[string]interface{}) error {
+	// VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+	parts := strings.SplitN(s, " ", 7)
+	if len(parts) < 7 {
+		return fmt.Errorf("invalid RFC 5424 header")
+	}
+	v, _ := strconv.Atoi(parts[0])
+	result["version"] = v
+	if parts[1] != syslogNil {
+		t, err := time.Parse(time.RFC3339Nano, parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %s", parts[1])
+		}
+		result["timestamp"] = t.UnixNano() / int64(time.Millisecond)
+	}
+	for i, k := range []string{"hostname", "appName", "procId", "msgId"} {
+		if p := parts[i+2]; p != syslogNil {
+			result[k] = p
+		}
+	}
+	sd, msg, err := parseStructuredData(parts[6])
+	if err != nil {
+		return err
+	}
+	if sd != nil {
+		result["structuredData"] = sd
+	}
+	result["message"] = strings.TrimPrefix(msg, "\xEF\xBB\xBF")
+	return nil
+}
+
+// parseStructuredData parses the structured data elements like [id k="v"][id2 k="v"] and returns the remaining message
+func parseStructuredData(s string) (map[string]interface{}, string, error) {
+	if strings.HasPrefix(s, syslogNil) {
+		return nil, strings.TrimPrefix(strings.TrimPrefix(s, syslogNil), " "), nil
+	}
+	result := make(map[string]interface{})
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		i++
+		start := i
+		for i < len(s) && s[i] != ' ' && s[i] != ']' {
+			i++
+		}
+		if i >= len(s) {
+			return nil, "", fmt.Errorf("invalid structured data %s", s)
+		}
+		id := s[start:i]
+		params := make(map[string]interface{})
+		for i < len(s) && s[i] == ' ' {
+			i++
+			start = i
+			for i < len(s) && s[i] != '=' {
+				i++
+			}
+			if i+1 >= len(s) || s[i+1] != '"' {
+				return nil, "", fmt.Errorf("invalid structured data %s", s)
+			}
+			name := s[start:i]
+			i += 2
+			var value strings.Builder
+			for i < len(s) && s[i] != '"' {
+				// only ", \ and ] are escaped
+				if s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					i++
+				}
+				value.WriteByte(s[i])
+				i++
+			}
+			if i >= len(s) {
+				return nil, "", fmt.Errorf("invalid structured data %s", s)
+			}
+			i++
+			params[name] = value.String()
+		}
+		if i >= len(s) || s[i] != ']' {
+			return nil, "", fmt.Errorf("invalid structured data %s", s)
+		}
+		i++
+		result[id] = params
+	}
+	if len(result) == 0 {
+		return nil, "", fmt.Errorf("invalid structured data %s", s)
+	}
+	return result, strings.TrimPrefix(s[i:], " "), nil
+}
+
+// parse3164 parses the BSD syslog header TIMESTAMP HOSTNAME TAG[PID]: MSG. The format is loose in practice, so the
+// parts which cannot be recognized are left in the message.
+func parse3164(s string, now time.Time, result map[string]interface{}) {
+	rest := s
+	if len(s) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], now.Location()); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			// the message of the last year received in the new year
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			result["timestamp"] = t.UnixNano() / int64(time.Millisecond)
+			rest = strings.TrimPrefix(s[len(time.Stamp):], " ")
+		}
+	}
+	if _, ok := result["timestamp"]; !ok {
+		if i := strings.IndexByte(s, ' '); i > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, s[:i]); err == nil {
+				result["timestamp"] = t.UnixNano() / int64(time.Millisecond)
+				rest = s[i+1:]
+			}
+		}
+	}
+	if _, ok := result["timestamp"]; ok {
+		// the hostname is only present after the timestamp
+		if i := strings.IndexByte(rest, ' '); i > 0 && !strings.HasSuffix(rest[:i], ":") {
+			result["hostname"] = rest[:i]
+			rest = rest[i+1:]
+		}
+	}
+	// the tag is alphanumeric with an optional [pid] and ends with a colon
+	if i := strings.IndexByte(rest, ':'); i > 0 && !strings.ContainsAny(rest[:i], " \t") {
+		tag := rest[:i]
+		if j := strings.IndexByte(tag, '['); j > 0 && strings.HasSuffix(tag, "]") {
+			result["procId"] = tag[j+1 : len(tag)-1]
+			tag = tag[:j]
+		}
+		result["appName"] = tag
+		rest = strings.TrimPrefix(rest[i+1:], " ")
+	}
+	result["message"] = rest
+}
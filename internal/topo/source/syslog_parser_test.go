@@ -0,0 +1,110 @@
+package source
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	var tests = []struct {
+		msg    string
+		result map[string]interface{}
+		rfc    string
+		err    string
+	}{
+		{
+			msg: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"][examplePriority@32473 class="high"] An application event log entry...`,
+			result: map[string]interface{}{
+				"priority": 165, "facility": 20, "severity": 5, "version": 1,
+				"timestamp": int64(1065910455003),
+				"hostname":  "mymachine.example.com",
+				"appName":   "evntslog",
+				"msgId":     "ID47",
+				"structuredData": map[string]interface{}{
+					"exampleSDID@32473":     map[string]interface{}{"iut": "3", "eventSource": "Application", "eventID": "1011"},
+					"examplePriority@32473": map[string]interface{}{"class": "high"},
+				},
+				"message": "An application event log entry...",
+			},
+			rfc: RFC5424,
+		},
+		{
+			msg: "<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 - \xEF\xBB\xBF'su root' failed for lonvick on /dev/pts/8",
+			result: map[string]interface{}{
+				"priority": 34, "facility": 4, "severity": 2, "version": 1,
+				"timestamp": int64(1065910455003),
+				"hostname":  "mymachine.example.com",
+				"appName":   "su",
+				"msgId":     "ID47",
+				"message":   "'su root' failed for lonvick on /dev/pts/8",
+			},
+			rfc: RFC5424,
+		},
+		{
+			msg: `<13>1 - - - - - [a k="x\"y\]"]`,
+			result: map[string]interface{}{
+				"priority": 13, "facility": 1, "severity": 5, "version": 1,
+				"structuredData": map[string]interface{}{"a": map[string]interface{}{"k": `x"y]`}},
+				"message":        "",
+			},
+			rfc: RFC5424,
+		},
+		{
+			msg: "<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick on /dev/pts/8\n",
+			result: map[string]interface{}{
+				"priority": 34, "facility": 4, "severity": 2,
+				"timestamp": time.Date(2020, 10, 11, 22, 14, 15, 0, time.UTC).UnixNano() / int64(time.Millisecond),
+				"hostname":  "mymachine",
+				"appName":   "su",
+				"procId":    "123",
+				"message":   "'su root' failed for lonvick on /dev/pts/8",
+			},
+			rfc: RFC3164,
+		},
+		{
+			msg: "<13>Jan  1 09:00:00 host app: hello",
+			result: map[string]interface{}{
+				"priority": 13, "facility": 1, "severity": 5,
+				"timestamp": time.Date(2021, 1, 1, 9, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond),
+				"hostname":  "host",
+				"appName":   "app",
+				"message":   "hello",
+			},
+			rfc: RFC3164,
+		},
+		{
+			msg: "<13>just a message",
+			result: map[string]interface{}{
+				"priority": 13, "facility": 1, "severity": 5,
+				"message": "just a message",
+			},
+			rfc: RFC3164,
+		},
+		{
+			msg: "no priority",
+			err: "missing priority",
+		},
+		{
+			msg: "<13>1 2003-10-11T22:14:15.003Z host app - - [a k=v] msg",
+			err: `invalid structured data [a k=v] msg`,
+		},
+	}
+	for i, tt := range tests {
+		result, rfc, err := parseSyslog([]byte(tt.msg), now)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%d \terror mismatch:\n\nexp=%s\n\ngot=%v\n\n", i, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d \tunexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.result, result) || tt.rfc != rfc {
+			t.Errorf("%d \tresult mismatch:\n\nexp=%s %v\n\ngot=%s %v\n\n", i, tt.rfc, tt.result, rfc, result)
+		}
+	}
+}
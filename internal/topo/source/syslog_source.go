@@ -0,0 +1,87 @@
+package source
+
+import (
+	"fmt"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"time"
+)
+
+type SyslogConfig struct {
+	Protocol       string `json:"protocol"`
+	Server         string `json:"server"`
+	Framing        string `json:"framing"`
+	MaxMessageSize int    `json:"maxMessageSize"`
+}
+
+// SyslogSource receives the RFC 5424 or RFC 3164 syslog messages from udp or tcp, and parses the syslog header into
+// the fields of the message.
+type SyslogSource struct {
+	lc *socketListenerConf
+
+	listener *socketListener
+}
+
+func (ss *SyslogSource) Configure(_ string, props map[string]interface{}) error {
+	cfg := &SyslogConfig{
+		Protocol:       "udp",
+		Server:         ":10514",
+		Framing:        FramingNewline,
+		MaxMessageSize: 65536,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	lc, err := newSocketListenerConf(cfg.Protocol, cfg.Server, cfg.Framing, cfg.MaxMessageSize, FramingNewline, FramingOctetCounting)
+	if err != nil {
+		return err
+	}
+	ss.lc = lc
+	conf.Log.Debugf("Initialized syslog source with %s server %s.", lc.protocol, lc.addr)
+	return nil
+}
+
+func (ss *SyslogSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	l, err := attachSocketListener(ss.lc, ss, func(frame []byte, remoteAddr string) {
+		ss.send(ctx, consumer, frame, remoteAddr)
+	})
+	if err != nil {
+		errCh <- err
+		return
+	}
+	ss.listener = l
+	logger.Infof("syslog source listens on %s://%s", ss.lc.protocol, ss.lc.addr)
+}
+
+func (ss *SyslogSource) send(ctx api.StreamContext, consumer chan<- api.SourceTuple, frame []byte, remoteAddr string) {
+	logger := ctx.GetLogger()
+	meta := map[string]interface{}{
+		"protocol":   ss.lc.protocol,
+		"remoteAddr": remoteAddr,
+	}
+	result, rfc, err := parseSyslog(frame, time.Now())
+	if err != nil {
+		// do not drop the message which is not in syslog format
+		logger.Warnf("Invalid syslog message %s: %v", string(frame), err)
+		result = map[string]interface{}{"message": string(frame)}
+	} else {
+		meta["rfc"] = rfc
+	}
+	select {
+	case consumer <- api.NewDefaultSourceTuple(result, meta):
+		logger.Debugf("send syslog message to source node")
+	case <-ctx.Done():
+	}
+}
+
+func (ss *SyslogSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing syslog source")
+	if ss.listener != nil {
+		ss.listener.detach(ss)
+		ss.listener = nil
+	}
+	return nil
+}
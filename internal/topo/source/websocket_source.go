@@ -0,0 +1,190 @@
+package source
+
+import (
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"github.com/lf-edge/ekuiper/pkg/cast"
+	"github.com/lf-edge/ekuiper/pkg/message"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type WebsocketConfig struct {
+	Mode                 string            `json:"mode"`
+	Url                  string            `json:"url"`
+	Server               string            `json:"server"`
+	Headers              map[string]string `json:"headers"`
+	InsecureSkipVerify   bool              `json:"insecureSkipVerify"`
+	CertificationPath    string            `json:"certificationPath"`
+	PrivateKeyPath       string            `json:"privateKeyPath"`
+	ReconnectInterval    int               `json:"reconnectInterval"`
+	MaxReconnectInterval int               `json:"maxReconnectInterval"`
+	Format               string            `json:"format"`
+	AllowedOrigins       []string          `json:"allowedOrigins"`
+}
+
+// WebsocketSource receives the messages from websocket. In client mode, it connects to the websocket server of the url
+// and reconnects with backoff when disconnected. In server mode, it receives the messages from all the clients
+// connected to the path of the embedded http server.
+type WebsocketSource struct {
+	cfg      *WebsocketConfig
+	url      string
+	path     string
+	certPath string
+	keyPath  string
+
+	decoder *payloadDecoder
+
+	conn  *websocket.Conn
+	ep    *httpx.WebsocketEndpoint
+	mutex sync.Mutex
+}
+
+func (ws *WebsocketSource) Configure(datasource string, props map[string]interface{}) error {
+	cfg := &WebsocketConfig{
+		Mode:                 "client",
+		Server:               ":10081",
+		ReconnectInterval:    1000,
+		MaxReconnectInterval: 30000,
+		Format:               message.FormatJson,
+	}
+	err := cast.MapToStruct(props, cfg)
+	if err != nil {
+		return fmt.Errorf("read properties %v fail with error: %v", props, err)
+	}
+	if ws.decoder, err = newPayloadDecoder(cfg.Format, props); err != nil {
+		return err
+	}
+	if cfg.ReconnectInterval <= 0 || cfg.MaxReconnectInterval < cfg.ReconnectInterval {
+		return fmt.Errorf("invalid reconnectInterval %d or maxReconnectInterval %d", cfg.ReconnectInterval, cfg.MaxReconnectInterval)
+	}
+	switch strings.ToLower(cfg.Mode) {
+	case "client":
+		if cfg.Url == "" {
+			return fmt.Errorf("missing property url for websocket client mode")
+		}
+		ws.url = cfg.Url + datasource
+		u, err := url.Parse(ws.url)
+		if err != nil {
+			return fmt.Errorf("invalid websocket url %s: %v", ws.url, err)
+		}
+		if u.Scheme != "ws" && u.Scheme != "wss" {
+			return fmt.Errorf("invalid websocket url %s, the scheme must be ws or wss", ws.url)
+		}
+	case "server":
+		if cfg.Server == "" {
+			return fmt.Errorf("missing property server for websocket server mode")
+		}
+		if !strings.HasPrefix(datasource, "/") {
+			datasource = "/" + datasource
+		}
+		ws.path = datasource
+		if cfg.CertificationPath != "" || cfg.PrivateKeyPath != "" {
+			if ws.certPath, err = conf.ProcessPath(cfg.CertificationPath); err != nil {
+				return fmt.Errorf("invalid certificationPath %s: %v", cfg.CertificationPath, err)
+			}
+			if ws.keyPath, err = conf.ProcessPath(cfg.PrivateKeyPath); err != nil {
+				return fmt.Errorf("invalid privateKeyPath %s: %v", cfg.PrivateKeyPath, err)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid mode %s, must be client or server", cfg.Mode)
+	}
+	cfg.Mode = strings.ToLower(cfg.Mode)
+	ws.cfg = cfg
+	return nil
+}
+
+func (ws *WebsocketSource) Open(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	if ws.cfg.Mode == "server" {
+		ws.openServer(ctx, consumer, errCh)
+	} else {
+		ws.runClient(ctx, consumer)
+	}
+}
+
+func (ws *WebsocketSource) openServer(ctx api.StreamContext, consumer chan<- api.SourceTuple, errCh chan<- error) {
+	logger := ctx.GetLogger()
+	ep, err := httpx.AttachWebsocketEndpoint(ws.cfg.Server, ws.certPath, ws.keyPath, ws.path, ws.cfg.AllowedOrigins)
+	if err != nil {
+		errCh <- err
+		return
+	}
+	meta := map[string]interface{}{"path": ws.path}
+	ep.AddReceiver(ws, func(data []byte) {
+		ws.send(ctx, consumer, data, meta)
+	})
+	ws.mutex.Lock()
+	ws.ep = ep
+	ws.mutex.Unlock()
+	logger.Infof("websocket source listens on path %s of server %s", ws.path, ws.cfg.Server)
+}
+
+func (ws *WebsocketSource) runClient(ctx api.StreamContext, consumer chan<- api.SourceTuple) {
+	logger := ctx.GetLogger()
+	meta := map[string]interface{}{"url": ws.url}
+	for {
+		conn, err := httpx.DialWebsocket(ctx, ws.url, ws.cfg.Headers, ws.cfg.InsecureSkipVerify, ws.cfg.ReconnectInterval, ws.cfg.MaxReconnectInterval)
+		if err != nil {
+			logger.Infof("websocket source stops connecting: %v", err)
+			return
+		}
+		ws.mutex.Lock()
+		ws.conn = conn
+		ws.mutex.Unlock()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				logger.Warnf("websocket source disconnected from %s: %v", ws.url, err)
+				break
+			}
+			ws.send(ctx, consumer, data, meta)
+		}
+		ws.mutex.Lock()
+		ws.conn = nil
+		ws.mutex.Unlock()
+		_ = conn.Close()
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+func (ws *WebsocketSource) send(ctx api.StreamContext, consumer chan<- api.SourceTuple, data []byte, meta map[string]interface{}) {
+	logger := ctx.GetLogger()
+	results, err := ws.decoder.decode(data)
+	if err != nil {
+		logger.Errorf("Invalid data format, cannot decode %s to %s format with error %s", string(data), ws.cfg.Format, err)
+		return
+	}
+	for _, result := range results {
+		select {
+		case consumer <- api.NewDefaultSourceTuple(result, meta):
+			logger.Debugf("send data to source node")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (ws *WebsocketSource) Close(ctx api.StreamContext) error {
+	ctx.GetLogger().Infof("Closing websocket source")
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+	if ws.conn != nil {
+		_ = ws.conn.Close()
+		ws.conn = nil
+	}
+	if ws.ep != nil {
+		ws.ep.RemoveReceiver(ws)
+		httpx.DetachEndpoint(ws.cfg.Server, ws.path)
+		ws.ep = nil
+	}
+	return nil
+}
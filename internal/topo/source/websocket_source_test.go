@@ -0,0 +1,124 @@
+package source
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/lf-edge/ekuiper/internal/conf"
+	"github.com/lf-edge/ekuiper/internal/pkg/httpx"
+	"github.com/lf-edge/ekuiper/internal/topo/context"
+	"github.com/lf-edge/ekuiper/pkg/api"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebsocketSource_Client(t *testing.T) {
+	contextLogger := conf.Log.WithField("rule", "TestWebsocketSource_Client")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	upgrader := websocket.Upgrader{}
+	var connected int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		n := atomic.AddInt32(&connected, 1)
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"temperature":20}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`[{"temperature":21},{"temperature":22}]`))
+		// disconnect the first connection to test the reconnection
+		if n == 1 {
+			_ = conn.Close()
+		}
+	}))
+	defer ts.Close()
+
+	s := &WebsocketSource{}
+	err := s.Configure("/ws", map[string]interface{}{
+		"url":               "ws" + strings.TrimPrefix(ts.URL, "http"),
+		"reconnectInterval": 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	go s.Open(ctx, consumer, make(chan error))
+	exp := []map[string]interface{}{
+		{"temperature": float64(20)}, {"temperature": float64(21)}, {"temperature": float64(22)},
+		{"temperature": float64(20)}, {"temperature": float64(21)}, {"temperature": float64(22)},
+	}
+	var results []map[string]interface{}
+	for range exp {
+		select {
+		case tuple := <-consumer:
+			results = append(results, tuple.Message())
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout to receive data, got %v", results)
+		}
+	}
+	if !reflect.DeepEqual(exp, results) {
+		t.Errorf("result mismatch:\n\nexp=%v\n\ngot=%v\n\n", exp, results)
+	}
+	cancel()
+	s.Close(ctx)
+}
+
+func TestWebsocketSource_Server(t *testing.T) {
+	const addr = "127.0.0.1:0"
+	contextLogger := conf.Log.WithField("rule", "TestWebsocketSource_Server")
+	ctx, cancel := context.WithValue(context.Background(), context.LoggerKey, contextLogger).WithCancel()
+	defer cancel()
+
+	s := &WebsocketSource{}
+	err := s.Configure("/ws", map[string]interface{}{
+		"mode":   "server",
+		"server": addr,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := make(chan api.SourceTuple, 10)
+	errCh := make(chan error, 1)
+	s.Open(ctx, consumer, errCh)
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	default:
+	}
+	a, _ := httpx.GetServerAddr(addr)
+	var conns []*websocket.Conn
+	for i := 0; i < 2; i++ {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+a.String()+"/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, conn)
+	}
+	_ = conns[0].WriteMessage(websocket.TextMessage, []byte(`{"humidity":50}`))
+	_ = conns[1].WriteMessage(websocket.TextMessage, []byte(`{"humidity":60}`))
+	results := make(map[float64]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case tuple := <-consumer:
+			results[tuple.Message()["humidity"].(float64)] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout to receive data, got %v", results)
+		}
+	}
+	if !results[50] || !results[60] {
+		t.Errorf("result mismatch, got %v", results)
+	}
+	s.Close(ctx)
+	if _, ok := httpx.GetServerAddr(addr); ok {
+		t.Errorf("server %s should stop after the source is closed", addr)
+	}
+	// the clients are disconnected
+	_ = conns[0].SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := conns[0].ReadMessage(); err == nil {
+		t.Errorf("client should be disconnected")
+	}
+}
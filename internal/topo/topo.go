@@ -207,7 +207,7 @@ func (s *Topo) GetMetrics() (keys []string, values []interface{}) {
 	for _, sn := range s.sinks {
 		for ins, metrics := range sn.GetMetrics() {
 			for i, v := range metrics {
-				keys = append(keys, "sink_"+sn.GetName()+"_"+strconv.Itoa(ins)+"_"+node.MetricNames[i])
+				keys = append(keys, "sink_"+sn.GetName()+"_"+strconv.Itoa(ins)+"_"+node.SinkMetricNames[i])
 				values = append(values, v)
 			}
 		}
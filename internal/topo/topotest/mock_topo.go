@@ -15,6 +15,7 @@ import (
 	"github.com/lf-edge/ekuiper/pkg/api"
 	"github.com/lf-edge/ekuiper/pkg/ast"
 	"github.com/lf-edge/ekuiper/pkg/cast"
+	"os"
 	"path"
 	"reflect"
 	"strings"
@@ -236,9 +237,11 @@ func createStream(t *testing.T, tt RuleTest, j int, opt *api.RuleOption, sinkPro
 			}
 		}
 	}
+	ruleId := fmt.Sprintf("%s_%d", tt.Name, j)
+	cleanRuleData(t, ruleId)
 	mockSink := mocknode.NewMockSink()
 	sink := node.NewSinkNodeWithSink("mockSink", mockSink, sinkProps)
-	tp, err := planner.PlanWithSourcesAndSinks(&api.Rule{Id: fmt.Sprintf("%s_%d", tt.Name, j), Sql: tt.Sql, Options: opt}, DbDir, sources, []*node.SinkNode{sink})
+	tp, err := planner.PlanWithSourcesAndSinks(&api.Rule{Id: ruleId, Sql: tt.Sql, Options: opt}, DbDir, sources, []*node.SinkNode{sink})
 	if err != nil {
 		t.Error(err)
 		return nil, 0, nil, nil, nil
@@ -247,6 +250,22 @@ func createStream(t *testing.T, tt RuleTest, j int, opt *api.RuleOption, sinkPro
 	return datas, dataLength, tp, mockSink, errCh
 }
 
+// Remove the checkpoint and sink cache left by the previous runs so that the rule starts from the clean state
+func cleanRuleData(t *testing.T, ruleId string) {
+	if ruleId == "" || strings.ContainsAny(ruleId, `/\`) || strings.Contains(ruleId, "..") {
+		t.Fatalf("invalid rule id %s to clean the rule data", ruleId)
+	}
+	dataDir, err := conf.GetDataLoc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []string{path.Join(dataDir, ruleId), path.Join(dataDir, "sink", ruleId)} {
+		if err := os.RemoveAll(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 // Create or drop streams
 func HandleStream(createOrDrop bool, names []string, t *testing.T) {
 	p := processor.NewStreamProcessor(path.Join(DbDir, "stream"))
@@ -120,6 +120,20 @@ func (a *Alias) AliasValue(key string) (interface{}, bool) {
 	return a.AliasMap.Value(key)
 }
 
+// ErrorSourceTuple is sent by a source for the data which cannot be decoded. It is counted as an exception of the
+// source node instead of being sent to the rule.
+type ErrorSourceTuple struct {
+	Error error
+}
+
+func (t *ErrorSourceTuple) Message() map[string]interface{} {
+	return nil
+}
+
+func (t *ErrorSourceTuple) Meta() map[string]interface{} {
+	return nil
+}
+
 type Tuple struct {
 	Emitter   string
 	Message   Message // immutable
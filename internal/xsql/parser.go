@@ -928,7 +928,10 @@ func validateStream(stmt *ast.StreamStmt) error {
 			return fmt.Errorf("'binary' format stream can have only one field")
 		}
 	default:
-		return fmt.Errorf("option 'format=%s' is invalid", f)
+		// the other formats are decoded by the registered converters, the encode only formats such as influx are invalid
+		if !message.IsDecodeSupported(f) {
+			return fmt.Errorf("option 'format=%s' is invalid", f)
+		}
 	}
 	return nil
 }
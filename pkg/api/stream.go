@@ -81,6 +81,59 @@ type Sink interface {
 	Closable
 }
 
+// Flushable is an optional interface of the sink which buffers the results. For the rules with qos >= 1, Flush is called
+// when the sink receives a checkpoint barrier so that the results before the checkpoint are durable. If it fails, the
+// checkpoint is not acknowledged.
+type Flushable interface {
+	Flush(ctx StreamContext) error
+}
+
+// BatchSink is an optional interface of the sink to send the batched results natively when the batchSize or lingerMs
+// property is set. Each item of the data is the same as the data of Collect. If the sink does not implement it, the
+// batch is merged and sent by Collect.
+type BatchSink interface {
+	CollectBatch(ctx StreamContext, data []interface{}) error
+}
+
+// FormatSink is an optional interface of the sink which handles the format property by itself, such as the file sink
+// writing csv files. The sink node does not encode the data for the formats supported by the sink.
+type FormatSink interface {
+	SupportFormat(format string) bool
+}
+
+// DynamicPropsSink is an optional interface of the sink which supports dynamic properties. A string property of the
+// action can be a go template such as "alerts/{{.deviceId}}" which is evaluated by each data to send. The evaluated
+// properties are passed to CollectWithProps instead of Collect. Only the dynamic properties are in the props.
+type DynamicPropsSink interface {
+	CollectWithProps(ctx StreamContext, data interface{}, props map[string]string) error
+}
+
+// RawSink is an optional interface of the sink which receives the results without encoding, such as the memory sink
+// passing the results to other rules. If the result is not customized by the dataTemplate or the format, CollectRaw is
+// called instead of Collect with a row as map[string]interface{} if sendSingle is true, or the rows as
+// []map[string]interface{}. Otherwise, the encoded []byte is sent by Collect.
+type RawSink interface {
+	CollectRaw(ctx StreamContext, data interface{}) error
+}
+
+// TwoPhaseCommitSink is an optional interface of the sink to write the results exactly once for the rules with qos 2.
+// The results between two checkpoints are written in a transaction. When the sink receives the barrier of a
+// checkpoint, PreCommit is called to make the data of the current transaction durable but not visible, then
+// BeginTransaction is called to start the next transaction. When the checkpoint is completed, Commit is called to make
+// the pre-committed transactions up to the checkpoint visible. When the rule is restarted, the pre-committed
+// transactions of the restored checkpoint are committed and the others are discarded by Abort. The checkpoint id of a
+// rule which starts without checkpoint is 0.
+type TwoPhaseCommitSink interface {
+	BeginTransaction(ctx StreamContext, checkpointId int64) error
+	PreCommit(ctx StreamContext, checkpointId int64) error
+	// Commit commits the pre-committed transactions whose checkpoint id is not greater than the checkpointId. It may
+	// be called again for the committed transactions after restart, so it must be idempotent.
+	Commit(ctx StreamContext, checkpointId int64) error
+	// Abort discards the current transaction and the pre-committed transactions whose checkpoint id is greater than
+	// the checkpointId
+	Abort(ctx StreamContext, checkpointId int64) error
+}
+
 type Emitter interface {
 	AddOutput(chan<- interface{}, string) error
 }
@@ -0,0 +1,104 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Converter encodes the results to the payload of a format for sinks and decodes the payload of the format for sources
+type Converter interface {
+	// Encode encodes the result which is a map or a slice of maps
+	Encode(d interface{}) ([]byte, error)
+	Decode(b []byte) (map[string]interface{}, error)
+}
+
+// ConverterFactory creates the converter by the options of the format such as the protobuf schema and message name
+type ConverterFactory func(props map[string]interface{}) (Converter, error)
+
+var (
+	converters = map[string]ConverterFactory{
+		FormatJson: func(map[string]interface{}) (Converter, error) {
+			return jsonConverter{}, nil
+		},
+		FormatBinary: func(map[string]interface{}) (Converter, error) {
+			return binaryConverter{}, nil
+		},
+	}
+	// the formats which can only encode the results of the sinks
+	encodeOnly = map[string]bool{}
+	convMutex  sync.RWMutex
+)
+
+// RegisterConverter registers the converter factory of a format. The format name is case insensitive
+func RegisterConverter(format string, f ConverterFactory) {
+	convMutex.Lock()
+	defer convMutex.Unlock()
+	converters[strings.ToLower(format)] = f
+}
+
+// RegisterEncoder registers the converter factory of a format which can only be used to encode the results of the
+// sinks, so it is not allowed as the format of streams
+func RegisterEncoder(format string, f ConverterFactory) {
+	convMutex.Lock()
+	defer convMutex.Unlock()
+	converters[strings.ToLower(format)] = f
+	encodeOnly[strings.ToLower(format)] = true
+}
+
+func IsFormatSupported(format string) bool {
+	convMutex.RLock()
+	defer convMutex.RUnlock()
+	_, ok := converters[strings.ToLower(format)]
+	return ok
+}
+
+// IsDecodeSupported returns whether the format can decode the payload of the sources
+func IsDecodeSupported(format string) bool {
+	convMutex.RLock()
+	defer convMutex.RUnlock()
+	_, ok := converters[strings.ToLower(format)]
+	return ok && !encodeOnly[strings.ToLower(format)]
+}
+
+func GetConverter(format string, props map[string]interface{}) (Converter, error) {
+	convMutex.RLock()
+	f, ok := converters[strings.ToLower(format)]
+	convMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("invalid format %s", format)
+	}
+	return f(props)
+}
+
+type jsonConverter struct{}
+
+func (c jsonConverter) Encode(d interface{}) ([]byte, error) {
+	return json.Marshal(d)
+}
+
+func (c jsonConverter) Decode(b []byte) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	e := json.Unmarshal(b, &result)
+	return result, e
+}
+
+type binaryConverter struct{}
+
+// Encode returns the bytes of the default field
+func (c binaryConverter) Encode(d interface{}) ([]byte, error) {
+	switch t := d.(type) {
+	case []byte:
+		return t, nil
+	case map[string]interface{}:
+		if b, ok := t[DefaultField].([]byte); ok {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("binary format requires the result to have a bytea field %s but found %v", DefaultField, d)
+}
+
+func (c binaryConverter) Decode(b []byte) (map[string]interface{}, error) {
+	return map[string]interface{}{DefaultField: b}, nil
+}
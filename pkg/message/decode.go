@@ -1,11 +1,5 @@
 package message
 
-import (
-	"encoding/json"
-	"fmt"
-	"strings"
-)
-
 const (
 	FormatBinary = "binary"
 	FormatJson   = "json"
@@ -14,15 +8,12 @@ const (
 	MetaKey      = "__meta"
 )
 
+// Decode decodes the payload by the converter of the format without options. To decode the payloads of a source,
+// create the converter once by GetConverter with the options of the format instead.
 func Decode(payload []byte, format string) (map[string]interface{}, error) {
-	result := make(map[string]interface{})
-	switch strings.ToLower(format) {
-	case FormatJson:
-		e := json.Unmarshal(payload, &result)
-		return result, e
-	case FormatBinary:
-		result[DefaultField] = payload
-		return result, nil
+	c, err := GetConverter(format, nil)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("invalid format %s", format)
+	return c.Decode(payload)
 }